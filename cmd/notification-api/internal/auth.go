@@ -0,0 +1,26 @@
+package notification
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// AdminAuth only lets requests through which carry the admin api key as bearer token,
+// without an api key all requests are rejected
+func AdminAuth(apiKey string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if apiKey == "" {
+				return echo.NewHTTPError(http.StatusUnauthorized, "ADMIN_API_KEY is not set")
+			}
+			token, ok := strings.CutPrefix(c.Request().Header.Get(echo.HeaderAuthorization), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(apiKey)) != 1 {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Invalid admin api key")
+			}
+			return next(c)
+		}
+	}
+}
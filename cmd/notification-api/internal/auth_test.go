@@ -0,0 +1,48 @@
+package notification_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("AdminAuth", func() {
+	var e *echo.Echo
+
+	BeforeEach(func() {
+		e = echo.New()
+	})
+
+	request := func(apiKey, authorization string) int {
+		e.GET("/notifications", func(c echo.Context) error {
+			return c.NoContent(http.StatusOK)
+		}, notification.AdminAuth(apiKey))
+
+		req := httptest.NewRequest(http.MethodGet, "/notifications", nil)
+		if authorization != "" {
+			req.Header.Set(echo.HeaderAuthorization, authorization)
+		}
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	It("should let requests with the api key through", func() {
+		Expect(request("secret", "Bearer secret")).To(Equal(http.StatusOK))
+	})
+
+	It("should reject requests without the api key", func() {
+		Expect(request("secret", "")).To(Equal(http.StatusUnauthorized))
+		Expect(request("secret", "Bearer wrong")).To(Equal(http.StatusUnauthorized))
+		Expect(request("secret", "secret")).To(Equal(http.StatusUnauthorized))
+	})
+
+	It("should reject all requests without an api key", func() {
+		Expect(request("", "Bearer ")).To(Equal(http.StatusUnauthorized))
+		Expect(request("", "")).To(Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,219 @@
+package notification
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=batch_presenter.go --destination mocks/batch_presenter.go --package mocks
+
+const (
+	// batchChunkSize is the number of notifications of a batch published at once, publishing
+	// starts while the rest of a large batch is still read
+	batchChunkSize = 500
+	// maxBatchLineSize is the longest NDJSON line of a batch
+	maxBatchLineSize = 1 << 20
+)
+
+type BatchController interface {
+	SendNotifications(ctx context.Context, batchID string, notifications []NotificationRequest) []SendResult
+}
+
+type BatchPresenter struct {
+	controller BatchController
+	validator  Validator
+	// maxSize is the number of notifications a batch has at most
+	maxSize int
+}
+
+func NewBatchPresenter(controller BatchController, validator Validator, maxSize int) *BatchPresenter {
+	return &BatchPresenter{
+		controller: controller,
+		validator:  validator,
+		maxSize:    maxSize,
+	}
+}
+
+// HandleSendBatch sends the notifications of a JSON array, or of NDJSON with the application/x-ndjson
+// content type. Every notification is validated and published on its own, the response has the id or
+// the error of each of them in the order of the batch.
+func (p *BatchPresenter) HandleSendBatch(c echo.Context) error {
+	reader, err := newBatchReader(c.Request())
+	if err != nil {
+		logrus.Errorf("failed to read batch: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+
+	ctx := c.Request().Context()
+	response := BatchResponse{BatchID: types.NewMessageID(), Items: []BatchItemResult{}}
+	var (
+		chunk   []NotificationRequest
+		indexes []int
+	)
+	publish := func() {
+		for j, result := range p.controller.SendNotifications(ctx, response.BatchID, chunk) {
+			item := &response.Items[indexes[j]]
+			item.ID = result.ID
+			if result.Err != nil {
+				item.Error = result.Err.Error()
+			}
+		}
+		chunk, indexes = chunk[:0], indexes[:0]
+	}
+
+	for {
+		request, invalid, err := reader.next()
+		if err == io.EOF {
+			break
+		}
+		index := len(response.Items)
+		if err == nil && index == p.maxSize {
+			err = fmt.Errorf("batch exceeds %d notifications", p.maxSize)
+		}
+		if err != nil {
+			if index == 0 {
+				logrus.Errorf("failed to read batch: %v", err)
+				return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+			}
+			// the rest of the batch cannot be read, the notifications before are sent
+			response.Items = append(response.Items, BatchItemResult{Index: index, Error: err.Error()})
+			break
+		}
+
+		response.Items = append(response.Items, BatchItemResult{Index: index})
+		if invalid == nil {
+			invalid = validateNotification(p.validator, request)
+		}
+		if invalid != nil {
+			response.Items[index].Error = invalid.Error()
+			continue
+		}
+
+		chunk = append(chunk, request)
+		indexes = append(indexes, index)
+		if len(chunk) == batchChunkSize {
+			publish()
+		}
+	}
+	if len(chunk) > 0 {
+		publish()
+	}
+
+	if len(response.Items) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Empty batch")
+	}
+	for _, item := range response.Items {
+		if item.Error == "" {
+			response.Accepted++
+		} else {
+			response.Rejected++
+		}
+	}
+	logrus.Infof("batch %s: %d notifications accepted, %d rejected", response.BatchID, response.Accepted, response.Rejected)
+
+	if response.Accepted == 0 {
+		return c.JSON(http.StatusUnprocessableEntity, response)
+	}
+	return c.JSON(http.StatusAccepted, response)
+}
+
+// validateNotification returns the failed validations of the notification with the JSON names of the fields
+func validateNotification(v Validator, request NotificationRequest) error {
+	err := v.Struct(request)
+	var validationErrors validator.ValidationErrors
+	if !errors.As(err, &validationErrors) {
+		return err
+	}
+
+	messages := make([]string, len(validationErrors))
+	for i, fieldError := range validationErrors {
+		messages[i] = fmt.Sprintf("invalid %s: %s", fieldError.Field(), fieldError.Tag())
+	}
+	return errors.New(strings.Join(messages, ", "))
+}
+
+// JSONFieldName returns the JSON name of a struct field, it names the fields in the validation errors
+func JSONFieldName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" || name == "-" {
+		return field.Name
+	}
+	return name
+}
+
+// batchReader reads the notifications of a batch one at a time, from a JSON array or NDJSON
+type batchReader struct {
+	array *json.Decoder
+	lines *bufio.Scanner
+}
+
+func newBatchReader(r *http.Request) (*batchReader, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get(echo.HeaderContentType))
+	if mediaType == "application/x-ndjson" || mediaType == "application/ndjson" {
+		lines := bufio.NewScanner(r.Body)
+		lines.Buffer(make([]byte, 64*1024), maxBatchLineSize)
+		return &batchReader{lines: lines}, nil
+	}
+
+	array := json.NewDecoder(r.Body)
+	token, err := array.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('[') {
+		return nil, fmt.Errorf("expected a JSON array")
+	}
+	return &batchReader{array: array}, nil
+}
+
+// next returns the next notification of the batch or io.EOF after the last one. A notification which
+// cannot be decoded is returned as invalid, reading continues after it. The batch cannot be read
+// any further after an error.
+func (r *batchReader) next() (request NotificationRequest, invalid error, err error) {
+	if r.lines != nil {
+		for r.lines.Scan() {
+			line := r.lines.Bytes()
+			if len(strings.TrimSpace(string(line))) == 0 {
+				continue
+			}
+			if err := json.Unmarshal(line, &request); err != nil {
+				return NotificationRequest{}, fmt.Errorf("invalid notification: %v", err), nil
+			}
+			return request, nil, nil
+		}
+		if err := r.lines.Err(); err != nil {
+			return NotificationRequest{}, nil, fmt.Errorf("invalid batch: %v", err)
+		}
+		return NotificationRequest{}, nil, io.EOF
+	}
+
+	if !r.array.More() {
+		if _, err := r.array.Token(); err != nil {
+			return NotificationRequest{}, nil, fmt.Errorf("invalid batch: %v", err)
+		}
+		return NotificationRequest{}, nil, io.EOF
+	}
+	err = r.array.Decode(&request)
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		// the decoder skipped the whole notification
+		return NotificationRequest{}, fmt.Errorf("invalid notification: %v", err), nil
+	}
+	if err != nil {
+		return NotificationRequest{}, nil, fmt.Errorf("invalid batch: %v", err)
+	}
+	return request, nil, nil
+}
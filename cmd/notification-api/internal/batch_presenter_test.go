@@ -0,0 +1,155 @@
+package notification_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BatchPresenter", func() {
+	var (
+		mockCtrl       *gomock.Controller
+		mockController *mocks.MockBatchController
+		presenter      *notification.BatchPresenter
+		recorder       *httptest.ResponseRecorder
+	)
+
+	const valid = `{"channel":"email","content":"hi","receiver":"a@example.com"}`
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockController = mocks.NewMockBatchController(mockCtrl)
+		structValidator := validator.New()
+		structValidator.RegisterTagNameFunc(notification.JSONFieldName)
+		presenter = notification.NewBatchPresenter(mockController, structValidator, 10000)
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	send := func(contentType, body string) error {
+		req := httptest.NewRequest(http.MethodPost, "/send/batch", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		recorder = httptest.NewRecorder()
+		return presenter.HandleSendBatch(echo.New().NewContext(req, recorder))
+	}
+
+	// publishes returns results with generated ids for the notifications of a chunk
+	publishes := func(ctx context.Context, batchID string, notifications []notification.NotificationRequest) []notification.SendResult {
+		Expect(batchID).To(HaveLen(36))
+		results := make([]notification.SendResult, len(notifications))
+		for i, n := range notifications {
+			results[i].ID = "id-" + n.Receiver
+		}
+		return results
+	}
+
+	expectBadRequest := func(err error) {
+		Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusBadRequest))
+	}
+
+	It("should validate and send every notification of a JSON array on its own", func() {
+		mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), []notification.NotificationRequest{
+			{Channel: "email", Content: "hi", Receiver: "a@example.com"},
+			{Channel: "sms", Content: "hi", Receiver: "+359"},
+		}).Return([]notification.SendResult{{ID: "n1"}, {Err: errors.New("error sending notification: broker down")}})
+
+		Expect(send(echo.MIMEApplicationJSON, `[`+valid+`, {"channel":"email","receiver":"b@example.com"}, {"channel":5}, {"channel":"sms","content":"hi","receiver":"+359"}]`)).To(Succeed())
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+
+		var response notification.BatchResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.BatchID).To(HaveLen(36))
+		Expect(response.Accepted).To(Equal(1))
+		Expect(response.Rejected).To(Equal(3))
+		Expect(response.Items).To(HaveLen(4))
+		Expect(response.Items[0]).To(Equal(notification.BatchItemResult{Index: 0, ID: "n1"}))
+		Expect(response.Items[1]).To(Equal(notification.BatchItemResult{Index: 1, Error: "invalid content: required"}))
+		Expect(response.Items[2].Error).To(ContainSubstring("invalid notification"))
+		Expect(response.Items[3]).To(Equal(notification.BatchItemResult{Index: 3, Error: "error sending notification: broker down"}))
+	})
+
+	It("should read NDJSON line by line", func() {
+		mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(2)).DoAndReturn(publishes)
+
+		Expect(send("application/x-ndjson", valid+"\n\n{not json}\n"+valid+"\n")).To(Succeed())
+		Expect(recorder.Code).To(Equal(http.StatusAccepted))
+
+		var response notification.BatchResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Accepted).To(Equal(2))
+		Expect(response.Items[1].Index).To(Equal(1))
+		Expect(response.Items[1].Error).To(ContainSubstring("invalid notification"))
+		Expect(response.Items[2].ID).To(Equal("id-a@example.com"))
+	})
+
+	It("should publish large batches in chunks", func() {
+		gomock.InOrder(
+			mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(500)).DoAndReturn(publishes),
+			mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(1)).DoAndReturn(publishes),
+		)
+
+		var body strings.Builder
+		for i := 0; i < 501; i++ {
+			fmt.Fprintf(&body, `{"channel":"email","content":"hi","receiver":"%d@example.com"}`+"\n", i)
+		}
+		Expect(send("application/x-ndjson", body.String())).To(Succeed())
+
+		var response notification.BatchResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Accepted).To(Equal(501))
+		Expect(response.Items[500]).To(Equal(notification.BatchItemResult{Index: 500, ID: "id-500@example.com"}))
+	})
+
+	It("should reject the notifications beyond the maximum batch size", func() {
+		presenter = notification.NewBatchPresenter(mockController, validator.New(), 1)
+		mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(1)).DoAndReturn(publishes)
+
+		Expect(send(echo.MIMEApplicationJSON, `[`+valid+`,`+valid+`,`+valid+`]`)).To(Succeed())
+
+		var response notification.BatchResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Items).To(Equal([]notification.BatchItemResult{
+			{Index: 0, ID: "id-a@example.com"},
+			{Index: 1, Error: "batch exceeds 1 notifications"},
+		}))
+	})
+
+	It("should send the notifications before a malformed array", func() {
+		mockController.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(1)).DoAndReturn(publishes)
+
+		Expect(send(echo.MIMEApplicationJSON, `[`+valid+`, {"channel": `)).To(Succeed())
+
+		var response notification.BatchResponse
+		Expect(json.Unmarshal(recorder.Body.Bytes(), &response)).To(Succeed())
+		Expect(response.Items).To(HaveLen(2))
+		Expect(response.Items[1].Error).To(ContainSubstring("invalid batch"))
+	})
+
+	It("should return unprocessable entity when no notification is valid", func() {
+		Expect(send(echo.MIMEApplicationJSON, `[{"channel":"email"}]`)).To(Succeed())
+		Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+		Expect(recorder.Body.String()).To(ContainSubstring(`"rejected":1`))
+	})
+
+	It("should reject bodies which are not a batch", func() {
+		expectBadRequest(send(echo.MIMEApplicationJSON, valid))
+		expectBadRequest(send(echo.MIMEApplicationJSON, `[]`))
+		expectBadRequest(send("application/x-ndjson", ""))
+		expectBadRequest(send(echo.MIMEApplicationJSON, `[{"channel": `))
+	})
+})
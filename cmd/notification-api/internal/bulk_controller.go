@@ -0,0 +1,365 @@
+package notification
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=bulk_controller.go --destination mocks/bulk_controller.go --package mocks
+
+const (
+	// bulkChunkSize is the number of rows of a bulk job published at once, pausing and
+	// canceling a job takes effect after the chunk which is published
+	bulkChunkSize = 500
+	// maxBulkRowErrors is the number of row errors kept per job, the rest are only counted
+	maxBulkRowErrors = 1000
+)
+
+var (
+	ErrInvalidBulkUpload = errors.New("invalid bulk upload")
+	ErrBulkJobNotFound   = errors.New("bulk job not found")
+	// ErrBulkJobState is returned for a state change the job does not allow, e.g. resuming a running job
+	ErrBulkJobState = errors.New("invalid bulk job state")
+)
+
+type TemplateRenderer interface {
+	Has(name string) bool
+	Render(name string, vars map[string]string) (string, error)
+}
+
+// BulkController sends CSV uploads as bulk jobs, the jobs are kept in the memory of the api instance
+type BulkController struct {
+	sender    BatchController
+	templates TemplateRenderer
+	validator Validator
+	// maxRows is the number of rows an upload has at most
+	maxRows int
+	// retention is how long completed and canceled jobs are kept
+	retention time.Duration
+
+	// ctx stops the running jobs on Close
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards the jobs and their state
+	mu   sync.Mutex
+	jobs map[string]*bulkJob
+}
+
+type bulkJob struct {
+	BulkJob
+	requests []NotificationRequest
+	// rows are the CSV lines of the requests
+	rows []int
+	// next is the index of the first request which is not published yet
+	next int
+	rate int
+	// resumed is closed when a paused job resumes or is canceled
+	resumed chan struct{}
+}
+
+func NewBulkController(sender BatchController, templates TemplateRenderer, validator Validator, maxRows int, retention time.Duration) *BulkController {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &BulkController{
+		sender:    sender,
+		templates: templates,
+		validator: validator,
+		maxRows:   maxRows,
+		retention: retention,
+		ctx:       ctx,
+		cancel:    cancel,
+		jobs:      make(map[string]*bulkJob),
+	}
+}
+
+// CreateBulkJob validates the rows of the CSV and starts sending the valid ones in the background.
+// The upload fails as a whole when its header, template or mapping is invalid, invalid rows are
+// reported as row errors of the job.
+func (c *BulkController) CreateBulkJob(upload BulkUpload, file io.Reader) (BulkJob, error) {
+	job, err := c.parse(upload, file)
+	if err != nil {
+		return BulkJob{}, err
+	}
+
+	now := time.Now()
+	job.ID = types.NewMessageID()
+	job.State = BulkRunning
+	job.CreatedAt = now
+	job.UpdatedAt = now
+	if len(job.requests) == 0 {
+		job.State = BulkCompleted
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prune(now)
+	c.jobs[job.ID] = job
+	logrus.Infof("bulk job %s: %d rows of template %s, %d invalid", job.ID, job.Rows, job.Template, job.Invalid)
+	if job.State == BulkRunning {
+		go c.run(job)
+	}
+	return job.snapshot(), nil
+}
+
+func (c *BulkController) GetBulkJob(id string) (BulkJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.jobs[id]
+	if !ok {
+		return BulkJob{}, ErrBulkJobNotFound
+	}
+	return job.snapshot(), nil
+}
+
+// PauseBulkJob stops sending the rows of a running job until it is resumed
+func (c *BulkController) PauseBulkJob(id string) (BulkJob, error) {
+	return c.transition(id, BulkPaused, func(job *bulkJob) {
+		job.resumed = make(chan struct{})
+	}, BulkRunning)
+}
+
+func (c *BulkController) ResumeBulkJob(id string) (BulkJob, error) {
+	return c.transition(id, BulkRunning, func(job *bulkJob) {
+		close(job.resumed)
+	}, BulkPaused)
+}
+
+// CancelBulkJob stops a running or paused job for good, its pending rows are never sent
+func (c *BulkController) CancelBulkJob(id string) (BulkJob, error) {
+	return c.transition(id, BulkCanceled, func(job *bulkJob) {
+		if job.State == BulkPaused {
+			close(job.resumed)
+		}
+	}, BulkRunning, BulkPaused)
+}
+
+// Close stops the running jobs, the rows they did not send yet are lost
+func (c *BulkController) Close() {
+	c.cancel()
+}
+
+func (c *BulkController) transition(id string, state BulkState, apply func(job *bulkJob), from ...BulkState) (BulkJob, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	job, ok := c.jobs[id]
+	if !ok {
+		return BulkJob{}, ErrBulkJobNotFound
+	}
+	for _, allowed := range from {
+		if job.State == allowed {
+			apply(job)
+			job.State = state
+			job.UpdatedAt = time.Now()
+			logrus.Infof("bulk job %s: %s", job.ID, state)
+			return job.snapshot(), nil
+		}
+	}
+	return BulkJob{}, fmt.Errorf("%w: a %s job cannot be %s", ErrBulkJobState, job.State, state)
+}
+
+// prune forgets the finished jobs after the retention
+func (c *BulkController) prune(now time.Time) {
+	for id, job := range c.jobs {
+		if (job.State == BulkCompleted || job.State == BulkCanceled) && now.Sub(job.UpdatedAt) > c.retention {
+			delete(c.jobs, id)
+		}
+	}
+}
+
+// run publishes the valid rows of the job in chunks until all of them are sent or the job is canceled
+func (c *BulkController) run(job *bulkJob) {
+	chunkSize := bulkChunkSize
+	if job.rate > 0 && job.rate < chunkSize {
+		chunkSize = job.rate
+	}
+
+	for {
+		c.mu.Lock()
+		for job.State == BulkPaused {
+			resumed := job.resumed
+			c.mu.Unlock()
+			select {
+			case <-resumed:
+			case <-c.ctx.Done():
+				return
+			}
+			c.mu.Lock()
+		}
+		if job.State == BulkRunning && job.next == len(job.requests) {
+			job.State = BulkCompleted
+			job.UpdatedAt = time.Now()
+			logrus.Infof("bulk job %s: completed, %d sent, %d failed", job.ID, job.Sent, job.Failed)
+		}
+		if job.State != BulkRunning || c.ctx.Err() != nil {
+			// the rows are not needed anymore
+			job.requests, job.rows = nil, nil
+			c.mu.Unlock()
+			return
+		}
+		start, end := job.next, min(job.next+chunkSize, len(job.requests))
+		job.next = end
+		requests, rows := job.requests[start:end], job.rows[start:end]
+		c.mu.Unlock()
+
+		started := time.Now()
+		results := c.sender.SendNotifications(c.ctx, job.ID, requests)
+
+		c.mu.Lock()
+		for i, result := range results {
+			if result.Err != nil {
+				job.Failed++
+				job.addError(rows[i], result.Err)
+			} else {
+				job.Sent++
+			}
+		}
+		job.UpdatedAt = time.Now()
+		c.mu.Unlock()
+
+		if job.rate > 0 {
+			wait := time.Duration(len(requests))*time.Second/time.Duration(job.rate) - time.Since(started)
+			select {
+			case <-time.After(wait):
+			case <-c.ctx.Done():
+			}
+		}
+	}
+}
+
+// parse reads the CSV and renders a notification for every valid row
+func (c *BulkController) parse(upload BulkUpload, file io.Reader) (*bulkJob, error) {
+	if !c.templates.Has(upload.Template) {
+		return nil, fmt.Errorf("%w: unknown template %s", ErrInvalidBulkUpload, upload.Template)
+	}
+
+	reader := csv.NewReader(file)
+	// rows with a different number of columns are reported as row errors
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: the CSV has no header", ErrInvalidBulkUpload)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read the header: %v", ErrInvalidBulkUpload, err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		if i == 0 {
+			// spreadsheets often save CSV files with a byte order mark
+			name = strings.TrimPrefix(name, "\ufeff")
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := columns[name]; ok {
+			return nil, fmt.Errorf("%w: duplicate column %q", ErrInvalidBulkUpload, name)
+		}
+		columns[name] = i
+	}
+
+	receiver, ok := columns[upload.ReceiverColumn]
+	if !ok {
+		return nil, fmt.Errorf("%w: no receiver column %q", ErrInvalidBulkUpload, upload.ReceiverColumn)
+	}
+	variables := make(map[string]int, len(columns))
+	for name, i := range columns {
+		if _, ok := upload.Mapping[name]; !ok {
+			variables[name] = i
+		}
+	}
+	for column, variable := range upload.Mapping {
+		i, ok := columns[column]
+		if !ok {
+			return nil, fmt.Errorf("%w: mapping of unknown column %q", ErrInvalidBulkUpload, column)
+		}
+		variables[variable] = i
+	}
+
+	job := &bulkJob{
+		BulkJob: BulkJob{
+			Template: upload.Template,
+			Channel:  upload.Channel,
+			Errors:   []RowError{},
+		},
+		rate: upload.Rate,
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+
+		job.Rows++
+		if job.Rows > c.maxRows {
+			return nil, fmt.Errorf("%w: the CSV exceeds %d rows", ErrInvalidBulkUpload, c.maxRows)
+		}
+		var parseError *csv.ParseError
+		if errors.As(err, &parseError) {
+			job.Invalid++
+			job.addError(parseError.StartLine, parseError.Err)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %v", err)
+		}
+
+		row, _ := reader.FieldPos(0)
+		if len(record) != len(header) {
+			job.Invalid++
+			job.addError(row, fmt.Errorf("the row has %d columns, the header %d", len(record), len(header)))
+			continue
+		}
+
+		vars := make(map[string]string, len(variables))
+		for name, i := range variables {
+			vars[name] = record[i]
+		}
+		content, err := c.templates.Render(upload.Template, vars)
+		if err != nil {
+			job.Invalid++
+			job.addError(row, err)
+			continue
+		}
+
+		request := NotificationRequest{
+			Channel:  upload.Channel,
+			Content:  content,
+			Receiver: strings.TrimSpace(record[receiver]),
+			Priority: upload.Priority,
+			Tenant:   upload.Tenant,
+			Tags:     upload.Tags,
+		}
+		if err := validateNotification(c.validator, request); err != nil {
+			job.Invalid++
+			job.addError(row, err)
+			continue
+		}
+		job.requests = append(job.requests, request)
+		job.rows = append(job.rows, row)
+	}
+	return job, nil
+}
+
+func (j *bulkJob) addError(row int, err error) {
+	if len(j.Errors) < maxBulkRowErrors {
+		j.Errors = append(j.Errors, RowError{Row: row, Error: err.Error()})
+	}
+}
+
+// snapshot returns a copy of the job which is safe to use without the lock
+func (j *bulkJob) snapshot() BulkJob {
+	job := j.BulkJob
+	job.Errors = append([]RowError{}, j.Errors...)
+	job.Pending = job.Rows - job.Invalid - job.Sent - job.Failed
+	return job
+}
@@ -0,0 +1,213 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BulkController", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		mockSender *mocks.MockBatchController
+		controller *notification.BulkController
+		upload     notification.BulkUpload
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockSender = mocks.NewMockBatchController(mockCtrl)
+
+		contentTemplates := &templates.Templates{}
+		Expect(contentTemplates.Add("welcome", "Hi {{.name}}, your code is {{.code}}")).To(Succeed())
+		structValidator := validator.New()
+		structValidator.RegisterTagNameFunc(notification.JSONFieldName)
+		controller = notification.NewBulkController(mockSender, contentTemplates, structValidator, 1000, time.Hour)
+		DeferCleanup(controller.Close)
+
+		upload = notification.BulkUpload{
+			Template:       "welcome",
+			Channel:        "email",
+			ReceiverColumn: "Email",
+			// code is a variable without a mapping
+			Mapping: map[string]string{"First Name": "name"},
+		}
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	// sends returns results with generated ids for the notifications of a chunk
+	sends := func(ctx context.Context, batchID string, notifications []notification.NotificationRequest) []notification.SendResult {
+		results := make([]notification.SendResult, len(notifications))
+		for i, n := range notifications {
+			results[i].ID = "id-" + n.Receiver
+		}
+		return results
+	}
+
+	// rows returns a CSV of the number of valid rows
+	rows := func(n int) string {
+		csv := "Email,First Name,code\n"
+		for i := 0; i < n; i++ {
+			csv += fmt.Sprintf("user%d@example.com,User %d,%04d\n", i, i, i)
+		}
+		return csv
+	}
+
+	job := func(id string) func() notification.BulkJob {
+		return func() notification.BulkJob {
+			job, err := controller.GetBulkJob(id)
+			Expect(err).NotTo(HaveOccurred())
+			return job
+		}
+	}
+
+	When("uploading a CSV with valid and invalid rows", func() {
+		const csv = "\ufeffEmail,First Name,code\n" +
+			"ana@example.com,Ana,1234\n" +
+			"bob@example.com,Bob\n" +
+			",Eve,9999\n" +
+			"\"joe@example.com \",\"Joe, Jr.\",4321\n"
+
+		It("should send the valid rows with the job as batch", func() {
+			var batchID string
+			mockSender.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), []notification.NotificationRequest{
+				{Channel: "email", Content: "Hi Ana, your code is 1234", Receiver: "ana@example.com"},
+				{Channel: "email", Content: "Hi Joe, Jr., your code is 4321", Receiver: "joe@example.com"},
+			}).DoAndReturn(func(ctx context.Context, id string, notifications []notification.NotificationRequest) []notification.SendResult {
+				batchID = id
+				return sends(ctx, id, notifications)
+			})
+
+			created, err := controller.CreateBulkJob(upload, strings.NewReader(csv))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.Rows).To(Equal(4))
+			Expect(created.Invalid).To(Equal(2))
+			Expect(created.Errors).To(Equal([]notification.RowError{
+				{Row: 3, Error: "the row has 2 columns, the header 3"},
+				{Row: 4, Error: "invalid receiver: required"},
+			}))
+
+			Eventually(job(created.ID)).Should(HaveField("State", notification.BulkCompleted))
+			completed := job(created.ID)()
+			Expect(completed.Sent).To(Equal(2))
+			Expect(completed.Pending).To(Equal(0))
+			Expect(batchID).To(Equal(created.ID))
+		})
+	})
+
+	When("a row does not have a variable of the template", func() {
+		It("should report the row", func() {
+			upload.Mapping = map[string]string{"First Name": "name", "code": "pin"}
+
+			created, err := controller.CreateBulkJob(upload, strings.NewReader(rows(1)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.State).To(Equal(notification.BulkCompleted))
+			Expect(created.Invalid).To(Equal(1))
+			Expect(created.Errors[0].Error).To(ContainSubstring(`map has no entry for key "code"`))
+		})
+	})
+
+	When("the upload is invalid", func() {
+		DescribeTable("should reject it as a whole", func(change func(), csv, message string) {
+			change()
+			_, err := controller.CreateBulkJob(upload, strings.NewReader(csv))
+			Expect(err).To(MatchError(notification.ErrInvalidBulkUpload))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+			Entry("with an unknown template", func() { upload.Template = "reminder" }, rows(1), "unknown template reminder"),
+			Entry("without a header", func() {}, "", "the CSV has no header"),
+			Entry("without the receiver column", func() { upload.ReceiverColumn = "Phone" }, rows(1), `no receiver column "Phone"`),
+			Entry("with a mapping of an unknown column", func() { upload.Mapping["Last Name"] = "last" }, rows(1), `mapping of unknown column "Last Name"`),
+			Entry("with too many rows", func() {}, rows(1001), "the CSV exceeds 1000 rows"),
+		)
+	})
+
+	When("publishing rows fails", func() {
+		It("should report the failed rows", func() {
+			mockSender.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(2)).Return([]notification.SendResult{
+				{ID: "id-user0@example.com"},
+				{Err: errors.New("error sending notification: connection closed")},
+			})
+
+			created, err := controller.CreateBulkJob(upload, strings.NewReader(rows(2)))
+			Expect(err).NotTo(HaveOccurred())
+
+			Eventually(job(created.ID)).Should(HaveField("State", notification.BulkCompleted))
+			completed := job(created.ID)()
+			Expect(completed.Sent).To(Equal(1))
+			Expect(completed.Failed).To(Equal(1))
+			Expect(completed.Errors).To(Equal([]notification.RowError{{Row: 3, Error: "error sending notification: connection closed"}}))
+		})
+	})
+
+	When("a job with more than one chunk is paused", func() {
+		var created notification.BulkJob
+
+		BeforeEach(func() {
+			started := make(chan struct{})
+			released := make(chan struct{})
+			mockSender.EXPECT().SendNotifications(gomock.Any(), gomock.Any(), gomock.Len(500)).
+				DoAndReturn(func(ctx context.Context, id string, notifications []notification.NotificationRequest) []notification.SendResult {
+					close(started)
+					<-released
+					return sends(ctx, id, notifications)
+				})
+
+			var err error
+			created, err = controller.CreateBulkJob(upload, strings.NewReader(rows(600)))
+			Expect(err).NotTo(HaveOccurred())
+			// paused while the first chunk is published
+			Eventually(started).Should(BeClosed())
+
+			paused, err := controller.PauseBulkJob(created.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(paused.State).To(Equal(notification.BulkPaused))
+			close(released)
+
+			Eventually(job(created.ID)).Should(HaveField("Sent", 500))
+			Consistently(job(created.ID), 100*time.Millisecond).Should(HaveField("Pending", 100))
+		})
+
+		It("should send the rest once it is resumed", func() {
+			mockSender.EXPECT().SendNotifications(gomock.Any(), created.ID, gomock.Len(100)).DoAndReturn(sends)
+
+			resumed, err := controller.ResumeBulkJob(created.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resumed.State).To(Equal(notification.BulkRunning))
+
+			Eventually(job(created.ID)).Should(HaveField("State", notification.BulkCompleted))
+			Expect(job(created.ID)().Sent).To(Equal(600))
+		})
+
+		It("should never send the rest once it is canceled", func() {
+			canceled, err := controller.CancelBulkJob(created.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(canceled.State).To(Equal(notification.BulkCanceled))
+			Expect(canceled.Pending).To(Equal(100))
+
+			Consistently(job(created.ID), 100*time.Millisecond).Should(HaveField("Sent", 500))
+			_, err = controller.ResumeBulkJob(created.ID)
+			Expect(err).To(MatchError("invalid bulk job state: a canceled job cannot be running"))
+		})
+	})
+
+	When("changing the state of an unknown job", func() {
+		It("should not find it", func() {
+			_, err := controller.PauseBulkJob("unknown")
+			Expect(err).To(MatchError(notification.ErrBulkJobNotFound))
+		})
+	})
+})
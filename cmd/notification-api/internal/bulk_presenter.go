@@ -0,0 +1,130 @@
+package notification
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=bulk_presenter.go --destination mocks/bulk_presenter.go --package mocks
+
+type BulkJobs interface {
+	CreateBulkJob(upload BulkUpload, file io.Reader) (BulkJob, error)
+	GetBulkJob(id string) (BulkJob, error)
+	PauseBulkJob(id string) (BulkJob, error)
+	ResumeBulkJob(id string) (BulkJob, error)
+	CancelBulkJob(id string) (BulkJob, error)
+}
+
+type BulkPresenter struct {
+	jobs BulkJobs
+}
+
+func NewBulkPresenter(jobs BulkJobs) *BulkPresenter {
+	return &BulkPresenter{
+		jobs: jobs,
+	}
+}
+
+// HandleCreateBulkJob starts a bulk job of a multipart upload with the CSV as file and the template,
+// channel, receiver_column and optional mapping, priority, tenant, tags and rate as fields
+func (p *BulkPresenter) HandleCreateBulkJob(c echo.Context) error {
+	upload := BulkUpload{
+		Template:       c.FormValue("template"),
+		Channel:        c.FormValue("channel"),
+		ReceiverColumn: c.FormValue("receiver_column"),
+		Priority:       c.FormValue("priority"),
+		Tenant:         c.FormValue("tenant"),
+	}
+	if upload.Template == "" || upload.Channel == "" || upload.ReceiverColumn == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "template, channel and receiver_column are required")
+	}
+	if mapping := c.FormValue("mapping"); mapping != "" {
+		if err := json.Unmarshal([]byte(mapping), &upload.Mapping); err != nil {
+			return echo.NewHTTPError(http.StatusBadRequest, "mapping has to be a JSON object of columns to variables")
+		}
+	}
+	if rate := c.FormValue("rate"); rate != "" {
+		var err error
+		upload.Rate, err = strconv.Atoi(rate)
+		if err != nil || upload.Rate < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid rate")
+		}
+	}
+	if form, err := c.MultipartForm(); err == nil {
+		upload.Tags = form.Value["tags"]
+	}
+
+	header, err := c.FormFile("file")
+	if err != nil {
+		logrus.Errorf("failed to read bulk upload: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "The CSV has to be uploaded as file")
+	}
+	file, err := header.Open()
+	if err != nil {
+		logrus.Errorf("failed to open bulk upload: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	defer file.Close()
+
+	job, err := p.jobs.CreateBulkJob(upload, file)
+	if err != nil {
+		return bulkJobError("failed to create bulk job", err)
+	}
+	if job.Rows == job.Invalid {
+		return c.JSON(http.StatusUnprocessableEntity, job)
+	}
+	return c.JSON(http.StatusAccepted, job)
+}
+
+func (p *BulkPresenter) HandleGetBulkJob(c echo.Context) error {
+	job, err := p.jobs.GetBulkJob(c.Param("id"))
+	if err != nil {
+		return bulkJobError("failed to get bulk job", err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func (p *BulkPresenter) HandlePauseBulkJob(c echo.Context) error {
+	job, err := p.jobs.PauseBulkJob(c.Param("id"))
+	if err != nil {
+		return bulkJobError("failed to pause bulk job", err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func (p *BulkPresenter) HandleResumeBulkJob(c echo.Context) error {
+	job, err := p.jobs.ResumeBulkJob(c.Param("id"))
+	if err != nil {
+		return bulkJobError("failed to resume bulk job", err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func (p *BulkPresenter) HandleCancelBulkJob(c echo.Context) error {
+	job, err := p.jobs.CancelBulkJob(c.Param("id"))
+	if err != nil {
+		return bulkJobError("failed to cancel bulk job", err)
+	}
+	return c.JSON(http.StatusOK, job)
+}
+
+func bulkJobError(msg string, err error) error {
+	logrus.Errorf("%s: %v", msg, err)
+
+	switch {
+	case errors.Is(err, ErrInvalidBulkUpload):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrBulkJobNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Bulk job not found")
+	case errors.Is(err, ErrBulkJobState):
+		return echo.NewHTTPError(http.StatusConflict, err.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to process bulk job")
+	}
+}
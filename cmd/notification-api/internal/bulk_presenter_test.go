@@ -0,0 +1,174 @@
+package notification_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("BulkPresenter", func() {
+	var (
+		mockCtrl  *gomock.Controller
+		mockJobs  *mocks.MockBulkJobs
+		presenter *notification.BulkPresenter
+		recorder  *httptest.ResponseRecorder
+	)
+
+	const csv = "email,name\nana@example.com,Ana\n"
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockJobs = mocks.NewMockBulkJobs(mockCtrl)
+		presenter = notification.NewBulkPresenter(mockJobs)
+		recorder = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	// upload posts a multipart form with the fields and the CSV as file, an empty CSV is not attached
+	upload := func(fields map[string][]string, file string) error {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		for name, values := range fields {
+			for _, value := range values {
+				Expect(form.WriteField(name, value)).To(Succeed())
+			}
+		}
+		if file != "" {
+			part, err := form.CreateFormFile("file", "recipients.csv")
+			Expect(err).NotTo(HaveOccurred())
+			io.WriteString(part, file)
+		}
+		Expect(form.Close()).To(Succeed())
+
+		req := httptest.NewRequest(http.MethodPost, "/bulk", &body)
+		req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+		return presenter.HandleCreateBulkJob(echo.New().NewContext(req, recorder))
+	}
+
+	fields := func() map[string][]string {
+		return map[string][]string{
+			"template":        {"welcome"},
+			"channel":         {"email"},
+			"receiver_column": {"email"},
+			"mapping":         {`{"name":"first_name"}`},
+			"tags":            {"onboarding", "october"},
+			"rate":            {"50"},
+		}
+	}
+
+	expectStatus := func(err error, status int) {
+		var httpError *echo.HTTPError
+		Expect(err).To(BeAssignableToTypeOf(httpError))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(status))
+	}
+
+	When("uploading a CSV", func() {
+		It("should start a bulk job of the upload", func() {
+			mockJobs.EXPECT().CreateBulkJob(notification.BulkUpload{
+				Template:       "welcome",
+				Channel:        "email",
+				ReceiverColumn: "email",
+				Mapping:        map[string]string{"name": "first_name"},
+				Tags:           []string{"onboarding", "october"},
+				Rate:           50,
+			}, gomock.Any()).DoAndReturn(func(upload notification.BulkUpload, file io.Reader) (notification.BulkJob, error) {
+				content, err := io.ReadAll(file)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(string(content)).To(Equal(csv))
+				return notification.BulkJob{ID: "job", State: notification.BulkRunning, Rows: 1, Pending: 1}, nil
+			})
+
+			Expect(upload(fields(), csv)).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusAccepted))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"id":"job","state":"running"`))
+		})
+	})
+
+	When("every row of the upload is invalid", func() {
+		It("should respond with the row errors", func() {
+			mockJobs.EXPECT().CreateBulkJob(gomock.Any(), gomock.Any()).Return(notification.BulkJob{
+				ID:      "job",
+				State:   notification.BulkCompleted,
+				Rows:    1,
+				Invalid: 1,
+				Errors:  []notification.RowError{{Row: 2, Error: "invalid receiver: required"}},
+			}, nil)
+
+			Expect(upload(fields(), csv)).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusUnprocessableEntity))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"errors":[{"row":2,"error":"invalid receiver: required"}]`))
+		})
+	})
+
+	When("the upload is incomplete", func() {
+		It("should reject an upload without the CSV", func() {
+			expectStatus(upload(fields(), ""), http.StatusBadRequest)
+		})
+
+		It("should reject an upload without a template", func() {
+			f := fields()
+			delete(f, "template")
+			expectStatus(upload(f, csv), http.StatusBadRequest)
+		})
+
+		It("should reject a mapping which is not a JSON object", func() {
+			f := fields()
+			f["mapping"] = []string{"name=first_name"}
+			expectStatus(upload(f, csv), http.StatusBadRequest)
+		})
+	})
+
+	When("the controller rejects the upload", func() {
+		It("should respond with the reason", func() {
+			mockJobs.EXPECT().CreateBulkJob(gomock.Any(), gomock.Any()).
+				Return(notification.BulkJob{}, fmt.Errorf("%w: unknown template welcome", notification.ErrInvalidBulkUpload))
+
+			err := upload(fields(), csv)
+			expectStatus(err, http.StatusBadRequest)
+			Expect(err.(*echo.HTTPError).Message).To(Equal("invalid bulk upload: unknown template welcome"))
+		})
+	})
+
+	When("changing the state of a job", func() {
+		handle := func(handler func(echo.Context) error, id string) error {
+			c := echo.New().NewContext(httptest.NewRequest(http.MethodPost, "/", nil), recorder)
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+			return handler(c)
+		}
+
+		It("should respond with the job", func() {
+			mockJobs.EXPECT().PauseBulkJob("job").Return(notification.BulkJob{ID: "job", State: notification.BulkPaused}, nil)
+
+			Expect(handle(presenter.HandlePauseBulkJob, "job")).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"state":"paused"`))
+		})
+
+		It("should respond with not found for an unknown job", func() {
+			mockJobs.EXPECT().CancelBulkJob("unknown").Return(notification.BulkJob{}, notification.ErrBulkJobNotFound)
+
+			expectStatus(handle(presenter.HandleCancelBulkJob, "unknown"), http.StatusNotFound)
+		})
+
+		It("should respond with conflict when the job cannot change its state", func() {
+			mockJobs.EXPECT().ResumeBulkJob("job").
+				Return(notification.BulkJob{}, fmt.Errorf("%w: a completed job cannot be running", notification.ErrBulkJobState))
+
+			expectStatus(handle(presenter.HandleResumeBulkJob, "job"), http.StatusConflict)
+		})
+	})
+})
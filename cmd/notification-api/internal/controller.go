@@ -3,34 +3,216 @@ package notification
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
 )
 
 //go:generate mockgen --source=controller.go --destination mocks/controller.go --package mocks
 
+var ErrInvalidExpiry = errors.New("invalid expiry")
+
 type MessageBroker interface {
-	Send(ctx context.Context, message []byte) error
+	Send(ctx context.Context, message types.Message) error
+	SendBatch(ctx context.Context, messages []types.Message) []error
+}
+
+type StatusRecorder interface {
+	Accepted(ctx context.Context, notification status.Notification)
+	Scheduled(ctx context.Context, id string)
+	Canceled(ctx context.Context, id string)
+	Queued(ctx context.Context, id string)
+	Rejected(ctx context.Context, id string, cause error)
 }
 
 type NotificationController struct {
-	broker MessageBroker
+	broker    MessageBroker
+	recorder  StatusRecorder
+	scheduled ScheduledStore
 }
 
-func NewNotificationController(broker MessageBroker) *NotificationController {
+// NewNotificationController creates the controller, with a nil recorder the status of notifications is not tracked
+// and without a scheduled store notifications with a send_at are rejected
+func NewNotificationController(broker MessageBroker, recorder StatusRecorder, scheduled ScheduledStore) *NotificationController {
 	return &NotificationController{
-		broker: broker,
+		broker:    broker,
+		recorder:  recorder,
+		scheduled: scheduled,
+	}
+}
+
+// SendNotification publishes the notification, or schedules it when it has a send_at, and returns its id
+func (c *NotificationController) SendNotification(ctx context.Context, notification NotificationRequest) (string, error) {
+	if notification.SendAt != nil && c.scheduled == nil {
+		return "", ErrSchedulingDisabled
+	}
+	message, err := c.accept(ctx, types.NewMessageID(), notification, "")
+	if err != nil {
+		return "", err
+	}
+	if notification.SendAt != nil {
+		return message.ID, c.schedule(ctx, message, *notification.SendAt)
+	}
+
+	if err := c.broker.Send(ctx, message); err != nil {
+		return "", c.rejected(ctx, message.ID, err)
+	}
+
+	if c.recorder != nil {
+		c.recorder.Queued(ctx, message.ID)
 	}
+	return message.ID, nil
 }
 
-func (c *NotificationController) SendNotification(ctx context.Context, notification NotificationRequest) error {
+// SendResult is the outcome of a notification of a batch, its id once it is published or the error
+type SendResult struct {
+	ID  string
+	Err error
+}
+
+// SendNotifications publishes the notifications of the batch at once and returns the result of each of them
+func (c *NotificationController) SendNotifications(ctx context.Context, batchID string, notifications []NotificationRequest) []SendResult {
+	results := make([]SendResult, len(notifications))
+	messages := make([]types.Message, 0, len(notifications))
+	// indexes maps the messages to their notification
+	indexes := make([]int, 0, len(notifications))
+	for i, notification := range notifications {
+		if notification.SendAt != nil && c.scheduled == nil {
+			results[i].Err = ErrSchedulingDisabled
+			continue
+		}
+		message, err := c.accept(ctx, types.NewMessageID(), notification, batchID)
+		if err != nil {
+			results[i].Err = err
+			continue
+		}
+		if notification.SendAt != nil {
+			results[i].Err = c.schedule(ctx, message, *notification.SendAt)
+			if results[i].Err == nil {
+				results[i].ID = message.ID
+			}
+			continue
+		}
+		messages = append(messages, message)
+		indexes = append(indexes, i)
+	}
+
+	for j, err := range c.broker.SendBatch(ctx, messages) {
+		i := indexes[j]
+		if err != nil {
+			results[i].Err = c.rejected(ctx, messages[j].ID, err)
+			continue
+		}
+		if c.recorder != nil {
+			c.recorder.Queued(ctx, messages[j].ID)
+		}
+		results[i].ID = messages[j].ID
+	}
+	return results
+}
+
+// accept creates the message of the notification with the id and records it as accepted
+func (c *NotificationController) accept(ctx context.Context, id string, notification NotificationRequest, batchID string) (types.Message, error) {
+	priority, err := types.ParsePriority(notification.Priority)
+	if err != nil {
+		return types.Message{}, fmt.Errorf("error parsing priority: %v", err)
+	}
+	expiresAt, err := expiryOf(notification, time.Now())
+	if err != nil {
+		return types.Message{}, err
+	}
+
 	msg, err := json.Marshal(notification)
 	if err != nil {
-		return fmt.Errorf("error marshaling event body: %v", err)
+		return types.Message{}, fmt.Errorf("error marshaling event body: %v", err)
+	}
+
+	if c.recorder != nil {
+		// recorded before publishing, so the service never records a state before it
+		c.recorder.Accepted(ctx, status.Notification{
+			ID:       id,
+			Channel:  notification.Channel,
+			Receiver: notification.Receiver,
+			Priority: priority.String(),
+			Tenant:   notification.Tenant,
+			Tags:     notification.Tags,
+			Batch:    batchID,
+		})
+	}
+
+	return types.Message{
+		ID:        id,
+		Channel:   notification.Channel,
+		Priority:  priority,
+		Payload:   msg,
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// expiryOf resolves the expires_at or ttl of the notification, zero if it never expires. A notification
+// expiring before it is sent is rejected, the ttl of a scheduled notification starts at its send_at.
+func expiryOf(notification NotificationRequest, now time.Time) (time.Time, error) {
+	sendAt := now
+	if notification.SendAt != nil && notification.SendAt.After(now) {
+		sendAt = *notification.SendAt
+	}
+
+	switch {
+	case notification.ExpiresAt != nil && notification.TTL != "":
+		return time.Time{}, fmt.Errorf("%w: only one of expires_at and ttl can be set", ErrInvalidExpiry)
+	case notification.ExpiresAt != nil:
+		if !notification.ExpiresAt.After(sendAt) {
+			return time.Time{}, fmt.Errorf("%w: expires_at is before the notification is sent", ErrInvalidExpiry)
+		}
+		return *notification.ExpiresAt, nil
+	case notification.TTL != "":
+		ttl, err := time.ParseDuration(notification.TTL)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: %v", ErrInvalidExpiry, err)
+		}
+		if ttl <= 0 {
+			return time.Time{}, fmt.Errorf("%w: ttl has to be positive", ErrInvalidExpiry)
+		}
+		return sendAt.Add(ttl), nil
+	default:
+		return time.Time{}, nil
 	}
+}
 
-	err = c.broker.Send(ctx, msg)
+// schedule keeps the message in the scheduled store until the send_at
+func (c *NotificationController) schedule(ctx context.Context, message types.Message, sendAt time.Time) error {
+	payload, err := json.Marshal(scheduledMessage{
+		Channel:   message.Channel,
+		Priority:  message.Priority,
+		Payload:   message.Payload,
+		ExpiresAt: message.ExpiresAt,
+	})
+	if err != nil {
+		return fmt.Errorf("error marshaling scheduled notification: %v", err)
+	}
+	n, err := newScheduled(message.ID, sendAt, payload)
 	if err != nil {
-		return fmt.Errorf("error sending notification: %v", err)
+		return fmt.Errorf("error marshaling scheduled notification: %v", err)
+	}
+
+	if err := c.scheduled.Create(ctx, n); err != nil {
+		return c.rejected(ctx, message.ID, fmt.Errorf("error scheduling notification: %v", err))
+	}
+
+	if c.recorder != nil {
+		c.recorder.Scheduled(ctx, message.ID)
 	}
 	return nil
 }
+
+// rejected records a notification which failed to publish and returns the error
+func (c *NotificationController) rejected(ctx context.Context, id string, cause error) error {
+	err := fmt.Errorf("error sending notification: %v", cause)
+	if c.recorder != nil {
+		c.recorder.Rejected(ctx, id, err)
+	}
+	return err
+}
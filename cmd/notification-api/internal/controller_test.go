@@ -4,9 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"time"
 
 	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
 	"github.com/golang/mock/gomock"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
@@ -21,10 +25,20 @@ var _ = Describe("NotificationController", func() {
 		notificationRequest notification.NotificationRequest
 	)
 
+	// sendsMessage compares the published message with expected apart from its generated id
+	sendsMessage := func(expected types.Message, err error) func(context.Context, types.Message) error {
+		return func(_ context.Context, message types.Message) error {
+			Expect(message.ID).To(HaveLen(36))
+			message.ID = ""
+			Expect(message).To(Equal(expected))
+			return err
+		}
+	}
+
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		mockBroker = mocks.NewMockMessageBroker(mockCtrl)
-		controller = notification.NewNotificationController(mockBroker)
+		controller = notification.NewNotificationController(mockBroker, nil, nil)
 		ctx = context.Background()
 		notificationRequest = notification.NotificationRequest{
 			Channel:  "email",
@@ -36,11 +50,11 @@ var _ = Describe("NotificationController", func() {
 	When("sending notification fails due to broker error", func() {
 		BeforeEach(func() {
 			msg, _ := json.Marshal(notificationRequest)
-			mockBroker.EXPECT().Send(ctx, msg).Return(errors.New("broker error"))
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(sendsMessage(types.Message{Channel: "email", Priority: types.PriorityNormal, Payload: msg}, errors.New("broker error")))
 		})
 
 		It("should return a sending error", func() {
-			err := controller.SendNotification(ctx, notificationRequest)
+			_, err := controller.SendNotification(ctx, notificationRequest)
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(ContainSubstring("error sending notification"))
 		})
@@ -49,15 +63,233 @@ var _ = Describe("NotificationController", func() {
 	When("sending notification succeeds", func() {
 		BeforeEach(func() {
 			msg, _ := json.Marshal(notificationRequest)
-			mockBroker.EXPECT().Send(ctx, msg).Return(nil)
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(sendsMessage(types.Message{Channel: "email", Priority: types.PriorityNormal, Payload: msg}, nil))
+		})
+
+		It("should return the id of the notification", func() {
+			id, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(HaveLen(36))
+		})
+	})
+
+	When("sending a high priority notification", func() {
+		BeforeEach(func() {
+			notificationRequest.Priority = "high"
+			msg, _ := json.Marshal(notificationRequest)
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(sendsMessage(types.Message{Channel: "email", Priority: types.PriorityHigh, Payload: msg}, nil))
+		})
+
+		It("should publish the message with high priority", func() {
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).NotTo(HaveOccurred())
+		})
+	})
+
+	When("the priority is unknown", func() {
+		BeforeEach(func() {
+			notificationRequest.Priority = "asap"
+		})
+
+		It("should return an error without publishing", func() {
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).To(MatchError("error parsing priority: unknown priority: asap"))
+		})
+	})
+
+	Context("with a status recorder", func() {
+		var mockRecorder *mocks.MockStatusRecorder
+
+		BeforeEach(func() {
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			controller = notification.NewNotificationController(mockBroker, mockRecorder, nil)
+		})
+
+		It("should record the notification as accepted and queued", func() {
+			var accepted status.Notification
+			gomock.InOrder(
+				mockRecorder.EXPECT().Accepted(ctx, gomock.Any()).Do(func(_ context.Context, n status.Notification) { accepted = n }),
+				mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(nil),
+				mockRecorder.EXPECT().Queued(ctx, gomock.Any()),
+			)
+
+			notificationRequest.Tenant = "acme"
+			notificationRequest.Tags = []string{"otp"}
+			id, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(accepted).To(Equal(status.Notification{
+				ID: id, Channel: "email", Receiver: "user@example.com", Priority: "normal", Tenant: "acme", Tags: []string{"otp"},
+			}))
+		})
+
+		It("should record the notification as failed when publishing fails", func() {
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any())
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(errors.New("broker error"))
+			mockRecorder.EXPECT().Rejected(ctx, gomock.Any(), gomock.Any())
+
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+
+	Context("sending a batch", func() {
+		var mockRecorder *mocks.MockStatusRecorder
+
+		BeforeEach(func() {
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			controller = notification.NewNotificationController(mockBroker, mockRecorder, nil)
 		})
 
-		It("should not return an error", func() {
-			err := controller.SendNotification(ctx, notificationRequest)
+		It("should publish the notifications at once and return the result of each", func() {
+			var accepted []status.Notification
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any()).Do(func(_ context.Context, n status.Notification) { accepted = append(accepted, n) }).Times(2)
+			mockBroker.EXPECT().SendBatch(ctx, gomock.Len(2)).Return([]error{nil, errors.New("broker error")})
+			mockRecorder.EXPECT().Queued(ctx, gomock.Any())
+			mockRecorder.EXPECT().Rejected(ctx, gomock.Any(), gomock.Any())
+
+			unknown := notificationRequest
+			unknown.Priority = "asap"
+			results := controller.SendNotifications(ctx, "b1", []notification.NotificationRequest{notificationRequest, unknown, notificationRequest})
+
+			Expect(results).To(HaveLen(3))
+			Expect(results[0].ID).To(Equal(accepted[0].ID))
+			Expect(results[0].Err).NotTo(HaveOccurred())
+			Expect(results[1].Err).To(MatchError("error parsing priority: unknown priority: asap"))
+			Expect(results[2].ID).To(BeEmpty())
+			Expect(results[2].Err).To(MatchError("error sending notification: broker error"))
+			Expect(accepted[1].Batch).To(Equal("b1"))
+		})
+	})
+
+	Context("with a send_at", func() {
+		var (
+			mockRecorder  *mocks.MockStatusRecorder
+			mockScheduled *mocks.MockScheduledStore
+			sendAt        time.Time
+		)
+
+		BeforeEach(func() {
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			mockScheduled = mocks.NewMockScheduledStore(mockCtrl)
+			controller = notification.NewNotificationController(mockBroker, mockRecorder, mockScheduled)
+			sendAt = time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+			notificationRequest.SendAt = &sendAt
+		})
+
+		It("should schedule the notification instead of publishing it", func() {
+			var created scheduled.Notification
+			gomock.InOrder(
+				mockRecorder.EXPECT().Accepted(ctx, gomock.Any()),
+				mockScheduled.EXPECT().Create(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, n scheduled.Notification) error {
+					created = n
+					return nil
+				}),
+				mockRecorder.EXPECT().Scheduled(ctx, gomock.Any()),
+			)
+
+			id, err := controller.SendNotification(ctx, notificationRequest)
 			Expect(err).NotTo(HaveOccurred())
+			Expect(created.ID).To(Equal(id))
+			Expect(created.SendAt).To(Equal(sendAt))
+			Expect(created.Channel).To(Equal(notificationRequest.Channel))
+		})
+
+		It("should record the notification as failed when scheduling fails", func() {
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any())
+			mockScheduled.EXPECT().Create(ctx, gomock.Any()).Return(errors.New("disk full"))
+			mockRecorder.EXPECT().Rejected(ctx, gomock.Any(), gomock.Any())
+
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).To(MatchError("error sending notification: error scheduling notification: disk full"))
+		})
+
+		It("should schedule the notifications of a batch which have one", func() {
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any()).Times(2)
+			mockScheduled.EXPECT().Create(ctx, gomock.Any())
+			mockRecorder.EXPECT().Scheduled(ctx, gomock.Any())
+			mockBroker.EXPECT().SendBatch(ctx, gomock.Len(1)).Return([]error{nil})
+			mockRecorder.EXPECT().Queued(ctx, gomock.Any())
+
+			now := notificationRequest
+			now.SendAt = nil
+			results := controller.SendNotifications(ctx, "b1", []notification.NotificationRequest{notificationRequest, now})
+			Expect(results[0].ID).To(HaveLen(36))
+			Expect(results[1].ID).To(HaveLen(36))
+		})
+
+		It("should reject the notification without a scheduled store", func() {
+			controller = notification.NewNotificationController(mockBroker, mockRecorder, nil)
+
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).To(MatchError(notification.ErrSchedulingDisabled))
 		})
 	})
 
+	Context("with an expiry", func() {
+		inAnHour := time.Now().Add(time.Hour)
+		aMinuteAgo := time.Now().Add(-time.Minute)
+
+		publishedExpiry := func() time.Time {
+			var expiresAt time.Time
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message types.Message) error {
+				expiresAt = message.ExpiresAt
+				return nil
+			})
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).NotTo(HaveOccurred())
+			return expiresAt
+		}
+
+		It("should publish the message with its expires_at", func() {
+			expiresAt := time.Now().Add(time.Hour)
+			notificationRequest.ExpiresAt = &expiresAt
+
+			Expect(publishedExpiry()).To(Equal(expiresAt))
+		})
+
+		It("should publish the message expiring after its ttl", func() {
+			notificationRequest.TTL = "10m"
+
+			Expect(publishedExpiry()).To(BeTemporally("~", time.Now().Add(10*time.Minute), time.Second))
+		})
+
+		It("should start the ttl of a scheduled notification at its send_at", func() {
+			sendAt := time.Now().Add(time.Hour)
+			notificationRequest.SendAt = &sendAt
+			notificationRequest.TTL = "10m"
+
+			var created scheduled.Notification
+			mockScheduled := mocks.NewMockScheduledStore(mockCtrl)
+			controller = notification.NewNotificationController(mockBroker, nil, mockScheduled)
+			mockScheduled.EXPECT().Create(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, n scheduled.Notification) error {
+				created = n
+				return nil
+			})
+			_, err := controller.SendNotification(ctx, notificationRequest)
+			Expect(err).NotTo(HaveOccurred())
+
+			var message struct {
+				ExpiresAt time.Time `json:"expires_at"`
+			}
+			Expect(json.Unmarshal(created.Message, &message)).To(Succeed())
+			Expect(message.ExpiresAt).To(BeTemporally("==", sendAt.Add(10*time.Minute)))
+		})
+
+		DescribeTable("should reject an invalid expiry without publishing",
+			func(expiresAt *time.Time, ttl string) {
+				notificationRequest.ExpiresAt = expiresAt
+				notificationRequest.TTL = ttl
+
+				_, err := controller.SendNotification(ctx, notificationRequest)
+				Expect(errors.Is(err, notification.ErrInvalidExpiry)).To(BeTrue())
+			},
+			Entry("both set", &inAnHour, "10m"),
+			Entry("expires_at in the past", &aMinuteAgo, ""),
+			Entry("unparsable ttl", nil, "ten minutes"),
+			Entry("negative ttl", nil, "-1m"),
+		)
+	})
+
 	AfterEach(func() {
 		mockCtrl.Finish()
 	})
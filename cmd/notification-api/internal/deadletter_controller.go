@@ -0,0 +1,114 @@
+package notification
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+//go:generate mockgen --source=deadletter_controller.go --destination mocks/deadletter_controller.go --package mocks
+
+const purgeTokenTTL = 5 * time.Minute
+
+var (
+	ErrEmptyFilter       = errors.New("filter selects no dead letters, set all to requeue every dead letter")
+	ErrInvalidPurgeToken = errors.New("invalid or expired purge confirmation token")
+)
+
+type DeadLetterQueue interface {
+	ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error)
+	RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error)
+	PurgeDeadLetters(ctx context.Context, channel string) (int, error)
+}
+
+type DeadLetterController struct {
+	queue DeadLetterQueue
+	// secret signs the purge confirmation tokens, every api replica needs the same secret
+	secret []byte
+}
+
+func NewDeadLetterController(queue DeadLetterQueue, secret []byte) *DeadLetterController {
+	return &DeadLetterController{
+		queue:  queue,
+		secret: secret,
+	}
+}
+
+func (c *DeadLetterController) ListDeadLetters(ctx context.Context, channel string, offset, limit int) (DeadLetterPage, error) {
+	items, total, err := c.queue.ListDeadLetters(ctx, channel, offset, limit)
+	if err != nil {
+		return DeadLetterPage{}, fmt.Errorf("error listing dead letters: %w", err)
+	}
+
+	if items == nil {
+		items = []types.DeadLetter{}
+	}
+	return DeadLetterPage{
+		Items:  items,
+		Total:  total,
+		Offset: offset,
+		Limit:  limit,
+	}, nil
+}
+
+func (c *DeadLetterController) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	if filter.Empty() {
+		return 0, ErrEmptyFilter
+	}
+
+	requeued, err := c.queue.RequeueDeadLetters(ctx, channel, filter)
+	if err != nil {
+		return requeued, fmt.Errorf("error requeueing dead letters: %w", err)
+	}
+	return requeued, nil
+}
+
+// IssuePurgeToken returns a token which confirms purging the DLQ of the channel for a limited time
+func (c *DeadLetterController) IssuePurgeToken(channel string) PurgeToken {
+	expiresAt := time.Now().Add(purgeTokenTTL).Truncate(time.Second)
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+
+	return PurgeToken{
+		Token:     expiry + "." + c.sign(channel, expiry),
+		ExpiresAt: expiresAt,
+	}
+}
+
+func (c *DeadLetterController) PurgeDeadLetters(ctx context.Context, channel, token string) (int, error) {
+	if !c.validPurgeToken(channel, token) {
+		return 0, ErrInvalidPurgeToken
+	}
+
+	purged, err := c.queue.PurgeDeadLetters(ctx, channel)
+	if err != nil {
+		return 0, fmt.Errorf("error purging dead letters: %w", err)
+	}
+	return purged, nil
+}
+
+func (c *DeadLetterController) validPurgeToken(channel, token string) bool {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(c.sign(channel, expiry))) {
+		return false
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return false
+	}
+	return time.Now().Unix() <= expiresAt
+}
+
+func (c *DeadLetterController) sign(channel, expiry string) string {
+	mac := hmac.New(sha256.New, c.secret)
+	mac.Write([]byte("purge:" + channel + ":" + expiry))
+	return hex.EncodeToString(mac.Sum(nil))
+}
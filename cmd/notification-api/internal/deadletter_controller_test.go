@@ -0,0 +1,94 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeadLetterController", func() {
+	var (
+		mockCtrl   *gomock.Controller
+		mockQueue  *mocks.MockDeadLetterQueue
+		controller *notification.DeadLetterController
+		ctx        context.Context
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockQueue = mocks.NewMockDeadLetterQueue(mockCtrl)
+		controller = notification.NewDeadLetterController(mockQueue, []byte("secret"))
+		ctx = context.Background()
+	})
+
+	When("listing an empty dead letter queue", func() {
+		BeforeEach(func() {
+			mockQueue.EXPECT().ListDeadLetters(ctx, "sms", 0, 10).Return(nil, 0, nil)
+		})
+
+		It("should return an empty page", func() {
+			page, err := controller.ListDeadLetters(ctx, "sms", 0, 10)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page).To(Equal(notification.DeadLetterPage{Items: []types.DeadLetter{}, Limit: 10}))
+		})
+	})
+
+	When("requeueing without a filter", func() {
+		It("should not requeue anything", func() {
+			_, err := controller.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{})
+			Expect(err).To(MatchError(notification.ErrEmptyFilter))
+		})
+	})
+
+	When("requeueing fails", func() {
+		BeforeEach(func() {
+			filter := types.DeadLetterFilter{ErrorClass: types.ErrorClassSendFailed}
+			mockQueue.EXPECT().RequeueDeadLetters(ctx, "sms", filter).Return(2, errors.New("connection closed"))
+		})
+
+		It("should return the number of requeued messages and the error", func() {
+			requeued, err := controller.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{ErrorClass: types.ErrorClassSendFailed})
+			Expect(err).To(MatchError("error requeueing dead letters: connection closed"))
+			Expect(requeued).To(Equal(2))
+		})
+	})
+
+	When("purging with an issued token", func() {
+		BeforeEach(func() {
+			mockQueue.EXPECT().PurgeDeadLetters(ctx, "sms").Return(3, nil)
+		})
+
+		It("should purge the dead letter queue", func() {
+			token := controller.IssuePurgeToken("sms")
+			purged, err := controller.PurgeDeadLetters(ctx, "sms", token.Token)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(purged).To(Equal(3))
+		})
+	})
+
+	When("purging with a token of another channel", func() {
+		It("should reject the token", func() {
+			token := controller.IssuePurgeToken("email")
+			_, err := controller.PurgeDeadLetters(ctx, "sms", token.Token)
+			Expect(err).To(MatchError(notification.ErrInvalidPurgeToken))
+		})
+	})
+
+	When("purging with a token signed by another secret", func() {
+		It("should reject the token", func() {
+			token := notification.NewDeadLetterController(mockQueue, []byte("other")).IssuePurgeToken("sms")
+			_, err := controller.PurgeDeadLetters(ctx, "sms", token.Token)
+			Expect(err).To(MatchError(notification.ErrInvalidPurgeToken))
+		})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+})
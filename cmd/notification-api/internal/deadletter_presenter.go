@@ -0,0 +1,108 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=deadletter_presenter.go --destination mocks/deadletter_presenter.go --package mocks
+
+const (
+	defaultDeadLetterLimit = 50
+	maxDeadLetterLimit     = 500
+)
+
+type DeadLetterAdmin interface {
+	ListDeadLetters(ctx context.Context, channel string, offset, limit int) (DeadLetterPage, error)
+	RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error)
+	IssuePurgeToken(channel string) PurgeToken
+	PurgeDeadLetters(ctx context.Context, channel, token string) (int, error)
+}
+
+type DeadLetterPresenter struct {
+	admin DeadLetterAdmin
+}
+
+func NewDeadLetterPresenter(admin DeadLetterAdmin) *DeadLetterPresenter {
+	return &DeadLetterPresenter{
+		admin: admin,
+	}
+}
+
+func (p *DeadLetterPresenter) HandleListDeadLetters(c echo.Context) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid offset")
+	}
+	limit, err := queryInt(c, "limit", defaultDeadLetterLimit)
+	if err != nil || limit < 1 || limit > maxDeadLetterLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+	}
+
+	page, err := p.admin.ListDeadLetters(c.Request().Context(), c.Param("channel"), offset, limit)
+	if err != nil {
+		return deadLetterError("failed to list dead letters", err)
+	}
+
+	return c.JSON(http.StatusOK, page)
+}
+
+func (p *DeadLetterPresenter) HandleRequeueDeadLetters(c echo.Context) error {
+	var filter types.DeadLetterFilter
+	if err := json.NewDecoder(c.Request().Body).Decode(&filter); err != nil {
+		logrus.Errorf("failed to decode body: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+
+	requeued, err := p.admin.RequeueDeadLetters(c.Request().Context(), c.Param("channel"), filter)
+	if err != nil {
+		return deadLetterError("failed to requeue dead letters", err)
+	}
+
+	return c.JSON(http.StatusOK, RequeueResult{Requeued: requeued})
+}
+
+func (p *DeadLetterPresenter) HandleIssuePurgeToken(c echo.Context) error {
+	return c.JSON(http.StatusOK, p.admin.IssuePurgeToken(c.Param("channel")))
+}
+
+func (p *DeadLetterPresenter) HandlePurgeDeadLetters(c echo.Context) error {
+	purged, err := p.admin.PurgeDeadLetters(c.Request().Context(), c.Param("channel"), c.QueryParam("token"))
+	if err != nil {
+		return deadLetterError("failed to purge dead letters", err)
+	}
+
+	return c.JSON(http.StatusOK, PurgeResult{Purged: purged})
+}
+
+func deadLetterError(msg string, err error) error {
+	logrus.Errorf("%s: %v", msg, err)
+
+	switch {
+	case errors.Is(err, types.ErrUnsupportedChannel):
+		return echo.NewHTTPError(http.StatusNotFound, "Unknown channel")
+	case errors.Is(err, types.ErrPeekLimit):
+		return echo.NewHTTPError(http.StatusBadRequest, types.ErrPeekLimit.Error())
+	case errors.Is(err, ErrEmptyFilter):
+		return echo.NewHTTPError(http.StatusBadRequest, ErrEmptyFilter.Error())
+	case errors.Is(err, ErrInvalidPurgeToken):
+		return echo.NewHTTPError(http.StatusForbidden, ErrInvalidPurgeToken.Error())
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to access dead letter queue")
+	}
+}
+
+func queryInt(c echo.Context, name string, defaultValue int) (int, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+	return strconv.Atoi(value)
+}
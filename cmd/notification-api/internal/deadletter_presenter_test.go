@@ -0,0 +1,128 @@
+package notification_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DeadLetterPresenter", func() {
+	var (
+		mockCtrl  *gomock.Controller
+		mockAdmin *mocks.MockDeadLetterAdmin
+		presenter *notification.DeadLetterPresenter
+		e         *echo.Echo
+		rec       *httptest.ResponseRecorder
+	)
+
+	newContext := func(method, target string, body []byte) echo.Context {
+		req := httptest.NewRequest(method, target, bytes.NewBuffer(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec = httptest.NewRecorder()
+		c := e.NewContext(req, rec)
+		c.SetParamNames("channel")
+		c.SetParamValues("sms")
+		return c
+	}
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockAdmin = mocks.NewMockDeadLetterAdmin(mockCtrl)
+		presenter = notification.NewDeadLetterPresenter(mockAdmin)
+		e = echo.New()
+	})
+
+	When("listing dead letters", func() {
+		BeforeEach(func() {
+			mockAdmin.EXPECT().ListDeadLetters(gomock.Any(), "sms", 20, 10).Return(notification.DeadLetterPage{
+				Items:  []types.DeadLetter{{ID: "1", Channel: "sms", ErrorClass: types.ErrorClassSendFailed}},
+				Total:  21,
+				Offset: 20,
+				Limit:  10,
+			}, nil)
+		})
+
+		It("should return the requested page", func() {
+			err := presenter.HandleListDeadLetters(newContext(http.MethodGet, "/admin/dlq/sms?offset=20&limit=10", nil))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rec.Code).To(Equal(http.StatusOK))
+
+			var page notification.DeadLetterPage
+			Expect(json.Unmarshal(rec.Body.Bytes(), &page)).To(Succeed())
+			Expect(page.Total).To(Equal(21))
+			Expect(page.Items).To(HaveLen(1))
+		})
+	})
+
+	When("the limit is too large", func() {
+		It("should reject the request", func() {
+			err := presenter.HandleListDeadLetters(newContext(http.MethodGet, "/admin/dlq/sms?limit=100000", nil))
+			Expect(err).To(MatchError(ContainSubstring("Invalid limit")))
+		})
+	})
+
+	When("the channel is unknown", func() {
+		BeforeEach(func() {
+			mockAdmin.EXPECT().ListDeadLetters(gomock.Any(), "sms", 0, 50).
+				Return(notification.DeadLetterPage{}, fmt.Errorf("error listing dead letters: %w", types.ErrUnsupportedChannel))
+		})
+
+		It("should return not found", func() {
+			err := presenter.HandleListDeadLetters(newContext(http.MethodGet, "/admin/dlq/sms", nil))
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusNotFound))
+		})
+	})
+
+	When("the page is beyond what the broker can list", func() {
+		BeforeEach(func() {
+			mockAdmin.EXPECT().ListDeadLetters(gomock.Any(), "sms", 990, 50).
+				Return(notification.DeadLetterPage{}, fmt.Errorf("error listing dead letters: %w", types.ErrPeekLimit))
+		})
+
+		It("should reject the request", func() {
+			err := presenter.HandleListDeadLetters(newContext(http.MethodGet, "/admin/dlq/sms?offset=990", nil))
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+
+	When("requeueing selected dead letters", func() {
+		BeforeEach(func() {
+			filter := types.DeadLetterFilter{IDs: []string{"1", "2"}}
+			mockAdmin.EXPECT().RequeueDeadLetters(gomock.Any(), "sms", filter).Return(2, nil)
+		})
+
+		It("should return the number of requeued messages", func() {
+			err := presenter.HandleRequeueDeadLetters(newContext(http.MethodPost, "/admin/dlq/sms/requeue", []byte(`{"ids":["1","2"]}`)))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(rec.Body.String()).To(MatchJSON(`{"requeued":2}`))
+		})
+	})
+
+	When("purging with an invalid token", func() {
+		BeforeEach(func() {
+			mockAdmin.EXPECT().PurgeDeadLetters(gomock.Any(), "sms", "forged").Return(0, notification.ErrInvalidPurgeToken)
+		})
+
+		It("should refuse to purge", func() {
+			err := presenter.HandlePurgeDeadLetters(newContext(http.MethodDelete, "/admin/dlq/sms?token=forged", nil))
+			Expect(err).To(HaveOccurred())
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusForbidden))
+		})
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+})
@@ -0,0 +1,50 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: batch_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockBatchController is a mock of BatchController interface.
+type MockBatchController struct {
+	ctrl     *gomock.Controller
+	recorder *MockBatchControllerMockRecorder
+}
+
+// MockBatchControllerMockRecorder is the mock recorder for MockBatchController.
+type MockBatchControllerMockRecorder struct {
+	mock *MockBatchController
+}
+
+// NewMockBatchController creates a new mock instance.
+func NewMockBatchController(ctrl *gomock.Controller) *MockBatchController {
+	mock := &MockBatchController{ctrl: ctrl}
+	mock.recorder = &MockBatchControllerMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBatchController) EXPECT() *MockBatchControllerMockRecorder {
+	return m.recorder
+}
+
+// SendNotifications mocks base method.
+func (m *MockBatchController) SendNotifications(ctx context.Context, batchID string, notifications []notification.NotificationRequest) []notification.SendResult {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendNotifications", ctx, batchID, notifications)
+	ret0, _ := ret[0].([]notification.SendResult)
+	return ret0
+}
+
+// SendNotifications indicates an expected call of SendNotifications.
+func (mr *MockBatchControllerMockRecorder) SendNotifications(ctx, batchID, notifications interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendNotifications", reflect.TypeOf((*MockBatchController)(nil).SendNotifications), ctx, batchID, notifications)
+}
@@ -0,0 +1,63 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: bulk_controller.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	reflect "reflect"
+
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockTemplateRenderer is a mock of TemplateRenderer interface.
+type MockTemplateRenderer struct {
+	ctrl     *gomock.Controller
+	recorder *MockTemplateRendererMockRecorder
+}
+
+// MockTemplateRendererMockRecorder is the mock recorder for MockTemplateRenderer.
+type MockTemplateRendererMockRecorder struct {
+	mock *MockTemplateRenderer
+}
+
+// NewMockTemplateRenderer creates a new mock instance.
+func NewMockTemplateRenderer(ctrl *gomock.Controller) *MockTemplateRenderer {
+	mock := &MockTemplateRenderer{ctrl: ctrl}
+	mock.recorder = &MockTemplateRendererMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockTemplateRenderer) EXPECT() *MockTemplateRendererMockRecorder {
+	return m.recorder
+}
+
+// Has mocks base method.
+func (m *MockTemplateRenderer) Has(name string) bool {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Has", name)
+	ret0, _ := ret[0].(bool)
+	return ret0
+}
+
+// Has indicates an expected call of Has.
+func (mr *MockTemplateRendererMockRecorder) Has(name interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Has", reflect.TypeOf((*MockTemplateRenderer)(nil).Has), name)
+}
+
+// Render mocks base method.
+func (m *MockTemplateRenderer) Render(name string, vars map[string]string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Render", name, vars)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Render indicates an expected call of Render.
+func (mr *MockTemplateRendererMockRecorder) Render(name, vars interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Render", reflect.TypeOf((*MockTemplateRenderer)(nil).Render), name, vars)
+}
@@ -0,0 +1,111 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: bulk_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	io "io"
+	reflect "reflect"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockBulkJobs is a mock of BulkJobs interface.
+type MockBulkJobs struct {
+	ctrl     *gomock.Controller
+	recorder *MockBulkJobsMockRecorder
+}
+
+// MockBulkJobsMockRecorder is the mock recorder for MockBulkJobs.
+type MockBulkJobsMockRecorder struct {
+	mock *MockBulkJobs
+}
+
+// NewMockBulkJobs creates a new mock instance.
+func NewMockBulkJobs(ctrl *gomock.Controller) *MockBulkJobs {
+	mock := &MockBulkJobs{ctrl: ctrl}
+	mock.recorder = &MockBulkJobsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBulkJobs) EXPECT() *MockBulkJobsMockRecorder {
+	return m.recorder
+}
+
+// CancelBulkJob mocks base method.
+func (m *MockBulkJobs) CancelBulkJob(id string) (notification.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelBulkJob", id)
+	ret0, _ := ret[0].(notification.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CancelBulkJob indicates an expected call of CancelBulkJob.
+func (mr *MockBulkJobsMockRecorder) CancelBulkJob(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelBulkJob", reflect.TypeOf((*MockBulkJobs)(nil).CancelBulkJob), id)
+}
+
+// CreateBulkJob mocks base method.
+func (m *MockBulkJobs) CreateBulkJob(upload notification.BulkUpload, file io.Reader) (notification.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateBulkJob", upload, file)
+	ret0, _ := ret[0].(notification.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateBulkJob indicates an expected call of CreateBulkJob.
+func (mr *MockBulkJobsMockRecorder) CreateBulkJob(upload, file interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateBulkJob", reflect.TypeOf((*MockBulkJobs)(nil).CreateBulkJob), upload, file)
+}
+
+// GetBulkJob mocks base method.
+func (m *MockBulkJobs) GetBulkJob(id string) (notification.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetBulkJob", id)
+	ret0, _ := ret[0].(notification.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetBulkJob indicates an expected call of GetBulkJob.
+func (mr *MockBulkJobsMockRecorder) GetBulkJob(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetBulkJob", reflect.TypeOf((*MockBulkJobs)(nil).GetBulkJob), id)
+}
+
+// PauseBulkJob mocks base method.
+func (m *MockBulkJobs) PauseBulkJob(id string) (notification.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PauseBulkJob", id)
+	ret0, _ := ret[0].(notification.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PauseBulkJob indicates an expected call of PauseBulkJob.
+func (mr *MockBulkJobsMockRecorder) PauseBulkJob(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PauseBulkJob", reflect.TypeOf((*MockBulkJobs)(nil).PauseBulkJob), id)
+}
+
+// ResumeBulkJob mocks base method.
+func (m *MockBulkJobs) ResumeBulkJob(id string) (notification.BulkJob, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ResumeBulkJob", id)
+	ret0, _ := ret[0].(notification.BulkJob)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ResumeBulkJob indicates an expected call of ResumeBulkJob.
+func (mr *MockBulkJobsMockRecorder) ResumeBulkJob(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ResumeBulkJob", reflect.TypeOf((*MockBulkJobs)(nil).ResumeBulkJob), id)
+}
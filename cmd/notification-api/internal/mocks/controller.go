@@ -8,6 +8,8 @@ import (
 	context "context"
 	reflect "reflect"
 
+	status "github.com/AlexTsIvanov/notification-system/pkg/status"
+	types "github.com/AlexTsIvanov/notification-system/pkg/types"
 	gomock "github.com/golang/mock/gomock"
 )
 
@@ -35,7 +37,7 @@ func (m *MockMessageBroker) EXPECT() *MockMessageBrokerMockRecorder {
 }
 
 // Send mocks base method.
-func (m *MockMessageBroker) Send(ctx context.Context, message []byte) error {
+func (m *MockMessageBroker) Send(ctx context.Context, message types.Message) error {
 	m.ctrl.T.Helper()
 	ret := m.ctrl.Call(m, "Send", ctx, message)
 	ret0, _ := ret[0].(error)
@@ -47,3 +49,100 @@ func (mr *MockMessageBrokerMockRecorder) Send(ctx, message interface{}) *gomock.
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Send", reflect.TypeOf((*MockMessageBroker)(nil).Send), ctx, message)
 }
+
+// SendBatch mocks base method.
+func (m *MockMessageBroker) SendBatch(ctx context.Context, messages []types.Message) []error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SendBatch", ctx, messages)
+	ret0, _ := ret[0].([]error)
+	return ret0
+}
+
+// SendBatch indicates an expected call of SendBatch.
+func (mr *MockMessageBrokerMockRecorder) SendBatch(ctx, messages interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SendBatch", reflect.TypeOf((*MockMessageBroker)(nil).SendBatch), ctx, messages)
+}
+
+// MockStatusRecorder is a mock of StatusRecorder interface.
+type MockStatusRecorder struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusRecorderMockRecorder
+}
+
+// MockStatusRecorderMockRecorder is the mock recorder for MockStatusRecorder.
+type MockStatusRecorderMockRecorder struct {
+	mock *MockStatusRecorder
+}
+
+// NewMockStatusRecorder creates a new mock instance.
+func NewMockStatusRecorder(ctrl *gomock.Controller) *MockStatusRecorder {
+	mock := &MockStatusRecorder{ctrl: ctrl}
+	mock.recorder = &MockStatusRecorderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatusRecorder) EXPECT() *MockStatusRecorderMockRecorder {
+	return m.recorder
+}
+
+// Accepted mocks base method.
+func (m *MockStatusRecorder) Accepted(ctx context.Context, notification status.Notification) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Accepted", ctx, notification)
+}
+
+// Accepted indicates an expected call of Accepted.
+func (mr *MockStatusRecorderMockRecorder) Accepted(ctx, notification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Accepted", reflect.TypeOf((*MockStatusRecorder)(nil).Accepted), ctx, notification)
+}
+
+// Canceled mocks base method.
+func (m *MockStatusRecorder) Canceled(ctx context.Context, id string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Canceled", ctx, id)
+}
+
+// Canceled indicates an expected call of Canceled.
+func (mr *MockStatusRecorderMockRecorder) Canceled(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Canceled", reflect.TypeOf((*MockStatusRecorder)(nil).Canceled), ctx, id)
+}
+
+// Queued mocks base method.
+func (m *MockStatusRecorder) Queued(ctx context.Context, id string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Queued", ctx, id)
+}
+
+// Queued indicates an expected call of Queued.
+func (mr *MockStatusRecorderMockRecorder) Queued(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Queued", reflect.TypeOf((*MockStatusRecorder)(nil).Queued), ctx, id)
+}
+
+// Rejected mocks base method.
+func (m *MockStatusRecorder) Rejected(ctx context.Context, id string, cause error) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Rejected", ctx, id, cause)
+}
+
+// Rejected indicates an expected call of Rejected.
+func (mr *MockStatusRecorderMockRecorder) Rejected(ctx, id, cause interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Rejected", reflect.TypeOf((*MockStatusRecorder)(nil).Rejected), ctx, id, cause)
+}
+
+// Scheduled mocks base method.
+func (m *MockStatusRecorder) Scheduled(ctx context.Context, id string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Scheduled", ctx, id)
+}
+
+// Scheduled indicates an expected call of Scheduled.
+func (mr *MockStatusRecorderMockRecorder) Scheduled(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Scheduled", reflect.TypeOf((*MockStatusRecorder)(nil).Scheduled), ctx, id)
+}
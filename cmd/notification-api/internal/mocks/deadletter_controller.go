@@ -0,0 +1,82 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: deadletter_controller.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	types "github.com/AlexTsIvanov/notification-system/pkg/types"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockDeadLetterQueue is a mock of DeadLetterQueue interface.
+type MockDeadLetterQueue struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterQueueMockRecorder
+}
+
+// MockDeadLetterQueueMockRecorder is the mock recorder for MockDeadLetterQueue.
+type MockDeadLetterQueueMockRecorder struct {
+	mock *MockDeadLetterQueue
+}
+
+// NewMockDeadLetterQueue creates a new mock instance.
+func NewMockDeadLetterQueue(ctrl *gomock.Controller) *MockDeadLetterQueue {
+	mock := &MockDeadLetterQueue{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterQueueMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterQueue) EXPECT() *MockDeadLetterQueueMockRecorder {
+	return m.recorder
+}
+
+// ListDeadLetters mocks base method.
+func (m *MockDeadLetterQueue) ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDeadLetters", ctx, channel, offset, limit)
+	ret0, _ := ret[0].([]types.DeadLetter)
+	ret1, _ := ret[1].(int)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// ListDeadLetters indicates an expected call of ListDeadLetters.
+func (mr *MockDeadLetterQueueMockRecorder) ListDeadLetters(ctx, channel, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDeadLetters", reflect.TypeOf((*MockDeadLetterQueue)(nil).ListDeadLetters), ctx, channel, offset, limit)
+}
+
+// PurgeDeadLetters mocks base method.
+func (m *MockDeadLetterQueue) PurgeDeadLetters(ctx context.Context, channel string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeadLetters", ctx, channel)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeadLetters indicates an expected call of PurgeDeadLetters.
+func (mr *MockDeadLetterQueueMockRecorder) PurgeDeadLetters(ctx, channel interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeadLetters", reflect.TypeOf((*MockDeadLetterQueue)(nil).PurgeDeadLetters), ctx, channel)
+}
+
+// RequeueDeadLetters mocks base method.
+func (m *MockDeadLetterQueue) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueDeadLetters", ctx, channel, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueDeadLetters indicates an expected call of RequeueDeadLetters.
+func (mr *MockDeadLetterQueueMockRecorder) RequeueDeadLetters(ctx, channel, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueDeadLetters", reflect.TypeOf((*MockDeadLetterQueue)(nil).RequeueDeadLetters), ctx, channel, filter)
+}
@@ -0,0 +1,96 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: deadletter_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	types "github.com/AlexTsIvanov/notification-system/pkg/types"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockDeadLetterAdmin is a mock of DeadLetterAdmin interface.
+type MockDeadLetterAdmin struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeadLetterAdminMockRecorder
+}
+
+// MockDeadLetterAdminMockRecorder is the mock recorder for MockDeadLetterAdmin.
+type MockDeadLetterAdminMockRecorder struct {
+	mock *MockDeadLetterAdmin
+}
+
+// NewMockDeadLetterAdmin creates a new mock instance.
+func NewMockDeadLetterAdmin(ctrl *gomock.Controller) *MockDeadLetterAdmin {
+	mock := &MockDeadLetterAdmin{ctrl: ctrl}
+	mock.recorder = &MockDeadLetterAdminMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeadLetterAdmin) EXPECT() *MockDeadLetterAdminMockRecorder {
+	return m.recorder
+}
+
+// IssuePurgeToken mocks base method.
+func (m *MockDeadLetterAdmin) IssuePurgeToken(channel string) notification.PurgeToken {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssuePurgeToken", channel)
+	ret0, _ := ret[0].(notification.PurgeToken)
+	return ret0
+}
+
+// IssuePurgeToken indicates an expected call of IssuePurgeToken.
+func (mr *MockDeadLetterAdminMockRecorder) IssuePurgeToken(channel interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssuePurgeToken", reflect.TypeOf((*MockDeadLetterAdmin)(nil).IssuePurgeToken), channel)
+}
+
+// ListDeadLetters mocks base method.
+func (m *MockDeadLetterAdmin) ListDeadLetters(ctx context.Context, channel string, offset, limit int) (notification.DeadLetterPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListDeadLetters", ctx, channel, offset, limit)
+	ret0, _ := ret[0].(notification.DeadLetterPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListDeadLetters indicates an expected call of ListDeadLetters.
+func (mr *MockDeadLetterAdminMockRecorder) ListDeadLetters(ctx, channel, offset, limit interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListDeadLetters", reflect.TypeOf((*MockDeadLetterAdmin)(nil).ListDeadLetters), ctx, channel, offset, limit)
+}
+
+// PurgeDeadLetters mocks base method.
+func (m *MockDeadLetterAdmin) PurgeDeadLetters(ctx context.Context, channel, token string) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PurgeDeadLetters", ctx, channel, token)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PurgeDeadLetters indicates an expected call of PurgeDeadLetters.
+func (mr *MockDeadLetterAdminMockRecorder) PurgeDeadLetters(ctx, channel, token interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PurgeDeadLetters", reflect.TypeOf((*MockDeadLetterAdmin)(nil).PurgeDeadLetters), ctx, channel, token)
+}
+
+// RequeueDeadLetters mocks base method.
+func (m *MockDeadLetterAdmin) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RequeueDeadLetters", ctx, channel, filter)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RequeueDeadLetters indicates an expected call of RequeueDeadLetters.
+func (mr *MockDeadLetterAdminMockRecorder) RequeueDeadLetters(ctx, channel, filter interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RequeueDeadLetters", reflect.TypeOf((*MockDeadLetterAdmin)(nil).RequeueDeadLetters), ctx, channel, filter)
+}
@@ -0,0 +1,108 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: recurring_controller.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	recurring "github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRecurringStore is a mock of RecurringStore interface.
+type MockRecurringStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecurringStoreMockRecorder
+}
+
+// MockRecurringStoreMockRecorder is the mock recorder for MockRecurringStore.
+type MockRecurringStoreMockRecorder struct {
+	mock *MockRecurringStore
+}
+
+// NewMockRecurringStore creates a new mock instance.
+func NewMockRecurringStore(ctrl *gomock.Controller) *MockRecurringStore {
+	mock := &MockRecurringStore{ctrl: ctrl}
+	mock.recorder = &MockRecurringStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecurringStore) EXPECT() *MockRecurringStoreMockRecorder {
+	return m.recorder
+}
+
+// Create mocks base method.
+func (m *MockRecurringStore) Create(ctx context.Context, schedule recurring.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, schedule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockRecurringStoreMockRecorder) Create(ctx, schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockRecurringStore)(nil).Create), ctx, schedule)
+}
+
+// Delete mocks base method.
+func (m *MockRecurringStore) Delete(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Delete", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Delete indicates an expected call of Delete.
+func (mr *MockRecurringStoreMockRecorder) Delete(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockRecurringStore)(nil).Delete), ctx, id)
+}
+
+// Get mocks base method.
+func (m *MockRecurringStore) Get(ctx context.Context, id string) (recurring.Schedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(recurring.Schedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockRecurringStoreMockRecorder) Get(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockRecurringStore)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockRecurringStore) List(ctx context.Context, query recurring.Query) (recurring.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, query)
+	ret0, _ := ret[0].(recurring.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockRecurringStoreMockRecorder) List(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockRecurringStore)(nil).List), ctx, query)
+}
+
+// Update mocks base method.
+func (m *MockRecurringStore) Update(ctx context.Context, schedule recurring.Schedule) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Update", ctx, schedule)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Update indicates an expected call of Update.
+func (mr *MockRecurringStoreMockRecorder) Update(ctx, schedule interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Update", reflect.TypeOf((*MockRecurringStore)(nil).Update), ctx, schedule)
+}
@@ -0,0 +1,142 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: recurring_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	recurring "github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockRecurringSchedules is a mock of RecurringSchedules interface.
+type MockRecurringSchedules struct {
+	ctrl     *gomock.Controller
+	recorder *MockRecurringSchedulesMockRecorder
+}
+
+// MockRecurringSchedulesMockRecorder is the mock recorder for MockRecurringSchedules.
+type MockRecurringSchedulesMockRecorder struct {
+	mock *MockRecurringSchedules
+}
+
+// NewMockRecurringSchedules creates a new mock instance.
+func NewMockRecurringSchedules(ctrl *gomock.Controller) *MockRecurringSchedules {
+	mock := &MockRecurringSchedules{ctrl: ctrl}
+	mock.recorder = &MockRecurringSchedulesMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRecurringSchedules) EXPECT() *MockRecurringSchedulesMockRecorder {
+	return m.recorder
+}
+
+// CreateRecurring mocks base method.
+func (m *MockRecurringSchedules) CreateRecurring(ctx context.Context, request notification.RecurringRequest) (notification.RecurringSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateRecurring", ctx, request)
+	ret0, _ := ret[0].(notification.RecurringSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// CreateRecurring indicates an expected call of CreateRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) CreateRecurring(ctx, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).CreateRecurring), ctx, request)
+}
+
+// DeleteRecurring mocks base method.
+func (m *MockRecurringSchedules) DeleteRecurring(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteRecurring", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteRecurring indicates an expected call of DeleteRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) DeleteRecurring(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).DeleteRecurring), ctx, id)
+}
+
+// GetRecurring mocks base method.
+func (m *MockRecurringSchedules) GetRecurring(ctx context.Context, id string) (notification.RecurringSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRecurring", ctx, id)
+	ret0, _ := ret[0].(notification.RecurringSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetRecurring indicates an expected call of GetRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) GetRecurring(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).GetRecurring), ctx, id)
+}
+
+// ListRecurring mocks base method.
+func (m *MockRecurringSchedules) ListRecurring(ctx context.Context, query recurring.Query) (notification.RecurringPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListRecurring", ctx, query)
+	ret0, _ := ret[0].(notification.RecurringPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListRecurring indicates an expected call of ListRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) ListRecurring(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).ListRecurring), ctx, query)
+}
+
+// NextRuns mocks base method.
+func (m *MockRecurringSchedules) NextRuns(ctx context.Context, id string, count int) ([]time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "NextRuns", ctx, id, count)
+	ret0, _ := ret[0].([]time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// NextRuns indicates an expected call of NextRuns.
+func (mr *MockRecurringSchedulesMockRecorder) NextRuns(ctx, id, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "NextRuns", reflect.TypeOf((*MockRecurringSchedules)(nil).NextRuns), ctx, id, count)
+}
+
+// PreviewRecurring mocks base method.
+func (m *MockRecurringSchedules) PreviewRecurring(expression, timezone string, count int) ([]time.Time, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PreviewRecurring", expression, timezone, count)
+	ret0, _ := ret[0].([]time.Time)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// PreviewRecurring indicates an expected call of PreviewRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) PreviewRecurring(expression, timezone, count interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PreviewRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).PreviewRecurring), expression, timezone, count)
+}
+
+// UpdateRecurring mocks base method.
+func (m *MockRecurringSchedules) UpdateRecurring(ctx context.Context, id string, request notification.RecurringRequest) (notification.RecurringSchedule, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "UpdateRecurring", ctx, id, request)
+	ret0, _ := ret[0].(notification.RecurringSchedule)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// UpdateRecurring indicates an expected call of UpdateRecurring.
+func (mr *MockRecurringSchedulesMockRecorder) UpdateRecurring(ctx, id, request interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateRecurring", reflect.TypeOf((*MockRecurringSchedules)(nil).UpdateRecurring), ctx, id, request)
+}
@@ -0,0 +1,110 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: schedule_controller.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	scheduled "github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockScheduledStore is a mock of ScheduledStore interface.
+type MockScheduledStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduledStoreMockRecorder
+}
+
+// MockScheduledStoreMockRecorder is the mock recorder for MockScheduledStore.
+type MockScheduledStoreMockRecorder struct {
+	mock *MockScheduledStore
+}
+
+// NewMockScheduledStore creates a new mock instance.
+func NewMockScheduledStore(ctrl *gomock.Controller) *MockScheduledStore {
+	mock := &MockScheduledStore{ctrl: ctrl}
+	mock.recorder = &MockScheduledStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduledStore) EXPECT() *MockScheduledStoreMockRecorder {
+	return m.recorder
+}
+
+// Cancel mocks base method.
+func (m *MockScheduledStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Cancel", ctx, id, now)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Cancel indicates an expected call of Cancel.
+func (mr *MockScheduledStoreMockRecorder) Cancel(ctx, id, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Cancel", reflect.TypeOf((*MockScheduledStore)(nil).Cancel), ctx, id, now)
+}
+
+// Create mocks base method.
+func (m *MockScheduledStore) Create(ctx context.Context, notification scheduled.Notification) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Create", ctx, notification)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Create indicates an expected call of Create.
+func (mr *MockScheduledStoreMockRecorder) Create(ctx, notification interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockScheduledStore)(nil).Create), ctx, notification)
+}
+
+// Get mocks base method.
+func (m *MockScheduledStore) Get(ctx context.Context, id string) (scheduled.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(scheduled.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockScheduledStoreMockRecorder) Get(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockScheduledStore)(nil).Get), ctx, id)
+}
+
+// List mocks base method.
+func (m *MockScheduledStore) List(ctx context.Context, query scheduled.Query) (scheduled.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx, query)
+	ret0, _ := ret[0].(scheduled.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockScheduledStoreMockRecorder) List(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockScheduledStore)(nil).List), ctx, query)
+}
+
+// Reschedule mocks base method.
+func (m *MockScheduledStore) Reschedule(ctx context.Context, id string, sendAt, now time.Time) (scheduled.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Reschedule", ctx, id, sendAt, now)
+	ret0, _ := ret[0].(scheduled.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Reschedule indicates an expected call of Reschedule.
+func (mr *MockScheduledStoreMockRecorder) Reschedule(ctx, id, sendAt, now interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Reschedule", reflect.TypeOf((*MockScheduledStore)(nil).Reschedule), ctx, id, sendAt, now)
+}
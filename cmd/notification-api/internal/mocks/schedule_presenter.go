@@ -0,0 +1,97 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: schedule_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+	time "time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	scheduled "github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockScheduledNotifications is a mock of ScheduledNotifications interface.
+type MockScheduledNotifications struct {
+	ctrl     *gomock.Controller
+	recorder *MockScheduledNotificationsMockRecorder
+}
+
+// MockScheduledNotificationsMockRecorder is the mock recorder for MockScheduledNotifications.
+type MockScheduledNotificationsMockRecorder struct {
+	mock *MockScheduledNotifications
+}
+
+// NewMockScheduledNotifications creates a new mock instance.
+func NewMockScheduledNotifications(ctrl *gomock.Controller) *MockScheduledNotifications {
+	mock := &MockScheduledNotifications{ctrl: ctrl}
+	mock.recorder = &MockScheduledNotificationsMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockScheduledNotifications) EXPECT() *MockScheduledNotificationsMockRecorder {
+	return m.recorder
+}
+
+// CancelScheduled mocks base method.
+func (m *MockScheduledNotifications) CancelScheduled(ctx context.Context, id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CancelScheduled", ctx, id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CancelScheduled indicates an expected call of CancelScheduled.
+func (mr *MockScheduledNotificationsMockRecorder) CancelScheduled(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CancelScheduled", reflect.TypeOf((*MockScheduledNotifications)(nil).CancelScheduled), ctx, id)
+}
+
+// GetScheduled mocks base method.
+func (m *MockScheduledNotifications) GetScheduled(ctx context.Context, id string) (notification.ScheduledNotification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetScheduled", ctx, id)
+	ret0, _ := ret[0].(notification.ScheduledNotification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetScheduled indicates an expected call of GetScheduled.
+func (mr *MockScheduledNotificationsMockRecorder) GetScheduled(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetScheduled", reflect.TypeOf((*MockScheduledNotifications)(nil).GetScheduled), ctx, id)
+}
+
+// ListScheduled mocks base method.
+func (m *MockScheduledNotifications) ListScheduled(ctx context.Context, query scheduled.Query) (notification.ScheduledPage, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListScheduled", ctx, query)
+	ret0, _ := ret[0].(notification.ScheduledPage)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListScheduled indicates an expected call of ListScheduled.
+func (mr *MockScheduledNotificationsMockRecorder) ListScheduled(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListScheduled", reflect.TypeOf((*MockScheduledNotifications)(nil).ListScheduled), ctx, query)
+}
+
+// RescheduleScheduled mocks base method.
+func (m *MockScheduledNotifications) RescheduleScheduled(ctx context.Context, id string, sendAt time.Time) (notification.ScheduledNotification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RescheduleScheduled", ctx, id, sendAt)
+	ret0, _ := ret[0].(notification.ScheduledNotification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// RescheduleScheduled indicates an expected call of RescheduleScheduled.
+func (mr *MockScheduledNotificationsMockRecorder) RescheduleScheduled(ctx, id, sendAt interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RescheduleScheduled", reflect.TypeOf((*MockScheduledNotifications)(nil).RescheduleScheduled), ctx, id, sendAt)
+}
@@ -0,0 +1,111 @@
+// Code generated by MockGen. DO NOT EDIT.
+// Source: status_presenter.go
+
+// Package mocks is a generated GoMock package.
+package mocks
+
+import (
+	context "context"
+	reflect "reflect"
+
+	status "github.com/AlexTsIvanov/notification-system/pkg/status"
+	gomock "github.com/golang/mock/gomock"
+)
+
+// MockStatusStore is a mock of StatusStore interface.
+type MockStatusStore struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusStoreMockRecorder
+}
+
+// MockStatusStoreMockRecorder is the mock recorder for MockStatusStore.
+type MockStatusStoreMockRecorder struct {
+	mock *MockStatusStore
+}
+
+// NewMockStatusStore creates a new mock instance.
+func NewMockStatusStore(ctrl *gomock.Controller) *MockStatusStore {
+	mock := &MockStatusStore{ctrl: ctrl}
+	mock.recorder = &MockStatusStoreMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatusStore) EXPECT() *MockStatusStoreMockRecorder {
+	return m.recorder
+}
+
+// Batch mocks base method.
+func (m *MockStatusStore) Batch(ctx context.Context, id string) (status.BatchProgress, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Batch", ctx, id)
+	ret0, _ := ret[0].(status.BatchProgress)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Batch indicates an expected call of Batch.
+func (mr *MockStatusStoreMockRecorder) Batch(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Batch", reflect.TypeOf((*MockStatusStore)(nil).Batch), ctx, id)
+}
+
+// Events mocks base method.
+func (m *MockStatusStore) Events(ctx context.Context, query status.EventQuery) ([]status.Event, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Events", ctx, query)
+	ret0, _ := ret[0].([]status.Event)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Events indicates an expected call of Events.
+func (mr *MockStatusStoreMockRecorder) Events(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Events", reflect.TypeOf((*MockStatusStore)(nil).Events), ctx, query)
+}
+
+// Get mocks base method.
+func (m *MockStatusStore) Get(ctx context.Context, id string) (status.Notification, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", ctx, id)
+	ret0, _ := ret[0].(status.Notification)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockStatusStoreMockRecorder) Get(ctx, id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockStatusStore)(nil).Get), ctx, id)
+}
+
+// LastSeq mocks base method.
+func (m *MockStatusStore) LastSeq(ctx context.Context) (int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "LastSeq", ctx)
+	ret0, _ := ret[0].(int64)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// LastSeq indicates an expected call of LastSeq.
+func (mr *MockStatusStoreMockRecorder) LastSeq(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "LastSeq", reflect.TypeOf((*MockStatusStore)(nil).LastSeq), ctx)
+}
+
+// Search mocks base method.
+func (m *MockStatusStore) Search(ctx context.Context, query status.Query) (status.Page, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Search", ctx, query)
+	ret0, _ := ret[0].(status.Page)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Search indicates an expected call of Search.
+func (mr *MockStatusStoreMockRecorder) Search(ctx, query interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Search", reflect.TypeOf((*MockStatusStore)(nil).Search), ctx, query)
+}
@@ -1,7 +1,188 @@
 package notification
 
+import (
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
 type NotificationRequest struct {
 	Channel  string `json:"channel" validate:"required"`
 	Content  string `json:"content" validate:"required"`
 	Receiver string `json:"receiver" validate:"required"`
-}
\ No newline at end of file
+	// Priority is one of low, normal or high, urgent notifications like OTP codes
+	// should be sent with high priority so they are not stuck behind bulk traffic
+	Priority string `json:"priority,omitempty" validate:"omitempty,oneof=low normal high"`
+	// Tenant and Tags are recorded with the status of the notification to search it in GET /notifications
+	Tenant string   `json:"tenant,omitempty" validate:"omitempty,max=128"`
+	Tags   []string `json:"tags,omitempty" validate:"omitempty,max=20,unique,dive,required,max=64"`
+	// CallbackURL receives a signed POST once the notification is delivered or failed for good
+	CallbackURL string `json:"callback_url,omitempty" validate:"omitempty,http_url,max=2048"`
+	// SendAt schedules the notification, it is published once the time is reached instead of right away
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// ExpiresAt or TTL drop the notification instead of sending it late, e.g. an OTP code waiting for a retry.
+	// TTL is a duration like "10m" counted from the send_at, or from the request without one.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+}
+
+type SendResponse struct {
+	// ID identifies the notification in GET /notifications/:id
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// BatchItemResult is the outcome of a notification of a batch, its id once it is published or the error
+type BatchItemResult struct {
+	// Index is the position of the notification in the batch, starting at 0
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type BatchResponse struct {
+	// BatchID identifies the batch in GET /batches/:id
+	BatchID  string            `json:"batch_id"`
+	Accepted int               `json:"accepted"`
+	Rejected int               `json:"rejected"`
+	Items    []BatchItemResult `json:"items"`
+}
+
+// BulkUpload describes how the rows of a CSV upload become notifications
+type BulkUpload struct {
+	// Template renders the content of every row
+	Template string
+	Channel  string
+	// ReceiverColumn is the CSV column of the receivers
+	ReceiverColumn string
+	// Mapping maps CSV columns to template variables, the other columns are variables of their own name
+	Mapping  map[string]string
+	Priority string
+	Tenant   string
+	Tags     []string
+	// Rate is the number of notifications sent per second, 0 sends them as fast as the broker confirms
+	Rate int
+}
+
+type BulkState string
+
+const (
+	BulkRunning   BulkState = "running"
+	BulkPaused    BulkState = "paused"
+	BulkCanceled  BulkState = "canceled"
+	BulkCompleted BulkState = "completed"
+)
+
+// RowError is a row of a bulk upload which is not sent
+type RowError struct {
+	// Row is the line of the row in the CSV, the header is line 1
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type BulkJob struct {
+	// ID identifies the job, it is the batch_id of its notifications as well
+	ID       string    `json:"id"`
+	State    BulkState `json:"state"`
+	Template string    `json:"template"`
+	Channel  string    `json:"channel"`
+	// Rows is the number of rows without the header, Invalid of them failed validation and are never sent
+	Rows    int `json:"rows"`
+	Invalid int `json:"invalid"`
+	Sent    int `json:"sent"`
+	// Failed rows were valid but could not be published
+	Failed int `json:"failed"`
+	// Pending rows are not sent yet, the rows pending when a job is canceled are never sent
+	Pending int `json:"pending"`
+	// Errors are the errors of the first rows which are invalid or failed
+	Errors    []RowError `json:"errors"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ScheduledNotification is a notification waiting for its send_at, the content is left out
+type ScheduledNotification struct {
+	ID       string    `json:"id"`
+	SendAt   time.Time `json:"send_at"`
+	Channel  string    `json:"channel"`
+	Receiver string    `json:"receiver"`
+	Priority string    `json:"priority"`
+	Tenant   string    `json:"tenant,omitempty"`
+	Tags     []string  `json:"tags,omitempty"`
+	// ExpiresAt is resolved from the expires_at or ttl of the request when it was scheduled
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+type ScheduledPage struct {
+	Items  []ScheduledNotification `json:"items"`
+	Total  int                     `json:"total"`
+	Offset int                     `json:"offset"`
+	Limit  int                     `json:"limit"`
+}
+
+type RescheduleRequest struct {
+	SendAt *time.Time `json:"send_at" validate:"required"`
+}
+
+// RecurringRequest creates or replaces a recurring schedule
+type RecurringRequest struct {
+	// Cron is a standard 5 field cron expression, e.g. "0 9 * * 1-5" for every weekday at 09:00
+	Cron string `json:"cron"`
+	// Timezone is the IANA timezone the expression runs in, e.g. Europe/Sofia, it defaults to UTC
+	Timezone string `json:"timezone,omitempty"`
+	Paused   bool   `json:"paused,omitempty"`
+	// Notification is sent at every run, it cannot have a send_at
+	Notification NotificationRequest `json:"notification"`
+}
+
+type RecurringSchedule struct {
+	ID           string              `json:"id"`
+	Cron         string              `json:"cron"`
+	Timezone     string              `json:"timezone"`
+	Paused       bool                `json:"paused"`
+	Notification NotificationRequest `json:"notification"`
+	// NextRun is left out while the schedule is paused, LastRun until its first run
+	NextRun   *time.Time `json:"next_run,omitempty"`
+	LastRun   *time.Time `json:"last_run,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type RecurringPage struct {
+	Items  []RecurringSchedule `json:"items"`
+	Total  int                 `json:"total"`
+	Offset int                 `json:"offset"`
+	Limit  int                 `json:"limit"`
+}
+
+// PreviewRequest is a cron expression to preview before creating a recurring schedule
+type PreviewRequest struct {
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone,omitempty"`
+	// Count is the number of runs, it defaults to 5
+	Count int `json:"count,omitempty"`
+}
+
+type RecurringPreview struct {
+	NextRuns []time.Time `json:"next_runs"`
+}
+
+type DeadLetterPage struct {
+	Items  []types.DeadLetter `json:"items"`
+	Total  int                `json:"total"`
+	Offset int                `json:"offset"`
+	Limit  int                `json:"limit"`
+}
+
+type RequeueResult struct {
+	Requeued int `json:"requeued"`
+}
+
+type PurgeToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type PurgeResult struct {
+	Purged int `json:"purged"`
+}
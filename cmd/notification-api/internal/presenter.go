@@ -2,9 +2,13 @@ package notification
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"net/http"
 
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
 	"github.com/labstack/echo/v4"
 	"github.com/sirupsen/logrus"
 )
@@ -12,22 +16,39 @@ import (
 //go:generate mockgen --source=presenter.go --destination mocks/presenter.go --package mocks
 
 type Controller interface {
-	SendNotification(ctx context.Context, notification NotificationRequest) error
+	SendNotification(ctx context.Context, notification NotificationRequest) (string, error)
 }
 
 type Validator interface {
 	Struct(s interface{}) error
 }
 
+type IdempotencyStore interface {
+	Reserve(ctx context.Context, key, fingerprint string) (*idempotency.Response, error)
+	Complete(ctx context.Context, key string, response idempotency.Response) error
+	Release(ctx context.Context, key string) error
+}
+
+const (
+	HeaderIdempotencyKey = "Idempotency-Key"
+	// HeaderIdempotentReplayed is set on responses replayed for a retry
+	HeaderIdempotentReplayed = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
 type NotificationPresenter struct {
-	contoller Controller
-	validator Validator
+	contoller   Controller
+	validator   Validator
+	idempotency IdempotencyStore
 }
 
-func NewNotificationPresenter(cont Controller, validator Validator) *NotificationPresenter {
+// NewNotificationPresenter creates the presenter, with a nil idempotency store the Idempotency-Key header is ignored
+func NewNotificationPresenter(cont Controller, validator Validator, idempotency IdempotencyStore) *NotificationPresenter {
 	return &NotificationPresenter{
-		contoller: cont,
-		validator: validator,
+		contoller:   cont,
+		validator:   validator,
+		idempotency: idempotency,
 	}
 }
 
@@ -44,10 +65,69 @@ func (p *NotificationPresenter) HandleSendNotification(c echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to validate body")
 	}
 
-	if err := p.contoller.SendNotification(c.Request().Context(), request); err != nil {
+	ctx := c.Request().Context()
+
+	key := c.Request().Header.Get(HeaderIdempotencyKey)
+	if p.idempotency == nil {
+		key = ""
+	}
+	if key != "" {
+		if len(key) > maxIdempotencyKeyLength {
+			return echo.NewHTTPError(http.StatusBadRequest, "Idempotency-Key is too long")
+		}
+
+		response, err := p.idempotency.Reserve(ctx, key, fingerprintOf(request))
+		switch {
+		case errors.Is(err, idempotency.ErrInFlight):
+			return echo.NewHTTPError(http.StatusConflict, "A request with this Idempotency-Key is in progress")
+		case errors.Is(err, idempotency.ErrMismatch):
+			return echo.NewHTTPError(http.StatusUnprocessableEntity, "Idempotency-Key was used with a different request")
+		case err != nil:
+			logrus.Errorf("failed to reserve idempotency key: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to check Idempotency-Key")
+		case response != nil:
+			c.Response().Header().Set(HeaderIdempotentReplayed, "true")
+			return c.JSONBlob(response.Status, response.Body)
+		}
+	}
+
+	id, err := p.contoller.SendNotification(ctx, request)
+	if err != nil {
 		logrus.Errorf("failed to send notification: %v", err)
+		if key != "" {
+			// nothing was published, a retry with the same key sends the notification
+			if err := p.idempotency.Release(ctx, key); err != nil {
+				logrus.Errorf("failed to release idempotency key: %v", err)
+			}
+		}
+		if errors.Is(err, ErrSchedulingDisabled) {
+			return echo.NewHTTPError(http.StatusBadRequest, ErrSchedulingDisabled.Error())
+		}
+		if errors.Is(err, ErrInvalidExpiry) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
 		return echo.NewHTTPError(http.StatusBadRequest, "Failed to send notification")
 	}
 
-	return c.JSON(http.StatusAccepted, "notification request accepted")
+	response := SendResponse{ID: id, Status: "accepted"}
+	if request.SendAt != nil {
+		response.Status = "scheduled"
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	if key != "" {
+		if err := p.idempotency.Complete(ctx, key, idempotency.Response{Status: http.StatusAccepted, Body: body}); err != nil {
+			logrus.Errorf("failed to store idempotent response: %v", err)
+		}
+	}
+	return c.JSONBlob(http.StatusAccepted, body)
+}
+
+// fingerprintOf hashes the decoded request, so retries with a different formatting of the same body match
+func fingerprintOf(request NotificationRequest) string {
+	data, _ := json.Marshal(request)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
 }
@@ -4,11 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"time"
 
 	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
 	"github.com/golang/mock/gomock"
 	"github.com/labstack/echo/v4"
 	. "github.com/onsi/ginkgo/v2"
@@ -20,17 +23,20 @@ var _ = Describe("NotificationPresenter", func() {
 		mockCtrl            *gomock.Controller
 		mockValidator       *mocks.MockValidator
 		mockController      *mocks.MockController
+		mockIdempotency     *mocks.MockIdempotencyStore
 		presenter           *notification.NotificationPresenter
 		e                   *echo.Echo
 		notificationRequest notification.NotificationRequest
 		c                   echo.Context
+		recorder            *httptest.ResponseRecorder
 	)
 
 	BeforeEach(func() {
 		mockCtrl = gomock.NewController(GinkgoT())
 		mockValidator = mocks.NewMockValidator(mockCtrl)
 		mockController = mocks.NewMockController(mockCtrl)
-		presenter = notification.NewNotificationPresenter(mockController, mockValidator)
+		mockIdempotency = mocks.NewMockIdempotencyStore(mockCtrl)
+		presenter = notification.NewNotificationPresenter(mockController, mockValidator, mockIdempotency)
 		e = echo.New()
 		notificationRequest = notification.NotificationRequest{
 			Channel:  "email",
@@ -45,16 +51,67 @@ var _ = Describe("NotificationPresenter", func() {
 			requestBody, _ := json.Marshal(notificationRequest)
 			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(requestBody))
 			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
-			c = e.NewContext(req, httptest.NewRecorder())
+			recorder = httptest.NewRecorder()
+			c = e.NewContext(req, recorder)
 
 			mockValidator.EXPECT().Struct(notificationRequest).Return(nil)
-			mockController.EXPECT().SendNotification(gomock.Any(), gomock.Eq(notificationRequest)).Return(nil)
+			mockController.EXPECT().SendNotification(gomock.Any(), gomock.Eq(notificationRequest)).Return("3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c", nil)
 		})
 
-		It("should accept the notification request", func() {
+		It("should accept the notification request and return its id", func() {
 			err := presenter.HandleSendNotification(c)
 			Expect(err).ToNot(HaveOccurred())
 			Expect(c.Response().Status).To(Equal(http.StatusAccepted))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"id":"3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c","status":"accepted"}`))
+		})
+	})
+
+	When("the request has a send_at", func() {
+		BeforeEach(func() {
+			sendAt := time.Date(2026, 10, 20, 9, 0, 0, 0, time.UTC)
+			notificationRequest.SendAt = &sendAt
+			requestBody, _ := json.Marshal(notificationRequest)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			recorder = httptest.NewRecorder()
+			c = e.NewContext(req, recorder)
+
+			mockValidator.EXPECT().Struct(gomock.Any()).Return(nil)
+		})
+
+		It("should respond that the notification is scheduled", func() {
+			mockController.EXPECT().SendNotification(gomock.Any(), gomock.Any()).Return("3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c", nil)
+
+			Expect(presenter.HandleSendNotification(c)).To(Succeed())
+			Expect(c.Response().Status).To(Equal(http.StatusAccepted))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"id":"3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c","status":"scheduled"}`))
+		})
+
+		It("should reject it when scheduled sends are disabled", func() {
+			mockController.EXPECT().SendNotification(gomock.Any(), gomock.Any()).Return("", notification.ErrSchedulingDisabled)
+
+			err := presenter.HandleSendNotification(c)
+			Expect(err).To(Equal(echo.NewHTTPError(http.StatusBadRequest, notification.ErrSchedulingDisabled.Error())))
+		})
+	})
+
+	When("the request has an invalid expiry", func() {
+		BeforeEach(func() {
+			notificationRequest.TTL = "soon"
+			requestBody, _ := json.Marshal(notificationRequest)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			c = e.NewContext(req, httptest.NewRecorder())
+
+			mockValidator.EXPECT().Struct(gomock.Any()).Return(nil)
+		})
+
+		It("should reject it with the reason", func() {
+			cause := fmt.Errorf("%w: time: invalid duration \"soon\"", notification.ErrInvalidExpiry)
+			mockController.EXPECT().SendNotification(gomock.Any(), gomock.Any()).Return("", cause)
+
+			err := presenter.HandleSendNotification(c)
+			Expect(err).To(Equal(echo.NewHTTPError(http.StatusBadRequest, cause.Error())))
 		})
 	})
 
@@ -76,6 +133,108 @@ var _ = Describe("NotificationPresenter", func() {
 		})
 	})
 
+	Context("with an Idempotency-Key", func() {
+		BeforeEach(func() {
+			requestBody, _ := json.Marshal(notificationRequest)
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBuffer(requestBody))
+			req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+			req.Header.Set(notification.HeaderIdempotencyKey, "key-1")
+			recorder = httptest.NewRecorder()
+			c = e.NewContext(req, recorder)
+
+			mockValidator.EXPECT().Struct(notificationRequest).Return(nil)
+		})
+
+		When("the key is new", func() {
+			BeforeEach(func() {
+				mockIdempotency.EXPECT().Reserve(gomock.Any(), "key-1", gomock.Any()).Return(nil, nil)
+				mockController.EXPECT().SendNotification(gomock.Any(), notificationRequest).Return("id-1", nil)
+				mockIdempotency.EXPECT().Complete(gomock.Any(), "key-1", idempotency.Response{
+					Status: http.StatusAccepted,
+					Body:   []byte(`{"id":"id-1","status":"accepted"}`),
+				}).Return(nil)
+			})
+
+			It("should send the notification and store the response", func() {
+				Expect(presenter.HandleSendNotification(c)).To(Succeed())
+				Expect(recorder.Code).To(Equal(http.StatusAccepted))
+				Expect(recorder.Header().Get(notification.HeaderIdempotentReplayed)).To(BeEmpty())
+			})
+		})
+
+		When("the key was completed", func() {
+			BeforeEach(func() {
+				mockIdempotency.EXPECT().Reserve(gomock.Any(), "key-1", gomock.Any()).
+					Return(&idempotency.Response{Status: http.StatusAccepted, Body: []byte(`{"id":"id-1","status":"accepted"}`)}, nil)
+			})
+
+			It("should replay the response without sending", func() {
+				Expect(presenter.HandleSendNotification(c)).To(Succeed())
+				Expect(recorder.Code).To(Equal(http.StatusAccepted))
+				Expect(recorder.Body.String()).To(Equal(`{"id":"id-1","status":"accepted"}`))
+				Expect(recorder.Header().Get(notification.HeaderIdempotentReplayed)).To(Equal("true"))
+			})
+		})
+
+		When("a request with the key is in flight", func() {
+			BeforeEach(func() {
+				mockIdempotency.EXPECT().Reserve(gomock.Any(), "key-1", gomock.Any()).Return(nil, idempotency.ErrInFlight)
+			})
+
+			It("should return a conflict", func() {
+				err := presenter.HandleSendNotification(c)
+				Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+				Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusConflict))
+			})
+		})
+
+		When("the key was used with a different request", func() {
+			BeforeEach(func() {
+				mockIdempotency.EXPECT().Reserve(gomock.Any(), "key-1", gomock.Any()).Return(nil, idempotency.ErrMismatch)
+			})
+
+			It("should return unprocessable entity", func() {
+				err := presenter.HandleSendNotification(c)
+				Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+				Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusUnprocessableEntity))
+			})
+		})
+
+		When("sending fails", func() {
+			BeforeEach(func() {
+				mockIdempotency.EXPECT().Reserve(gomock.Any(), "key-1", gomock.Any()).Return(nil, nil)
+				mockController.EXPECT().SendNotification(gomock.Any(), notificationRequest).Return("", errors.New("broker error"))
+				mockIdempotency.EXPECT().Release(gomock.Any(), "key-1").Return(nil)
+			})
+
+			It("should release the key for a retry", func() {
+				err := presenter.HandleSendNotification(c)
+				Expect(err).To(HaveOccurred())
+			})
+		})
+	})
+
+	It("should fingerprint equal requests alike regardless of their formatting", func() {
+		store := idempotency.NewMemoryStore(time.Hour)
+		presenter = notification.NewNotificationPresenter(mockController, mockValidator, store)
+		mockValidator.EXPECT().Struct(gomock.Any()).Return(nil).Times(3)
+		mockController.EXPECT().SendNotification(gomock.Any(), gomock.Any()).Return("id-1", nil).Times(1)
+
+		post := func(body string) int {
+			req := httptest.NewRequest(http.MethodPost, "/send", bytes.NewBufferString(body))
+			req.Header.Set(notification.HeaderIdempotencyKey, "key-1")
+			recorder := httptest.NewRecorder()
+			if err := presenter.HandleSendNotification(e.NewContext(req, recorder)); err != nil {
+				return err.(*echo.HTTPError).Code
+			}
+			return recorder.Code
+		}
+
+		Expect(post(`{"channel":"email","content":"hi","receiver":"a@example.com"}`)).To(Equal(http.StatusAccepted))
+		Expect(post(`{ "receiver": "a@example.com", "content": "hi", "channel": "email" }`)).To(Equal(http.StatusAccepted))
+		Expect(post(`{"channel":"email","content":"bye","receiver":"a@example.com"}`)).To(Equal(http.StatusUnprocessableEntity))
+	})
+
 	AfterEach(func() {
 		mockCtrl.Finish()
 	})
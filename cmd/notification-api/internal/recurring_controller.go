@@ -0,0 +1,267 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=recurring_controller.go --destination mocks/recurring_controller.go --package mocks
+
+var (
+	ErrInvalidRecurring  = errors.New("invalid recurring schedule")
+	ErrRecurringNotFound = errors.New("recurring schedule not found")
+)
+
+// RecurringStore keeps the recurring schedules, it is implemented by the stores of pkg/recurring
+type RecurringStore interface {
+	Create(ctx context.Context, schedule recurring.Schedule) error
+	Get(ctx context.Context, id string) (recurring.Schedule, error)
+	List(ctx context.Context, query recurring.Query) (recurring.Page, error)
+	Update(ctx context.Context, schedule recurring.Schedule) error
+	Delete(ctx context.Context, id string) error
+}
+
+type RecurringController struct {
+	store RecurringStore
+}
+
+func NewRecurringController(store RecurringStore) *RecurringController {
+	return &RecurringController{
+		store: store,
+	}
+}
+
+func (c *RecurringController) CreateRecurring(ctx context.Context, request RecurringRequest) (RecurringSchedule, error) {
+	cron, notification, err := parseRecurring(&request)
+	if err != nil {
+		return RecurringSchedule{}, err
+	}
+
+	now := time.Now()
+	schedule := recurring.Schedule{
+		ID:           types.NewMessageID(),
+		Cron:         request.Cron,
+		Timezone:     request.Timezone,
+		Channel:      request.Notification.Channel,
+		Tenant:       request.Notification.Tenant,
+		Notification: notification,
+		Paused:       request.Paused,
+		NextRun:      cron.Next(now),
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	if err := c.store.Create(ctx, schedule); err != nil {
+		return RecurringSchedule{}, fmt.Errorf("error creating recurring schedule: %v", err)
+	}
+	return recurringSchedule(schedule)
+}
+
+func (c *RecurringController) GetRecurring(ctx context.Context, id string) (RecurringSchedule, error) {
+	schedule, err := c.get(ctx, id)
+	if err != nil {
+		return RecurringSchedule{}, err
+	}
+	return recurringSchedule(schedule)
+}
+
+// ListRecurring returns a page of the schedules ordered by their creation
+func (c *RecurringController) ListRecurring(ctx context.Context, query recurring.Query) (RecurringPage, error) {
+	page, err := c.store.List(ctx, query)
+	if err != nil {
+		return RecurringPage{}, fmt.Errorf("error listing recurring schedules: %v", err)
+	}
+
+	result := RecurringPage{Items: make([]RecurringSchedule, 0, len(page.Schedules)), Total: page.Total, Offset: query.Offset, Limit: query.Limit}
+	for _, schedule := range page.Schedules {
+		item, err := recurringSchedule(schedule)
+		if err != nil {
+			return RecurringPage{}, err
+		}
+		result.Items = append(result.Items, item)
+	}
+	return result, nil
+}
+
+// UpdateRecurring replaces the schedule. The next run moves when the cron expression or the timezone
+// change, or the schedule is resumed, the runs missed while it was paused are never sent.
+func (c *RecurringController) UpdateRecurring(ctx context.Context, id string, request RecurringRequest) (RecurringSchedule, error) {
+	cron, notification, err := parseRecurring(&request)
+	if err != nil {
+		return RecurringSchedule{}, err
+	}
+	schedule, err := c.get(ctx, id)
+	if err != nil {
+		return RecurringSchedule{}, err
+	}
+
+	now := time.Now()
+	if request.Cron != schedule.Cron || request.Timezone != schedule.Timezone || schedule.Paused {
+		schedule.NextRun = cron.Next(now)
+	}
+	schedule.Cron = request.Cron
+	schedule.Timezone = request.Timezone
+	schedule.Channel = request.Notification.Channel
+	schedule.Tenant = request.Notification.Tenant
+	schedule.Notification = notification
+	schedule.Paused = request.Paused
+	schedule.UpdatedAt = now
+
+	err = c.store.Update(ctx, schedule)
+	if errors.Is(err, recurring.ErrNotFound) {
+		return RecurringSchedule{}, ErrRecurringNotFound
+	}
+	if err != nil {
+		return RecurringSchedule{}, fmt.Errorf("error updating recurring schedule: %v", err)
+	}
+	return recurringSchedule(schedule)
+}
+
+// DeleteRecurring removes the schedule, a notification of it which is being sent is still delivered
+func (c *RecurringController) DeleteRecurring(ctx context.Context, id string) error {
+	err := c.store.Delete(ctx, id)
+	if errors.Is(err, recurring.ErrNotFound) {
+		return ErrRecurringNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error deleting recurring schedule: %v", err)
+	}
+	return nil
+}
+
+// NextRuns returns the next count runs of the schedule, a paused schedule has none
+func (c *RecurringController) NextRuns(ctx context.Context, id string, count int) ([]time.Time, error) {
+	schedule, err := c.get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if schedule.Paused {
+		return []time.Time{}, nil
+	}
+
+	cron, err := recurring.ParseCron(schedule.Cron, schedule.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing recurring schedule %s: %v", id, err)
+	}
+	// the runs start at the next run, it may be due and not sent yet
+	return cron.NextRuns(schedule.NextRun.Add(-time.Second), count), nil
+}
+
+// PreviewRecurring returns the next count runs of a cron expression in the timezone
+func (c *RecurringController) PreviewRecurring(expression, timezone string, count int) ([]time.Time, error) {
+	cron, err := recurring.ParseCron(expression, timezone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidRecurring, err)
+	}
+	return cron.NextRuns(time.Now(), count), nil
+}
+
+func (c *RecurringController) get(ctx context.Context, id string) (recurring.Schedule, error) {
+	schedule, err := c.store.Get(ctx, id)
+	if errors.Is(err, recurring.ErrNotFound) {
+		return recurring.Schedule{}, ErrRecurringNotFound
+	}
+	if err != nil {
+		return recurring.Schedule{}, fmt.Errorf("error getting recurring schedule: %v", err)
+	}
+	return schedule, nil
+}
+
+// NewRecurringSend returns the function sending the occurrences of the recurring schedules with the
+// notification ids the runner assigned to them, the runner sends occurrences which fail again
+func NewRecurringSend(broker MessageBroker, recorder StatusRecorder) recurring.SendFunc {
+	controller := NewNotificationController(broker, recorder, nil)
+	return func(ctx context.Context, occurrence recurring.Occurrence) error {
+		var request NotificationRequest
+		if err := json.Unmarshal(occurrence.Notification, &request); err != nil {
+			// a corrupt occurrence can never be sent, drop it instead of retrying forever
+			logrus.Errorf("dropping unreadable occurrence of recurring schedule %s: %v", occurrence.ScheduleID, err)
+			return nil
+		}
+		message, err := controller.accept(ctx, occurrence.NotificationID, request, "")
+		if err != nil {
+			logrus.Errorf("dropping occurrence of recurring schedule %s: %v", occurrence.ScheduleID, err)
+			return nil
+		}
+
+		err = broker.Send(ctx, message)
+		if errors.Is(err, types.ErrUnsupportedChannel) {
+			logrus.Errorf("dropping occurrence of recurring schedule %s: %v", occurrence.ScheduleID, controller.rejected(ctx, message.ID, err))
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if recorder != nil {
+			recorder.Queued(ctx, message.ID)
+		}
+		return nil
+	}
+}
+
+// parseRecurring checks the cron expression and the notification of the request, it defaults its
+// timezone to UTC and returns the notification as stored
+func parseRecurring(request *RecurringRequest) (recurring.Cron, []byte, error) {
+	if request.Timezone == "" {
+		request.Timezone = "UTC"
+	}
+	cron, err := recurring.ParseCron(request.Cron, request.Timezone)
+	if err != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("%w: %v", ErrInvalidRecurring, err)
+	}
+	if request.Notification.SendAt != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("%w: the notification cannot have a send_at", ErrInvalidRecurring)
+	}
+	// the ttl starts over at every run, a fixed expiry would expire all the runs after it
+	if request.Notification.ExpiresAt != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("%w: the notification cannot have an expires_at, use a ttl", ErrInvalidRecurring)
+	}
+	if _, err := expiryOf(request.Notification, time.Now()); err != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("%w: %v", ErrInvalidRecurring, err)
+	}
+	if _, err := types.ParsePriority(request.Notification.Priority); err != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("%w: %v", ErrInvalidRecurring, err)
+	}
+
+	notification, err := json.Marshal(request.Notification)
+	if err != nil {
+		return recurring.Cron{}, nil, fmt.Errorf("error marshaling notification: %v", err)
+	}
+	return cron, notification, nil
+}
+
+// recurringSchedule describes a stored schedule
+func recurringSchedule(schedule recurring.Schedule) (RecurringSchedule, error) {
+	result := RecurringSchedule{
+		ID:        schedule.ID,
+		Cron:      schedule.Cron,
+		Timezone:  schedule.Timezone,
+		Paused:    schedule.Paused,
+		CreatedAt: schedule.CreatedAt,
+		UpdatedAt: schedule.UpdatedAt,
+	}
+	if err := json.Unmarshal(schedule.Notification, &result.Notification); err != nil {
+		return RecurringSchedule{}, fmt.Errorf("error unmarshaling recurring schedule %s: %v", schedule.ID, err)
+	}
+
+	location, err := time.LoadLocation(schedule.Timezone)
+	if err != nil {
+		location = time.UTC
+	}
+	if !schedule.Paused {
+		nextRun := schedule.NextRun.In(location)
+		result.NextRun = &nextRun
+	}
+	if !schedule.LastRun.IsZero() {
+		lastRun := schedule.LastRun.In(location)
+		result.LastRun = &lastRun
+	}
+	return result, nil
+}
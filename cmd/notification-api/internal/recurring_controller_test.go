@@ -0,0 +1,224 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RecurringController", func() {
+	var (
+		store      *recurring.MemoryStore
+		controller *notification.RecurringController
+		ctx        context.Context
+		request    notification.RecurringRequest
+	)
+
+	BeforeEach(func() {
+		store = recurring.NewMemoryStore()
+		controller = notification.NewRecurringController(store)
+		ctx = context.Background()
+		request = notification.RecurringRequest{
+			Cron:     "0 9 * * 1-5",
+			Timezone: "Europe/Sofia",
+			Notification: notification.NotificationRequest{
+				Channel:  "slack",
+				Content:  "Standup in 15 minutes",
+				Receiver: "#team",
+				Tenant:   "acme",
+			},
+		}
+	})
+
+	When("creating a recurring schedule", func() {
+		It("should store it with its next run", func() {
+			created, err := controller.CreateRecurring(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.ID).NotTo(BeEmpty())
+			Expect(created.Notification).To(Equal(request.Notification))
+			Expect(created.NextRun).NotTo(BeNil())
+			Expect(created.NextRun.Location().String()).To(Equal("Europe/Sofia"))
+			Expect(created.NextRun.Hour()).To(Equal(9))
+			Expect(created.LastRun).To(BeNil())
+
+			stored, err := store.Get(ctx, created.ID)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(stored.Channel).To(Equal("slack"))
+			Expect(stored.Tenant).To(Equal("acme"))
+		})
+
+		It("should default the timezone to UTC", func() {
+			request.Timezone = ""
+			created, err := controller.CreateRecurring(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(created.Timezone).To(Equal("UTC"))
+		})
+
+		DescribeTable("should reject", func(change func(), message string) {
+			change()
+			_, err := controller.CreateRecurring(ctx, request)
+			Expect(err).To(MatchError(notification.ErrInvalidRecurring))
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		},
+			Entry("an invalid cron expression", func() { request.Cron = "every day" }, "invalid cron expression"),
+			Entry("an unknown timezone", func() { request.Timezone = "Mars/Olympus" }, "unknown timezone"),
+			Entry("a notification with a send_at", func() {
+				sendAt := time.Now()
+				request.Notification.SendAt = &sendAt
+			}, "cannot have a send_at"),
+			Entry("a notification with an expires_at", func() {
+				expiresAt := time.Now().Add(time.Hour)
+				request.Notification.ExpiresAt = &expiresAt
+			}, "use a ttl"),
+			Entry("an invalid ttl", func() { request.Notification.TTL = "-5m" }, "ttl has to be positive"),
+		)
+	})
+
+	When("updating a recurring schedule", func() {
+		var created notification.RecurringSchedule
+
+		BeforeEach(func() {
+			var err error
+			created, err = controller.CreateRecurring(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("should move the next run with the cron expression", func() {
+			request.Cron = "30 17 * * 1-5"
+			updated, err := controller.UpdateRecurring(ctx, created.ID, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.NextRun.Hour()).To(Equal(17))
+			Expect(updated.NextRun.Minute()).To(Equal(30))
+		})
+
+		It("should leave out the next run while it is paused", func() {
+			request.Paused = true
+			updated, err := controller.UpdateRecurring(ctx, created.ID, request)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(updated.Paused).To(BeTrue())
+			Expect(updated.NextRun).To(BeNil())
+
+			runs, err := controller.NextRuns(ctx, created.ID, 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runs).To(BeEmpty())
+		})
+
+		It("should not find an unknown schedule", func() {
+			_, err := controller.UpdateRecurring(ctx, "unknown", request)
+			Expect(err).To(MatchError(notification.ErrRecurringNotFound))
+		})
+	})
+
+	When("previewing the next runs", func() {
+		It("should start at the next run of a schedule", func() {
+			created, err := controller.CreateRecurring(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			runs, err := controller.NextRuns(ctx, created.ID, 5)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runs).To(HaveLen(5))
+			Expect(runs[0]).To(BeTemporally("==", *created.NextRun))
+			for _, run := range runs {
+				Expect(run.Weekday()).NotTo(BeElementOf(time.Saturday, time.Sunday))
+			}
+		})
+
+		It("should preview an expression without a schedule", func() {
+			runs, err := controller.PreviewRecurring("0 0 1 * *", "UTC", 3)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(runs).To(HaveLen(3))
+			Expect(runs[1].Day()).To(Equal(1))
+
+			_, err = controller.PreviewRecurring("0 0 1 *", "UTC", 3)
+			Expect(err).To(MatchError(notification.ErrInvalidRecurring))
+		})
+	})
+
+	When("deleting a recurring schedule", func() {
+		It("should remove it", func() {
+			created, err := controller.CreateRecurring(ctx, request)
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(controller.DeleteRecurring(ctx, created.ID)).To(Succeed())
+			_, err = controller.GetRecurring(ctx, created.ID)
+			Expect(err).To(MatchError(notification.ErrRecurringNotFound))
+			Expect(controller.DeleteRecurring(ctx, created.ID)).To(MatchError(notification.ErrRecurringNotFound))
+		})
+	})
+
+	When("an occurrence is sent", func() {
+		var (
+			mockCtrl     *gomock.Controller
+			mockBroker   *mocks.MockMessageBroker
+			mockRecorder *mocks.MockStatusRecorder
+			send         recurring.SendFunc
+			occurrence   recurring.Occurrence
+		)
+
+		BeforeEach(func() {
+			mockCtrl = gomock.NewController(GinkgoT())
+			mockBroker = mocks.NewMockMessageBroker(mockCtrl)
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			send = notification.NewRecurringSend(mockBroker, mockRecorder)
+			occurrence = recurring.Occurrence{
+				ScheduleID:     "schedule-1",
+				Time:           time.Now(),
+				NotificationID: "occurrence-1",
+				Notification:   []byte(`{"channel":"slack","content":"Standup in 15 minutes","receiver":"#team","tenant":"acme"}`),
+			}
+		})
+
+		AfterEach(func() {
+			mockCtrl.Finish()
+		})
+
+		It("should publish it with the id of the occurrence", func() {
+			mockRecorder.EXPECT().Accepted(ctx, status.Notification{ID: "occurrence-1", Channel: "slack", Receiver: "#team", Priority: "normal", Tenant: "acme"})
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message types.Message) error {
+				Expect(message.ID).To(Equal("occurrence-1"))
+				Expect(message.Channel).To(Equal("slack"))
+				Expect(string(message.Payload)).To(ContainSubstring(`"content":"Standup in 15 minutes"`))
+				return nil
+			})
+			mockRecorder.EXPECT().Queued(ctx, "occurrence-1")
+
+			Expect(send(ctx, occurrence)).To(Succeed())
+		})
+
+		It("should publish it expiring after the ttl of its notification", func() {
+			occurrence.Notification = []byte(`{"channel":"slack","content":"Standup in 15 minutes","receiver":"#team","ttl":"15m"}`)
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any())
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message types.Message) error {
+				Expect(message.ExpiresAt).To(BeTemporally("~", time.Now().Add(15*time.Minute), time.Second))
+				return nil
+			})
+			mockRecorder.EXPECT().Queued(ctx, "occurrence-1")
+
+			Expect(send(ctx, occurrence)).To(Succeed())
+		})
+
+		It("should fail so the occurrence is sent again when publishing fails", func() {
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any())
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(errors.New("connection closed"))
+
+			Expect(send(ctx, occurrence)).To(MatchError("connection closed"))
+		})
+
+		It("should drop it when its channel is not supported", func() {
+			mockRecorder.EXPECT().Accepted(ctx, gomock.Any())
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(types.ErrUnsupportedChannel)
+			mockRecorder.EXPECT().Rejected(ctx, "occurrence-1", gomock.Any())
+
+			Expect(send(ctx, occurrence)).To(Succeed())
+		})
+	})
+})
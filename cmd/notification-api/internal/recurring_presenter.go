@@ -0,0 +1,171 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=recurring_presenter.go --destination mocks/recurring_presenter.go --package mocks
+
+const (
+	defaultRecurringLimit = 50
+	maxRecurringLimit     = 500
+	defaultPreviewCount   = 5
+	maxPreviewCount       = 100
+)
+
+type RecurringSchedules interface {
+	CreateRecurring(ctx context.Context, request RecurringRequest) (RecurringSchedule, error)
+	GetRecurring(ctx context.Context, id string) (RecurringSchedule, error)
+	ListRecurring(ctx context.Context, query recurring.Query) (RecurringPage, error)
+	UpdateRecurring(ctx context.Context, id string, request RecurringRequest) (RecurringSchedule, error)
+	DeleteRecurring(ctx context.Context, id string) error
+	NextRuns(ctx context.Context, id string, count int) ([]time.Time, error)
+	PreviewRecurring(expression, timezone string, count int) ([]time.Time, error)
+}
+
+type RecurringPresenter struct {
+	schedules RecurringSchedules
+	validator Validator
+}
+
+func NewRecurringPresenter(schedules RecurringSchedules, validator Validator) *RecurringPresenter {
+	return &RecurringPresenter{
+		schedules: schedules,
+		validator: validator,
+	}
+}
+
+func (p *RecurringPresenter) HandleCreateRecurring(c echo.Context) error {
+	request, err := p.decode(c)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := p.schedules.CreateRecurring(c.Request().Context(), request)
+	if err != nil {
+		return recurringError("failed to create recurring schedule", err)
+	}
+	return c.JSON(http.StatusCreated, schedule)
+}
+
+// HandleListRecurring lists the recurring schedules, optionally of a channel or tenant
+func (p *RecurringPresenter) HandleListRecurring(c echo.Context) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid offset")
+	}
+	limit, err := queryInt(c, "limit", defaultRecurringLimit)
+	if err != nil || limit < 1 || limit > maxRecurringLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+	}
+
+	page, err := p.schedules.ListRecurring(c.Request().Context(), recurring.Query{
+		Channel: c.QueryParam("channel"),
+		Tenant:  c.QueryParam("tenant"),
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return recurringError("failed to list recurring schedules", err)
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func (p *RecurringPresenter) HandleGetRecurring(c echo.Context) error {
+	schedule, err := p.schedules.GetRecurring(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return recurringError("failed to get recurring schedule", err)
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+// HandleUpdateRecurring replaces the schedule with the body, it pauses and resumes schedules as well
+func (p *RecurringPresenter) HandleUpdateRecurring(c echo.Context) error {
+	request, err := p.decode(c)
+	if err != nil {
+		return err
+	}
+
+	schedule, err := p.schedules.UpdateRecurring(c.Request().Context(), c.Param("id"), request)
+	if err != nil {
+		return recurringError("failed to update recurring schedule", err)
+	}
+	return c.JSON(http.StatusOK, schedule)
+}
+
+func (p *RecurringPresenter) HandleDeleteRecurring(c echo.Context) error {
+	if err := p.schedules.DeleteRecurring(c.Request().Context(), c.Param("id")); err != nil {
+		return recurringError("failed to delete recurring schedule", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleNextRuns previews the next runs of a schedule, as many as the count query parameter
+func (p *RecurringPresenter) HandleNextRuns(c echo.Context) error {
+	count, err := queryInt(c, "count", defaultPreviewCount)
+	if err != nil || count < 1 || count > maxPreviewCount {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid count")
+	}
+
+	runs, err := p.schedules.NextRuns(c.Request().Context(), c.Param("id"), count)
+	if err != nil {
+		return recurringError("failed to get next runs", err)
+	}
+	return c.JSON(http.StatusOK, RecurringPreview{NextRuns: runs})
+}
+
+// HandlePreviewRecurring previews the next runs of the cron expression of the body without creating a schedule
+func (p *RecurringPresenter) HandlePreviewRecurring(c echo.Context) error {
+	var request PreviewRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		logrus.Errorf("failed to decode body: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	if request.Count == 0 {
+		request.Count = defaultPreviewCount
+	}
+	if request.Count < 1 || request.Count > maxPreviewCount {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid count")
+	}
+
+	runs, err := p.schedules.PreviewRecurring(request.Cron, request.Timezone, request.Count)
+	if err != nil {
+		return recurringError("failed to preview recurring schedule", err)
+	}
+	return c.JSON(http.StatusOK, RecurringPreview{NextRuns: runs})
+}
+
+// decode reads the schedule of the body and validates its notification like the ones of /send
+func (p *RecurringPresenter) decode(c echo.Context) (RecurringRequest, error) {
+	var request RecurringRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		logrus.Errorf("failed to decode body: %v", err)
+		return RecurringRequest{}, echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	if err := validateNotification(p.validator, request.Notification); err != nil {
+		logrus.Errorf("failed to validate body: %v", err)
+		return RecurringRequest{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid notification: "+err.Error())
+	}
+	return request, nil
+}
+
+func recurringError(msg string, err error) error {
+	logrus.Errorf("%s: %v", msg, err)
+
+	switch {
+	case errors.Is(err, ErrInvalidRecurring):
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	case errors.Is(err, ErrRecurringNotFound):
+		return echo.NewHTTPError(http.StatusNotFound, "Recurring schedule not found")
+	default:
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to access recurring schedules")
+	}
+}
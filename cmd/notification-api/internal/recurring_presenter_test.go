@@ -0,0 +1,142 @@
+package notification_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("RecurringPresenter", func() {
+	var (
+		mockCtrl      *gomock.Controller
+		mockSchedules *mocks.MockRecurringSchedules
+		presenter     *notification.RecurringPresenter
+		recorder      *httptest.ResponseRecorder
+	)
+
+	const body = `{"cron":"0 9 * * 1-5","timezone":"Europe/Sofia","notification":{"channel":"slack","content":"Standup in 15 minutes","receiver":"#team"}}`
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockSchedules = mocks.NewMockRecurringSchedules(mockCtrl)
+		structValidator := validator.New()
+		structValidator.RegisterTagNameFunc(notification.JSONFieldName)
+		presenter = notification.NewRecurringPresenter(mockSchedules, structValidator)
+		recorder = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	request := func(method, target, body string, id string) echo.Context {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(req, recorder)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		return c
+	}
+
+	expectStatus := func(err error, status int) {
+		var httpError *echo.HTTPError
+		Expect(err).To(BeAssignableToTypeOf(httpError))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(status))
+	}
+
+	When("creating a recurring schedule", func() {
+		It("should respond with the created schedule", func() {
+			mockSchedules.EXPECT().CreateRecurring(gomock.Any(), notification.RecurringRequest{
+				Cron:     "0 9 * * 1-5",
+				Timezone: "Europe/Sofia",
+				Notification: notification.NotificationRequest{
+					Channel:  "slack",
+					Content:  "Standup in 15 minutes",
+					Receiver: "#team",
+				},
+			}).Return(notification.RecurringSchedule{ID: "schedule-1", Cron: "0 9 * * 1-5"}, nil)
+
+			Expect(presenter.HandleCreateRecurring(request(http.MethodPost, "/recurring", body, ""))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusCreated))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"id":"schedule-1"`))
+		})
+
+		It("should reject an invalid notification", func() {
+			err := presenter.HandleCreateRecurring(request(http.MethodPost, "/recurring", `{"cron":"0 9 * * *","notification":{"channel":"slack"}}`, ""))
+			expectStatus(err, http.StatusBadRequest)
+			Expect(err.(*echo.HTTPError).Message).To(Equal("Invalid notification: invalid content: required, invalid receiver: required"))
+		})
+
+		It("should respond with the reason an expression is rejected", func() {
+			mockSchedules.EXPECT().CreateRecurring(gomock.Any(), gomock.Any()).
+				Return(notification.RecurringSchedule{}, fmt.Errorf("%w: unknown timezone \"Europe/Atlantis\"", notification.ErrInvalidRecurring))
+
+			err := presenter.HandleCreateRecurring(request(http.MethodPost, "/recurring", body, ""))
+			expectStatus(err, http.StatusBadRequest)
+			Expect(err.(*echo.HTTPError).Message).To(Equal(`invalid recurring schedule: unknown timezone "Europe/Atlantis"`))
+		})
+	})
+
+	When("listing the recurring schedules", func() {
+		It("should pass the filters and the page", func() {
+			mockSchedules.EXPECT().ListRecurring(gomock.Any(), recurring.Query{Channel: "slack", Tenant: "acme", Offset: 10, Limit: 5}).
+				Return(notification.RecurringPage{Items: []notification.RecurringSchedule{}, Total: 10, Offset: 10, Limit: 5}, nil)
+
+			Expect(presenter.HandleListRecurring(request(http.MethodGet, "/recurring?channel=slack&tenant=acme&offset=10&limit=5", "", ""))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"items":[],"total":10,"offset":10,"limit":5}`))
+		})
+	})
+
+	When("updating a recurring schedule", func() {
+		It("should respond with not found for an unknown schedule", func() {
+			mockSchedules.EXPECT().UpdateRecurring(gomock.Any(), "unknown", gomock.Any()).Return(notification.RecurringSchedule{}, notification.ErrRecurringNotFound)
+
+			expectStatus(presenter.HandleUpdateRecurring(request(http.MethodPut, "/recurring/unknown", body, "unknown")), http.StatusNotFound)
+		})
+	})
+
+	When("deleting a recurring schedule", func() {
+		It("should respond without content", func() {
+			mockSchedules.EXPECT().DeleteRecurring(gomock.Any(), "schedule-1").Return(nil)
+
+			Expect(presenter.HandleDeleteRecurring(request(http.MethodDelete, "/recurring/schedule-1", "", "schedule-1"))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	When("previewing the next runs", func() {
+		run := time.Date(2026, 10, 19, 9, 0, 0, 0, time.UTC)
+
+		It("should respond with the runs of a schedule", func() {
+			mockSchedules.EXPECT().NextRuns(gomock.Any(), "schedule-1", 2).Return([]time.Time{run, run.Add(24 * time.Hour)}, nil)
+
+			Expect(presenter.HandleNextRuns(request(http.MethodGet, "/recurring/schedule-1/next?count=2", "", "schedule-1"))).To(Succeed())
+			Expect(recorder.Body.String()).To(MatchJSON(`{"next_runs":["2026-10-19T09:00:00Z","2026-10-20T09:00:00Z"]}`))
+		})
+
+		It("should preview an expression with the default count", func() {
+			mockSchedules.EXPECT().PreviewRecurring("0 9 * * *", "", 5).Return([]time.Time{run}, nil)
+
+			Expect(presenter.HandlePreviewRecurring(request(http.MethodPost, "/recurring/preview", `{"cron":"0 9 * * *"}`, ""))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		})
+
+		It("should reject too many runs", func() {
+			expectStatus(presenter.HandleNextRuns(request(http.MethodGet, "/recurring/schedule-1/next?count=1000", "", "schedule-1")), http.StatusBadRequest)
+		})
+	})
+})
@@ -0,0 +1,226 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduler"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=schedule_controller.go --destination mocks/schedule_controller.go --package mocks
+
+var (
+	ErrSchedulingDisabled = errors.New("send_at is not supported, scheduled sends are disabled")
+	ErrScheduledNotFound  = errors.New("scheduled notification not found")
+)
+
+// ScheduledStore keeps the scheduled notifications until their send_at, it is implemented by the stores of pkg/scheduled
+type ScheduledStore interface {
+	Create(ctx context.Context, notification scheduled.Notification) error
+	Get(ctx context.Context, id string) (scheduled.Notification, error)
+	List(ctx context.Context, query scheduled.Query) (scheduled.Page, error)
+	Reschedule(ctx context.Context, id string, sendAt, now time.Time) (scheduled.Notification, error)
+	Cancel(ctx context.Context, id string, now time.Time) error
+}
+
+// scheduledMessage is the message of a scheduled notification kept in the schedule store
+type scheduledMessage struct {
+	Channel  string         `json:"channel"`
+	Priority types.Priority `json:"priority"`
+	Payload  []byte         `json:"payload"`
+	// ExpiresAt is zero for notifications which never expire
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ScheduleController struct {
+	store    ScheduledStore
+	recorder StatusRecorder
+}
+
+// NewScheduleController creates the controller, with a nil recorder the status of notifications is not tracked
+func NewScheduleController(store ScheduledStore, recorder StatusRecorder) *ScheduleController {
+	return &ScheduleController{
+		store:    store,
+		recorder: recorder,
+	}
+}
+
+// ListScheduled returns a page of the pending notifications ordered by their send_at
+func (c *ScheduleController) ListScheduled(ctx context.Context, query scheduled.Query) (ScheduledPage, error) {
+	page, err := c.store.List(ctx, query)
+	if err != nil {
+		return ScheduledPage{}, fmt.Errorf("error listing scheduled notifications: %v", err)
+	}
+
+	items := []ScheduledNotification{}
+	for _, n := range page.Notifications {
+		item, err := scheduledNotification(n)
+		if err != nil {
+			logrus.Errorf("failed to read scheduled notification: %v", err)
+			continue
+		}
+		items = append(items, item)
+	}
+	return ScheduledPage{Items: items, Total: page.Total, Offset: query.Offset, Limit: query.Limit}, nil
+}
+
+func (c *ScheduleController) GetScheduled(ctx context.Context, id string) (ScheduledNotification, error) {
+	n, err := c.store.Get(ctx, id)
+	if errors.Is(err, scheduled.ErrNotFound) {
+		return ScheduledNotification{}, ErrScheduledNotFound
+	}
+	if err != nil {
+		return ScheduledNotification{}, fmt.Errorf("error getting scheduled notification: %v", err)
+	}
+	return scheduledNotification(n)
+}
+
+// CancelScheduled removes a pending notification, notifications which are being sent or sent already are not found
+func (c *ScheduleController) CancelScheduled(ctx context.Context, id string) error {
+	err := c.store.Cancel(ctx, id, time.Now())
+	if errors.Is(err, scheduled.ErrNotFound) {
+		return ErrScheduledNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("error canceling scheduled notification: %v", err)
+	}
+
+	if c.recorder != nil {
+		c.recorder.Canceled(ctx, id)
+	}
+	return nil
+}
+
+// RescheduleScheduled moves the send_at of a pending notification, a send_at in the past sends it right away
+func (c *ScheduleController) RescheduleScheduled(ctx context.Context, id string, sendAt time.Time) (ScheduledNotification, error) {
+	n, err := c.store.Reschedule(ctx, id, sendAt, time.Now())
+	if errors.Is(err, scheduled.ErrNotFound) {
+		return ScheduledNotification{}, ErrScheduledNotFound
+	}
+	if err != nil {
+		return ScheduledNotification{}, fmt.Errorf("error rescheduling notification: %v", err)
+	}
+	return scheduledNotification(n)
+}
+
+// ImportScheduled moves the notifications scheduled in the directory of an earlier version into the store,
+// so they are sent by any replica. It returns the number of moved notifications.
+func ImportScheduled(ctx context.Context, dir string, store ScheduledStore) (int, error) {
+	files, err := scheduler.NewFileStore(dir)
+	if err != nil {
+		return 0, err
+	}
+	entries, err := files.Load()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, entry := range entries {
+		n, err := newScheduled(entry.ID, entry.Due, entry.Payload)
+		if err != nil {
+			return 0, err
+		}
+		// an entry may have been imported already by a replica which crashed before deleting it
+		if _, err := store.Get(ctx, entry.ID); errors.Is(err, scheduled.ErrNotFound) {
+			if err := store.Create(ctx, n); err != nil {
+				return 0, fmt.Errorf("error importing scheduled notification %s: %v", entry.ID, err)
+			}
+		} else if err != nil {
+			return 0, fmt.Errorf("error importing scheduled notification %s: %v", entry.ID, err)
+		}
+		if err := files.Delete(entry.ID); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// NewScheduledSend returns the function publishing the scheduled notifications once they are due,
+// the runner sends notifications which fail to publish again
+func NewScheduledSend(broker MessageBroker, recorder StatusRecorder) scheduled.SendFunc {
+	return func(ctx context.Context, n scheduled.Notification) error {
+		var message scheduledMessage
+		if err := json.Unmarshal(n.Message, &message); err != nil {
+			// a corrupt notification can never be sent, drop it instead of retrying forever
+			logrus.Errorf("dropping unreadable scheduled notification %s: %v", n.ID, err)
+			return nil
+		}
+
+		// an expired notification is still published, the service drops it and records it as expired
+		err := broker.Send(ctx, types.Message{
+			ID:        n.ID,
+			Channel:   message.Channel,
+			Priority:  message.Priority,
+			Payload:   message.Payload,
+			ExpiresAt: message.ExpiresAt,
+		})
+		if errors.Is(err, types.ErrUnsupportedChannel) {
+			logrus.Errorf("dropping scheduled notification %s: %v", n.ID, err)
+			if recorder != nil {
+				recorder.Rejected(ctx, n.ID, fmt.Errorf("error sending notification: %v", err))
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		if recorder != nil {
+			recorder.Queued(ctx, n.ID)
+		}
+		return nil
+	}
+}
+
+// newScheduled creates the stored notification of a message of the store, its channel and tenant are
+// copied so the notifications can be listed by them
+func newScheduled(id string, sendAt time.Time, message []byte) (scheduled.Notification, error) {
+	var m scheduledMessage
+	if err := json.Unmarshal(message, &m); err != nil {
+		return scheduled.Notification{}, fmt.Errorf("error unmarshaling scheduled notification %s: %v", id, err)
+	}
+	var request NotificationRequest
+	if err := json.Unmarshal(m.Payload, &request); err != nil {
+		return scheduled.Notification{}, fmt.Errorf("error unmarshaling scheduled notification %s: %v", id, err)
+	}
+	return scheduled.Notification{
+		ID:        id,
+		SendAt:    sendAt,
+		Channel:   m.Channel,
+		Tenant:    request.Tenant,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// scheduledNotification describes a notification of the store
+func scheduledNotification(n scheduled.Notification) (ScheduledNotification, error) {
+	var message scheduledMessage
+	if err := json.Unmarshal(n.Message, &message); err != nil {
+		return ScheduledNotification{}, fmt.Errorf("error unmarshaling scheduled notification %s: %v", n.ID, err)
+	}
+	var request NotificationRequest
+	if err := json.Unmarshal(message.Payload, &request); err != nil {
+		return ScheduledNotification{}, fmt.Errorf("error unmarshaling scheduled notification %s: %v", n.ID, err)
+	}
+
+	item := ScheduledNotification{
+		ID:       n.ID,
+		SendAt:   n.SendAt,
+		Channel:  message.Channel,
+		Receiver: request.Receiver,
+		Priority: message.Priority.String(),
+		Tenant:   request.Tenant,
+		Tags:     request.Tags,
+	}
+	if !message.ExpiresAt.IsZero() {
+		item.ExpiresAt = &message.ExpiresAt
+	}
+	return item, nil
+}
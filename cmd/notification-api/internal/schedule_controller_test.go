@@ -0,0 +1,204 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduler"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/golang/mock/gomock"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ScheduleController", func() {
+	var (
+		mockCtrl     *gomock.Controller
+		mockBroker   *mocks.MockMessageBroker
+		mockRecorder *mocks.MockStatusRecorder
+		store        *scheduled.MemoryStore
+		controller   *notification.ScheduleController
+		ctx          context.Context
+		sendAt       time.Time
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockBroker = mocks.NewMockMessageBroker(mockCtrl)
+		mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+		ctx = context.Background()
+		sendAt = time.Now().Add(time.Hour).Truncate(time.Second)
+
+		// no runner is started, nothing is sent by the specs of the controller
+		store = scheduled.NewMemoryStore()
+		controller = notification.NewScheduleController(store, mockRecorder)
+
+		mockRecorder.EXPECT().Accepted(ctx, gomock.Any()).AnyTimes()
+		mockRecorder.EXPECT().Scheduled(ctx, gomock.Any()).AnyTimes()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	// schedule schedules a notification of the tenant through the notification controller
+	schedule := func(tenant string, at time.Time) string {
+		id, err := notification.NewNotificationController(mockBroker, mockRecorder, store).SendNotification(ctx, notification.NotificationRequest{
+			Channel:  "sms",
+			Content:  "Your appointment is tomorrow",
+			Receiver: "+359888123456",
+			Tenant:   tenant,
+			SendAt:   &at,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		return id
+	}
+
+	When("listing the scheduled notifications", func() {
+		It("should return them ordered by send_at", func() {
+			late := schedule("acme", sendAt.Add(time.Hour))
+			early := schedule("acme", sendAt)
+			schedule("globex", sendAt)
+
+			page, err := controller.ListScheduled(ctx, scheduled.Query{Tenant: "acme", Limit: 10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Total).To(Equal(2))
+			Expect(page.Items).To(Equal([]notification.ScheduledNotification{
+				{ID: early, SendAt: sendAt, Channel: "sms", Receiver: "+359888123456", Priority: "normal", Tenant: "acme"},
+				{ID: late, SendAt: sendAt.Add(time.Hour), Channel: "sms", Receiver: "+359888123456", Priority: "normal", Tenant: "acme"},
+			}))
+
+			page, err = controller.ListScheduled(ctx, scheduled.Query{Offset: 2, Limit: 10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Total).To(Equal(3))
+			Expect(page.Items).To(HaveLen(1))
+		})
+	})
+
+	When("canceling a scheduled notification", func() {
+		It("should remove it and record it as canceled", func() {
+			id := schedule("acme", sendAt)
+			mockRecorder.EXPECT().Canceled(ctx, id)
+
+			Expect(controller.CancelScheduled(ctx, id)).To(Succeed())
+			_, err := controller.GetScheduled(ctx, id)
+			Expect(err).To(MatchError(notification.ErrScheduledNotFound))
+			Expect(controller.CancelScheduled(ctx, id)).To(MatchError(notification.ErrScheduledNotFound))
+		})
+	})
+
+	When("rescheduling a scheduled notification", func() {
+		It("should move its send_at", func() {
+			id := schedule("acme", sendAt)
+
+			item, err := controller.RescheduleScheduled(ctx, id, sendAt.Add(24*time.Hour))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(item.SendAt).To(Equal(sendAt.Add(24 * time.Hour)))
+
+			item, err = controller.GetScheduled(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(item.SendAt).To(Equal(sendAt.Add(24 * time.Hour)))
+		})
+
+		It("should not find a notification which is not pending", func() {
+			_, err := controller.RescheduleScheduled(ctx, "unknown", sendAt)
+			Expect(err).To(MatchError(notification.ErrScheduledNotFound))
+		})
+	})
+
+	When("a scheduled notification is due", func() {
+		var send scheduled.SendFunc
+
+		BeforeEach(func() {
+			send = notification.NewScheduledSend(mockBroker, mockRecorder)
+		})
+
+		get := func(id string) scheduled.Notification {
+			n, err := store.Get(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			return n
+		}
+
+		It("should publish it with its id and record it as queued", func() {
+			id := schedule("acme", sendAt)
+
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message types.Message) error {
+				Expect(message.ID).To(Equal(id))
+				Expect(message.Channel).To(Equal("sms"))
+				Expect(message.Priority).To(Equal(types.PriorityNormal))
+				Expect(string(message.Payload)).To(ContainSubstring(`"receiver":"+359888123456"`))
+				return nil
+			})
+			mockRecorder.EXPECT().Queued(ctx, id)
+
+			Expect(send(ctx, get(id))).To(Succeed())
+		})
+
+		It("should publish it with the expiry resolved when it was scheduled", func() {
+			id, err := notification.NewNotificationController(mockBroker, mockRecorder, store).SendNotification(ctx, notification.NotificationRequest{
+				Channel:  "sms",
+				Content:  "Your code is 123456",
+				Receiver: "+359888123456",
+				SendAt:   &sendAt,
+				TTL:      "5m",
+			})
+			Expect(err).NotTo(HaveOccurred())
+			item, err := controller.GetScheduled(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(*item.ExpiresAt).To(BeTemporally("==", sendAt.Add(5*time.Minute)))
+
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, message types.Message) error {
+				Expect(message.ExpiresAt).To(BeTemporally("==", sendAt.Add(5*time.Minute)))
+				return nil
+			})
+			mockRecorder.EXPECT().Queued(ctx, id)
+
+			Expect(send(ctx, get(id))).To(Succeed())
+		})
+
+		It("should fail when publishing fails, so the runner sends it again", func() {
+			id := schedule("acme", sendAt)
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(errors.New("connection closed"))
+
+			Expect(send(ctx, get(id))).To(MatchError("connection closed"))
+		})
+
+		It("should drop it when its channel is not supported", func() {
+			id := schedule("acme", sendAt)
+			mockBroker.EXPECT().Send(ctx, gomock.Any()).Return(types.ErrUnsupportedChannel)
+			mockRecorder.EXPECT().Rejected(ctx, id, gomock.Any())
+
+			Expect(send(ctx, get(id))).To(Succeed())
+		})
+	})
+
+	When("importing the notifications of a schedule directory", func() {
+		It("should move them to the store", func() {
+			id := schedule("acme", sendAt)
+			n, err := store.Get(ctx, id)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(store.Cancel(ctx, id, time.Now())).To(Succeed())
+
+			dir := GinkgoT().TempDir()
+			files, err := scheduler.NewFileStore(dir)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(files.Save(scheduler.Entry{ID: id, Due: sendAt, Payload: n.Message})).To(Succeed())
+
+			imported, err := notification.ImportScheduled(ctx, dir, store)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(imported).To(Equal(1))
+			Expect(files.Load()).To(BeEmpty())
+
+			page, err := controller.ListScheduled(ctx, scheduled.Query{Tenant: "acme", Limit: 10})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Items).To(HaveLen(1))
+			Expect(page.Items[0].ID).To(Equal(id))
+			Expect(page.Items[0].SendAt).To(BeTemporally("==", sendAt))
+			Expect(page.Items[0].Receiver).To(Equal("+359888123456"))
+		})
+	})
+})
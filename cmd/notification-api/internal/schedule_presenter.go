@@ -0,0 +1,105 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=schedule_presenter.go --destination mocks/schedule_presenter.go --package mocks
+
+const (
+	defaultScheduledLimit = 50
+	maxScheduledLimit     = 500
+)
+
+type ScheduledNotifications interface {
+	ListScheduled(ctx context.Context, query scheduled.Query) (ScheduledPage, error)
+	GetScheduled(ctx context.Context, id string) (ScheduledNotification, error)
+	CancelScheduled(ctx context.Context, id string) error
+	RescheduleScheduled(ctx context.Context, id string, sendAt time.Time) (ScheduledNotification, error)
+}
+
+type SchedulePresenter struct {
+	scheduled ScheduledNotifications
+	validator Validator
+}
+
+func NewSchedulePresenter(scheduled ScheduledNotifications, validator Validator) *SchedulePresenter {
+	return &SchedulePresenter{
+		scheduled: scheduled,
+		validator: validator,
+	}
+}
+
+// HandleListScheduled lists the pending scheduled notifications, optionally of a channel or tenant
+func (p *SchedulePresenter) HandleListScheduled(c echo.Context) error {
+	offset, err := queryInt(c, "offset", 0)
+	if err != nil || offset < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid offset")
+	}
+	limit, err := queryInt(c, "limit", defaultScheduledLimit)
+	if err != nil || limit < 1 || limit > maxScheduledLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+	}
+
+	page, err := p.scheduled.ListScheduled(c.Request().Context(), scheduled.Query{
+		Channel: c.QueryParam("channel"),
+		Tenant:  c.QueryParam("tenant"),
+		Offset:  offset,
+		Limit:   limit,
+	})
+	if err != nil {
+		return scheduledError("failed to list scheduled notifications", err)
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+func (p *SchedulePresenter) HandleGetScheduled(c echo.Context) error {
+	item, err := p.scheduled.GetScheduled(c.Request().Context(), c.Param("id"))
+	if err != nil {
+		return scheduledError("failed to get scheduled notification", err)
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+func (p *SchedulePresenter) HandleCancelScheduled(c echo.Context) error {
+	if err := p.scheduled.CancelScheduled(c.Request().Context(), c.Param("id")); err != nil {
+		return scheduledError("failed to cancel scheduled notification", err)
+	}
+	return c.NoContent(http.StatusNoContent)
+}
+
+// HandleRescheduleScheduled moves a pending notification to the send_at of the body
+func (p *SchedulePresenter) HandleRescheduleScheduled(c echo.Context) error {
+	var request RescheduleRequest
+	if err := json.NewDecoder(c.Request().Body).Decode(&request); err != nil {
+		logrus.Errorf("failed to decode body: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "Failed to read request body")
+	}
+	if err := p.validator.Struct(request); err != nil {
+		logrus.Errorf("failed to validate body: %v", err)
+		return echo.NewHTTPError(http.StatusBadRequest, "send_at is required")
+	}
+
+	item, err := p.scheduled.RescheduleScheduled(c.Request().Context(), c.Param("id"), *request.SendAt)
+	if err != nil {
+		return scheduledError("failed to reschedule notification", err)
+	}
+	return c.JSON(http.StatusOK, item)
+}
+
+func scheduledError(msg string, err error) error {
+	logrus.Errorf("%s: %v", msg, err)
+
+	if errors.Is(err, ErrScheduledNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Scheduled notification not found, it may have been sent already")
+	}
+	return echo.NewHTTPError(http.StatusInternalServerError, "Failed to access scheduled notifications")
+}
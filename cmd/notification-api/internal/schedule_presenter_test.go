@@ -0,0 +1,106 @@
+package notification_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/go-playground/validator/v10"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SchedulePresenter", func() {
+	var (
+		mockCtrl      *gomock.Controller
+		mockScheduled *mocks.MockScheduledNotifications
+		presenter     *notification.SchedulePresenter
+		recorder      *httptest.ResponseRecorder
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockScheduled = mocks.NewMockScheduledNotifications(mockCtrl)
+		presenter = notification.NewSchedulePresenter(mockScheduled, validator.New())
+		recorder = httptest.NewRecorder()
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	request := func(method, target, body string, id string) echo.Context {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(req, recorder)
+		if id != "" {
+			c.SetParamNames("id")
+			c.SetParamValues(id)
+		}
+		return c
+	}
+
+	expectStatus := func(err error, status int) {
+		var httpError *echo.HTTPError
+		Expect(err).To(BeAssignableToTypeOf(httpError))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(status))
+	}
+
+	When("listing the scheduled notifications", func() {
+		It("should pass the filters and the page", func() {
+			mockScheduled.EXPECT().ListScheduled(gomock.Any(), scheduled.Query{Channel: "sms", Tenant: "acme", Offset: 10, Limit: 5}).
+				Return(notification.ScheduledPage{Items: []notification.ScheduledNotification{}, Total: 10, Offset: 10, Limit: 5}, nil)
+
+			Expect(presenter.HandleListScheduled(request(http.MethodGet, "/scheduled?channel=sms&tenant=acme&offset=10&limit=5", "", ""))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{"items":[],"total":10,"offset":10,"limit":5}`))
+		})
+
+		It("should reject an invalid limit", func() {
+			expectStatus(presenter.HandleListScheduled(request(http.MethodGet, "/scheduled?limit=1000", "", "")), http.StatusBadRequest)
+		})
+
+		It("should respond with an internal error when the store fails", func() {
+			mockScheduled.EXPECT().ListScheduled(gomock.Any(), gomock.Any()).Return(notification.ScheduledPage{}, errors.New("connection refused"))
+
+			expectStatus(presenter.HandleListScheduled(request(http.MethodGet, "/scheduled", "", "")), http.StatusInternalServerError)
+		})
+	})
+
+	When("canceling a scheduled notification", func() {
+		It("should respond without content", func() {
+			mockScheduled.EXPECT().CancelScheduled(gomock.Any(), "id-1").Return(nil)
+
+			Expect(presenter.HandleCancelScheduled(request(http.MethodDelete, "/scheduled/id-1", "", "id-1"))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusNoContent))
+		})
+
+		It("should respond with not found once the notification is sent", func() {
+			mockScheduled.EXPECT().CancelScheduled(gomock.Any(), "id-1").Return(notification.ErrScheduledNotFound)
+
+			expectStatus(presenter.HandleCancelScheduled(request(http.MethodDelete, "/scheduled/id-1", "", "id-1")), http.StatusNotFound)
+		})
+	})
+
+	When("rescheduling a notification", func() {
+		It("should move it to the send_at of the body", func() {
+			sendAt := time.Date(2026, 10, 21, 9, 0, 0, 0, time.UTC)
+			mockScheduled.EXPECT().RescheduleScheduled(gomock.Any(), "id-1", sendAt).Return(notification.ScheduledNotification{ID: "id-1", SendAt: sendAt}, nil)
+
+			Expect(presenter.HandleRescheduleScheduled(request(http.MethodPatch, "/scheduled/id-1", `{"send_at":"2026-10-21T09:00:00Z"}`, "id-1"))).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(ContainSubstring(`"send_at":"2026-10-21T09:00:00Z"`))
+		})
+
+		It("should require a send_at", func() {
+			expectStatus(presenter.HandleRescheduleScheduled(request(http.MethodPatch, "/scheduled/id-1", `{}`, "id-1")), http.StatusBadRequest)
+		})
+	})
+})
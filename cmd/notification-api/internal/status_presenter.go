@@ -0,0 +1,273 @@
+package notification
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+//go:generate mockgen --source=status_presenter.go --destination mocks/status_presenter.go --package mocks
+
+const (
+	defaultNotificationLimit = 50
+	maxNotificationLimit     = 500
+
+	// maxStreamIDs is the number of notifications a stream follows at most
+	maxStreamIDs = 500
+	// streamPageSize is the number of events a stream reads from the store at once
+	streamPageSize = 100
+	// streamRetry is how long EventSource clients wait before reconnecting to a closed stream
+	streamRetry = 3 * time.Second
+)
+
+type StatusStore interface {
+	Get(ctx context.Context, id string) (status.Notification, error)
+	Search(ctx context.Context, query status.Query) (status.Page, error)
+	Events(ctx context.Context, query status.EventQuery) ([]status.Event, error)
+	LastSeq(ctx context.Context) (int64, error)
+	Batch(ctx context.Context, id string) (status.BatchProgress, error)
+}
+
+type StatusPresenter struct {
+	store     StatusStore
+	receivers status.Receivers
+	// pollInterval is how often streams read new events from the store, heartbeat how often
+	// idle streams send a comment so proxies do not close them
+	pollInterval time.Duration
+	heartbeat    time.Duration
+	// done ends the streams when the server shuts down
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewStatusPresenter creates the presenter, receivers hashes the recipients searched for
+// the same way the recorder hashed them
+func NewStatusPresenter(store StatusStore, receivers status.Receivers, pollInterval, heartbeat time.Duration) *StatusPresenter {
+	return &StatusPresenter{
+		store:        store,
+		receivers:    receivers,
+		pollInterval: pollInterval,
+		heartbeat:    heartbeat,
+		done:         make(chan struct{}),
+	}
+}
+
+// Close ends the open streams, the http server does not cancel them on shutdown
+func (p *StatusPresenter) Close() {
+	p.closeOnce.Do(func() {
+		close(p.done)
+	})
+}
+
+// HandleGetNotification returns the state of a notification with its attempt history
+func (p *StatusPresenter) HandleGetNotification(c echo.Context) error {
+	notification, err := p.store.Get(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, status.ErrNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Notification not found")
+	}
+	if err != nil {
+		logrus.Errorf("failed to get notification status: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get notification")
+	}
+	return c.JSON(http.StatusOK, notification)
+}
+
+// HandleGetBatch returns the progress of the notifications of a batch
+func (p *StatusPresenter) HandleGetBatch(c echo.Context) error {
+	progress, err := p.store.Batch(c.Request().Context(), c.Param("id"))
+	if errors.Is(err, status.ErrBatchNotFound) {
+		return echo.NewHTTPError(http.StatusNotFound, "Batch not found")
+	}
+	if err != nil {
+		logrus.Errorf("failed to get batch progress: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to get batch")
+	}
+	return c.JSON(http.StatusOK, progress)
+}
+
+// HandleSearchNotifications returns a page of the notifications matching the query parameters
+func (p *StatusPresenter) HandleSearchNotifications(c echo.Context) error {
+	query, err := p.searchQuery(c)
+	if err != nil {
+		return err
+	}
+
+	page, err := p.store.Search(c.Request().Context(), query)
+	if errors.Is(err, status.ErrInvalidCursor) {
+		return echo.NewHTTPError(http.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		logrus.Errorf("failed to search notifications: %v", err)
+		return echo.NewHTTPError(http.StatusInternalServerError, "Failed to search notifications")
+	}
+	return c.JSON(http.StatusOK, page)
+}
+
+// HandleStreamNotification streams the status changes of a notification as server-sent events,
+// starting with its history
+func (p *StatusPresenter) HandleStreamNotification(c echo.Context) error {
+	return p.stream(c, status.EventQuery{IDs: []string{c.Param("id")}}, false)
+}
+
+// HandleStreamNotifications streams the status changes of the notifications of the id parameters or
+// the batch parameter starting with their history, or of all notifications of the tenant parameter from now on
+func (p *StatusPresenter) HandleStreamNotifications(c echo.Context) error {
+	query := status.EventQuery{
+		IDs:    c.QueryParams()["id"],
+		Tenant: c.QueryParam("tenant"),
+		Batch:  c.QueryParam("batch"),
+	}
+	if len(query.IDs) == 0 && query.Tenant == "" && query.Batch == "" {
+		return echo.NewHTTPError(http.StatusBadRequest, "Missing id, batch or tenant")
+	}
+	if len(query.IDs) > maxStreamIDs {
+		return echo.NewHTTPError(http.StatusBadRequest, "Too many ids")
+	}
+	return p.stream(c, query, len(query.IDs) == 0 && query.Batch == "")
+}
+
+// stream writes the events of the query until the client disconnects. Every event carries its seq
+// as id, a reconnecting client sends the last one as Last-Event-ID and the stream resumes after it.
+// Without it the stream starts with the history of the notifications, or from now when fromNow is set.
+func (p *StatusPresenter) stream(c echo.Context, query status.EventQuery, fromNow bool) error {
+	ctx := c.Request().Context()
+	query.Limit = streamPageSize
+
+	// EventSource sends the header when it reconnects, the parameter allows resuming a new EventSource
+	lastEventID := c.Request().Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.QueryParam("last_event_id")
+	}
+	switch {
+	case lastEventID != "":
+		seq, err := strconv.ParseInt(lastEventID, 10, 64)
+		if err != nil || seq < 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "Invalid Last-Event-ID")
+		}
+		query.After = seq
+	case fromNow:
+		seq, err := p.store.LastSeq(ctx)
+		if err != nil {
+			logrus.Errorf("failed to get last notification event: %v", err)
+			return echo.NewHTTPError(http.StatusInternalServerError, "Failed to stream notifications")
+		}
+		query.After = seq
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// nginx buffers responses by default, which holds back the events
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	fmt.Fprintf(res, "retry: %d\n\n", streamRetry.Milliseconds())
+	res.Flush()
+
+	poll := time.NewTicker(p.pollInterval)
+	defer poll.Stop()
+	heartbeat := time.NewTicker(p.heartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		events, err := p.store.Events(ctx, query)
+		if err != nil {
+			if ctx.Err() == nil {
+				// the response has started, the client reconnects and resumes after its last event
+				logrus.Errorf("failed to read notification events: %v", err)
+			}
+			return nil
+		}
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				logrus.Errorf("failed to marshal notification event: %v", err)
+				return nil
+			}
+			fmt.Fprintf(res, "id: %d\nevent: status\ndata: %s\n\n", event.Seq, data)
+			query.After = event.Seq
+		}
+		if len(events) > 0 {
+			res.Flush()
+			heartbeat.Reset(p.heartbeat)
+		}
+		// a full page means more events are waiting
+		if len(events) == query.Limit {
+			continue
+		}
+
+	wait:
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-p.done:
+				return nil
+			case <-heartbeat.C:
+				fmt.Fprint(res, ": heartbeat\n\n")
+				res.Flush()
+			case <-poll.C:
+				break wait
+			}
+		}
+	}
+}
+
+// searchQuery parses the query parameters, invalid parameters are returned as bad request errors
+func (p *StatusPresenter) searchQuery(c echo.Context) (status.Query, error) {
+	query := status.Query{
+		ReceiverHash: c.QueryParam("recipient_hash"),
+		Channel:      c.QueryParam("channel"),
+		Tenant:       c.QueryParam("tenant"),
+		Batch:        c.QueryParam("batch"),
+		Tags:         c.QueryParams()["tag"],
+		Cursor:       c.QueryParam("cursor"),
+	}
+	if recipient := c.QueryParam("recipient"); recipient != "" {
+		query.ReceiverHash = p.receivers.Hash(recipient)
+	}
+
+	if states := c.QueryParam("status"); states != "" {
+		for _, s := range strings.Split(states, ",") {
+			state, err := status.ParseState(s)
+			if err != nil {
+				return status.Query{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid status")
+			}
+			query.States = append(query.States, state)
+		}
+	}
+
+	var err error
+	if query.From, err = queryTime(c, "from"); err != nil {
+		return status.Query{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid from")
+	}
+	if query.To, err = queryTime(c, "to"); err != nil {
+		return status.Query{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid to")
+	}
+	if query.Sort, err = status.ParseSort(c.QueryParam("sort")); err != nil {
+		return status.Query{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid sort")
+	}
+	query.Limit, err = queryInt(c, "limit", defaultNotificationLimit)
+	if err != nil || query.Limit < 1 || query.Limit > maxNotificationLimit {
+		return status.Query{}, echo.NewHTTPError(http.StatusBadRequest, "Invalid limit")
+	}
+	return query, nil
+}
+
+// queryTime parses an RFC 3339 time, the zero time when the parameter is not set
+func queryTime(c echo.Context, name string) (time.Time, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
@@ -0,0 +1,264 @@
+package notification_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal/mocks"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/golang/mock/gomock"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("StatusPresenter", func() {
+	var (
+		mockCtrl  *gomock.Controller
+		mockStore *mocks.MockStatusStore
+		presenter *notification.StatusPresenter
+		recorder  *httptest.ResponseRecorder
+		c         echo.Context
+	)
+
+	BeforeEach(func() {
+		mockCtrl = gomock.NewController(GinkgoT())
+		mockStore = mocks.NewMockStatusStore(mockCtrl)
+		presenter = notification.NewStatusPresenter(mockStore, status.NewReceivers("key", true), time.Hour, time.Hour)
+
+		recorder = httptest.NewRecorder()
+		c = echo.New().NewContext(httptest.NewRequest(http.MethodGet, "/notifications/n1", nil), recorder)
+		c.SetParamNames("id")
+		c.SetParamValues("n1")
+	})
+
+	AfterEach(func() {
+		mockCtrl.Finish()
+	})
+
+	It("should return the notification with its history", func() {
+		at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+		mockStore.EXPECT().Get(gomock.Any(), "n1").Return(status.Notification{
+			ID:        "n1",
+			Channel:   "sms",
+			Receiver:  "+359",
+			Priority:  "high",
+			State:     status.StateRetrying,
+			Attempts:  1,
+			CreatedAt: at,
+			UpdatedAt: at.Add(time.Second),
+			History: []status.Event{
+				{Seq: 1, NotificationID: "n1", State: status.StateAccepted, Time: at},
+				{Seq: 2, NotificationID: "n1", State: status.StateRetrying, Attempt: 1, Error: "timeout", Time: at.Add(time.Second)},
+			},
+		}, nil)
+
+		Expect(presenter.HandleGetNotification(c)).To(Succeed())
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(recorder.Body.String()).To(MatchJSON(`{
+			"id": "n1", "channel": "sms", "receiver": "+359", "priority": "high", "state": "retrying", "attempts": 1,
+			"created_at": "2026-10-19T10:00:00Z", "updated_at": "2026-10-19T10:00:01Z",
+			"history": [
+				{"seq": 1, "notification_id": "n1", "state": "accepted", "time": "2026-10-19T10:00:00Z"},
+				{"seq": 2, "notification_id": "n1", "state": "retrying", "attempt": 1, "error": "timeout", "time": "2026-10-19T10:00:01Z"}
+			]
+		}`))
+	})
+
+	It("should return not found for unknown notifications", func() {
+		mockStore.EXPECT().Get(gomock.Any(), "n1").Return(status.Notification{}, status.ErrNotFound)
+
+		err := presenter.HandleGetNotification(c)
+		Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusNotFound))
+	})
+
+	It("should return an internal error when the store fails", func() {
+		mockStore.EXPECT().Get(gomock.Any(), "n1").Return(status.Notification{}, errors.New("connection refused"))
+
+		err := presenter.HandleGetNotification(c)
+		Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusInternalServerError))
+	})
+
+	It("should return the progress of a batch", func() {
+		c.SetParamValues("b1")
+		mockStore.EXPECT().Batch(gomock.Any(), "b1").Return(status.BatchProgress{
+			ID: "b1", Total: 3, States: map[status.State]int{status.StateDelivered: 2, status.StateRetrying: 1}, Completed: 2,
+		}, nil)
+
+		Expect(presenter.HandleGetBatch(c)).To(Succeed())
+		Expect(recorder.Body.String()).To(MatchJSON(`{"id": "b1", "total": 3, "states": {"delivered": 2, "retrying": 1}, "completed": 2, "done": false}`))
+	})
+
+	It("should return not found for unknown batches", func() {
+		mockStore.EXPECT().Batch(gomock.Any(), "n1").Return(status.BatchProgress{}, status.ErrBatchNotFound)
+
+		err := presenter.HandleGetBatch(c)
+		Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+		Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusNotFound))
+	})
+
+	Context("searching notifications", func() {
+		search := func(target string) error {
+			recorder = httptest.NewRecorder()
+			c = echo.New().NewContext(httptest.NewRequest(http.MethodGet, target, nil), recorder)
+			return presenter.HandleSearchNotifications(c)
+		}
+
+		expectBadRequest := func(err error) {
+			Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusBadRequest))
+		}
+
+		It("should search with the hashed recipient and the filters", func() {
+			mockStore.EXPECT().Search(gomock.Any(), status.Query{
+				ReceiverHash: status.NewReceivers("key", false).Hash("john@example.com"),
+				Channel:      "sms",
+				States:       []status.State{status.StateDelivered, status.StateFailed},
+				Tenant:       "acme",
+				Batch:        "b1",
+				Tags:         []string{"otp", "login"},
+				From:         time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC),
+				To:           time.Date(2026, 10, 14, 0, 0, 0, 0, time.UTC),
+				Sort:         status.SortCreatedAsc,
+				Cursor:       "abc",
+				Limit:        10,
+			}).Return(status.Page{Items: []status.Notification{{ID: "n1", State: status.StateDelivered}}, NextCursor: "def"}, nil)
+
+			Expect(search("/notifications?recipient=john@example.com&channel=sms&status=delivered,failed&tenant=acme&batch=b1&tag=otp&tag=login" +
+				"&from=2026-10-13T00:00:00Z&to=2026-10-14T00:00:00Z&sort=created_at&cursor=abc&limit=10")).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Body.String()).To(MatchJSON(`{
+				"items": [{"id": "n1", "channel": "", "receiver": "", "priority": "", "state": "delivered", "attempts": 0,
+					"created_at": "0001-01-01T00:00:00Z", "updated_at": "0001-01-01T00:00:00Z"}],
+				"next_cursor": "def"
+			}`))
+		})
+
+		It("should search the newest notifications by default", func() {
+			mockStore.EXPECT().Search(gomock.Any(), status.Query{ReceiverHash: "cafe", Sort: status.SortCreatedDesc, Limit: 50}).Return(status.Page{}, nil)
+
+			Expect(search("/notifications?recipient_hash=cafe")).To(Succeed())
+		})
+
+		It("should reject invalid parameters", func() {
+			expectBadRequest(search("/notifications?status=lost"))
+			expectBadRequest(search("/notifications?from=yesterday"))
+			expectBadRequest(search("/notifications?sort=receiver"))
+			expectBadRequest(search("/notifications?limit=1000"))
+		})
+
+		It("should reject invalid cursors", func() {
+			mockStore.EXPECT().Search(gomock.Any(), gomock.Any()).Return(status.Page{}, status.ErrInvalidCursor)
+
+			expectBadRequest(search("/notifications?cursor=abc"))
+		})
+	})
+
+	Context("streaming status changes", func() {
+		var (
+			ctx    context.Context
+			cancel context.CancelFunc
+		)
+
+		BeforeEach(func() {
+			ctx, cancel = context.WithCancel(context.Background())
+			DeferCleanup(cancel)
+		})
+
+		stream := func(target string, lastEventID string, handler func(echo.Context) error) error {
+			req := httptest.NewRequest(http.MethodGet, target, nil).WithContext(ctx)
+			if lastEventID != "" {
+				req.Header.Set("Last-Event-ID", lastEventID)
+			}
+			recorder = httptest.NewRecorder()
+			c = echo.New().NewContext(req, recorder)
+			return handler(c)
+		}
+
+		// disconnect ends the stream at its next read of the store
+		disconnect := func(ctx context.Context, query status.EventQuery) ([]status.Event, error) {
+			cancel()
+			return nil, nil
+		}
+
+		It("should stream the history and the changes of a notification", func() {
+			presenter = notification.NewStatusPresenter(mockStore, status.Receivers{}, time.Millisecond, time.Hour)
+			at := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			gomock.InOrder(
+				mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{IDs: []string{"n1"}, Limit: 100}).Return([]status.Event{
+					{Seq: 3, NotificationID: "n1", State: status.StateAccepted, Time: at},
+				}, nil),
+				mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{IDs: []string{"n1"}, After: 3, Limit: 100}).Return(nil, nil),
+				mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{IDs: []string{"n1"}, After: 3, Limit: 100}).Return([]status.Event{
+					{Seq: 9, NotificationID: "n1", State: status.StateDelivered, Attempt: 1, Time: at},
+				}, nil),
+				mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{IDs: []string{"n1"}, After: 9, Limit: 100}).DoAndReturn(disconnect),
+			)
+
+			Expect(stream("/notifications/n1/stream", "", func(c echo.Context) error {
+				c.SetParamNames("id")
+				c.SetParamValues("n1")
+				return presenter.HandleStreamNotification(c)
+			})).To(Succeed())
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+			Expect(recorder.Header().Get("Content-Type")).To(Equal("text/event-stream"))
+			Expect(recorder.Body.String()).To(Equal("retry: 3000\n\n" +
+				"id: 3\nevent: status\ndata: {\"seq\":3,\"notification_id\":\"n1\",\"state\":\"accepted\",\"time\":\"2026-10-19T10:00:00Z\"}\n\n" +
+				"id: 9\nevent: status\ndata: {\"seq\":9,\"notification_id\":\"n1\",\"state\":\"delivered\",\"attempt\":1,\"time\":\"2026-10-19T10:00:00Z\"}\n\n"))
+		})
+
+		It("should stream the changes of a tenant from now on", func() {
+			mockStore.EXPECT().LastSeq(gomock.Any()).Return(int64(41), nil)
+			mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{Tenant: "acme", After: 41, Limit: 100}).DoAndReturn(disconnect)
+
+			Expect(stream("/notifications/stream?tenant=acme", "", presenter.HandleStreamNotifications)).To(Succeed())
+		})
+
+		It("should resume after the Last-Event-ID", func() {
+			mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{IDs: []string{"n1", "n2"}, Tenant: "acme", After: 7, Limit: 100}).DoAndReturn(disconnect)
+
+			Expect(stream("/notifications/stream?id=n1&id=n2&tenant=acme", "7", presenter.HandleStreamNotifications)).To(Succeed())
+		})
+
+		It("should send heartbeats while there are no changes", func() {
+			presenter = notification.NewStatusPresenter(mockStore, status.Receivers{}, time.Hour, time.Millisecond)
+			mockStore.EXPECT().Events(gomock.Any(), gomock.Any()).Return(nil, nil)
+			time.AfterFunc(50*time.Millisecond, cancel)
+
+			Expect(stream("/notifications/stream?tenant=acme", "0", presenter.HandleStreamNotifications)).To(Succeed())
+			Expect(recorder.Body.String()).To(ContainSubstring(": heartbeat\n\n"))
+		})
+
+		It("should end the streams when the presenter is closed", func() {
+			mockStore.EXPECT().Events(gomock.Any(), gomock.Any()).DoAndReturn(func(ctx context.Context, query status.EventQuery) ([]status.Event, error) {
+				presenter.Close()
+				return nil, nil
+			})
+
+			Expect(stream("/notifications/stream?id=n1", "", presenter.HandleStreamNotifications)).To(Succeed())
+			presenter.Close()
+		})
+
+		It("should stream a batch with its history", func() {
+			mockStore.EXPECT().Events(gomock.Any(), status.EventQuery{Batch: "b1", Limit: 100}).DoAndReturn(disconnect)
+
+			Expect(stream("/notifications/stream?batch=b1", "", presenter.HandleStreamNotifications)).To(Succeed())
+		})
+
+		It("should reject streams without filters or with an invalid Last-Event-ID", func() {
+			err := stream("/notifications/stream", "", presenter.HandleStreamNotifications)
+			Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusBadRequest))
+
+			err = stream("/notifications/stream?id=n1", "abc", presenter.HandleStreamNotifications)
+			Expect(err).To(BeAssignableToTypeOf(&echo.HTTPError{}))
+			Expect(err.(*echo.HTTPError).Code).To(Equal(http.StatusBadRequest))
+		})
+	})
+})
@@ -10,10 +10,18 @@ import (
 	"time"
 
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/env"
-	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/server"
+	"github.com/AlexTsIvanov/notification-system/pkg/broker"
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
+	"github.com/AlexTsIvanov/notification-system/pkg/jetstream"
 	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
-	"github.com/go-playground/validator/v10"
-	"github.com/labstack/echo/v4"
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/spool"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,21 +32,110 @@ func main() {
 		logrus.Fatal("failed to load app config: ", err)
 	}
 
-	e := echo.New()
+	messageBroker, err := broker.New(broker.Config{
+		Backend:  config.BrokerBackend,
+		Channels: config.Channels,
+		Retry:    config.RetryPolicies(),
+		RabbitMQ: rabbitmq.Config{
+			Uri:      config.RabbitMQUri,
+			Exchange: config.RabbitMQExchange,
+			Queue:    config.RabbitMQQueue,
+			Confirm:  config.RabbitMQConfirm,
+		},
+		JetStream: jetstream.Config{
+			Url:    config.NATSUrl,
+			Stream: config.NATSStream,
+		},
+	}, false)
+	if err != nil {
+		logrus.Fatal("failed to init message broker: ", err)
+	}
+	defer messageBroker.Close()
+
+	var forwarder *spool.Forwarder
+	if config.SpoolDir != "" {
+		notificationSpool, err := spool.Open(spool.Config{
+			Dir:          config.SpoolDir,
+			SegmentSize:  config.SpoolSegmentSize,
+			SyncInterval: config.SpoolSyncInterval,
+		})
+		if err != nil {
+			logrus.Fatal("failed to open spool: ", err)
+		}
+		defer notificationSpool.Close()
+
+		if depth := notificationSpool.Depth(); depth > 0 {
+			logrus.Infof("forwarding %d spooled notifications", depth)
+		}
+		forwarder = spool.NewForwarder(notificationSpool, messageBroker, config.SpoolRetryInterval)
+	}
+
+	forwarderCtx, stopForwarder := context.WithCancel(context.Background())
+	forwarderDone := make(chan struct{})
+	go func() {
+		defer close(forwarderDone)
+		if forwarder != nil {
+			forwarder.Run(forwarderCtx)
+		}
+	}()
 
-	rabbitmqBroker, err := rabbitmq.NewRabbitMQBroker(config.RabbitMQUri, config.RabbitMQQueue, config.RabbitMQMaxRetries, false)
+	statusStore, err := status.Open(context.Background(), config.StatusStore, config.StatusDSN)
 	if err != nil {
-		logrus.Fatal("failed to init rabbitMQ broker: ", err)
+		logrus.Fatal("failed to open status store: ", err)
+	}
+	if statusStore != nil {
+		defer statusStore.Close()
 	}
-	defer rabbitmqBroker.Close()
 
-	structValidator := validator.New()
-	controller := notification.NewNotificationController(rabbitmqBroker)
+	var emitter *status.Emitter
+	if config.EventsExchange != "" {
+		eventPublisher, err := rabbitmq.NewEventPublisher(config.RabbitMQUri, config.EventsExchange)
+		if err != nil {
+			logrus.Fatal("failed to init event publisher: ", err)
+		}
+		defer eventPublisher.Close()
+		emitter = status.NewEmitter(eventPublisher, events.SourceAPI)
+	}
 
-	presenter := notification.NewNotificationPresenter(controller, structValidator)
+	var contentTemplates *templates.Templates
+	if config.TemplateDir != "" {
+		contentTemplates, err = templates.Load(config.TemplateDir)
+		if err != nil {
+			logrus.Fatal("failed to load templates: ", err)
+		}
+	}
 
-	// TODO auth middleware, rate limiter
-	e.POST("/send", presenter.HandleSendNotification)
+	scheduledStore, err := scheduled.Open(context.Background(), config.ScheduleStore, config.ScheduleDSN)
+	if err != nil {
+		logrus.Fatal("failed to open schedule store: ", err)
+	}
+	if scheduledStore != nil {
+		defer scheduledStore.Close()
+	}
+
+	recurringStore, err := recurring.Open(context.Background(), config.RecurringStore, config.RecurringDSN)
+	if err != nil {
+		logrus.Fatal("failed to open recurring store: ", err)
+	}
+	if recurringStore != nil {
+		defer recurringStore.Close()
+	}
+
+	var idempotencyStore idempotency.Store
+	if config.IdempotencyTTL > 0 {
+		idempotencyStore, err = idempotency.Open(context.Background(), config.IdempotencyStore, config.IdempotencyDSN, config.IdempotencyTTL)
+		if err != nil {
+			logrus.Fatal("failed to open idempotency store: ", err)
+		}
+		if idempotencyStore != nil {
+			defer idempotencyStore.Close()
+		}
+	}
+
+	e, err := server.New(config, messageBroker, forwarder, statusStore, emitter, contentTemplates, scheduledStore, recurringStore, idempotencyStore)
+	if err != nil {
+		logrus.Fatal("failed to init server: ", err)
+	}
 
 	// Start server
 	go func() {
@@ -61,4 +158,7 @@ func main() {
 	if err := e.Shutdown(ctx); err != nil {
 		logrus.Fatal("failed to shutdown server", err)
 	}
+
+	stopForwarder()
+	<-forwarderDone
 }
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net/http"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/env"
+	notification "github.com/AlexTsIvanov/notification-system/cmd/notification-api/internal"
+	"github.com/AlexTsIvanov/notification-system/pkg/broker"
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/spool"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// New creates the http server of the api with all its routes registered. When forwarder is set
+// notifications are published through it, so they are spooled while the broker is unavailable.
+// When statusStore is set the status of the notifications is recorded and served, when emitter
+// is set their lifecycle events are published. When contentTemplates is set CSV files can be sent as bulk jobs,
+// when scheduledStore is set notifications can have a send_at and when recurringStore is set recurring
+// schedules are managed and sent. When idempotencyStore is set retries with an Idempotency-Key are sent once.
+func New(config env.AppConfig, messageBroker broker.Backend, forwarder *spool.Forwarder, statusStore status.Store, emitter *status.Emitter,
+	contentTemplates *templates.Templates, scheduledStore scheduled.Store, recurringStore recurring.Store, idempotencyStore idempotency.Store) (*echo.Echo, error) {
+	e := echo.New()
+
+	structValidator := validator.New()
+	// the errors of the batch items name the fields as in the request
+	structValidator.RegisterTagNameFunc(notification.JSONFieldName)
+	var publisher notification.MessageBroker = messageBroker
+	if forwarder != nil {
+		publisher = forwarder
+	}
+	receivers := config.StatusReceivers()
+	var observers status.Observers
+	if statusStore != nil {
+		observers = append(observers, status.NewRecorder(statusStore, receivers))
+	}
+	if emitter != nil {
+		observers = append(observers, emitter)
+	}
+	var recorder notification.StatusRecorder
+	if len(observers) > 0 {
+		recorder = observers
+	}
+	// scheduled notifications wait in the store shared by the replicas until any of them sends them
+	var scheduledNotifications notification.ScheduledStore
+	if scheduledStore != nil {
+		if config.ScheduleDir != "" {
+			imported, err := notification.ImportScheduled(context.Background(), config.ScheduleDir, scheduledStore)
+			if err != nil {
+				return nil, fmt.Errorf("failed to import scheduled notifications of SCHEDULE_DIR: %v", err)
+			}
+			if imported > 0 {
+				logrus.Infof("imported %d scheduled notifications of SCHEDULE_DIR", imported)
+			}
+		}
+
+		runner := scheduled.NewRunner(scheduledStore, notification.NewScheduledSend(publisher, recorder), scheduled.RunnerConfig{
+			PollInterval: config.SchedulePollInterval,
+			ClaimTimeout: config.ScheduleClaimTimeout,
+		})
+		ctx, stopRunner := context.WithCancel(context.Background())
+		go runner.Run(ctx)
+		e.Server.RegisterOnShutdown(stopRunner)
+		scheduledNotifications = scheduledStore
+	} else if config.ScheduleDir != "" {
+		return nil, fmt.Errorf("SCHEDULE_DIR is no longer supported, set SCHEDULE_STORE to send its scheduled notifications")
+	}
+	controller := notification.NewNotificationController(publisher, recorder, scheduledNotifications)
+
+	var idempotencyKeys notification.IdempotencyStore
+	if idempotencyStore != nil {
+		idempotencyKeys = idempotencyStore
+	}
+	presenter := notification.NewNotificationPresenter(controller, structValidator, idempotencyKeys)
+	// everything but sending needs the admin api key
+	auth := notification.AdminAuth(config.AdminApiKey)
+
+	// TODO auth middleware, rate limiter
+	e.POST("/send", presenter.HandleSendNotification)
+	e.POST("/send/batch", notification.NewBatchPresenter(controller, structValidator, config.BatchMaxSize).HandleSendBatch)
+
+	if scheduledStore != nil {
+		schedulePresenter := notification.NewSchedulePresenter(notification.NewScheduleController(scheduledStore, recorder), structValidator)
+		e.GET("/scheduled", schedulePresenter.HandleListScheduled, auth)
+		e.GET("/scheduled/:id", schedulePresenter.HandleGetScheduled, auth)
+		e.PATCH("/scheduled/:id", schedulePresenter.HandleRescheduleScheduled, auth)
+		e.DELETE("/scheduled/:id", schedulePresenter.HandleCancelScheduled, auth)
+	}
+
+	if recurringStore != nil {
+		runner := recurring.NewRunner(recurringStore, notification.NewRecurringSend(publisher, recorder), recurring.RunnerConfig{
+			PollInterval: config.RecurringPollInterval,
+			ClaimTimeout: config.RecurringClaimTimeout,
+		})
+		ctx, stopRunner := context.WithCancel(context.Background())
+		go runner.Run(ctx)
+		e.Server.RegisterOnShutdown(stopRunner)
+
+		recurringPresenter := notification.NewRecurringPresenter(notification.NewRecurringController(recurringStore), structValidator)
+		e.POST("/recurring", recurringPresenter.HandleCreateRecurring, auth)
+		e.POST("/recurring/preview", recurringPresenter.HandlePreviewRecurring, auth)
+		e.GET("/recurring", recurringPresenter.HandleListRecurring, auth)
+		e.GET("/recurring/:id", recurringPresenter.HandleGetRecurring, auth)
+		e.GET("/recurring/:id/next", recurringPresenter.HandleNextRuns, auth)
+		e.PUT("/recurring/:id", recurringPresenter.HandleUpdateRecurring, auth)
+		e.DELETE("/recurring/:id", recurringPresenter.HandleDeleteRecurring, auth)
+	}
+
+	if contentTemplates != nil {
+		bulkController := notification.NewBulkController(controller, contentTemplates, structValidator, config.BulkMaxRows, config.BulkJobRetention)
+		bulkPresenter := notification.NewBulkPresenter(bulkController)
+		e.POST("/bulk", bulkPresenter.HandleCreateBulkJob, auth)
+		e.GET("/bulk/:id", bulkPresenter.HandleGetBulkJob, auth)
+		e.POST("/bulk/:id/pause", bulkPresenter.HandlePauseBulkJob, auth)
+		e.POST("/bulk/:id/resume", bulkPresenter.HandleResumeBulkJob, auth)
+		e.POST("/bulk/:id/cancel", bulkPresenter.HandleCancelBulkJob, auth)
+		e.Server.RegisterOnShutdown(bulkController.Close)
+	}
+
+	if statusStore != nil {
+		statusPresenter := notification.NewStatusPresenter(statusStore, receivers, config.StatusStreamPollInterval, config.StatusStreamHeartbeat)
+		e.GET("/notifications", statusPresenter.HandleSearchNotifications, auth)
+		e.GET("/notifications/stream", statusPresenter.HandleStreamNotifications, auth)
+		e.GET("/notifications/:id", statusPresenter.HandleGetNotification, auth)
+		e.GET("/notifications/:id/stream", statusPresenter.HandleStreamNotification, auth)
+		e.GET("/batches/:id", statusPresenter.HandleGetBatch, auth)
+		e.Server.RegisterOnShutdown(statusPresenter.Close)
+	}
+
+	if config.AdminApiKey != "" {
+		secret := []byte(config.AdminTokenSecret)
+		if len(secret) == 0 {
+			logrus.Warn("ADMIN_TOKEN_SECRET is not set, purge tokens are only valid on this instance")
+			secret = make([]byte, 32)
+			rand.Read(secret)
+		}
+
+		deadLetterPresenter := notification.NewDeadLetterPresenter(notification.NewDeadLetterController(messageBroker, secret))
+
+		admin := e.Group("/admin", notification.AdminAuth(config.AdminApiKey))
+		admin.GET("/dlq/:channel", deadLetterPresenter.HandleListDeadLetters)
+		admin.POST("/dlq/:channel/requeue", deadLetterPresenter.HandleRequeueDeadLetters)
+		admin.POST("/dlq/:channel/purge-token", deadLetterPresenter.HandleIssuePurgeToken)
+		admin.DELETE("/dlq/:channel", deadLetterPresenter.HandlePurgeDeadLetters)
+
+		if forwarder != nil {
+			admin.GET("/spool", func(c echo.Context) error {
+				return c.JSON(http.StatusOK, forwarder.Stats())
+			})
+		}
+	} else {
+		logrus.Warn("ADMIN_API_KEY is not set, admin endpoints are disabled and all other endpoints but sending reject requests")
+	}
+
+	return e, nil
+}
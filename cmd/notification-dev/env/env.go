@@ -0,0 +1,31 @@
+package env
+
+import (
+	"fmt"
+
+	apienv "github.com/AlexTsIvanov/notification-system/cmd/notification-api/env"
+	"github.com/kelseyhightower/envconfig"
+)
+
+// AppConfig takes the api settings, the broker always runs in memory
+type AppConfig struct {
+	apienv.AppConfig
+
+	// CaptureSenders replaces the channel senders with stubs recording the notifications at GET /dev/outbox
+	CaptureSenders bool `envconfig:"CAPTURE_SENDERS" default:"true"`
+	// CallbackSecret enables the status callbacks, they are retried with the retry policy of the notifications
+	CallbackSecret string `envconfig:"CALLBACK_SECRET"`
+	// CallbackAllowedNetworks are the CIDRs of private networks callbacks may be posted to, the receivers
+	// of local development usually run on the same host
+	CallbackAllowedNetworks []string `envconfig:"CALLBACK_ALLOWED_NETWORKS" default:"127.0.0.0/8,::1/128"`
+}
+
+// LoadAppConfig binds environment variables to application config
+func LoadAppConfig() (AppConfig, error) {
+	var config AppConfig
+	if err := envconfig.Process("", &config); err != nil {
+		return AppConfig{}, fmt.Errorf("failed to load app config: %v", err)
+	}
+
+	return config, nil
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-api/server"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-dev/env"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/worker"
+	"github.com/AlexTsIvanov/notification-system/pkg/broker"
+	"github.com/AlexTsIvanov/notification-system/pkg/callback"
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
+	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// notification-dev runs the api and the consumer in one process over the in-memory broker,
+// so the whole /send to sender path works without any external service
+func main() {
+	logrus.Info("loading application config...")
+	config, err := env.LoadAppConfig()
+	if err != nil {
+		logrus.Fatal("failed to load app config: ", err)
+	}
+
+	e, stop, err := start(config)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	go func() {
+		if err := e.Start(fmt.Sprintf("%s:%d", config.Host, config.Port)); err != nil && err != http.ErrServerClosed {
+			logrus.Fatal("failed to start server: ", err)
+		}
+	}()
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan,
+		syscall.SIGINT,
+		syscall.SIGTERM,
+		syscall.SIGQUIT)
+	<-sigChan
+	signal.Stop(sigChan)
+	logrus.Info("http server is stopping...")
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer shutdownCancel()
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		logrus.Fatal("failed to shutdown server", err)
+	}
+
+	// the server no longer publishes, stop the consumer
+	stop()
+}
+
+// start creates the api server and starts the consumer, stop ends the consumer and closes the brokers
+func start(config env.AppConfig) (e *echo.Echo, stop func(), err error) {
+	var closers []func()
+	defer func() {
+		if err != nil {
+			for i := len(closers) - 1; i >= 0; i-- {
+				closers[i]()
+			}
+		}
+	}()
+
+	messageBroker, err := broker.New(broker.Config{
+		Backend:  broker.BackendMemory,
+		Channels: config.Channels,
+		Retry:    config.RetryPolicies(),
+	}, true)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init message broker: %v", err)
+	}
+	closers = append(closers, messageBroker.Close)
+
+	// the api and the consumer share the process, so the memory store sees the whole lifecycle
+	statusStore := status.NewMemoryStore()
+	observers := status.Observers{status.NewRecorder(statusStore, config.StatusReceivers())}
+
+	// the events need a RabbitMQ even in development
+	var apiEmitter *status.Emitter
+	if config.EventsExchange != "" {
+		eventPublisher, err := rabbitmq.NewEventPublisher(config.RabbitMQUri, config.EventsExchange)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to init event publisher: %v", err)
+		}
+		closers = append(closers, func() { eventPublisher.Close() })
+		apiEmitter = status.NewEmitter(eventPublisher, events.SourceAPI)
+		observers = append(observers, status.NewEmitter(eventPublisher, events.SourceService))
+	}
+
+	var contentTemplates *templates.Templates
+	if config.TemplateDir != "" {
+		contentTemplates, err = templates.Load(config.TemplateDir)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load templates: %v", err)
+		}
+	}
+
+	// a single api runs, the scheduled notifications, recurring schedules and idempotency keys only need to be shared within the process.
+	// The notifications of a SCHEDULE_DIR are not moved into the memory store, they would be lost on exit.
+	config.ScheduleDir = ""
+	var idempotencyStore idempotency.Store
+	if config.IdempotencyTTL > 0 {
+		idempotencyStore = idempotency.NewMemoryStore(config.IdempotencyTTL)
+	}
+	e, err = server.New(config.AppConfig, messageBroker, nil, statusStore, apiEmitter, contentTemplates, scheduled.NewMemoryStore(), recurring.NewMemoryStore(), idempotencyStore)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to init server: %v", err)
+	}
+
+	var outbox *capture.Outbox
+	if config.CaptureSenders {
+		outbox = capture.NewOutbox()
+		e.GET("/dev/outbox", func(c echo.Context) error {
+			return c.JSON(http.StatusOK, outbox.Messages())
+		})
+		e.DELETE("/dev/outbox", func(c echo.Context) error {
+			outbox.Reset()
+			return c.NoContent(http.StatusNoContent)
+		})
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var notifier *callback.Notifier
+	callbacksDone := make(chan struct{})
+	if config.CallbackSecret != "" {
+		allowed, err := callback.ParseNetworks(config.CallbackAllowedNetworks)
+		if err != nil {
+			cancel()
+			return nil, nil, fmt.Errorf("failed to init callbacks: %v", err)
+		}
+		callbackBroker, err := broker.New(broker.Config{
+			Backend:  broker.BackendMemory,
+			Channels: []string{callback.Channel},
+			Retry:    config.RetryPolicies(),
+		}, true)
+		if err != nil {
+			cancel()
+			return nil, nil, fmt.Errorf("failed to init callback broker: %v", err)
+		}
+		closers = append(closers, callbackBroker.Close)
+
+		notifier = callback.NewNotifier(callbackBroker)
+		go func() {
+			defer close(callbacksDone)
+			callback.NewDispatcher(callbackBroker, config.CallbackSecret, 10*time.Second, allowed).Run(ctx, 1)
+		}()
+	} else {
+		close(callbacksDone)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := worker.Run(ctx, messageBroker, config.Channels, outbox, nil, observers, notifier); err != nil {
+			logrus.Fatal(err)
+		}
+	}()
+
+	return e, func() {
+		cancel()
+		<-done
+		<-callbacksDone
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+	}, nil
+}
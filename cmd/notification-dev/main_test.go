@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-dev/env"
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
+	"github.com/labstack/echo/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("notification-dev", func() {
+	var (
+		e    *echo.Echo
+		stop func()
+	)
+
+	request := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.Header.Set(echo.HeaderAuthorization, "Bearer admin-key")
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec
+	}
+
+	outbox := func() []capture.Message {
+		var messages []capture.Message
+		Expect(json.Unmarshal(request(http.MethodGet, "/dev/outbox", "").Body.Bytes(), &messages)).To(Succeed())
+		return messages
+	}
+
+	BeforeEach(func() {
+		GinkgoT().Setenv("ADMIN_API_KEY", "admin-key")
+		config, err := env.LoadAppConfig()
+		Expect(err).NotTo(HaveOccurred())
+
+		e, stop, err = start(config)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		Expect(e.Shutdown(context.Background())).To(Succeed())
+		stop()
+	})
+
+	It("captures the notifications sent to the api and records their status", func() {
+		rec := request(http.MethodPost, "/send", `{"channel":"email","content":"hi","receiver":"a@example.com"}`)
+		Expect(rec.Code).To(Equal(http.StatusAccepted))
+		var sent struct {
+			ID string `json:"id"`
+		}
+		Expect(json.Unmarshal(rec.Body.Bytes(), &sent)).To(Succeed())
+
+		Eventually(outbox).Should(HaveLen(1))
+		Expect(outbox()[0].Receiver).To(Equal("a@example.com"))
+		Eventually(func() string {
+			return request(http.MethodGet, "/notifications/"+sent.ID, "").Body.String()
+		}).Should(ContainSubstring(`"state":"delivered"`))
+
+		Expect(request(http.MethodDelete, "/dev/outbox", "").Code).To(Equal(http.StatusNoContent))
+		Expect(outbox()).To(BeEmpty())
+	})
+})
@@ -3,7 +3,9 @@ package consumer
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/factory"
 	"github.com/AlexTsIvanov/notification-system/pkg/types"
@@ -12,36 +14,83 @@ import (
 
 //go:generate mockgen --source=consumer.go --destination ../mocks/consumer.go --package mocks
 
+// ErrRead is returned when no event could be read, e.g. while the broker is unavailable
+var ErrRead = errors.New("error reading event queue")
+
 type Reader interface {
 	Read(ctx context.Context) (event types.EventContext, err error)
 	Ack(event types.EventContext) error
-	Nack(event types.EventContext) error
+	// Nack schedules a retry of the event or dead-letters it and returns which, cause is the error the event failed with
+	Nack(event types.EventContext, cause error) (types.Outcome, error)
 }
 
 type Factory interface {
 	GetSender(channel string) (factory.Sender, error)
 }
 
+// Deduplicator remembers the ids of delivered messages
+type Deduplicator interface {
+	Seen(id string) (bool, error)
+	Mark(id string) error
+}
+
+// StatusRecorder records the outcome of every delivery attempt
+type StatusRecorder interface {
+	Sending(ctx context.Context, event types.EventContext)
+	Delivered(ctx context.Context, event types.EventContext)
+	// Failed records a failed attempt with the outcome of its Nack
+	Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome)
+	Expired(ctx context.Context, event types.EventContext)
+}
+
+// Callbacks tells the callers of notifications with a callback url about their final status
+type Callbacks interface {
+	Delivered(ctx context.Context, event types.EventContext, channel, url string)
+	// Failed is called for every failed attempt with the outcome of its Nack, only the final outcomes are reported
+	Failed(ctx context.Context, event types.EventContext, channel, url string, cause error, outcome types.Outcome)
+	Expired(ctx context.Context, event types.EventContext, channel, url string)
+}
+
 type Consumer struct {
-	reader  Reader
-	factory Factory
+	reader       Reader
+	factory      Factory
+	deduplicator Deduplicator
+	recorder     StatusRecorder
+	callbacks    Callbacks
 }
 
-func NewConsumer(reader Reader, factory Factory) *Consumer {
+// NewConsumer creates a consumer, with a nil deduplicator redeliveries are sent again, with a nil
+// recorder the status of the notifications is not recorded and with nil callbacks no callbacks are sent
+func NewConsumer(reader Reader, factory Factory, deduplicator Deduplicator, recorder StatusRecorder, callbacks Callbacks) *Consumer {
 	return &Consumer{
-		reader:  reader,
-		factory: factory,
+		reader:       reader,
+		factory:      factory,
+		deduplicator: deduplicator,
+		recorder:     recorder,
+		callbacks:    callbacks,
 	}
 }
 
-func (c *Consumer) HandleNotificationEvent(ctx context.Context) error {
+func (c *Consumer) HandleNotificationEvent(ctx context.Context) (err error) {
 	event, err := c.reader.Read(ctx)
 	if err != nil {
-		return fmt.Errorf("error reading event queue: %v", err)
+		return fmt.Errorf("%w: %v", ErrRead, err)
 	}
+
+	var notification Notification
 	defer func() {
 		if err != nil {
-			if nackErr := c.reader.Nack(event); nackErr != nil {
+			// the broker decides whether the event is retried or dead-lettered, its outcome is reported
+			outcome, nackErr := c.reader.Nack(event, err)
+			if outcome != "" {
+				if c.recorder != nil {
+					c.recorder.Failed(ctx, event, notification.Channel, err, outcome)
+				}
+				if c.callbacks != nil && notification.CallbackURL != "" {
+					c.callbacks.Failed(ctx, event, notification.Channel, notification.CallbackURL, err, outcome)
+				}
+			}
+			if nackErr != nil {
 				err = fmt.Errorf("%w; 2nd error: error sending negative acknowledgement: %v", err, nackErr)
 			}
 		} else {
@@ -53,23 +102,70 @@ func (c *Consumer) HandleNotificationEvent(ctx context.Context) error {
 		}
 	}()
 
-	var notification Notification
+	if c.alreadyDelivered(event.MessageId) {
+		// the notification was sent but not acked before, e.g. the consumer crashed in between
+		logrus.Infof("skipping already delivered message %s", event.MessageId)
+		return nil
+	}
+
 	err = json.Unmarshal(event.Payload, &notification)
 	if err != nil {
-		return fmt.Errorf("error unmarshaling event body: %v", err)
+		return types.NewDeliveryError(types.ErrorClassInvalidPayload, fmt.Errorf("error unmarshaling event body: %v", err))
+	}
+
+	if event.Expired(time.Now()) {
+		// sending it late is worse than not sending it, e.g. an OTP code returning from the retries
+		logrus.Infof("dropping message %s expired at %s", event.MessageId, event.ExpiresAt.Format(time.RFC3339))
+		if c.recorder != nil {
+			c.recorder.Expired(ctx, event)
+		}
+		if c.callbacks != nil && notification.CallbackURL != "" {
+			c.callbacks.Expired(ctx, event, notification.Channel, notification.CallbackURL)
+		}
+		return nil
 	}
 
 	channel, err := c.factory.GetSender(notification.Channel)
 	if err != nil {
-		return fmt.Errorf("error getting channel: %v", err)
+		return types.NewDeliveryError(types.ErrorClassUnsupportedChannel, fmt.Errorf("error getting channel: %v", err))
+	}
+
+	if c.recorder != nil {
+		c.recorder.Sending(ctx, event)
 	}
 
 	// TODO - maybe the notification.Receiver is some userId and db has to be queried
 	// to retrieve the channel specific receiver (email, phone for sms, slack id etc.)
 	err = channel.Send(notification.Content, notification.Receiver)
 	if err != nil {
-		return fmt.Errorf("error sending notification: %v", err)
+		return types.NewDeliveryError(types.ErrorClassSendFailed, fmt.Errorf("error sending notification: %v", err))
+	}
+	if c.recorder != nil {
+		c.recorder.Delivered(ctx, event)
+	}
+	if c.callbacks != nil && notification.CallbackURL != "" {
+		c.callbacks.Delivered(ctx, event, notification.Channel, notification.CallbackURL)
+	}
+
+	if c.deduplicator != nil && event.MessageId != "" {
+		if markErr := c.deduplicator.Mark(event.MessageId); markErr != nil {
+			logrus.Errorf("error marking message %s delivered: %v", event.MessageId, markErr)
+		}
 	}
 
 	return nil
 }
+
+// alreadyDelivered reports whether the message was marked delivered, messages without id and
+// lookup failures are treated as not delivered, so they are sent at least once
+func (c *Consumer) alreadyDelivered(id string) bool {
+	if c.deduplicator == nil || id == "" {
+		return false
+	}
+	seen, err := c.deduplicator.Seen(id)
+	if err != nil {
+		logrus.Errorf("error looking up message %s: %v", id, err)
+		return false
+	}
+	return seen
+}
@@ -3,6 +3,7 @@ package consumer_test
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/consumer"
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/mocks"
@@ -18,6 +19,7 @@ var _ = Describe("Consumer", func() {
 		mockReader  *mocks.MockReader
 		mockFactory *mocks.MockFactory
 		mockSender  *mocks.MockSender
+		mockDedup   *mocks.MockDeduplicator
 		c           *consumer.Consumer
 		ctx         context.Context
 		event       types.EventContext
@@ -28,7 +30,8 @@ var _ = Describe("Consumer", func() {
 		mockReader = mocks.NewMockReader(mockCtrl)
 		mockFactory = mocks.NewMockFactory(mockCtrl)
 		mockSender = mocks.NewMockSender(mockCtrl)
-		c = consumer.NewConsumer(mockReader, mockFactory)
+		mockDedup = mocks.NewMockDeduplicator(mockCtrl)
+		c = consumer.NewConsumer(mockReader, mockFactory, mockDedup, nil, nil)
 		ctx = context.TODO()
 		event = types.EventContext{Payload: []byte(`{"channel":"email","content":"Test message","receiver":"test@example.com"}`)}
 	})
@@ -47,7 +50,10 @@ var _ = Describe("Consumer", func() {
 	When("unmarshaling the event payload fails", func() {
 		BeforeEach(func() {
 			mockReader.EXPECT().Read(ctx).Return(types.EventContext{Payload: []byte(`invalid`)}, nil)
-			mockReader.EXPECT().Nack(gomock.Any()).Return(nil)
+			mockReader.EXPECT().Nack(gomock.Any(), gomock.Any()).DoAndReturn(func(_ types.EventContext, cause error) (types.Outcome, error) {
+				Expect(types.ClassOf(cause)).To(Equal(types.ErrorClassInvalidPayload))
+				return types.OutcomeFailed, nil
+			})
 		})
 
 		It("should return an error", func() {
@@ -61,7 +67,10 @@ var _ = Describe("Consumer", func() {
 		BeforeEach(func() {
 			mockReader.EXPECT().Read(ctx).Return(event, nil)
 			mockFactory.EXPECT().GetSender("email").Return(nil, errors.New("factory error"))
-			mockReader.EXPECT().Nack(gomock.Any()).Return(nil)
+			mockReader.EXPECT().Nack(event, gomock.Any()).DoAndReturn(func(_ types.EventContext, cause error) (types.Outcome, error) {
+				Expect(types.ClassOf(cause)).To(Equal(types.ErrorClassUnsupportedChannel))
+				return types.OutcomeFailed, nil
+			})
 		})
 
 		It("should return an error", func() {
@@ -75,7 +84,10 @@ var _ = Describe("Consumer", func() {
 			mockReader.EXPECT().Read(ctx).Return(event, nil)
 			mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
 			mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
-			mockReader.EXPECT().Nack(gomock.Any()).Return(nil)
+			mockReader.EXPECT().Nack(event, gomock.Any()).DoAndReturn(func(_ types.EventContext, cause error) (types.Outcome, error) {
+				Expect(types.ClassOf(cause)).To(Equal(types.ErrorClassSendFailed))
+				return types.OutcomeRetrying, nil
+			})
 		})
 
 		It("should return an error", func() {
@@ -84,6 +96,21 @@ var _ = Describe("Consumer", func() {
 		})
 	})
 
+	When("sending the negative acknowledgement fails", func() {
+		BeforeEach(func() {
+			mockReader.EXPECT().Read(ctx).Return(event, nil)
+			mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+			mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
+			mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.Outcome(""), errors.New("channel closed"))
+		})
+
+		It("should return both errors", func() {
+			err := c.HandleNotificationEvent(ctx)
+			Expect(err).To(MatchError("error sending notification: send error; 2nd error: error sending negative acknowledgement: channel closed"))
+			Expect(types.ClassOf(err)).To(Equal(types.ErrorClassSendFailed))
+		})
+	})
+
 	When("handling the event successfully", func() {
 		BeforeEach(func() {
 			mockReader.EXPECT().Read(ctx).Return(event, nil)
@@ -98,6 +125,229 @@ var _ = Describe("Consumer", func() {
 		})
 	})
 
+	Context("with a message id", func() {
+		BeforeEach(func() {
+			event.MessageId = "3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c"
+		})
+
+		When("the message was not delivered yet", func() {
+			BeforeEach(func() {
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+				mockDedup.EXPECT().Seen(event.MessageId).Return(false, nil)
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil)
+				mockDedup.EXPECT().Mark(event.MessageId).Return(nil)
+				mockReader.EXPECT().Ack(event).Return(nil)
+			})
+
+			It("should send it and mark it delivered", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+
+		When("the message was delivered already", func() {
+			BeforeEach(func() {
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+				mockDedup.EXPECT().Seen(event.MessageId).Return(true, nil)
+				mockReader.EXPECT().Ack(event).Return(nil)
+			})
+
+			It("should ack it without sending", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+
+		When("the lookup fails", func() {
+			BeforeEach(func() {
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+				mockDedup.EXPECT().Seen(event.MessageId).Return(false, errors.New("disk error"))
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil)
+				mockDedup.EXPECT().Mark(event.MessageId).Return(errors.New("disk error"))
+				mockReader.EXPECT().Ack(event).Return(nil)
+			})
+
+			It("should send it anyway", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+
+		When("sending fails", func() {
+			BeforeEach(func() {
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+				mockDedup.EXPECT().Seen(event.MessageId).Return(false, nil)
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
+				mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.OutcomeRetrying, nil)
+			})
+
+			It("should not mark it delivered", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(MatchError("error sending notification: send error"))
+			})
+		})
+	})
+
+	Context("with a status recorder", func() {
+		var mockRecorder *mocks.MockStatusRecorder
+
+		BeforeEach(func() {
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			c = consumer.NewConsumer(mockReader, mockFactory, nil, mockRecorder, nil)
+			event.MessageId = "3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c"
+			mockReader.EXPECT().Read(ctx).Return(event, nil)
+		})
+
+		When("the notification is sent", func() {
+			BeforeEach(func() {
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				gomock.InOrder(
+					mockRecorder.EXPECT().Sending(ctx, event),
+					mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil),
+					mockRecorder.EXPECT().Delivered(ctx, event),
+				)
+				mockReader.EXPECT().Ack(event).Return(nil)
+			})
+
+			It("should record the attempt as delivered", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+
+		When("sending fails", func() {
+			BeforeEach(func() {
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockRecorder.EXPECT().Sending(ctx, event)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
+				gomock.InOrder(
+					mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.OutcomeDeadLettered, nil),
+					mockRecorder.EXPECT().Failed(ctx, event, "email", gomock.Any(), types.OutcomeDeadLettered).Do(func(_ context.Context, _ types.EventContext, _ string, cause error, _ types.Outcome) {
+						Expect(types.ClassOf(cause)).To(Equal(types.ErrorClassSendFailed))
+					}),
+				)
+			})
+
+			It("should record the failed attempt with the outcome of the nack", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(HaveOccurred())
+			})
+		})
+
+		When("the channel is not supported", func() {
+			BeforeEach(func() {
+				mockFactory.EXPECT().GetSender("email").Return(nil, errors.New("factory error"))
+				mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.OutcomeFailed, nil)
+				mockRecorder.EXPECT().Failed(ctx, event, "email", gomock.Any(), types.OutcomeFailed)
+			})
+
+			It("should record the failure without a sending attempt", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(HaveOccurred())
+			})
+		})
+
+		When("the event cannot be negatively acknowledged", func() {
+			BeforeEach(func() {
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockRecorder.EXPECT().Sending(ctx, event)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
+				mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.Outcome(""), errors.New("unknown event"))
+			})
+
+			It("should not record an outcome", func() {
+				Expect(c.HandleNotificationEvent(ctx)).To(MatchError(ContainSubstring("unknown event")))
+			})
+		})
+	})
+
+	Context("with callbacks", func() {
+		var mockCallbacks *mocks.MockCallbacks
+
+		BeforeEach(func() {
+			mockCallbacks = mocks.NewMockCallbacks(mockCtrl)
+			c = consumer.NewConsumer(mockReader, mockFactory, nil, nil, mockCallbacks)
+			event.MessageId = "3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c"
+			event.Payload = []byte(`{"channel":"email","content":"Test message","receiver":"test@example.com","callback_url":"https://caller.example.com/hook"}`)
+			mockReader.EXPECT().Read(ctx).Return(event, nil)
+			mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+		})
+
+		It("should report the delivery to the callback url", func() {
+			mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil)
+			mockCallbacks.EXPECT().Delivered(ctx, event, "email", "https://caller.example.com/hook")
+			mockReader.EXPECT().Ack(event).Return(nil)
+
+			Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+		})
+
+		It("should report the failed attempt to the callback url", func() {
+			mockSender.EXPECT().Send("Test message", "test@example.com").Return(errors.New("send error"))
+			mockReader.EXPECT().Nack(event, gomock.Any()).Return(types.OutcomeRetrying, nil)
+			mockCallbacks.EXPECT().Failed(ctx, event, "email", "https://caller.example.com/hook", gomock.Any(), types.OutcomeRetrying)
+
+			Expect(c.HandleNotificationEvent(ctx)).To(HaveOccurred())
+		})
+	})
+
+	When("the notification has no callback url", func() {
+		It("should not report it", func() {
+			c = consumer.NewConsumer(mockReader, mockFactory, nil, nil, mocks.NewMockCallbacks(mockCtrl))
+			mockReader.EXPECT().Read(ctx).Return(event, nil)
+			mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+			mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil)
+			mockReader.EXPECT().Ack(event).Return(nil)
+
+			Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+		})
+	})
+
+	Context("with an expiry", func() {
+		var (
+			mockRecorder  *mocks.MockStatusRecorder
+			mockCallbacks *mocks.MockCallbacks
+		)
+
+		BeforeEach(func() {
+			mockRecorder = mocks.NewMockStatusRecorder(mockCtrl)
+			mockCallbacks = mocks.NewMockCallbacks(mockCtrl)
+			c = consumer.NewConsumer(mockReader, mockFactory, nil, mockRecorder, mockCallbacks)
+			event.MessageId = "3f1c2a9e-5b7d-4e8a-9c6f-1d2e3f4a5b6c"
+			event.Payload = []byte(`{"channel":"email","content":"Test message","receiver":"test@example.com","callback_url":"https://caller.example.com/hook"}`)
+		})
+
+		When("the message expired", func() {
+			BeforeEach(func() {
+				// e.g. it comes back from the retry queue after its expiry
+				event.RetryCount = 2
+				event.ExpiresAt = time.Now().Add(-time.Second)
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+			})
+
+			It("should drop and record it without sending", func() {
+				mockRecorder.EXPECT().Expired(ctx, event)
+				mockCallbacks.EXPECT().Expired(ctx, event, "email", "https://caller.example.com/hook")
+				mockReader.EXPECT().Ack(event).Return(nil)
+
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+
+		When("the message did not expire yet", func() {
+			BeforeEach(func() {
+				event.ExpiresAt = time.Now().Add(time.Minute)
+				mockReader.EXPECT().Read(ctx).Return(event, nil)
+			})
+
+			It("should send it", func() {
+				mockFactory.EXPECT().GetSender("email").Return(mockSender, nil)
+				mockRecorder.EXPECT().Sending(ctx, event)
+				mockSender.EXPECT().Send("Test message", "test@example.com").Return(nil)
+				mockRecorder.EXPECT().Delivered(ctx, event)
+				mockCallbacks.EXPECT().Delivered(ctx, event, "email", "https://caller.example.com/hook")
+				mockReader.EXPECT().Ack(event).Return(nil)
+
+				Expect(c.HandleNotificationEvent(ctx)).To(Succeed())
+			})
+		})
+	})
+
 	AfterEach(func() {
 		mockCtrl.Finish()
 	})
@@ -4,4 +4,6 @@ type Notification struct {
 	Channel  string `json:"channel"`
 	Content  string `json:"content"`
 	Receiver string `json:"receiver"`
-}
\ No newline at end of file
+	// CallbackURL receives the final status of the notification
+	CallbackURL string `json:"callback_url"`
+}
@@ -3,12 +3,12 @@ package factory
 import (
 	"fmt"
 
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
 	"github.com/AlexTsIvanov/notification-system/pkg/channels/email"
 	"github.com/AlexTsIvanov/notification-system/pkg/channels/slack"
 	"github.com/AlexTsIvanov/notification-system/pkg/channels/sms"
 )
 
-
 //go:generate mockgen --source=factory.go --destination ../mocks/factory.go --package mocks
 
 // needs to be implemented by all sending channels
@@ -16,21 +16,34 @@ type Sender interface {
 	Send(message, recipient string) error
 }
 
-type NotificationFactory struct{}
+type NotificationFactory struct {
+	outbox *capture.Outbox
+}
 
 func NewNotificationFactory() *NotificationFactory {
 	return &NotificationFactory{}
 }
 
+// NewCapturingFactory creates a factory whose senders record the notifications in the outbox instead of sending them
+func NewCapturingFactory(outbox *capture.Outbox) *NotificationFactory {
+	return &NotificationFactory{outbox: outbox}
+}
+
 func (f NotificationFactory) GetSender(channel string) (Sender, error) {
+	var sender Sender
 	switch channel {
 	case "email":
-		return email.NewEmailSender(), nil
+		sender = email.NewEmailSender()
 	case "sms":
-		return sms.NewSMSSender(), nil
+		sender = sms.NewSMSSender()
 	case "slack":
-		return slack.NewSlackSender(), nil
+		sender = slack.NewSlackSender()
 	default:
 		return nil, fmt.Errorf("Unsupported notification channel: %s", channel)
 	}
+
+	if f.outbox != nil {
+		return f.outbox.Sender(channel), nil
+	}
+	return sender, nil
 }
@@ -51,17 +51,18 @@ func (mr *MockReaderMockRecorder) Ack(event interface{}) *gomock.Call {
 }
 
 // Nack mocks base method.
-func (m *MockReader) Nack(event types.EventContext) error {
+func (m *MockReader) Nack(event types.EventContext, cause error) (types.Outcome, error) {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "Nack", event)
-	ret0, _ := ret[0].(error)
-	return ret0
+	ret := m.ctrl.Call(m, "Nack", event, cause)
+	ret0, _ := ret[0].(types.Outcome)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
 
 // Nack indicates an expected call of Nack.
-func (mr *MockReaderMockRecorder) Nack(event interface{}) *gomock.Call {
+func (mr *MockReaderMockRecorder) Nack(event, cause interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockReader)(nil).Nack), event)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Nack", reflect.TypeOf((*MockReader)(nil).Nack), event, cause)
 }
 
 // Read mocks base method.
@@ -116,3 +117,185 @@ func (mr *MockFactoryMockRecorder) GetSender(channel interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetSender", reflect.TypeOf((*MockFactory)(nil).GetSender), channel)
 }
+
+// MockDeduplicator is a mock of Deduplicator interface.
+type MockDeduplicator struct {
+	ctrl     *gomock.Controller
+	recorder *MockDeduplicatorMockRecorder
+}
+
+// MockDeduplicatorMockRecorder is the mock recorder for MockDeduplicator.
+type MockDeduplicatorMockRecorder struct {
+	mock *MockDeduplicator
+}
+
+// NewMockDeduplicator creates a new mock instance.
+func NewMockDeduplicator(ctrl *gomock.Controller) *MockDeduplicator {
+	mock := &MockDeduplicator{ctrl: ctrl}
+	mock.recorder = &MockDeduplicatorMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockDeduplicator) EXPECT() *MockDeduplicatorMockRecorder {
+	return m.recorder
+}
+
+// Mark mocks base method.
+func (m *MockDeduplicator) Mark(id string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Mark", id)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Mark indicates an expected call of Mark.
+func (mr *MockDeduplicatorMockRecorder) Mark(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Mark", reflect.TypeOf((*MockDeduplicator)(nil).Mark), id)
+}
+
+// Seen mocks base method.
+func (m *MockDeduplicator) Seen(id string) (bool, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Seen", id)
+	ret0, _ := ret[0].(bool)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Seen indicates an expected call of Seen.
+func (mr *MockDeduplicatorMockRecorder) Seen(id interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Seen", reflect.TypeOf((*MockDeduplicator)(nil).Seen), id)
+}
+
+// MockStatusRecorder is a mock of StatusRecorder interface.
+type MockStatusRecorder struct {
+	ctrl     *gomock.Controller
+	recorder *MockStatusRecorderMockRecorder
+}
+
+// MockStatusRecorderMockRecorder is the mock recorder for MockStatusRecorder.
+type MockStatusRecorderMockRecorder struct {
+	mock *MockStatusRecorder
+}
+
+// NewMockStatusRecorder creates a new mock instance.
+func NewMockStatusRecorder(ctrl *gomock.Controller) *MockStatusRecorder {
+	mock := &MockStatusRecorder{ctrl: ctrl}
+	mock.recorder = &MockStatusRecorderMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockStatusRecorder) EXPECT() *MockStatusRecorderMockRecorder {
+	return m.recorder
+}
+
+// Delivered mocks base method.
+func (m *MockStatusRecorder) Delivered(ctx context.Context, event types.EventContext) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Delivered", ctx, event)
+}
+
+// Delivered indicates an expected call of Delivered.
+func (mr *MockStatusRecorderMockRecorder) Delivered(ctx, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delivered", reflect.TypeOf((*MockStatusRecorder)(nil).Delivered), ctx, event)
+}
+
+// Expired mocks base method.
+func (m *MockStatusRecorder) Expired(ctx context.Context, event types.EventContext) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Expired", ctx, event)
+}
+
+// Expired indicates an expected call of Expired.
+func (mr *MockStatusRecorderMockRecorder) Expired(ctx, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expired", reflect.TypeOf((*MockStatusRecorder)(nil).Expired), ctx, event)
+}
+
+// Failed mocks base method.
+func (m *MockStatusRecorder) Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Failed", ctx, event, channel, cause, outcome)
+}
+
+// Failed indicates an expected call of Failed.
+func (mr *MockStatusRecorderMockRecorder) Failed(ctx, event, channel, cause, outcome interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Failed", reflect.TypeOf((*MockStatusRecorder)(nil).Failed), ctx, event, channel, cause, outcome)
+}
+
+// Sending mocks base method.
+func (m *MockStatusRecorder) Sending(ctx context.Context, event types.EventContext) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Sending", ctx, event)
+}
+
+// Sending indicates an expected call of Sending.
+func (mr *MockStatusRecorderMockRecorder) Sending(ctx, event interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Sending", reflect.TypeOf((*MockStatusRecorder)(nil).Sending), ctx, event)
+}
+
+// MockCallbacks is a mock of Callbacks interface.
+type MockCallbacks struct {
+	ctrl     *gomock.Controller
+	recorder *MockCallbacksMockRecorder
+}
+
+// MockCallbacksMockRecorder is the mock recorder for MockCallbacks.
+type MockCallbacksMockRecorder struct {
+	mock *MockCallbacks
+}
+
+// NewMockCallbacks creates a new mock instance.
+func NewMockCallbacks(ctrl *gomock.Controller) *MockCallbacks {
+	mock := &MockCallbacks{ctrl: ctrl}
+	mock.recorder = &MockCallbacksMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockCallbacks) EXPECT() *MockCallbacksMockRecorder {
+	return m.recorder
+}
+
+// Delivered mocks base method.
+func (m *MockCallbacks) Delivered(ctx context.Context, event types.EventContext, channel, url string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Delivered", ctx, event, channel, url)
+}
+
+// Delivered indicates an expected call of Delivered.
+func (mr *MockCallbacksMockRecorder) Delivered(ctx, event, channel, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delivered", reflect.TypeOf((*MockCallbacks)(nil).Delivered), ctx, event, channel, url)
+}
+
+// Expired mocks base method.
+func (m *MockCallbacks) Expired(ctx context.Context, event types.EventContext, channel, url string) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Expired", ctx, event, channel, url)
+}
+
+// Expired indicates an expected call of Expired.
+func (mr *MockCallbacksMockRecorder) Expired(ctx, event, channel, url interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Expired", reflect.TypeOf((*MockCallbacks)(nil).Expired), ctx, event, channel, url)
+}
+
+// Failed mocks base method.
+func (m *MockCallbacks) Failed(ctx context.Context, event types.EventContext, channel, url string, cause error, outcome types.Outcome) {
+	m.ctrl.T.Helper()
+	m.ctrl.Call(m, "Failed", ctx, event, channel, url, cause, outcome)
+}
+
+// Failed indicates an expected call of Failed.
+func (mr *MockCallbacksMockRecorder) Failed(ctx, event, channel, url, cause, outcome interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Failed", reflect.TypeOf((*MockCallbacks)(nil).Failed), ctx, event, channel, url, cause, outcome)
+}
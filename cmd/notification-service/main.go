@@ -4,12 +4,20 @@ import (
 	"context"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/env"
-	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/consumer"
-	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/factory"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/worker"
+	"github.com/AlexTsIvanov/notification-system/pkg/broker"
+	"github.com/AlexTsIvanov/notification-system/pkg/callback"
+	"github.com/AlexTsIvanov/notification-system/pkg/dedup"
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/jetstream"
 	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
@@ -24,16 +32,71 @@ func main() {
 		logrus.Fatal("failed to load app config: ", err)
 	}
 
-	rabbitmqBroker, err := rabbitmq.NewRabbitMQBroker(config.RabbitMQUri, config.RabbitMQQueue, config.RabbitMQMaxRetries, true)
+	messageBroker, err := newBroker(config, config.Channels, config.RetryPolicies(), config.SchedulerDir)
 	if err != nil {
-		logrus.Fatal("failed to init rabbitMQ broker: ", err)
+		logrus.Fatal("failed to init message broker: ", err)
 	}
-	defer rabbitmqBroker.Close()
+	defer messageBroker.Close()
 
-	// TODO will probably need env vars for the different channels
-	factory := factory.NewNotificationFactory()
+	dedupStore, err := dedup.New(dedup.Config{
+		Store:    config.DedupStore,
+		Capacity: config.DedupCapacity,
+		TTL:      config.DedupTTL,
+		File:     config.DedupFile,
+	})
+	if err != nil {
+		logrus.Fatal("failed to init dedup store: ", err)
+	}
+	if dedupStore != nil {
+		defer dedupStore.Close()
+	}
+
+	statusStore, err := status.Open(ctx, config.StatusStore, config.StatusDSN)
+	if err != nil {
+		logrus.Fatal("failed to open status store: ", err)
+	}
+	var observers status.Observers
+	if statusStore != nil {
+		defer statusStore.Close()
+		// only the api creates notifications with receivers, the service needs no hashing
+		observers = append(observers, status.NewRecorder(statusStore, status.Receivers{}))
+	}
+	if config.EventsExchange != "" {
+		eventPublisher, err := rabbitmq.NewEventPublisher(config.RabbitMQUri, config.EventsExchange)
+		if err != nil {
+			logrus.Fatal("failed to init event publisher: ", err)
+		}
+		defer eventPublisher.Close()
+		observers = append(observers, status.NewEmitter(eventPublisher, events.SourceService))
+	}
+	var observer status.Observer
+	if len(observers) > 0 {
+		observer = observers
+	}
+
+	var notifier *callback.Notifier
+	dispatcherDone := make(chan struct{})
+	if config.CallbackSecret != "" {
+		// the callbacks have their own queue, so slow receivers never hold up the notifications
+		callbackBroker, err := newBroker(config, []string{callback.Channel}, config.CallbackRetryPolicies(), filepath.Join(config.SchedulerDir, callback.Channel))
+		if err != nil {
+			logrus.Fatal("failed to init callback broker: ", err)
+		}
+		defer callbackBroker.Close()
 
-	consumer := consumer.NewConsumer(rabbitmqBroker, factory)
+		allowed, err := callback.ParseNetworks(config.CallbackAllowedNetworks)
+		if err != nil {
+			logrus.Fatal("failed to init callbacks: ", err)
+		}
+		notifier = callback.NewNotifier(callbackBroker)
+		dispatcher := callback.NewDispatcher(callbackBroker, config.CallbackSecret, config.CallbackTimeout, allowed)
+		go func() {
+			defer close(dispatcherDone)
+			dispatcher.Run(ctx, config.CallbackWorkers)
+		}()
+	} else {
+		close(dispatcherDone)
+	}
 
 	go func() {
 		signals := make(chan os.Signal, 1)
@@ -46,13 +109,31 @@ func main() {
 		cancel()
 	}()
 
-	logrus.Info("entering consumer loop...")
-	for {
-		if err := consumer.HandleNotificationEvent(ctx); err != nil {
-			logrus.Infof("Error consuming message: %v", err)
-			if ctx.Err() == context.Canceled {
-				break
-			}
-		}
+	if err := worker.Run(ctx, messageBroker, config.Channels, nil, dedupStore, observer, notifier); err != nil {
+		logrus.Fatal(err)
 	}
+	<-dispatcherDone
+}
+
+// newBroker creates a consuming broker of the channels, brokers of different channels need their own scheduler dir
+func newBroker(config env.AppConfig, channels []string, policies retry.Policies, schedulerDir string) (broker.Backend, error) {
+	return broker.New(broker.Config{
+		Backend:  config.BrokerBackend,
+		Channels: channels,
+		Retry:    policies,
+		RabbitMQ: rabbitmq.Config{
+			Uri:      config.RabbitMQUri,
+			Exchange: config.RabbitMQExchange,
+			Queue:    config.RabbitMQQueue,
+			Prefetch: config.RabbitMQPrefetch,
+
+			DelayBackend: config.DelayBackend,
+			SchedulerDir: schedulerDir,
+		},
+		JetStream: jetstream.Config{
+			Url:      config.NATSUrl,
+			Stream:   config.NATSStream,
+			Prefetch: config.NATSPrefetch,
+		},
+	}, true)
 }
@@ -0,0 +1,6 @@
+//go:build sqlite
+
+package main
+
+// the sqlite3 driver needs cgo, so it is only built into binaries for single host deployments with -tags sqlite
+import _ "github.com/mattn/go-sqlite3"
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/consumer"
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/internal/factory"
+	"github.com/AlexTsIvanov/notification-system/pkg/callback"
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
+	"github.com/AlexTsIvanov/notification-system/pkg/dedup"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minReadDelay and maxReadDelay bound the backoff between reads while reading fails
+	minReadDelay = 100 * time.Millisecond
+	maxReadDelay = 5 * time.Second
+)
+
+// Run dispatches the notifications read from the reader until the context is done. The notifications
+// are sent through the channel senders, or recorded in the outbox instead when it is not nil. Messages
+// marked in the dedup store are acked without sending them again, a nil store disables the check.
+// Every attempt is reported to the observer when it is not nil, and the final status of
+// notifications with a callback url is queued to the notifier when it is not nil.
+func Run(ctx context.Context, reader consumer.Reader, channels []string, outbox *capture.Outbox, store dedup.Store, observer status.Observer, notifier *callback.Notifier) error {
+	// TODO will probably need env vars for the different channels
+	f := factory.NewNotificationFactory()
+	if outbox != nil {
+		f = factory.NewCapturingFactory(outbox)
+	}
+	for _, channel := range channels {
+		if _, err := f.GetSender(channel); err != nil {
+			return fmt.Errorf("invalid channel config: %v", err)
+		}
+	}
+
+	var deduplicator consumer.Deduplicator
+	if store != nil {
+		deduplicator = store
+	}
+	var statusRecorder consumer.StatusRecorder
+	if observer != nil {
+		statusRecorder = observer
+	}
+	var callbacks consumer.Callbacks
+	if notifier != nil {
+		callbacks = notifier
+	}
+	c := consumer.NewConsumer(reader, f, deduplicator, statusRecorder, callbacks)
+
+	logrus.Infof("entering consumer loop for channels %v...", channels)
+	delay := minReadDelay
+	for {
+		err := c.HandleNotificationEvent(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if errors.Is(err, consumer.ErrRead) {
+			// reading fails until the broker is available again, back off instead of spinning
+			logrus.Errorf("Error consuming message, reading again in %s: %v", delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil
+			}
+			delay = min(2*delay, maxReadDelay)
+			continue
+		}
+		delay = minReadDelay
+
+		if err != nil {
+			logrus.Infof("Error consuming message: %v", err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package worker_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notification-service/worker"
+	"github.com/AlexTsIvanov/notification-system/pkg/broker/memory"
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// failingReader fails every read like a broker which is unavailable
+type failingReader struct {
+	reads atomic.Int32
+}
+
+func (r *failingReader) Read(ctx context.Context) (types.EventContext, error) {
+	r.reads.Add(1)
+	return types.EventContext{}, errors.New("connection refused")
+}
+
+func (r *failingReader) Ack(event types.EventContext) error {
+	return nil
+}
+
+func (r *failingReader) Nack(event types.EventContext, cause error) (types.Outcome, error) {
+	return types.OutcomeRetrying, nil
+}
+
+var _ = Describe("Run", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		outbox *capture.Outbox
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithCancel(context.Background())
+		outbox = capture.NewOutbox()
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("sends the notifications it reads until the context is done", func() {
+		broker, err := memory.NewBroker([]string{"email"}, retry.Policies{
+			Default: retry.Policy{InitialDelay: time.Millisecond, Multiplier: 2, MaxDelay: time.Second, Jitter: retry.JitterNone, MaxAttempts: 1},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		defer broker.Close()
+
+		done := make(chan error)
+		go func() {
+			done <- worker.Run(ctx, broker, []string{"email"}, outbox, nil, nil, nil)
+		}()
+
+		payload := []byte(`{"channel":"email","content":"hi","receiver":"a@example.com"}`)
+		Expect(broker.Send(ctx, types.Message{Channel: "email", Payload: payload})).To(Succeed())
+		Eventually(outbox.Messages).Should(HaveLen(1))
+		Expect(outbox.Messages()[0].Receiver).To(Equal("a@example.com"))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("backs off while reading fails", func() {
+		reader := &failingReader{}
+		done := make(chan error)
+		go func() {
+			done <- worker.Run(ctx, reader, []string{"email"}, outbox, nil, nil, nil)
+		}()
+
+		// reads after 0, 100ms and 300ms
+		time.Sleep(500 * time.Millisecond)
+		Expect(reader.reads.Load()).To(BeNumerically("<=", 4))
+
+		cancel()
+		Eventually(done).Should(Receive(BeNil()))
+	})
+
+	It("rejects channels without a sender", func() {
+		err := worker.Run(ctx, &failingReader{}, []string{"fax"}, nil, nil, nil, nil)
+		Expect(err).To(MatchError(ContainSubstring("invalid channel config")))
+	})
+})
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+// stringList is a flag which can be repeated
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+func (a *app) dlq(ctx context.Context, args []string) error {
+	if len(args) < 2 {
+		return usageError{"usage: notifyctl dlq <list|requeue|purge> <channel> [flags]"}
+	}
+	command, channel, args := args[0], args[1], args[2:]
+
+	switch command {
+	case "list":
+		return a.dlqList(ctx, channel, args)
+	case "requeue":
+		return a.dlqRequeue(ctx, channel, args)
+	case "purge":
+		return a.dlqPurge(ctx, channel, args)
+	default:
+		return usageError{fmt.Sprintf("unknown dlq command: %s", command)}
+	}
+}
+
+func (a *app) dlqList(ctx context.Context, channel string, args []string) error {
+	fs := a.newFlagSet("dlq list")
+	offset := fs.Int("offset", 0, "number of dead letters to skip")
+	limit := fs.Int("limit", 50, "maximum number of dead letters")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	page, err := a.client.ListDeadLetters(ctx, channel, *offset, *limit)
+	if err != nil {
+		return err
+	}
+
+	return a.print(page, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tCLASS\tATTEMPTS\tLAST ATTEMPT\tERROR")
+		for _, d := range page.Items {
+			lastAttempt := ""
+			if d.LastAttempt != nil {
+				lastAttempt = d.LastAttempt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", d.ID, d.ErrorClass, d.Attempts, lastAttempt, d.LastError)
+		}
+		fmt.Fprintf(w, "showing %d of %d\n", len(page.Items), page.Total)
+	})
+}
+
+func (a *app) dlqRequeue(ctx context.Context, channel string, args []string) error {
+	var ids stringList
+	fs := a.newFlagSet("dlq requeue")
+	fs.Var(&ids, "id", "id of a dead letter to requeue, can be repeated")
+	errorClass := fs.String("error-class", "", "requeue the dead letters failed with this class")
+	all := fs.Bool("all", false, "requeue every dead letter")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	filter := types.DeadLetterFilter{IDs: ids, ErrorClass: types.ErrorClass(*errorClass), All: *all}
+	if filter.Empty() {
+		return usageError{"dlq requeue: one of -id, -error-class or -all is required"}
+	}
+
+	requeued, err := a.client.RequeueDeadLetters(ctx, channel, filter)
+	if err != nil {
+		return err
+	}
+
+	return a.print(map[string]int{"requeued": requeued}, func(w io.Writer) {
+		fmt.Fprintf(w, "requeued %d dead letters\n", requeued)
+	})
+}
+
+func (a *app) dlqPurge(ctx context.Context, channel string, args []string) error {
+	fs := a.newFlagSet("dlq purge")
+	yes := fs.Bool("yes", false, "confirm purging the dead letter queue")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !*yes {
+		return usageError{"dlq purge: deleting all dead letters requires -yes"}
+	}
+
+	purged, err := a.client.PurgeDeadLetters(ctx, channel)
+	if err != nil {
+		return err
+	}
+
+	return a.print(map[string]int{"purged": purged}, func(w io.Writer) {
+		fmt.Fprintf(w, "purged %d dead letters\n", purged)
+	})
+}
@@ -0,0 +1,246 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Notification is the request body of /send
+type Notification struct {
+	Channel  string   `json:"channel"`
+	Content  string   `json:"content"`
+	Receiver string   `json:"receiver"`
+	Priority string   `json:"priority,omitempty"`
+	Tenant   string   `json:"tenant,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// CallbackURL receives a signed POST once the notification is delivered or failed for good
+	CallbackURL string `json:"callback_url,omitempty"`
+	// SendAt schedules the notification instead of publishing it right away
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// ExpiresAt or TTL, a duration like "10m", drop the notification instead of sending it late
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+}
+
+// BatchItem is the result of a notification of POST /send/batch, its id or the error
+type BatchItem struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+type BatchResult struct {
+	BatchID  string      `json:"batch_id"`
+	Accepted int         `json:"accepted"`
+	Rejected int         `json:"rejected"`
+	Items    []BatchItem `json:"items"`
+}
+
+// SearchFilter are the filters of GET /notifications, empty fields are not sent
+type SearchFilter struct {
+	Recipient string
+	Channel   string
+	// Status is a comma separated list of states
+	Status   string
+	Tenant   string
+	Tags     []string
+	From, To time.Time
+	Sort     string
+	Cursor   string
+	Limit    int
+}
+
+type DeadLetterPage struct {
+	Items  []types.DeadLetter `json:"items"`
+	Total  int                `json:"total"`
+	Offset int                `json:"offset"`
+	Limit  int                `json:"limit"`
+}
+
+// APIError is a non successful response of the notification-api
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client calls the notification-api
+type Client struct {
+	baseURL    string
+	adminKey   string
+	httpClient *http.Client
+}
+
+func NewClient(baseURL, adminKey string) *Client {
+	return &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		adminKey:   adminKey,
+		httpClient: &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Send sends the notification and returns its id
+func (c *Client) Send(ctx context.Context, notification Notification) (string, error) {
+	var result struct {
+		ID string `json:"id"`
+	}
+	err := c.do(ctx, http.MethodPost, "/send", notification, &result)
+	return result.ID, err
+}
+
+// SendBatch sends the notifications with a single request and returns the result of each of them,
+// a batch without any accepted notification is returned without an error too
+func (c *Client) SendBatch(ctx context.Context, notifications []Notification) (BatchResult, error) {
+	var result BatchResult
+	err := c.do(ctx, http.MethodPost, "/send/batch", notifications, &result)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && len(result.Items) > 0 {
+		return result, nil
+	}
+	return result, err
+}
+
+// GetNotification returns the status of the notification with its history
+func (c *Client) GetNotification(ctx context.Context, id string) (status.Notification, error) {
+	var notification status.Notification
+	err := c.do(ctx, http.MethodGet, "/notifications/"+url.PathEscape(id), nil, &notification)
+	return notification, err
+}
+
+// SearchNotifications returns a page of the notifications matching the filter
+func (c *Client) SearchNotifications(ctx context.Context, filter SearchFilter) (status.Page, error) {
+	query := url.Values{}
+	set := func(name, value string) {
+		if value != "" {
+			query.Set(name, value)
+		}
+	}
+	set("recipient", filter.Recipient)
+	set("channel", filter.Channel)
+	set("status", filter.Status)
+	set("tenant", filter.Tenant)
+	set("sort", filter.Sort)
+	set("cursor", filter.Cursor)
+	for _, tag := range filter.Tags {
+		query.Add("tag", tag)
+	}
+	if !filter.From.IsZero() {
+		query.Set("from", filter.From.Format(time.RFC3339))
+	}
+	if !filter.To.IsZero() {
+		query.Set("to", filter.To.Format(time.RFC3339))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var page status.Page
+	err := c.do(ctx, http.MethodGet, "/notifications?"+query.Encode(), nil, &page)
+	return page, err
+}
+
+func (c *Client) ListDeadLetters(ctx context.Context, channel string, offset, limit int) (DeadLetterPage, error) {
+	query := url.Values{}
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+
+	var page DeadLetterPage
+	err := c.do(ctx, http.MethodGet, "/admin/dlq/"+url.PathEscape(channel)+"?"+query.Encode(), nil, &page)
+	return page, err
+}
+
+func (c *Client) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	var result struct {
+		Requeued int `json:"requeued"`
+	}
+	err := c.do(ctx, http.MethodPost, "/admin/dlq/"+url.PathEscape(channel)+"/requeue", filter, &result)
+	return result.Requeued, err
+}
+
+// PurgeDeadLetters requests a confirmation token and purges the DLQ with it
+func (c *Client) PurgeDeadLetters(ctx context.Context, channel string) (int, error) {
+	var token struct {
+		Token string `json:"token"`
+	}
+	if err := c.do(ctx, http.MethodPost, "/admin/dlq/"+url.PathEscape(channel)+"/purge-token", nil, &token); err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Purged int `json:"purged"`
+	}
+	err := c.do(ctx, http.MethodDelete, "/admin/dlq/"+url.PathEscape(channel)+"?token="+url.QueryEscape(token.Token), nil, &result)
+	return result.Purged, err
+}
+
+func (c *Client) do(ctx context.Context, method, path string, body, result interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to marshal request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.adminKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.adminKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response: %v", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		if resp.StatusCode == http.StatusUnprocessableEntity && result != nil {
+			// unprocessable entities may describe what was wrong in the body of the result
+			json.Unmarshal(data, result)
+		}
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(data))}
+		var echoErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &echoErr) == nil && echoErr.Message != "" {
+			apiErr.Message = echoErr.Message
+		}
+		return apiErr
+	}
+
+	if result != nil {
+		if err := json.Unmarshal(data, result); err != nil {
+			return fmt.Errorf("failed to decode response: %v", err)
+		}
+	}
+	return nil
+}
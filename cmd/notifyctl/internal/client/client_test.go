@@ -0,0 +1,211 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/client"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Client", func() {
+	var (
+		server   *httptest.Server
+		handler  http.HandlerFunc
+		requests []*http.Request
+		c        *client.Client
+		ctx      context.Context
+	)
+
+	BeforeEach(func() {
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			requests = append(requests, r)
+			handler(w, r)
+		}))
+		c = client.NewClient(server.URL+"/", "admin-key")
+		ctx = context.Background()
+	})
+
+	AfterEach(func() {
+		server.Close()
+	})
+
+	When("the api rejects a notification", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write([]byte(`{"message":"Failed to validate body"}`))
+			}
+		})
+
+		It("should return the message of the api", func() {
+			_, err := c.Send(ctx, client.Notification{Channel: "email"})
+			Expect(err).To(MatchError("400 Bad Request: Failed to validate body"))
+			Expect(requests[0].URL.Path).To(Equal("/send"))
+		})
+	})
+
+	When("the api accepts a notification", func() {
+		var body map[string]interface{}
+
+		BeforeEach(func() {
+			body = nil
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				json.NewDecoder(r.Body).Decode(&body)
+				w.WriteHeader(http.StatusAccepted)
+				w.Write([]byte(`{"id":"n1","status":"accepted"}`))
+			}
+		})
+
+		It("should return the id of the notification", func() {
+			id, err := c.Send(ctx, client.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(id).To(Equal("n1"))
+		})
+
+		It("should send the callback url", func() {
+			_, err := c.Send(ctx, client.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", CallbackURL: "https://example.com/hook"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(HaveKeyWithValue("callback_url", "https://example.com/hook"))
+		})
+
+		It("should send the time to send the notification at", func() {
+			sendAt := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			_, err := c.Send(ctx, client.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", SendAt: &sendAt})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(HaveKeyWithValue("send_at", "2026-10-19T10:00:00Z"))
+		})
+
+		It("should send the expiry", func() {
+			expiresAt := time.Date(2026, 10, 19, 10, 0, 0, 0, time.UTC)
+			_, err := c.Send(ctx, client.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", ExpiresAt: &expiresAt, TTL: "10m"})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(body).To(HaveKeyWithValue("expires_at", "2026-10-19T10:00:00Z"))
+			Expect(body).To(HaveKeyWithValue("ttl", "10m"))
+		})
+	})
+
+	When("sending a batch", func() {
+		var code int
+
+		BeforeEach(func() {
+			code = http.StatusAccepted
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				var notifications []client.Notification
+				Expect(json.NewDecoder(r.Body).Decode(&notifications)).To(Succeed())
+				Expect(notifications).To(HaveLen(2))
+				w.WriteHeader(code)
+				w.Write([]byte(`{"batch_id":"b1","accepted":1,"rejected":1,"items":[{"index":0,"id":"n1"},{"index":1,"error":"invalid content: required"}]}`))
+			}
+		})
+
+		It("should return the result of every notification", func() {
+			result, err := c.SendBatch(ctx, []client.Notification{{Channel: "email"}, {Channel: "sms"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests[0].URL.Path).To(Equal("/send/batch"))
+			Expect(result.BatchID).To(Equal("b1"))
+			Expect(result.Items).To(Equal([]client.BatchItem{{Index: 0, ID: "n1"}, {Index: 1, Error: "invalid content: required"}}))
+		})
+
+		It("should return the results when no notification was accepted", func() {
+			code = http.StatusUnprocessableEntity
+			result, err := c.SendBatch(ctx, []client.Notification{{Channel: "email"}, {Channel: "sms"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Items).To(HaveLen(2))
+		})
+	})
+
+	When("getting the status of a notification", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"id":"n1","state":"delivered","attempts":1,"history":[{"seq":1,"notification_id":"n1","state":"accepted"},{"seq":2,"notification_id":"n1","state":"delivered","attempt":1}]}`))
+			}
+		})
+
+		It("should decode the history", func() {
+			notification, err := c.GetNotification(ctx, "n1")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(notification.State).To(Equal(status.StateDelivered))
+			Expect(notification.History).To(HaveLen(2))
+			Expect(requests[0].URL.Path).To(Equal("/notifications/n1"))
+		})
+	})
+
+	When("searching notifications", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(`{"items":[{"id":"n1","state":"delivered"}],"next_cursor":"abc"}`))
+			}
+		})
+
+		It("should send the filters as query parameters", func() {
+			page, err := c.SearchNotifications(ctx, client.SearchFilter{
+				Recipient: "+359888123456",
+				Status:    "delivered,failed",
+				Tags:      []string{"otp", "login"},
+				From:      time.Date(2026, 10, 13, 0, 0, 0, 0, time.UTC),
+				Limit:     10,
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(page.Items).To(HaveLen(1))
+			Expect(page.NextCursor).To(Equal("abc"))
+
+			query := requests[0].URL.Query()
+			Expect(requests[0].URL.Path).To(Equal("/notifications"))
+			Expect(query.Get("recipient")).To(Equal("+359888123456"))
+			Expect(query.Get("status")).To(Equal("delivered,failed"))
+			Expect(query["tag"]).To(Equal([]string{"otp", "login"}))
+			Expect(query.Get("from")).To(Equal("2026-10-13T00:00:00Z"))
+			Expect(query.Get("limit")).To(Equal("10"))
+			Expect(query.Has("channel")).To(BeFalse())
+		})
+	})
+
+	When("requeueing dead letters", func() {
+		var filter types.DeadLetterFilter
+
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				Expect(json.NewDecoder(r.Body).Decode(&filter)).To(Succeed())
+				w.Write([]byte(`{"requeued":2}`))
+			}
+		})
+
+		It("should send the filter with the admin key", func() {
+			requeued, err := c.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{IDs: []string{"a", "b"}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requeued).To(Equal(2))
+			Expect(filter.IDs).To(Equal([]string{"a", "b"}))
+			Expect(requests[0].URL.Path).To(Equal("/admin/dlq/sms/requeue"))
+			Expect(requests[0].Header.Get("Authorization")).To(Equal("Bearer admin-key"))
+		})
+	})
+
+	When("purging dead letters", func() {
+		BeforeEach(func() {
+			handler = func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodPost {
+					w.Write([]byte(`{"token":"123.abc","expires_at":"2026-10-19T10:00:00Z"}`))
+					return
+				}
+				w.Write([]byte(`{"purged":7}`))
+			}
+		})
+
+		It("should confirm the purge with the issued token", func() {
+			purged, err := c.PurgeDeadLetters(ctx, "sms")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(purged).To(Equal(7))
+			Expect(requests).To(HaveLen(2))
+			Expect(requests[1].Method).To(Equal(http.MethodDelete))
+			Expect(requests[1].URL.Query().Get("token")).To(Equal("123.abc"))
+		})
+	})
+})
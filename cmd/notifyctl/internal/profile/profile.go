@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const DefaultName = "default"
+
+// Profile holds the connection settings of one environment
+type Profile struct {
+	URL      string `json:"url"`
+	AdminKey string `json:"admin_key,omitempty"`
+}
+
+// Config is the content of the notifyctl config file
+type Config struct {
+	Current  string             `json:"current"`
+	Profiles map[string]Profile `json:"profiles"`
+}
+
+// DefaultPath returns $NOTIFYCTL_CONFIG or the notifyctl config file in the user config dir
+func DefaultPath() (string, error) {
+	if path := os.Getenv("NOTIFYCTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find config dir: %v", err)
+	}
+	return filepath.Join(dir, "notifyctl", "config.json"), nil
+}
+
+// Load reads the config file, a missing file results in an empty config
+func Load(path string) (Config, error) {
+	config := Config{Profiles: map[string]Profile{}}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return Config{}, fmt.Errorf("failed to read config: %v", err)
+	}
+
+	if err := json.Unmarshal(data, &config); err != nil {
+		return Config{}, fmt.Errorf("failed to parse config %s: %v", path, err)
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]Profile{}
+	}
+	return config, nil
+}
+
+// Save writes the config file readable only by the user as it contains api keys
+func Save(path string, config Config) error {
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config dir: %v", err)
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// Resolve returns the named profile, the current one when name is empty
+func (c Config) Resolve(name string) (Profile, error) {
+	if name == "" {
+		name = c.Current
+	}
+	if name == "" {
+		name = DefaultName
+	}
+
+	p, ok := c.Profiles[name]
+	if !ok {
+		if name == DefaultName {
+			return Profile{URL: "http://localhost:8080"}, nil
+		}
+		return Profile{}, fmt.Errorf("unknown profile: %s", name)
+	}
+	return p, nil
+}
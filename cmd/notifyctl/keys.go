@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/profile"
+)
+
+// keySize is the number of random bytes of a generated api key
+const keySize = 32
+
+// key manages the admin api key. The notification-api has a single key, its ADMIN_API_KEY, so a key is
+// generated here, deployed as ADMIN_API_KEY and stored in the profiles which use it.
+func (a *app) key(args []string) error {
+	if len(args) == 0 || args[0] != "generate" {
+		return usageError{"usage: notifyctl key generate [-save <profile>]"}
+	}
+	fs := a.newFlagSet("key generate")
+	save := fs.String("save", "", "profile to store the key in")
+	if err := parseFlags(fs, args[1:]); err != nil {
+		return err
+	}
+
+	var config profile.Config
+	if *save != "" {
+		var err error
+		if config, err = profile.Load(a.configPath); err != nil {
+			return err
+		}
+		if _, ok := config.Profiles[*save]; !ok {
+			return usageError{fmt.Sprintf("unknown profile: %s", *save)}
+		}
+	}
+
+	b := make([]byte, keySize)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("failed to generate key: %v", err)
+	}
+	key := hex.EncodeToString(b)
+
+	if *save != "" {
+		p := config.Profiles[*save]
+		p.AdminKey = key
+		config.Profiles[*save] = p
+		if err := profile.Save(a.configPath, config); err != nil {
+			return err
+		}
+	}
+
+	return a.print(map[string]string{"key": key}, func(w io.Writer) {
+		fmt.Fprintln(w, key)
+	})
+}
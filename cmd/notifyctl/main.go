@@ -0,0 +1,203 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"text/tabwriter"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/client"
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/profile"
+)
+
+// exit codes for scripting
+const (
+	exitOK             = 0
+	exitFailure        = 1
+	exitUsage          = 2
+	exitPartialFailure = 3
+)
+
+const usage = `usage: notifyctl [flags] <command> [args]
+
+commands:
+  send      send notifications from flags or JSON/NDJSON
+  status    show the status of a notification with its history
+  search    search the notification history
+  dlq       list, requeue and purge dead letters
+  template  list and render the content templates of a template directory
+  key       generate an admin api key
+  profile   manage the environment profiles
+
+flags:
+`
+
+// usageError is an invalid invocation, it exits with exitUsage
+type usageError struct {
+	msg string
+}
+
+func (e usageError) Error() string {
+	return e.msg
+}
+
+// partialError reports that only some items of a batch failed, it exits with exitPartialFailure
+type partialError struct {
+	failed, total int
+}
+
+func (e partialError) Error() string {
+	return fmt.Sprintf("%d of %d notifications failed", e.failed, e.total)
+}
+
+type app struct {
+	client     *client.Client
+	configPath string
+	output     string
+	stdin      io.Reader
+	stdout     io.Writer
+	stderr     io.Writer
+}
+
+func main() {
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("notifyctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	profileName := fs.String("profile", os.Getenv("NOTIFYCTL_PROFILE"), "profile to use, defaults to the current profile")
+	url := fs.String("url", "", "notification-api url, overrides the profile")
+	adminKey := fs.String("admin-key", os.Getenv("NOTIFYCTL_ADMIN_KEY"), "admin api key, overrides the profile")
+	output := fs.String("o", "table", "output format, table or json")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if *output != "table" && *output != "json" {
+		fmt.Fprintf(stderr, "unknown output format: %s\n", *output)
+		return exitUsage
+	}
+
+	configPath, err := profile.DefaultPath()
+	if err != nil {
+		fmt.Fprintln(stderr, err)
+		return exitFailure
+	}
+
+	a := &app{
+		configPath: configPath,
+		output:     *output,
+		stdin:      stdin,
+		stdout:     stdout,
+		stderr:     stderr,
+	}
+
+	command, commandArgs := fs.Arg(0), fs.Args()[1:]
+	// the local commands need no api
+	if command != "profile" && command != "template" && command != "key" {
+		config, err := profile.Load(configPath)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitFailure
+		}
+		p, err := config.Resolve(*profileName)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return exitUsage
+		}
+		if *url != "" {
+			p.URL = *url
+		}
+		if *adminKey != "" {
+			p.AdminKey = *adminKey
+		}
+		a.client = client.NewClient(p.URL, p.AdminKey)
+	}
+
+	switch command {
+	case "send":
+		err = a.send(ctx, commandArgs)
+	case "status":
+		err = a.status(ctx, commandArgs)
+	case "search":
+		err = a.search(ctx, commandArgs)
+	case "dlq":
+		err = a.dlq(ctx, commandArgs)
+	case "template":
+		err = a.template(commandArgs)
+	case "key":
+		err = a.key(commandArgs)
+	case "profile":
+		err = a.profile(commandArgs)
+	default:
+		err = usageError{fmt.Sprintf("unknown command: %s", command)}
+	}
+
+	return exitCode(err, stderr)
+}
+
+func exitCode(err error, stderr io.Writer) int {
+	if err == nil || errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	fmt.Fprintln(stderr, "error:", err)
+
+	var usageErr usageError
+	var partialErr partialError
+	switch {
+	case errors.As(err, &usageErr):
+		return exitUsage
+	case errors.As(err, &partialErr):
+		return exitPartialFailure
+	default:
+		return exitFailure
+	}
+}
+
+// print writes v as JSON or calls table with a tabwriter
+func (a *app) print(v interface{}, table func(w io.Writer)) error {
+	if a.output == "json" {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	table(w)
+	return w.Flush()
+}
+
+// newFlagSet creates the flag set of a sub command, parse errors are reported as usage errors
+func (a *app) newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	return fs
+}
+
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{fmt.Sprintf("%s: %v", fs.Name(), err)}
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/profile"
+)
+
+func (a *app) profile(args []string) error {
+	if len(args) == 0 {
+		return usageError{"usage: notifyctl profile <list|set|use> [name] [flags]"}
+	}
+
+	config, err := profile.Load(a.configPath)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		return a.profileList(config)
+	case "set":
+		if len(args) < 2 {
+			return usageError{"usage: notifyctl profile set <name> -url <url> [-admin-key <key>]"}
+		}
+		fs := a.newFlagSet("profile set")
+		url := fs.String("url", "", "notification-api url")
+		adminKey := fs.String("admin-key", "", "admin api key")
+		if err := parseFlags(fs, args[2:]); err != nil {
+			return err
+		}
+		if *url == "" {
+			return usageError{"profile set: -url is required"}
+		}
+
+		config.Profiles[args[1]] = profile.Profile{URL: *url, AdminKey: *adminKey}
+		if config.Current == "" {
+			config.Current = args[1]
+		}
+		return profile.Save(a.configPath, config)
+	case "use":
+		if len(args) < 2 {
+			return usageError{"usage: notifyctl profile use <name>"}
+		}
+		if _, ok := config.Profiles[args[1]]; !ok {
+			return usageError{fmt.Sprintf("unknown profile: %s", args[1])}
+		}
+		config.Current = args[1]
+		return profile.Save(a.configPath, config)
+	default:
+		return usageError{fmt.Sprintf("unknown profile command: %s", args[0])}
+	}
+}
+
+func (a *app) profileList(config profile.Config) error {
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// api keys are never printed
+	type entry struct {
+		Name    string `json:"name"`
+		URL     string `json:"url"`
+		Current bool   `json:"current"`
+	}
+	entries := make([]entry, 0, len(names))
+	for _, name := range names {
+		entries = append(entries, entry{Name: name, URL: config.Profiles[name].URL, Current: name == config.Current})
+	}
+
+	return a.print(entries, func(w io.Writer) {
+		fmt.Fprintln(w, "CURRENT\tNAME\tURL")
+		for _, e := range entries {
+			current := ""
+			if e.Current {
+				current = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\n", current, e.Name, e.URL)
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/client"
+)
+
+type sendResult struct {
+	Index    int    `json:"index"`
+	Channel  string `json:"channel"`
+	Receiver string `json:"receiver"`
+	ID       string `json:"id,omitempty"`
+	BatchID  string `json:"batch_id,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+}
+
+// send sends a single notification described by flags, or every notification read with -f
+func (a *app) send(ctx context.Context, args []string) error {
+	fs := a.newFlagSet("send")
+	channel := fs.String("channel", "", "notification channel")
+	receiver := fs.String("receiver", "", "notification receiver")
+	content := fs.String("content", "", "notification content")
+	priority := fs.String("priority", "", "low, normal or high")
+	tenant := fs.String("tenant", "", "tenant of the notification")
+	var tags stringList
+	fs.Var(&tags, "tag", "tag of the notification, can be repeated")
+	callbackURL := fs.String("callback-url", "", "url notified once the notification is delivered or failed for good")
+	sendAt := fs.String("send-at", "", "time to send the notification at (RFC 3339)")
+	expiresAt := fs.String("expires-at", "", "time the notification is dropped at instead of sent late (RFC 3339)")
+	ttl := fs.String("ttl", "", "duration after which the notification is dropped instead of sent late, e.g. 10m")
+	file := fs.String("f", "", "read a JSON object, a JSON array or NDJSON from the file, - for stdin")
+	batchSize := fs.Int("batch-size", 1000, "notifications sent per request to /send/batch, 1 sends them one by one to /send")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	var notifications []client.Notification
+	if *file != "" {
+		var err error
+		notifications, err = a.readNotifications(*file)
+		if err != nil {
+			return err
+		}
+	} else {
+		if *channel == "" || *receiver == "" || *content == "" {
+			return usageError{"send: -channel, -receiver and -content are required without -f"}
+		}
+		n := client.Notification{
+			Channel:     *channel,
+			Content:     *content,
+			Receiver:    *receiver,
+			Priority:    *priority,
+			Tenant:      *tenant,
+			Tags:        tags,
+			CallbackURL: *callbackURL,
+			TTL:         *ttl,
+		}
+		if *sendAt != "" {
+			t, err := time.Parse(time.RFC3339, *sendAt)
+			if err != nil {
+				return usageError{fmt.Sprintf("send: invalid -send-at: %v", err)}
+			}
+			n.SendAt = &t
+		}
+		if *expiresAt != "" {
+			t, err := time.Parse(time.RFC3339, *expiresAt)
+			if err != nil {
+				return usageError{fmt.Sprintf("send: invalid -expires-at: %v", err)}
+			}
+			n.ExpiresAt = &t
+		}
+		notifications = []client.Notification{n}
+	}
+
+	if *batchSize < 1 {
+		return usageError{"send: -batch-size has to be at least 1"}
+	}
+
+	var results []sendResult
+	if len(notifications) > 1 && *batchSize > 1 {
+		results = a.sendBatches(ctx, notifications, *batchSize)
+	} else {
+		results = a.sendEach(ctx, notifications)
+	}
+	failed := 0
+	for _, r := range results {
+		if r.Status == "failed" {
+			failed++
+		}
+	}
+
+	err := a.print(results, func(w io.Writer) {
+		fmt.Fprintln(w, "INDEX\tCHANNEL\tRECEIVER\tID\tSTATUS\tERROR")
+		batchID := ""
+		for _, r := range results {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Index, r.Channel, r.Receiver, r.ID, r.Status, r.Error)
+		}
+		for _, r := range results {
+			if r.BatchID != "" && r.BatchID != batchID {
+				batchID = r.BatchID
+				fmt.Fprintf(w, "batch: %s\n", batchID)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case failed == 0 && len(results) == len(notifications):
+		return nil
+	case failed == len(notifications):
+		return fmt.Errorf("all notifications failed")
+	default:
+		return partialError{failed: failed + len(notifications) - len(results), total: len(notifications)}
+	}
+}
+
+// sendEach sends the notifications one by one to /send
+func (a *app) sendEach(ctx context.Context, notifications []client.Notification) []sendResult {
+	results := make([]sendResult, 0, len(notifications))
+	for i, n := range notifications {
+		result := sendResult{Index: i, Channel: n.Channel, Receiver: n.Receiver, Status: "accepted"}
+		id, err := a.client.Send(ctx, n)
+		result.ID = id
+		if err != nil {
+			result.Status = "failed"
+			result.Error = err.Error()
+		}
+		results = append(results, result)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return results
+}
+
+// sendBatches sends the notifications in batches of the size to /send/batch
+func (a *app) sendBatches(ctx context.Context, notifications []client.Notification, size int) []sendResult {
+	results := make([]sendResult, 0, len(notifications))
+	for start := 0; start < len(notifications) && ctx.Err() == nil; start += size {
+		batch := notifications[start:min(start+size, len(notifications))]
+		batchResult, err := a.client.SendBatch(ctx, batch)
+
+		for i, n := range batch {
+			result := sendResult{Index: start + i, Channel: n.Channel, Receiver: n.Receiver, BatchID: batchResult.BatchID, Status: "accepted"}
+			switch {
+			case err != nil:
+				result.Error = err.Error()
+			case i >= len(batchResult.Items):
+				result.Error = "missing in the batch response"
+			default:
+				result.ID = batchResult.Items[i].ID
+				result.Error = batchResult.Items[i].Error
+			}
+			if result.Error != "" {
+				result.Status = "failed"
+			}
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// readNotifications decodes a JSON array or a stream of JSON objects, which covers NDJSON
+func (a *app) readNotifications(file string) ([]client.Notification, error) {
+	var r io.Reader = a.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %v", file, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	first, err := peekNonSpace(br)
+	if err != nil {
+		return nil, usageError{"send: no notifications in input"}
+	}
+
+	var notifications []client.Notification
+	dec := json.NewDecoder(br)
+	dec.DisallowUnknownFields()
+
+	if first == '[' {
+		if err := dec.Decode(&notifications); err != nil {
+			return nil, usageError{fmt.Sprintf("send: invalid JSON array: %v", err)}
+		}
+		return notifications, nil
+	}
+
+	for {
+		var n client.Notification
+		err := dec.Decode(&n)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, usageError{fmt.Sprintf("send: invalid notification %d: %v", len(notifications), err)}
+		}
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+func peekNonSpace(br *bufio.Reader) (byte, error) {
+	for {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if b != ' ' && b != '\t' && b != '\n' && b != '\r' {
+			return b, br.UnreadByte()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/cmd/notifyctl/internal/client"
+)
+
+func (a *app) status(ctx context.Context, args []string) error {
+	fs := a.newFlagSet("status")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return usageError{"usage: notifyctl status <id>"}
+	}
+
+	notification, err := a.client.GetNotification(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	return a.print(notification, func(w io.Writer) {
+		fmt.Fprintf(w, "ID:\t%s\n", notification.ID)
+		fmt.Fprintf(w, "CHANNEL:\t%s\n", notification.Channel)
+		fmt.Fprintf(w, "RECEIVER:\t%s\n", notification.Receiver)
+		fmt.Fprintf(w, "STATE:\t%s\n", notification.State)
+		fmt.Fprintf(w, "ATTEMPTS:\t%d\n", notification.Attempts)
+		fmt.Fprintln(w)
+		fmt.Fprintln(w, "TIME\tSTATE\tATTEMPT\tHOST\tERROR")
+		for _, e := range notification.History {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\n", e.Time.Format(time.RFC3339), e.State, e.Attempt, e.Host, e.Error)
+		}
+	})
+}
+
+func (a *app) search(ctx context.Context, args []string) error {
+	var (
+		filter client.SearchFilter
+		tags   stringList
+	)
+	fs := a.newFlagSet("search")
+	fs.StringVar(&filter.Recipient, "recipient", "", "receiver the notifications were sent to")
+	fs.StringVar(&filter.Channel, "channel", "", "channel of the notifications")
+	fs.StringVar(&filter.Status, "status", "", "comma separated states of the notifications")
+	fs.StringVar(&filter.Tenant, "tenant", "", "tenant of the notifications")
+	fs.Var(&tags, "tag", "tag of the notifications, can be repeated")
+	from := fs.String("from", "", "notifications created at or after the RFC 3339 time")
+	to := fs.String("to", "", "notifications created before the RFC 3339 time")
+	since := fs.Duration("since", 0, "notifications created in the last duration, e.g. 168h")
+	fs.StringVar(&filter.Sort, "sort", "", "created_at, -created_at, updated_at or -updated_at")
+	fs.StringVar(&filter.Cursor, "cursor", "", "cursor of the next page")
+	fs.IntVar(&filter.Limit, "limit", 50, "maximum number of notifications")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	filter.Tags = tags
+
+	var err error
+	if filter.From, err = parseTime(*from); err != nil {
+		return usageError{fmt.Sprintf("search: invalid -from: %v", err)}
+	}
+	if filter.To, err = parseTime(*to); err != nil {
+		return usageError{fmt.Sprintf("search: invalid -to: %v", err)}
+	}
+	if *since > 0 {
+		filter.From = time.Now().Add(-*since)
+	}
+
+	page, err := a.client.SearchNotifications(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	return a.print(page, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tCREATED\tCHANNEL\tRECEIVER\tTENANT\tSTATE\tATTEMPTS")
+		for _, n := range page.Items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\n", n.ID, n.CreatedAt.Format(time.RFC3339), n.Channel, n.Receiver, n.Tenant, n.State, n.Attempts)
+		}
+		if page.NextCursor != "" {
+			fmt.Fprintf(w, "next page: -cursor %s\n", page.NextCursor)
+		}
+	})
+}
+
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
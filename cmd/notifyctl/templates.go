@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+)
+
+// template manages the content templates. The notification-api loads them from the files of its
+// TEMPLATE_DIR on start, so they are checked and previewed locally before they are deployed there.
+func (a *app) template(args []string) error {
+	if len(args) == 0 {
+		return usageError{"usage: notifyctl template <list|render> [name] [flags]"}
+	}
+
+	switch args[0] {
+	case "list":
+		fs := a.newFlagSet("template list")
+		dir := fs.String("dir", os.Getenv("NOTIFYCTL_TEMPLATE_DIR"), "template directory")
+		if err := parseFlags(fs, args[1:]); err != nil {
+			return err
+		}
+
+		t, err := loadTemplates(*dir)
+		if err != nil {
+			return err
+		}
+		names := t.Names()
+		return a.print(names, func(w io.Writer) {
+			fmt.Fprintln(w, "NAME")
+			for _, name := range names {
+				fmt.Fprintln(w, name)
+			}
+		})
+	case "render":
+		if len(args) < 2 {
+			return usageError{"usage: notifyctl template render <name> [-dir <dir>] [-var name=value ...]"}
+		}
+		var vars stringList
+		fs := a.newFlagSet("template render")
+		dir := fs.String("dir", os.Getenv("NOTIFYCTL_TEMPLATE_DIR"), "template directory")
+		fs.Var(&vars, "var", "variable of the template as name=value, can be repeated")
+		if err := parseFlags(fs, args[2:]); err != nil {
+			return err
+		}
+
+		values := make(map[string]string, len(vars))
+		for _, v := range vars {
+			name, value, ok := strings.Cut(v, "=")
+			if !ok {
+				return usageError{fmt.Sprintf("template render: invalid variable %q, expected name=value", v)}
+			}
+			values[name] = value
+		}
+
+		t, err := loadTemplates(*dir)
+		if err != nil {
+			return err
+		}
+		content, err := t.Render(args[1], values)
+		if err != nil {
+			return err
+		}
+		return a.print(map[string]string{"name": args[1], "content": content}, func(w io.Writer) {
+			fmt.Fprintln(w, content)
+		})
+	default:
+		return usageError{fmt.Sprintf("unknown template command: %s", args[0])}
+	}
+}
+
+// loadTemplates parses the templates like the notification-api does, a template which does not parse fails
+func loadTemplates(dir string) (*templates.Templates, error) {
+	if dir == "" {
+		return nil, usageError{"-dir or NOTIFYCTL_TEMPLATE_DIR is required"}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return templates.Load(dir)
+}
@@ -0,0 +1,440 @@
+package amqptest
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	frameMethod    = 1
+	frameHeader    = 2
+	frameBody      = 3
+	frameHeartbeat = 8
+	frameEnd       = 0xCE
+
+	frameMax = 131072
+)
+
+// content properties flags in the order they are encoded
+const (
+	flagContentType     = 0x8000
+	flagContentEncoding = 0x4000
+	flagHeaders         = 0x2000
+	flagDeliveryMode    = 0x1000
+	flagPriority        = 0x0800
+	flagCorrelationId   = 0x0400
+	flagReplyTo         = 0x0200
+	flagExpiration      = 0x0100
+	flagMessageId       = 0x0080
+	flagTimestamp       = 0x0040
+	flagType            = 0x0020
+	flagUserId          = 0x0010
+	flagAppId           = 0x0008
+)
+
+var protocolHeader = []byte("AMQP\x00\x00\x09\x01")
+
+var errSyntax = errors.New("malformed frame")
+
+type frame struct {
+	typ     byte
+	channel uint16
+	payload []byte
+}
+
+func readFrame(r *bufio.Reader) (frame, error) {
+	var head [7]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return frame{}, err
+	}
+
+	size := binary.BigEndian.Uint32(head[3:7])
+	if size > frameMax {
+		return frame{}, fmt.Errorf("frame of %d bytes exceeds the frame max", size)
+	}
+
+	payload := make([]byte, size+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return frame{}, err
+	}
+	if payload[size] != frameEnd {
+		return frame{}, errSyntax
+	}
+
+	return frame{
+		typ:     head[0],
+		channel: binary.BigEndian.Uint16(head[1:3]),
+		payload: payload[:size],
+	}, nil
+}
+
+func encodeFrame(typ byte, channel uint16, payload []byte) []byte {
+	buf := make([]byte, 7, len(payload)+8)
+	buf[0] = typ
+	binary.BigEndian.PutUint16(buf[1:3], channel)
+	binary.BigEndian.PutUint32(buf[3:7], uint32(len(payload)))
+	buf = append(buf, payload...)
+	return append(buf, frameEnd)
+}
+
+// decoder reads the fields of a method or content header, consecutive bits are packed into one octet
+type decoder struct {
+	buf  []byte
+	pos  int
+	bits byte
+	bit  uint
+	err  error
+}
+
+func (d *decoder) take(n int) []byte {
+	d.bit = 0
+	if d.err != nil {
+		return make([]byte, n)
+	}
+	if d.pos+n > len(d.buf) {
+		d.err = errSyntax
+		return make([]byte, n)
+	}
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b
+}
+
+func (d *decoder) octet() uint8     { return d.take(1)[0] }
+func (d *decoder) short() uint16    { return binary.BigEndian.Uint16(d.take(2)) }
+func (d *decoder) long() uint32     { return binary.BigEndian.Uint32(d.take(4)) }
+func (d *decoder) longlong() uint64 { return binary.BigEndian.Uint64(d.take(8)) }
+
+func (d *decoder) shortstr() string {
+	return string(d.take(int(d.octet())))
+}
+
+func (d *decoder) longstr() string {
+	return string(d.take(int(d.long())))
+}
+
+func (d *decoder) bitField() bool {
+	if d.bit == 0 {
+		d.bits = d.octet()
+	}
+	v := d.bits&(1<<d.bit) != 0
+	d.bit = (d.bit + 1) % 8
+	return v
+}
+
+func (d *decoder) table() amqp.Table {
+	inner := &decoder{buf: d.take(int(d.long()))}
+	if d.err != nil {
+		return nil
+	}
+
+	table := amqp.Table{}
+	for inner.pos < len(inner.buf) && inner.err == nil {
+		key := inner.shortstr()
+		table[key] = inner.field()
+	}
+	if inner.err != nil {
+		d.err = inner.err
+	}
+	return table
+}
+
+func (d *decoder) field() interface{} {
+	switch d.octet() {
+	case 't':
+		return d.octet() != 0
+	case 'b':
+		return d.octet()
+	case 's':
+		return int16(d.short())
+	case 'I':
+		return int32(d.long())
+	case 'l':
+		return int64(d.longlong())
+	case 'f':
+		return math.Float32frombits(d.long())
+	case 'd':
+		return math.Float64frombits(d.longlong())
+	case 'D':
+		scale := d.octet()
+		return amqp.Decimal{Scale: scale, Value: int32(d.long())}
+	case 'S':
+		return d.longstr()
+	case 'A':
+		inner := &decoder{buf: d.take(int(d.long()))}
+		var values []interface{}
+		for inner.pos < len(inner.buf) && inner.err == nil {
+			values = append(values, inner.field())
+		}
+		if inner.err != nil {
+			d.err = inner.err
+		}
+		return values
+	case 'T':
+		return time.Unix(int64(d.longlong()), 0)
+	case 'F':
+		return d.table()
+	case 'x':
+		return append([]byte{}, d.take(int(d.long()))...)
+	case 'V':
+		return nil
+	default:
+		d.err = errSyntax
+		return nil
+	}
+}
+
+// encoder writes the fields of a method or content header
+type encoder struct {
+	buf    bytes.Buffer
+	bits   byte
+	bit    uint
+	inBits bool
+}
+
+func (e *encoder) flushBits() {
+	if e.inBits {
+		e.buf.WriteByte(e.bits)
+		e.bits, e.bit, e.inBits = 0, 0, false
+	}
+}
+
+func (e *encoder) octet(v uint8) {
+	e.flushBits()
+	e.buf.WriteByte(v)
+}
+
+func (e *encoder) short(v uint16) {
+	e.flushBits()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) long(v uint32) {
+	e.flushBits()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) longlong(v uint64) {
+	e.flushBits()
+	binary.Write(&e.buf, binary.BigEndian, v)
+}
+
+func (e *encoder) shortstr(v string) {
+	e.octet(uint8(len(v)))
+	e.buf.WriteString(v)
+}
+
+func (e *encoder) longstr(v string) {
+	e.long(uint32(len(v)))
+	e.buf.WriteString(v)
+}
+
+func (e *encoder) bitField(v bool) {
+	e.inBits = true
+	if v {
+		e.bits |= 1 << e.bit
+	}
+	e.bit++
+	if e.bit == 8 {
+		e.flushBits()
+	}
+}
+
+func (e *encoder) table(table amqp.Table) {
+	inner := &encoder{}
+	for key, value := range table {
+		inner.shortstr(key)
+		inner.field(value)
+	}
+	e.long(uint32(inner.buf.Len()))
+	e.buf.Write(inner.buf.Bytes())
+}
+
+func (e *encoder) field(value interface{}) {
+	switch v := value.(type) {
+	case bool:
+		e.octet('t')
+		if v {
+			e.octet(1)
+		} else {
+			e.octet(0)
+		}
+	case byte:
+		e.octet('b')
+		e.octet(v)
+	case int16:
+		e.octet('s')
+		e.short(uint16(v))
+	case int:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case int32:
+		e.octet('I')
+		e.long(uint32(v))
+	case int64:
+		e.octet('l')
+		e.longlong(uint64(v))
+	case float32:
+		e.octet('f')
+		e.long(math.Float32bits(v))
+	case float64:
+		e.octet('d')
+		e.longlong(math.Float64bits(v))
+	case amqp.Decimal:
+		e.octet('D')
+		e.octet(v.Scale)
+		e.long(uint32(v.Value))
+	case string:
+		e.octet('S')
+		e.longstr(v)
+	case []interface{}:
+		inner := &encoder{}
+		for _, item := range v {
+			inner.field(item)
+		}
+		e.octet('A')
+		e.long(uint32(inner.buf.Len()))
+		e.buf.Write(inner.buf.Bytes())
+	case time.Time:
+		e.octet('T')
+		e.longlong(uint64(v.Unix()))
+	case amqp.Table:
+		e.octet('F')
+		e.table(v)
+	case []byte:
+		e.octet('x')
+		e.long(uint32(len(v)))
+		e.buf.Write(v)
+	default:
+		e.octet('V')
+	}
+}
+
+func (e *encoder) bytes() []byte {
+	e.flushBits()
+	return e.buf.Bytes()
+}
+
+// properties are the content header fields of a message, flags records which of them are present
+type properties struct {
+	flags           uint16
+	contentType     string
+	contentEncoding string
+	headers         amqp.Table
+	deliveryMode    uint8
+	priority        uint8
+	correlationId   string
+	replyTo         string
+	expiration      string
+	messageId       string
+	timestamp       time.Time
+	typ             string
+	userId          string
+	appId           string
+}
+
+func decodeHeader(payload []byte) (bodySize uint64, props properties, err error) {
+	d := &decoder{buf: payload}
+	d.short() // class
+	d.short() // weight
+	bodySize = d.longlong()
+	props.flags = d.short()
+
+	if props.flags&flagContentType != 0 {
+		props.contentType = d.shortstr()
+	}
+	if props.flags&flagContentEncoding != 0 {
+		props.contentEncoding = d.shortstr()
+	}
+	if props.flags&flagHeaders != 0 {
+		props.headers = d.table()
+	}
+	if props.flags&flagDeliveryMode != 0 {
+		props.deliveryMode = d.octet()
+	}
+	if props.flags&flagPriority != 0 {
+		props.priority = d.octet()
+	}
+	if props.flags&flagCorrelationId != 0 {
+		props.correlationId = d.shortstr()
+	}
+	if props.flags&flagReplyTo != 0 {
+		props.replyTo = d.shortstr()
+	}
+	if props.flags&flagExpiration != 0 {
+		props.expiration = d.shortstr()
+	}
+	if props.flags&flagMessageId != 0 {
+		props.messageId = d.shortstr()
+	}
+	if props.flags&flagTimestamp != 0 {
+		props.timestamp = time.Unix(int64(d.longlong()), 0)
+	}
+	if props.flags&flagType != 0 {
+		props.typ = d.shortstr()
+	}
+	if props.flags&flagUserId != 0 {
+		props.userId = d.shortstr()
+	}
+	if props.flags&flagAppId != 0 {
+		props.appId = d.shortstr()
+	}
+	return bodySize, props, d.err
+}
+
+func encodeHeader(bodySize int, props properties) []byte {
+	e := &encoder{}
+	e.short(classBasic)
+	e.short(0)
+	e.longlong(uint64(bodySize))
+	e.short(props.flags)
+
+	if props.flags&flagContentType != 0 {
+		e.shortstr(props.contentType)
+	}
+	if props.flags&flagContentEncoding != 0 {
+		e.shortstr(props.contentEncoding)
+	}
+	if props.flags&flagHeaders != 0 {
+		e.table(props.headers)
+	}
+	if props.flags&flagDeliveryMode != 0 {
+		e.octet(props.deliveryMode)
+	}
+	if props.flags&flagPriority != 0 {
+		e.octet(props.priority)
+	}
+	if props.flags&flagCorrelationId != 0 {
+		e.shortstr(props.correlationId)
+	}
+	if props.flags&flagReplyTo != 0 {
+		e.shortstr(props.replyTo)
+	}
+	if props.flags&flagExpiration != 0 {
+		e.shortstr(props.expiration)
+	}
+	if props.flags&flagMessageId != 0 {
+		e.shortstr(props.messageId)
+	}
+	if props.flags&flagTimestamp != 0 {
+		e.longlong(uint64(props.timestamp.Unix()))
+	}
+	if props.flags&flagType != 0 {
+		e.shortstr(props.typ)
+	}
+	if props.flags&flagUserId != 0 {
+		e.shortstr(props.userId)
+	}
+	if props.flags&flagAppId != 0 {
+		e.shortstr(props.appId)
+	}
+	return e.bytes()
+}
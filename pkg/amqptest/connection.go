@@ -0,0 +1,969 @@
+package amqptest
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	classConnection = 10
+	classChannel    = 20
+	classExchange   = 40
+	classQueue      = 50
+	classBasic      = 60
+	classConfirm    = 85
+)
+
+// method ids are shared by all classes, the class tells them apart
+const (
+	connectionStart   = 10
+	connectionStartOk = 11
+	connectionTune    = 30
+	connectionTuneOk  = 31
+	connectionOpen    = 40
+	connectionOpenOk  = 41
+	connectionClose   = 50
+	connectionCloseOk = 51
+
+	channelOpen    = 10
+	channelOpenOk  = 11
+	channelFlow    = 20
+	channelFlowOk  = 21
+	channelClose   = 40
+	channelCloseOk = 41
+
+	exchangeDeclare   = 10
+	exchangeDeclareOk = 11
+	exchangeDelete    = 20
+	exchangeDeleteOk  = 21
+
+	queueDeclare   = 10
+	queueDeclareOk = 11
+	queueBind      = 20
+	queueBindOk    = 21
+	queuePurge     = 30
+	queuePurgeOk   = 31
+	queueDelete    = 40
+	queueDeleteOk  = 41
+	queueUnbind    = 50
+	queueUnbindOk  = 51
+
+	basicQos          = 10
+	basicQosOk        = 11
+	basicConsume      = 20
+	basicConsumeOk    = 21
+	basicCancel       = 30
+	basicCancelOk     = 31
+	basicPublish      = 40
+	basicDeliver      = 60
+	basicGet          = 70
+	basicGetOk        = 71
+	basicGetEmpty     = 72
+	basicAck          = 80
+	basicReject       = 90
+	basicRecoverAsync = 100
+	basicRecover      = 110
+	basicRecoverOk    = 111
+	basicNack         = 120
+
+	confirmSelect   = 10
+	confirmSelectOk = 11
+)
+
+// amqpError closes the channel, or the whole connection when connection is set
+type amqpError struct {
+	code       int
+	text       string
+	connection bool
+}
+
+func (e *amqpError) Error() string {
+	return fmt.Sprintf("%d %s", e.code, e.text)
+}
+
+type connection struct {
+	server *Server
+	conn   net.Conn
+
+	// channels is guarded by the server lock
+	channels map[uint16]*channel
+	// closing is set once the server sent connection.close
+	closing bool
+
+	outMu     sync.Mutex
+	outCond   *sync.Cond
+	out       [][]byte
+	outClosed bool
+	done      chan struct{}
+}
+
+type channel struct {
+	id      uint16
+	conn    *connection
+	closing bool
+
+	prefetch       int
+	globalPrefetch int
+	consumers      map[string]*consumer
+	deliveryTag    uint64
+	unacked        map[uint64]*delivery
+
+	confirm    bool
+	publishSeq uint64
+	publishing *publishing
+}
+
+type consumer struct {
+	tag      string
+	channel  *channel
+	queue    *queue
+	noAck    bool
+	prefetch int
+	unacked  int
+}
+
+type delivery struct {
+	msg      *message
+	queue    *queue
+	consumer *consumer
+}
+
+// publishing is a basic.publish waiting for its content frames
+type publishing struct {
+	exchange   string
+	routingKey string
+	size       uint64
+	props      properties
+	header     bool
+	body       []byte
+}
+
+func newConnection(s *Server, conn net.Conn) *connection {
+	c := &connection{
+		server:   s,
+		conn:     conn,
+		channels: make(map[uint16]*channel),
+		done:     make(chan struct{}),
+	}
+	c.outCond = sync.NewCond(&c.outMu)
+	return c
+}
+
+func (c *connection) serve() {
+	reader := bufio.NewReader(c.conn)
+
+	header := make([]byte, len(protocolHeader))
+	if _, err := io.ReadFull(reader, header); err != nil || !bytes.Equal(header, protocolHeader) {
+		c.conn.Write(protocolHeader)
+		c.teardown(false)
+		return
+	}
+
+	go c.write()
+
+	e := &encoder{}
+	e.octet(0)
+	e.octet(9)
+	e.table(amqp.Table{
+		"product": "amqptest",
+		"capabilities": amqp.Table{
+			"publisher_confirms":     true,
+			"basic.nack":             true,
+			"consumer_cancel_notify": true,
+		},
+	})
+	e.longstr("PLAIN AMQPLAIN")
+	e.longstr("en_US")
+	c.sendMethod(0, classConnection, connectionStart, e)
+
+	for {
+		f, err := readFrame(reader)
+		if err != nil {
+			c.teardown(false)
+			return
+		}
+
+		if f.typ == frameHeartbeat {
+			continue
+		}
+		if f.channel == 0 {
+			if done := c.handleConnection(f); done {
+				c.teardown(true)
+				return
+			}
+			continue
+		}
+
+		c.server.mu.Lock()
+		c.handleChannel(f)
+		c.server.mu.Unlock()
+	}
+}
+
+// handleConnection handles the methods of channel 0, it reports whether the connection is closed
+func (c *connection) handleConnection(f frame) bool {
+	if f.typ != frameMethod {
+		c.fail(&amqpError{code: amqp.FrameError, text: "unexpected frame on channel 0", connection: true}, 0, 0, 0)
+		return false
+	}
+
+	d := &decoder{buf: f.payload}
+	class, method := d.short(), d.short()
+
+	switch {
+	case class == classConnection && method == connectionStartOk:
+		e := &encoder{}
+		e.short(2047)
+		e.long(frameMax)
+		e.short(0)
+		c.sendMethod(0, classConnection, connectionTune, e)
+	case class == classConnection && method == connectionTuneOk:
+		d.short()
+		d.long()
+		if heartbeat := d.short(); heartbeat > 0 {
+			go c.heartbeat(time.Duration(heartbeat) * time.Second)
+		}
+	case class == classConnection && method == connectionOpen:
+		e := &encoder{}
+		e.shortstr("")
+		c.sendMethod(0, classConnection, connectionOpenOk, e)
+	case class == classConnection && method == connectionClose:
+		c.sendMethod(0, classConnection, connectionCloseOk, &encoder{})
+		return true
+	case class == classConnection && method == connectionCloseOk:
+		return true
+	default:
+		c.fail(&amqpError{code: amqp.NotImplemented, text: fmt.Sprintf("method %d.%d not supported", class, method), connection: true}, 0, class, method)
+	}
+	return false
+}
+
+// handleChannel handles the frames of all the other channels. Must be called with the server lock held.
+func (c *connection) handleChannel(f frame) {
+	if c.closing {
+		return
+	}
+
+	ch, ok := c.channels[f.channel]
+	if f.typ != frameMethod {
+		if !ok || ch.closing {
+			return
+		}
+		if err := ch.content(f); err != nil {
+			c.fail(err, f.channel, classBasic, basicPublish)
+		}
+		return
+	}
+
+	d := &decoder{buf: f.payload}
+	class, method := d.short(), d.short()
+
+	if class == classChannel && method == channelOpen {
+		if ok {
+			c.fail(&amqpError{code: amqp.ChannelError, text: "channel already open", connection: true}, f.channel, class, method)
+			return
+		}
+		c.channels[f.channel] = &channel{
+			id:        f.channel,
+			conn:      c,
+			consumers: make(map[string]*consumer),
+			unacked:   make(map[uint64]*delivery),
+		}
+		e := &encoder{}
+		e.longstr("")
+		c.sendMethod(f.channel, classChannel, channelOpenOk, e)
+		return
+	}
+	if !ok {
+		c.fail(&amqpError{code: amqp.ChannelError, text: fmt.Sprintf("expected 'channel.open' on channel %d", f.channel), connection: true}, f.channel, class, method)
+		return
+	}
+
+	if class == classChannel && method == channelCloseOk {
+		delete(c.channels, f.channel)
+		return
+	}
+	if ch.closing {
+		// everything but close-ok is discarded until the client confirmed the close
+		return
+	}
+	if ch.publishing != nil {
+		c.fail(&amqpError{code: amqp.UnexpectedFrame, text: "expected content header", connection: true}, f.channel, class, method)
+		return
+	}
+
+	if err := ch.handle(class, method, d); err != nil {
+		c.fail(err, f.channel, class, method)
+		return
+	}
+	if d.err != nil {
+		c.fail(&amqpError{code: amqp.SyntaxError, text: d.err.Error(), connection: true}, f.channel, class, method)
+	}
+}
+
+// fail closes the channel or the connection of the error. Must be called with the server lock held
+// unless the error is a connection error.
+func (c *connection) fail(err error, channelID, class, method uint16) {
+	e, ok := err.(*amqpError)
+	if !ok {
+		e = &amqpError{code: amqp.InternalError, text: err.Error(), connection: true}
+	}
+
+	enc := &encoder{}
+	enc.short(uint16(e.code))
+	enc.shortstr(fmt.Sprintf("%s - %s", amqpReplyText(e.code), e.text))
+	enc.short(class)
+	enc.short(method)
+
+	if e.connection || channelID == 0 {
+		c.closing = true
+		c.sendMethod(0, classConnection, connectionClose, enc)
+		return
+	}
+
+	// the channel is kept until the client confirmed the close, so its id is not reused too early
+	if ch, ok := c.channels[channelID]; ok {
+		ch.release()
+	}
+	c.sendMethod(channelID, classChannel, channelClose, enc)
+}
+
+// teardown releases the resources of the connection, flush sends the pending frames before closing the socket
+func (c *connection) teardown(flush bool) {
+	s := c.server
+	s.mu.Lock()
+	delete(s.conns, c)
+	for _, ch := range c.channels {
+		ch.release()
+	}
+	c.channels = map[uint16]*channel{}
+	for _, q := range s.queues {
+		if q.exclusive && q.owner == c {
+			s.deleteQueue(q)
+		}
+	}
+	s.mu.Unlock()
+
+	c.outMu.Lock()
+	if !flush {
+		c.out = nil
+	}
+	if !c.outClosed {
+		c.outClosed = true
+		close(c.done)
+	}
+	c.outCond.Signal()
+	c.outMu.Unlock()
+
+	if !flush {
+		c.conn.Close()
+	}
+}
+
+func (c *connection) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.send(encodeFrame(frameHeartbeat, 0, nil))
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write sends the queued frames until the connection is torn down
+func (c *connection) write() {
+	for {
+		c.outMu.Lock()
+		for len(c.out) == 0 && !c.outClosed {
+			c.outCond.Wait()
+		}
+		frames, closed := c.out, c.outClosed
+		c.out = nil
+		c.outMu.Unlock()
+
+		var buf bytes.Buffer
+		for _, f := range frames {
+			buf.Write(f)
+		}
+		if buf.Len() > 0 {
+			if _, err := c.conn.Write(buf.Bytes()); err != nil {
+				c.conn.Close()
+				return
+			}
+		}
+
+		if closed {
+			c.conn.Close()
+			return
+		}
+	}
+}
+
+func (c *connection) send(frames ...[]byte) {
+	c.outMu.Lock()
+	defer c.outMu.Unlock()
+
+	if c.outClosed {
+		return
+	}
+	c.out = append(c.out, frames...)
+	c.outCond.Signal()
+}
+
+func (c *connection) sendMethod(channelID uint16, class, method uint16, args *encoder) {
+	c.send(encodeMethod(channelID, class, method, args))
+}
+
+// sendContent sends a method followed by the content header and body frames of the message
+func (c *connection) sendContent(channelID uint16, class, method uint16, args *encoder, msg *message) {
+	frames := [][]byte{
+		encodeMethod(channelID, class, method, args),
+		encodeFrame(frameHeader, channelID, encodeHeader(len(msg.body), msg.props)),
+	}
+	for body := msg.body; len(body) > 0; {
+		n := len(body)
+		if n > frameMax-8 {
+			n = frameMax - 8
+		}
+		frames = append(frames, encodeFrame(frameBody, channelID, body[:n]))
+		body = body[n:]
+	}
+	c.send(frames...)
+}
+
+func encodeMethod(channelID uint16, class, method uint16, args *encoder) []byte {
+	e := &encoder{}
+	e.short(class)
+	e.short(method)
+	payload := append(e.bytes(), args.bytes()...)
+	return encodeFrame(frameMethod, channelID, payload)
+}
+
+// handle executes a method of the channel. Must be called with the server lock held.
+func (ch *channel) handle(class, method uint16, d *decoder) error {
+	s := ch.conn.server
+
+	switch class<<8 | method {
+	case classChannel<<8 | channelClose:
+		ch.release()
+		delete(ch.conn.channels, ch.id)
+		ch.sendMethod(classChannel, channelCloseOk, &encoder{})
+
+	case classChannel<<8 | channelFlow:
+		e := &encoder{}
+		e.bitField(d.bitField())
+		ch.sendMethod(classChannel, channelFlowOk, e)
+
+	case classExchange<<8 | exchangeDeclare:
+		d.short()
+		name, typ := d.shortstr(), d.shortstr()
+		passive, durable, _, _, noWait := d.bitField(), d.bitField(), d.bitField(), d.bitField(), d.bitField()
+		args := d.table()
+
+		if passive {
+			if _, ok := s.exchanges[name]; !ok {
+				return &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no exchange '%s' in vhost '/'", name)}
+			}
+		} else if err := s.declareExchange(name, typ, durable, args); err != nil {
+			return err
+		}
+		if !noWait {
+			ch.sendMethod(classExchange, exchangeDeclareOk, &encoder{})
+		}
+
+	case classExchange<<8 | exchangeDelete:
+		d.short()
+		name := d.shortstr()
+		ifUnused, noWait := d.bitField(), d.bitField()
+
+		if e, ok := s.exchanges[name]; ok {
+			if ifUnused && len(e.bindings) > 0 {
+				return &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("exchange '%s' in vhost '/' in use", name)}
+			}
+			delete(s.exchanges, name)
+		}
+		if !noWait {
+			ch.sendMethod(classExchange, exchangeDeleteOk, &encoder{})
+		}
+
+	case classQueue<<8 | queueDeclare:
+		d.short()
+		name := d.shortstr()
+		passive, durable, exclusive, autoDelete, noWait := d.bitField(), d.bitField(), d.bitField(), d.bitField(), d.bitField()
+		args := d.table()
+
+		var q *queue
+		if passive {
+			var ok bool
+			if q, ok = s.queues[name]; !ok {
+				return &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no queue '%s' in vhost '/'", name)}
+			}
+		} else {
+			if name == "" {
+				name = randomName("amq.gen-")
+			}
+			var err error
+			if q, err = s.declareQueue(name, durable, exclusive, autoDelete, args); err != nil {
+				return err
+			}
+			if exclusive && q.owner == nil {
+				q.owner = ch.conn
+			}
+		}
+		s.expire(q)
+
+		if !noWait {
+			e := &encoder{}
+			e.shortstr(q.name)
+			e.long(uint32(len(q.messages)))
+			e.long(uint32(len(q.consumers)))
+			ch.sendMethod(classQueue, queueDeclareOk, e)
+		}
+
+	case classQueue<<8 | queueBind:
+		d.short()
+		queueName, exchangeName, key := d.shortstr(), d.shortstr(), d.shortstr()
+		noWait := d.bitField()
+		d.table()
+
+		q, e, err := ch.lookupBinding(queueName, exchangeName)
+		if err != nil {
+			return err
+		}
+		e.bind(q.name, key)
+		if !noWait {
+			ch.sendMethod(classQueue, queueBindOk, &encoder{})
+		}
+
+	case classQueue<<8 | queueUnbind:
+		d.short()
+		queueName, exchangeName, key := d.shortstr(), d.shortstr(), d.shortstr()
+		d.table()
+
+		q, e, err := ch.lookupBinding(queueName, exchangeName)
+		if err != nil {
+			return err
+		}
+		e.unbind(q.name, &key)
+		ch.sendMethod(classQueue, queueUnbindOk, &encoder{})
+
+	case classQueue<<8 | queuePurge:
+		d.short()
+		name := d.shortstr()
+		noWait := d.bitField()
+
+		q, ok := s.queues[name]
+		if !ok {
+			return &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no queue '%s' in vhost '/'", name)}
+		}
+		purged := len(q.messages)
+		q.messages = nil
+		s.expire(q)
+
+		if !noWait {
+			e := &encoder{}
+			e.long(uint32(purged))
+			ch.sendMethod(classQueue, queuePurgeOk, e)
+		}
+
+	case classQueue<<8 | queueDelete:
+		d.short()
+		name := d.shortstr()
+		ifUnused, ifEmpty, noWait := d.bitField(), d.bitField(), d.bitField()
+
+		// deleting a missing queue succeeds like on RabbitMQ
+		deleted := 0
+		if q, ok := s.queues[name]; ok {
+			s.expire(q)
+			if ifUnused && len(q.consumers) > 0 {
+				return &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("queue '%s' in vhost '/' in use", name)}
+			}
+			if ifEmpty && len(q.messages) > 0 {
+				return &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("queue '%s' in vhost '/' not empty", name)}
+			}
+			deleted = len(q.messages)
+			s.deleteQueue(q)
+		}
+		if !noWait {
+			e := &encoder{}
+			e.long(uint32(deleted))
+			ch.sendMethod(classQueue, queueDeleteOk, e)
+		}
+
+	case classBasic<<8 | basicQos:
+		d.long()
+		count := int(d.short())
+		if global := d.bitField(); global {
+			ch.globalPrefetch = count
+		} else {
+			ch.prefetch = count
+		}
+		ch.sendMethod(classBasic, basicQosOk, &encoder{})
+
+	case classBasic<<8 | basicConsume:
+		d.short()
+		queueName, tag := d.shortstr(), d.shortstr()
+		_, noAck, _, noWait := d.bitField(), d.bitField(), d.bitField(), d.bitField()
+		d.table()
+
+		q, ok := s.queues[queueName]
+		if !ok {
+			return &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no queue '%s' in vhost '/'", queueName)}
+		}
+		if tag == "" {
+			tag = randomName("amq.ctag-")
+		}
+		if _, ok := ch.consumers[tag]; ok {
+			return &amqpError{code: amqp.NotAllowed, text: fmt.Sprintf("attempt to reuse consumer tag '%s'", tag), connection: true}
+		}
+
+		c := &consumer{tag: tag, channel: ch, queue: q, noAck: noAck, prefetch: ch.prefetch}
+		ch.consumers[tag] = c
+		q.consumers = append(q.consumers, c)
+
+		if !noWait {
+			e := &encoder{}
+			e.shortstr(tag)
+			ch.sendMethod(classBasic, basicConsumeOk, e)
+		}
+		s.dispatch(q)
+
+	case classBasic<<8 | basicCancel:
+		tag := d.shortstr()
+		noWait := d.bitField()
+
+		if c, ok := ch.consumers[tag]; ok {
+			ch.removeConsumer(c)
+		}
+		if !noWait {
+			e := &encoder{}
+			e.shortstr(tag)
+			ch.sendMethod(classBasic, basicCancelOk, e)
+		}
+
+	case classBasic<<8 | basicPublish:
+		d.short()
+		exchangeName, key := d.shortstr(), d.shortstr()
+		d.bitField()
+		d.bitField()
+		ch.publishing = &publishing{exchange: exchangeName, routingKey: key}
+
+	case classBasic<<8 | basicGet:
+		d.short()
+		name := d.shortstr()
+		noAck := d.bitField()
+
+		q, ok := s.queues[name]
+		if !ok {
+			return &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no queue '%s' in vhost '/'", name)}
+		}
+		s.expire(q)
+		if len(q.messages) == 0 {
+			e := &encoder{}
+			e.shortstr("")
+			ch.sendMethod(classBasic, basicGetEmpty, e)
+			return nil
+		}
+
+		msg := q.messages[0]
+		q.messages = q.messages[1:]
+		ch.deliveryTag++
+		if !noAck {
+			ch.unacked[ch.deliveryTag] = &delivery{msg: msg, queue: q}
+			q.unacked++
+		}
+
+		e := &encoder{}
+		e.longlong(ch.deliveryTag)
+		e.bitField(msg.redelivered)
+		e.shortstr(msg.exchange)
+		e.shortstr(msg.routingKey)
+		e.long(uint32(len(q.messages)))
+		ch.conn.sendContent(ch.id, classBasic, basicGetOk, e, msg)
+		s.expire(q)
+
+	case classBasic<<8 | basicAck:
+		tag := d.longlong()
+		multiple := d.bitField()
+		return ch.settle(tag, multiple, func(dl *delivery) {})
+
+	case classBasic<<8 | basicReject:
+		tag := d.longlong()
+		requeue := d.bitField()
+		return ch.settle(tag, false, ch.reject(requeue))
+
+	case classBasic<<8 | basicNack:
+		tag := d.longlong()
+		multiple, requeue := d.bitField(), d.bitField()
+		return ch.settle(tag, multiple, ch.reject(requeue))
+
+	case classBasic<<8 | basicRecover, classBasic<<8 | basicRecoverAsync:
+		d.bitField()
+		ch.requeueAll()
+		if method == basicRecover {
+			ch.sendMethod(classBasic, basicRecoverOk, &encoder{})
+		}
+
+	case classConfirm<<8 | confirmSelect:
+		noWait := d.bitField()
+		ch.confirm = true
+		if !noWait {
+			ch.sendMethod(classConfirm, confirmSelectOk, &encoder{})
+		}
+
+	default:
+		return &amqpError{code: amqp.NotImplemented, text: fmt.Sprintf("method %d.%d not supported", class, method), connection: true}
+	}
+
+	return nil
+}
+
+// content collects the header and body frames of a publishing and publishes it once complete.
+// Must be called with the server lock held.
+func (ch *channel) content(f frame) error {
+	p := ch.publishing
+	if p == nil {
+		return &amqpError{code: amqp.UnexpectedFrame, text: "content frame without basic.publish", connection: true}
+	}
+
+	switch f.typ {
+	case frameHeader:
+		if p.header {
+			return &amqpError{code: amqp.UnexpectedFrame, text: "expected content body", connection: true}
+		}
+		size, props, err := decodeHeader(f.payload)
+		if err != nil {
+			return &amqpError{code: amqp.SyntaxError, text: err.Error(), connection: true}
+		}
+		p.header, p.size, p.props = true, size, props
+	case frameBody:
+		if !p.header {
+			return &amqpError{code: amqp.UnexpectedFrame, text: "expected content header", connection: true}
+		}
+		p.body = append(p.body, f.payload...)
+	default:
+		return &amqpError{code: amqp.UnexpectedFrame, text: fmt.Sprintf("unexpected frame type %d", f.typ), connection: true}
+	}
+
+	if uint64(len(p.body)) < p.size {
+		return nil
+	}
+	ch.publishing = nil
+
+	accepted, err := ch.conn.server.publish(p.exchange, &message{
+		routingKey: p.routingKey,
+		props:      p.props,
+		body:       p.body,
+	})
+	if err != nil {
+		return err
+	}
+
+	if ch.confirm {
+		ch.publishSeq++
+		e := &encoder{}
+		e.longlong(ch.publishSeq)
+		e.bitField(false)
+		if accepted {
+			ch.sendMethod(classBasic, basicAck, e)
+		} else {
+			// the requeue bit of basic.nack
+			e.bitField(false)
+			ch.sendMethod(classBasic, basicNack, e)
+		}
+	}
+	return nil
+}
+
+// deliver pushes the message to the consumer. Must be called with the server lock held.
+func (ch *channel) deliver(c *consumer, q *queue, msg *message) {
+	ch.deliveryTag++
+	if !c.noAck {
+		ch.unacked[ch.deliveryTag] = &delivery{msg: msg, queue: q, consumer: c}
+		c.unacked++
+		q.unacked++
+	}
+
+	e := &encoder{}
+	e.shortstr(c.tag)
+	e.longlong(ch.deliveryTag)
+	e.bitField(msg.redelivered)
+	e.shortstr(msg.exchange)
+	e.shortstr(msg.routingKey)
+	ch.conn.sendContent(ch.id, classBasic, basicDeliver, e, msg)
+}
+
+// ready reports whether the consumer can take another message
+func (c *consumer) ready() bool {
+	ch := c.channel
+	if ch.closing {
+		return false
+	}
+	if c.noAck {
+		return true
+	}
+	if c.prefetch > 0 && c.unacked >= c.prefetch {
+		return false
+	}
+	return ch.globalPrefetch == 0 || len(ch.unacked) < ch.globalPrefetch
+}
+
+// settle removes the acknowledged deliveries up to tag and hands them to done, a tag of zero with
+// multiple settles all the deliveries. Must be called with the server lock held.
+func (ch *channel) settle(tag uint64, multiple bool, done func(*delivery)) error {
+	var tags []uint64
+	if multiple {
+		for t := range ch.unacked {
+			if tag == 0 || t <= tag {
+				tags = append(tags, t)
+			}
+		}
+		sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+	} else {
+		if _, ok := ch.unacked[tag]; !ok {
+			return &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("unknown delivery tag %d", tag)}
+		}
+		tags = []uint64{tag}
+	}
+
+	queues := make(map[*queue]bool)
+	for _, t := range tags {
+		dl := ch.unacked[t]
+		delete(ch.unacked, t)
+		dl.queue.unacked--
+		if dl.consumer != nil {
+			dl.consumer.unacked--
+		}
+		done(dl)
+		queues[dl.queue] = true
+	}
+
+	// settled deliveries free prefetch capacity
+	for q := range queues {
+		if ch.conn.server.queues[q.name] == q {
+			ch.conn.server.dispatch(q)
+		}
+	}
+	return nil
+}
+
+func (ch *channel) reject(requeue bool) func(*delivery) {
+	s := ch.conn.server
+	return func(dl *delivery) {
+		if requeue {
+			s.requeue(dl.queue, dl.msg)
+		} else {
+			s.deadLetter(dl.queue, dl.msg, "rejected")
+		}
+	}
+}
+
+// requeueAll returns all the unacknowledged messages to their queues. Must be called with the server lock held.
+func (ch *channel) requeueAll() {
+	if len(ch.unacked) > 0 {
+		ch.settle(0, true, ch.reject(true))
+	}
+}
+
+// release cancels the consumers of the channel and requeues its unacknowledged messages.
+// Must be called with the server lock held.
+func (ch *channel) release() {
+	ch.closing = true
+	ch.publishing = nil
+	for _, c := range ch.consumers {
+		ch.removeConsumer(c)
+	}
+	ch.requeueAll()
+}
+
+func (ch *channel) removeConsumer(c *consumer) {
+	delete(ch.consumers, c.tag)
+
+	q := c.queue
+	for i, other := range q.consumers {
+		if other == c {
+			q.consumers = append(q.consumers[:i], q.consumers[i+1:]...)
+			break
+		}
+	}
+	if len(q.consumers) > 0 {
+		q.next %= len(q.consumers)
+	} else {
+		q.next = 0
+		s := ch.conn.server
+		if q.autoDelete && s.queues[q.name] == q {
+			s.deleteQueue(q)
+		}
+	}
+}
+
+// cancelConsumer removes a consumer whose queue was deleted and notifies the client. Must be called with the server lock held.
+func (ch *channel) cancelConsumer(c *consumer) {
+	delete(ch.consumers, c.tag)
+
+	e := &encoder{}
+	e.shortstr(c.tag)
+	e.bitField(true)
+	ch.sendMethod(classBasic, basicCancel, e)
+}
+
+func (ch *channel) lookupBinding(queueName, exchangeName string) (*queue, *exchange, error) {
+	s := ch.conn.server
+	q, ok := s.queues[queueName]
+	if !ok {
+		return nil, nil, &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no queue '%s' in vhost '/'", queueName)}
+	}
+	e, ok := s.exchanges[exchangeName]
+	if !ok {
+		return nil, nil, &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no exchange '%s' in vhost '/'", exchangeName)}
+	}
+	if e.name == "" {
+		return nil, nil, &amqpError{code: amqp.AccessRefused, text: "operation not permitted on the default exchange"}
+	}
+	return q, e, nil
+}
+
+func (ch *channel) sendMethod(class, method uint16, args *encoder) {
+	ch.conn.sendMethod(ch.id, class, method, args)
+}
+
+func amqpReplyText(code int) string {
+	switch code {
+	case amqp.NotFound:
+		return "NOT_FOUND"
+	case amqp.AccessRefused:
+		return "ACCESS_REFUSED"
+	case amqp.PreconditionFailed:
+		return "PRECONDITION_FAILED"
+	case amqp.ResourceLocked:
+		return "RESOURCE_LOCKED"
+	case amqp.CommandInvalid:
+		return "COMMAND_INVALID"
+	case amqp.ChannelError:
+		return "CHANNEL_ERROR"
+	case amqp.NotAllowed:
+		return "NOT_ALLOWED"
+	case amqp.NotImplemented:
+		return "NOT_IMPLEMENTED"
+	case amqp.UnexpectedFrame:
+		return "UNEXPECTED_FRAME"
+	case amqp.SyntaxError:
+		return "SYNTAX_ERROR"
+	case amqp.FrameError:
+		return "FRAME_ERROR"
+	default:
+		return "INTERNAL_ERROR"
+	}
+}
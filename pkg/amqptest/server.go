@@ -0,0 +1,689 @@
+package amqptest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/streadway/amqp"
+)
+
+const (
+	ExchangeDirect  = "direct"
+	ExchangeTopic   = "topic"
+	ExchangeFanout  = "fanout"
+	ExchangeDelayed = "x-delayed-message"
+)
+
+type Config struct {
+	// DelayedMessageExchange enables the x-delayed-message exchange type of the
+	// rabbitmq-delayed-message-exchange plugin, the delay is taken from the x-delay header
+	DelayedMessageExchange bool
+}
+
+// QueueInfo is a snapshot of a queue
+type QueueInfo struct {
+	Name      string
+	Arguments amqp.Table
+	// Messages is the number of messages ready for delivery
+	Messages  int
+	Unacked   int
+	Consumers int
+}
+
+// Server is an in-process AMQP 0-9-1 server for tests. It keeps everything in memory in a single
+// vhost and implements the subset of RabbitMQ the streadway client needs: direct, topic and fanout
+// exchanges, priority queues, per queue and per message TTL, dead-lettering, consumers with
+// prefetch, basic.get, acks and publisher confirms.
+type Server struct {
+	config   Config
+	listener net.Listener
+
+	mu        sync.Mutex
+	exchanges map[string]*exchange
+	queues    map[string]*queue
+	conns     map[*connection]struct{}
+	seq       uint64
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+type exchange struct {
+	name string
+	typ  string
+	// delayedType is the routing of an x-delayed-message exchange
+	delayedType string
+	durable     bool
+	bindings    []binding
+}
+
+type binding struct {
+	queue string
+	key   string
+}
+
+type message struct {
+	seq        uint64
+	exchange   string
+	routingKey string
+	props      properties
+	body       []byte
+	// expiresAt is zero for messages without TTL
+	expiresAt   time.Time
+	redelivered bool
+}
+
+type queue struct {
+	name       string
+	durable    bool
+	exclusive  bool
+	autoDelete bool
+	// owner is the connection of an exclusive queue, the queue is deleted when it closes
+	owner       *connection
+	args        amqp.Table
+	maxPriority uint8
+	// ttl is the x-message-ttl, negative without one
+	ttl time.Duration
+	// deadLetterExchange is nil without x-dead-letter-exchange, the empty name is the default exchange
+	deadLetterExchange *string
+	deadLetterKey      *string
+	// rejectPublishes makes the queue refuse new messages, see RejectPublishes
+	rejectPublishes bool
+
+	// messages are ordered by priority and then by publishing order
+	messages  []*message
+	consumers []*consumer
+	next      int
+	unacked   int
+	expiry    *time.Timer
+}
+
+// NewServer starts a server listening on a random local port
+func NewServer(config Config) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %v", err)
+	}
+
+	s := &Server{
+		config:    config,
+		listener:  listener,
+		exchanges: make(map[string]*exchange),
+		queues:    make(map[string]*queue),
+		conns:     make(map[*connection]struct{}),
+	}
+	for name, typ := range map[string]string{
+		"":           ExchangeDirect,
+		"amq.direct": ExchangeDirect,
+		"amq.topic":  ExchangeTopic,
+		"amq.fanout": ExchangeFanout,
+	} {
+		s.exchanges[name] = &exchange{name: name, typ: typ, durable: true}
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+
+	return s, nil
+}
+
+// URI returns the address clients dial with the default guest credentials
+func (s *Server) URI() string {
+	return fmt.Sprintf("amqp://guest:guest@%s/", s.listener.Addr())
+}
+
+// Close stops the server and drops all the connections
+func (s *Server) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for _, q := range s.queues {
+		if q.expiry != nil {
+			q.expiry.Stop()
+		}
+	}
+	s.mu.Unlock()
+
+	err := s.listener.Close()
+	s.CloseConnections()
+	s.wg.Wait()
+	return err
+}
+
+// CloseConnections drops all the client connections without closing them gracefully,
+// which lets tests simulate a network failure. Unacknowledged messages are requeued.
+func (s *Server) CloseConnections() {
+	s.mu.Lock()
+	conns := make([]*connection, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+
+	for _, c := range conns {
+		c.conn.Close()
+	}
+}
+
+// Queue returns a snapshot of the queue, it reports false when the queue does not exist
+func (s *Server) Queue(name string) (QueueInfo, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	q, ok := s.queues[name]
+	if !ok {
+		return QueueInfo{}, false
+	}
+	s.expire(q)
+	return QueueInfo{
+		Name:      q.name,
+		Arguments: q.args,
+		Messages:  len(q.messages),
+		Unacked:   q.unacked,
+		Consumers: len(q.consumers),
+	}, true
+}
+
+// QueueNames returns the names of all the queues in alphabetical order
+func (s *Server) QueueNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.queues))
+	for name := range s.queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RejectPublishes makes the queue refuse the messages routed to it like a full queue with the
+// reject-publish overflow, in confirm mode the publishings are nacked
+func (s *Server) RejectPublishes(name string, reject bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if q, ok := s.queues[name]; ok {
+		q.rejectPublishes = reject
+	}
+}
+
+// ExchangeType returns the type of the exchange, it reports false when the exchange does not exist
+func (s *Server) ExchangeType(name string) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.exchanges[name]
+	if !ok {
+		return "", false
+	}
+	return e.typ, true
+}
+
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := newConnection(s, conn)
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			conn.Close()
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			c.serve()
+		}()
+	}
+}
+
+// declareExchange creates the exchange or checks that an existing one is equivalent. Must be called with the lock held.
+func (s *Server) declareExchange(name, typ string, durable bool, args amqp.Table) error {
+	if strings.HasPrefix(name, "amq.") {
+		if _, ok := s.exchanges[name]; !ok {
+			return &amqpError{code: amqp.AccessRefused, text: fmt.Sprintf("exchange name '%s' contains reserved prefix 'amq.*'", name)}
+		}
+	}
+
+	delayedType := ""
+	switch typ {
+	case ExchangeDirect, ExchangeTopic, ExchangeFanout:
+	case ExchangeDelayed:
+		if !s.config.DelayedMessageExchange {
+			return &amqpError{code: amqp.CommandInvalid, text: fmt.Sprintf("unknown exchange type '%s'", typ), connection: true}
+		}
+		delayedType, _ = args["x-delayed-type"].(string)
+		switch delayedType {
+		case ExchangeDirect, ExchangeTopic, ExchangeFanout:
+		default:
+			return &amqpError{code: amqp.PreconditionFailed, text: "Invalid argument, 'x-delayed-type' must be an existing exchange type"}
+		}
+	default:
+		return &amqpError{code: amqp.CommandInvalid, text: fmt.Sprintf("unknown exchange type '%s'", typ), connection: true}
+	}
+
+	if e, ok := s.exchanges[name]; ok {
+		if e.typ != typ || e.durable != durable || e.delayedType != delayedType {
+			return &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("inequivalent arg 'type' for exchange '%s' in vhost '/'", name)}
+		}
+		return nil
+	}
+
+	s.exchanges[name] = &exchange{name: name, typ: typ, durable: durable, delayedType: delayedType}
+	return nil
+}
+
+// declareQueue creates the queue or checks that an existing one is equivalent. Must be called with the lock held.
+func (s *Server) declareQueue(name string, durable, exclusive, autoDelete bool, args amqp.Table) (*queue, error) {
+	if args == nil {
+		args = amqp.Table{}
+	}
+
+	if q, ok := s.queues[name]; ok {
+		if q.durable != durable {
+			return nil, &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("inequivalent arg 'durable' for queue '%s' in vhost '/'", name)}
+		}
+		for _, key := range []string{"x-dead-letter-exchange", "x-dead-letter-routing-key", "x-message-ttl", "x-max-priority"} {
+			if !equivalentArg(q.args[key], args[key]) {
+				return nil, &amqpError{code: amqp.PreconditionFailed, text: fmt.Sprintf("inequivalent arg '%s' for queue '%s' in vhost '/'", key, name)}
+			}
+		}
+		return q, nil
+	}
+
+	q := &queue{
+		name:       name,
+		durable:    durable,
+		exclusive:  exclusive,
+		autoDelete: autoDelete,
+		args:       args,
+		ttl:        -1,
+	}
+
+	if v, ok := args["x-max-priority"]; ok {
+		p, ok := toInt(v)
+		if !ok || p < 0 || p > 255 {
+			return nil, &amqpError{code: amqp.PreconditionFailed, text: "invalid arg 'x-max-priority'"}
+		}
+		q.maxPriority = uint8(p)
+	}
+	if v, ok := args["x-message-ttl"]; ok {
+		ttl, ok := toInt(v)
+		if !ok || ttl < 0 {
+			return nil, &amqpError{code: amqp.PreconditionFailed, text: "invalid arg 'x-message-ttl'"}
+		}
+		q.ttl = time.Duration(ttl) * time.Millisecond
+	}
+	if v, ok := args["x-dead-letter-exchange"].(string); ok {
+		q.deadLetterExchange = &v
+	}
+	if v, ok := args["x-dead-letter-routing-key"].(string); ok {
+		q.deadLetterKey = &v
+	}
+
+	s.queues[name] = q
+	return q, nil
+}
+
+// deleteQueue removes the queue with its bindings and cancels its consumers. Must be called with the lock held.
+func (s *Server) deleteQueue(q *queue) {
+	for _, c := range q.consumers {
+		c.channel.cancelConsumer(c)
+	}
+	if q.expiry != nil {
+		q.expiry.Stop()
+	}
+	for _, e := range s.exchanges {
+		e.unbind(q.name, nil)
+	}
+	delete(s.queues, q.name)
+}
+
+// publish routes the message through the exchange, it reports false when a queue rejected the
+// message. Must be called with the lock held.
+func (s *Server) publish(exchangeName string, msg *message) (bool, error) {
+	e, ok := s.exchanges[exchangeName]
+	if !ok {
+		return false, &amqpError{code: amqp.NotFound, text: fmt.Sprintf("no exchange '%s' in vhost '/'", exchangeName)}
+	}
+	msg.exchange = exchangeName
+
+	if e.typ == ExchangeDelayed {
+		delay, _ := toInt(msg.props.headers["x-delay"])
+		if delay > 0 {
+			time.AfterFunc(time.Duration(delay)*time.Millisecond, func() {
+				s.mu.Lock()
+				defer s.mu.Unlock()
+				if !s.closed {
+					s.route(e, msg)
+				}
+			})
+			return true, nil
+		}
+	}
+
+	return s.route(e, msg), nil
+}
+
+// route enqueues a copy of the message in every queue bound to the exchange with a matching key,
+// it reports false when a queue rejected the message. Must be called with the lock held.
+func (s *Server) route(e *exchange, msg *message) bool {
+	if e.name == "" {
+		q, ok := s.queues[msg.routingKey]
+		if !ok {
+			return true
+		}
+		if q.rejectPublishes {
+			return false
+		}
+		s.enqueue(q, msg)
+		return true
+	}
+
+	typ := e.typ
+	if typ == ExchangeDelayed {
+		typ = e.delayedType
+	}
+
+	accepted := true
+	routed := make(map[string]bool)
+	for _, b := range e.bindings {
+		if routed[b.queue] || !matches(typ, b.key, msg.routingKey) {
+			continue
+		}
+		routed[b.queue] = true
+		q, ok := s.queues[b.queue]
+		if !ok {
+			continue
+		}
+		if q.rejectPublishes {
+			accepted = false
+			continue
+		}
+		copied := *msg
+		s.enqueue(q, &copied)
+	}
+	return accepted
+}
+
+// enqueue adds the message to the queue and hands it to a consumer if possible. Must be called with the lock held.
+func (s *Server) enqueue(q *queue, msg *message) {
+	s.seq++
+	msg.seq = s.seq
+	msg.redelivered = false
+	msg.expiresAt = time.Time{}
+
+	ttl := q.ttl
+	if msg.props.flags&flagExpiration != 0 {
+		if ms, err := strconv.ParseInt(msg.props.expiration, 10, 64); err == nil && ms >= 0 {
+			if d := time.Duration(ms) * time.Millisecond; ttl < 0 || d < ttl {
+				ttl = d
+			}
+		}
+	}
+	if ttl >= 0 {
+		msg.expiresAt = time.Now().Add(ttl)
+	}
+
+	q.insert(msg)
+	s.dispatch(q)
+}
+
+// requeue returns an unacknowledged message to its original position. Must be called with the lock held.
+func (s *Server) requeue(q *queue, msg *message) {
+	if _, ok := s.queues[q.name]; !ok {
+		return
+	}
+	msg.redelivered = true
+	q.insert(msg)
+	s.dispatch(q)
+}
+
+// dispatch delivers ready messages to the consumers with free prefetch capacity, round-robin.
+// Must be called with the lock held.
+func (s *Server) dispatch(q *queue) {
+	s.expire(q)
+
+	for len(q.messages) > 0 && len(q.consumers) > 0 {
+		var target *consumer
+		for i := 0; i < len(q.consumers); i++ {
+			c := q.consumers[(q.next+i)%len(q.consumers)]
+			if c.ready() {
+				target = c
+				q.next = (q.next + i + 1) % len(q.consumers)
+				break
+			}
+		}
+		if target == nil {
+			return
+		}
+
+		msg := q.messages[0]
+		q.messages = q.messages[1:]
+		target.channel.deliver(target, q, msg)
+		s.expire(q)
+	}
+}
+
+// expire dead-letters the expired messages at the head of the queue, like RabbitMQ messages
+// only expire once they reach the head. Must be called with the lock held.
+func (s *Server) expire(q *queue) {
+	now := time.Now()
+	for len(q.messages) > 0 {
+		head := q.messages[0]
+		if head.expiresAt.IsZero() || head.expiresAt.After(now) {
+			break
+		}
+		q.messages = q.messages[1:]
+		s.deadLetter(q, head, "expired")
+	}
+
+	if q.expiry != nil {
+		q.expiry.Stop()
+		q.expiry = nil
+	}
+	if len(q.messages) > 0 && !q.messages[0].expiresAt.IsZero() {
+		q.expiry = time.AfterFunc(time.Until(q.messages[0].expiresAt), func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.queues[q.name] == q && !s.closed {
+				s.dispatch(q)
+			}
+		})
+	}
+}
+
+// deadLetter republishes the message to the dead letter exchange of the queue, it is dropped
+// when the queue has none. Must be called with the lock held.
+func (s *Server) deadLetter(q *queue, msg *message, reason string) {
+	if q.deadLetterExchange == nil {
+		return
+	}
+	e, ok := s.exchanges[*q.deadLetterExchange]
+	if !ok {
+		return
+	}
+
+	headers := amqp.Table{}
+	for k, v := range msg.props.headers {
+		headers[k] = v
+	}
+	headers["x-death"] = deaths(msg, q.name, reason)
+	headers["x-first-death-reason"] = reason
+	headers["x-first-death-queue"] = q.name
+	headers["x-first-death-exchange"] = msg.exchange
+	for _, key := range []string{"x-first-death-reason", "x-first-death-queue", "x-first-death-exchange"} {
+		if v, ok := msg.props.headers[key]; ok {
+			headers[key] = v
+		}
+	}
+
+	dead := &message{
+		exchange:   e.name,
+		routingKey: msg.routingKey,
+		props:      msg.props,
+		body:       msg.body,
+	}
+	if q.deadLetterKey != nil {
+		dead.routingKey = *q.deadLetterKey
+	}
+	dead.props.headers = headers
+	dead.props.flags |= flagHeaders
+	// the expiration is removed so the message does not expire again
+	dead.props.flags &^= flagExpiration
+	dead.props.expiration = ""
+
+	s.route(e, dead)
+}
+
+// deaths returns the x-death header with the count of the queue and reason incremented
+func deaths(msg *message, queueName, reason string) []interface{} {
+	previous, _ := msg.props.headers["x-death"].([]interface{})
+
+	count := int64(1)
+	var rest []interface{}
+	for _, d := range previous {
+		t, ok := d.(amqp.Table)
+		if ok && t["queue"] == queueName && t["reason"] == reason {
+			if n, ok := toInt(t["count"]); ok {
+				count = int64(n) + 1
+			}
+			continue
+		}
+		rest = append(rest, d)
+	}
+
+	death := amqp.Table{
+		"count":        count,
+		"reason":       reason,
+		"queue":        queueName,
+		"time":         time.Now(),
+		"exchange":     msg.exchange,
+		"routing-keys": []interface{}{msg.routingKey},
+	}
+	return append([]interface{}{death}, rest...)
+}
+
+// insert places the message after all messages with the same or a higher priority
+// which were published before it
+func (q *queue) insert(msg *message) {
+	priority := q.priorityOf(msg)
+	i := sort.Search(len(q.messages), func(i int) bool {
+		other := q.messages[i]
+		p := q.priorityOf(other)
+		return p < priority || (p == priority && other.seq > msg.seq)
+	})
+
+	q.messages = append(q.messages, nil)
+	copy(q.messages[i+1:], q.messages[i:])
+	q.messages[i] = msg
+}
+
+func (q *queue) priorityOf(msg *message) uint8 {
+	if msg.props.priority > q.maxPriority {
+		return q.maxPriority
+	}
+	return msg.props.priority
+}
+
+func (e *exchange) bind(queueName, key string) {
+	for _, b := range e.bindings {
+		if b.queue == queueName && b.key == key {
+			return
+		}
+	}
+	e.bindings = append(e.bindings, binding{queue: queueName, key: key})
+}
+
+// unbind removes the binding of the queue with the key, or all its bindings when key is nil
+func (e *exchange) unbind(queueName string, key *string) {
+	kept := e.bindings[:0]
+	for _, b := range e.bindings {
+		if b.queue == queueName && (key == nil || *key == b.key) {
+			continue
+		}
+		kept = append(kept, b)
+	}
+	e.bindings = kept
+}
+
+func matches(typ, bindingKey, routingKey string) bool {
+	switch typ {
+	case ExchangeFanout:
+		return true
+	case ExchangeTopic:
+		return matchTopic(strings.Split(bindingKey, "."), strings.Split(routingKey, "."))
+	default:
+		return bindingKey == routingKey
+	}
+}
+
+// matchTopic matches the words of a routing key against a binding pattern,
+// * matches exactly one word and # zero or more words
+func matchTopic(pattern, words []string) bool {
+	if len(pattern) == 0 {
+		return len(words) == 0
+	}
+
+	switch pattern[0] {
+	case "#":
+		for i := 0; i <= len(words); i++ {
+			if matchTopic(pattern[1:], words[i:]) {
+				return true
+			}
+		}
+		return false
+	case "*":
+		return len(words) > 0 && matchTopic(pattern[1:], words[1:])
+	default:
+		return len(words) > 0 && pattern[0] == words[0] && matchTopic(pattern[1:], words[1:])
+	}
+}
+
+func equivalentArg(a, b interface{}) bool {
+	ai, aok := toInt(a)
+	bi, bok := toInt(b)
+	if aok && bok {
+		return ai == bi
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func toInt(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case byte:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case int:
+		return n, true
+	default:
+		return 0, false
+	}
+}
+
+func randomName(prefix string) string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return prefix + hex.EncodeToString(b)
+}
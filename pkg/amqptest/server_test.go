@@ -0,0 +1,236 @@
+package amqptest_test
+
+import (
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/amqptest"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("Server", func() {
+	var (
+		config  amqptest.Config
+		server  *amqptest.Server
+		conn    *amqp.Connection
+		channel *amqp.Channel
+	)
+
+	JustBeforeEach(func() {
+		var err error
+		server, err = amqptest.NewServer(config)
+		Expect(err).ToNot(HaveOccurred())
+
+		conn, err = amqp.Dial(server.URI())
+		Expect(err).ToNot(HaveOccurred())
+		channel, err = conn.Channel()
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		server.Close()
+		config = amqptest.Config{}
+	})
+
+	publish := func(exchange, key string, msg amqp.Publishing) {
+		Expect(channel.Publish(exchange, key, false, false, msg)).To(Succeed())
+	}
+
+	get := func(queue string) (amqp.Delivery, bool) {
+		d, ok, err := channel.Get(queue, true)
+		Expect(err).ToNot(HaveOccurred())
+		return d, ok
+	}
+
+	queueLength := func(name string) func() int {
+		return func() int {
+			info, _ := server.Queue(name)
+			return info.Messages
+		}
+	}
+
+	It("routes through topic exchanges", func() {
+		Expect(channel.ExchangeDeclare("events", "topic", true, false, false, false, nil)).To(Succeed())
+		for _, q := range []string{"all", "sms"} {
+			_, err := channel.QueueDeclare(q, true, false, false, false, nil)
+			Expect(err).ToNot(HaveOccurred())
+		}
+		Expect(channel.QueueBind("all", "notification.#", "events", false, nil)).To(Succeed())
+		Expect(channel.QueueBind("sms", "notification.sms", "events", false, nil)).To(Succeed())
+
+		publish("events", "notification.sms", amqp.Publishing{Body: []byte("a")})
+		publish("events", "notification.email", amqp.Publishing{Body: []byte("b")})
+
+		Eventually(queueLength("all")).Should(Equal(2))
+		Eventually(queueLength("sms")).Should(Equal(1))
+	})
+
+	It("delivers by priority and keeps the properties", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, amqp.Table{"x-max-priority": 9})
+		Expect(err).ToNot(HaveOccurred())
+
+		publish("", "q", amqp.Publishing{Priority: 1, Body: []byte("low")})
+		publish("", "q", amqp.Publishing{Priority: 9, Body: []byte("high"), MessageId: "m1", Headers: amqp.Table{"x-retry-count": 2}})
+		Eventually(queueLength("q")).Should(Equal(2))
+
+		d, ok := get("q")
+		Expect(ok).To(BeTrue())
+		Expect(string(d.Body)).To(Equal("high"))
+		Expect(d.MessageId).To(Equal("m1"))
+		Expect(d.Headers["x-retry-count"]).To(BeEquivalentTo(2))
+
+		d, _ = get("q")
+		Expect(string(d.Body)).To(Equal("low"))
+		_, ok = get("q")
+		Expect(ok).To(BeFalse())
+	})
+
+	It("dead-letters expired and rejected messages", func() {
+		_, err := channel.QueueDeclare("dead", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = channel.QueueDeclare("work", true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    "",
+			"x-dead-letter-routing-key": "dead",
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		publish("", "work", amqp.Publishing{Body: []byte("expired"), Expiration: "20"})
+		Eventually(queueLength("dead")).Should(Equal(1))
+
+		publish("", "work", amqp.Publishing{Body: []byte("rejected")})
+		Eventually(queueLength("work")).Should(Equal(1))
+		d, ok, err := channel.Get("work", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(d.Reject(false)).To(Succeed())
+		Eventually(queueLength("dead")).Should(Equal(2))
+
+		d, _ = get("dead")
+		Expect(string(d.Body)).To(Equal("expired"))
+		Expect(d.Expiration).To(BeEmpty())
+		Expect(d.Headers["x-first-death-reason"]).To(Equal("expired"))
+		d, _ = get("dead")
+		Expect(d.Headers["x-first-death-reason"]).To(Equal("rejected"))
+	})
+
+	It("limits unacknowledged deliveries to the prefetch count and requeues them on close", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		for i := 0; i < 3; i++ {
+			publish("", "q", amqp.Publishing{Body: []byte{byte('a' + i)}})
+		}
+
+		consumerChannel, err := conn.Channel()
+		Expect(err).ToNot(HaveOccurred())
+		Expect(consumerChannel.Qos(2, 0, false)).To(Succeed())
+		deliveries, err := consumerChannel.Consume("q", "c", false, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		var first amqp.Delivery
+		Eventually(deliveries).Should(Receive(&first))
+		Eventually(deliveries).Should(Receive())
+		Consistently(deliveries, 50*time.Millisecond).ShouldNot(Receive())
+
+		Expect(first.Ack(false)).To(Succeed())
+		Eventually(deliveries).Should(Receive())
+
+		Expect(consumerChannel.Close()).To(Succeed())
+		Eventually(queueLength("q")).Should(Equal(2))
+	})
+
+	It("confirms publishings", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(channel.Confirm(false)).To(Succeed())
+		confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+		publish("", "q", amqp.Publishing{Body: []byte("a")})
+		Eventually(confirms).Should(Receive(Equal(amqp.Confirmation{DeliveryTag: 1, Ack: true})))
+	})
+
+	It("nacks publishings rejected by a queue", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(channel.Confirm(false)).To(Succeed())
+		confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 2))
+
+		server.RejectPublishes("q", true)
+		publish("", "q", amqp.Publishing{Body: []byte("a")})
+		Eventually(confirms).Should(Receive(Equal(amqp.Confirmation{DeliveryTag: 1, Ack: false})))
+
+		server.RejectPublishes("q", false)
+		publish("", "q", amqp.Publishing{Body: []byte("b")})
+		Eventually(confirms).Should(Receive(Equal(amqp.Confirmation{DeliveryTag: 2, Ack: true})))
+		Expect(queueLength("q")()).To(Equal(1))
+	})
+
+	It("closes the channel on missing queues and refuses inequivalent declarations", func() {
+		_, err := channel.QueueInspect("missing")
+		Expect(err).To(MatchError(ContainSubstring("NOT_FOUND")))
+
+		channel, err = conn.Channel()
+		Expect(err).ToNot(HaveOccurred())
+		_, err = channel.QueueDeclare("q", true, false, false, false, amqp.Table{"x-message-ttl": 100})
+		Expect(err).ToNot(HaveOccurred())
+		_, err = channel.QueueDeclare("q", true, false, false, false, amqp.Table{"x-message-ttl": 200})
+		Expect(err).To(MatchError(ContainSubstring("PRECONDITION_FAILED")))
+	})
+
+	It("only deletes empty queues when asked to", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		publish("", "q", amqp.Publishing{Body: []byte("a")})
+		Eventually(queueLength("q")).Should(Equal(1))
+
+		_, err = channel.QueueDelete("q", false, true, false)
+		Expect(err).To(MatchError(ContainSubstring("not empty")))
+
+		channel, err = conn.Channel()
+		Expect(err).ToNot(HaveOccurred())
+		deleted, err := channel.QueueDelete("q", false, false, false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deleted).To(Equal(1))
+		Expect(server.QueueNames()).To(BeEmpty())
+	})
+
+	It("closes the connection on unknown exchange types", func() {
+		err := channel.ExchangeDeclare("delayed", "x-delayed-message", true, false, false, false, amqp.Table{"x-delayed-type": "direct"})
+		Expect(err).To(MatchError(ContainSubstring("COMMAND_INVALID")))
+		Eventually(conn.IsClosed).Should(BeTrue())
+	})
+
+	Context("with the delayed message exchange", func() {
+		BeforeEach(func() {
+			config.DelayedMessageExchange = true
+		})
+
+		It("holds messages for their x-delay", func() {
+			Expect(channel.ExchangeDeclare("delayed", "x-delayed-message", true, false, false, false, amqp.Table{"x-delayed-type": "direct"})).To(Succeed())
+			_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(channel.QueueBind("q", "q", "delayed", false, nil)).To(Succeed())
+
+			publish("delayed", "q", amqp.Publishing{Body: []byte("a"), Headers: amqp.Table{"x-delay": int64(100)}})
+			Consistently(queueLength("q"), 50*time.Millisecond).Should(Equal(0))
+			Eventually(queueLength("q")).Should(Equal(1))
+		})
+	})
+
+	It("requeues unacknowledged messages when connections drop", func() {
+		_, err := channel.QueueDeclare("q", true, false, false, false, nil)
+		Expect(err).ToNot(HaveOccurred())
+		publish("", "q", amqp.Publishing{Body: []byte("a")})
+		Eventually(queueLength("q")).Should(Equal(1))
+
+		_, ok, err := channel.Get("q", false)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(ok).To(BeTrue())
+		Expect(queueLength("q")()).To(Equal(0))
+
+		server.CloseConnections()
+		Eventually(conn.IsClosed).Should(BeTrue())
+		Eventually(queueLength("q")).Should(Equal(1))
+	})
+})
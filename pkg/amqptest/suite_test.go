@@ -0,0 +1,13 @@
+package amqptest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestAmqptest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "AMQP Test Server Suite")
+}
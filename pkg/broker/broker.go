@@ -0,0 +1,91 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/broker/memory"
+	"github.com/AlexTsIvanov/notification-system/pkg/jetstream"
+	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+const (
+	BackendRabbitMQ = "rabbitmq"
+	// BackendMemory keeps all the queues in the process, it is meant for local development and tests
+	BackendMemory = "memory"
+	// BackendNATS runs on a NATS JetStream work-queue stream, messages are not ordered by priority
+	BackendNATS = "nats"
+)
+
+// Backend is implemented by every message broker the services can run on. Messages are published to a
+// queue per channel, failed messages are retried following the retry policy of their channel and
+// dead-lettered once it is exhausted or they failed permanently.
+type Backend interface {
+	Send(ctx context.Context, message types.Message) error
+	// SendBatch publishes the messages and returns the error of each of them, nil for the published ones
+	SendBatch(ctx context.Context, messages []types.Message) []error
+
+	Read(ctx context.Context) (types.EventContext, error)
+	Ack(event types.EventContext) error
+	// Nack schedules a retry of the event or dead-letters it and returns which, cause is the error the event failed with
+	Nack(event types.EventContext, cause error) (types.Outcome, error)
+
+	ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error)
+	RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error)
+	PurgeDeadLetters(ctx context.Context, channel string) (int, error)
+
+	Close()
+}
+
+var (
+	_ Backend = (*rabbitmq.RabbitMQBroker)(nil)
+	_ Backend = (*memory.Broker)(nil)
+	_ Backend = (*jetstream.JetStreamBroker)(nil)
+)
+
+type Config struct {
+	Backend  string
+	Channels []string
+	Retry    retry.Policies
+	// RabbitMQ holds the connection and topology settings of the rabbitmq backend,
+	// its channels and retry policies are taken from the fields above
+	RabbitMQ rabbitmq.Config
+	// JetStream holds the connection and stream settings of the nats backend
+	JetStream jetstream.Config
+}
+
+// New creates the configured backend, when withConsumer is set the backend consumes the queues of all the channels
+func New(config Config, withConsumer bool) (Backend, error) {
+	switch config.Backend {
+	case "", BackendRabbitMQ:
+		rabbitmqConfig := config.RabbitMQ
+		rabbitmqConfig.Channels = config.Channels
+		rabbitmqConfig.Retry = config.Retry
+
+		b, err := rabbitmq.NewRabbitMQBroker(rabbitmqConfig, withConsumer)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case BackendNATS:
+		jetStreamConfig := config.JetStream
+		jetStreamConfig.Channels = config.Channels
+		jetStreamConfig.Retry = config.Retry
+
+		b, err := jetstream.NewJetStreamBroker(jetStreamConfig, withConsumer)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	case BackendMemory:
+		b, err := memory.NewBroker(config.Channels, config.Retry)
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("unknown broker backend: %s", config.Backend)
+	}
+}
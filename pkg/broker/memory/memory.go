@@ -0,0 +1,344 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+// message is a notification waiting in a queue or handed out to a consumer
+type message struct {
+	// seq orders messages of the same priority and identifies messages without id
+	seq        uint64
+	id         string
+	channel    string
+	payload    []byte
+	priority   types.Priority
+	retryCount int
+	firstSeen  time.Time
+	expiresAt  time.Time
+}
+
+// deadLetter is a message in the DLQ of its channel
+type deadLetter struct {
+	message
+	info types.DeadLetter
+}
+
+type queue struct {
+	policy      retry.Policy
+	messages    []message
+	deadLetters []deadLetter
+}
+
+// Broker keeps a priority queue with retries and a DLQ per channel in memory. Nothing survives
+// a restart and publishers only reach consumers of the same Broker, so it is meant for
+// running everything in one process during development and for tests.
+type Broker struct {
+	mu       sync.Mutex
+	queues   map[string]*queue
+	inflight map[uint64]message
+	retries  map[uint64]*time.Timer
+	seq      uint64
+	// ready is closed and replaced whenever a message is added to a queue
+	ready    chan struct{}
+	closed   bool
+	hostname string
+}
+
+func NewBroker(channels []string, policies retry.Policies) (*Broker, error) {
+	hostname, _ := os.Hostname()
+
+	b := &Broker{
+		queues:   make(map[string]*queue, len(channels)),
+		inflight: make(map[uint64]message),
+		retries:  make(map[uint64]*time.Timer),
+		ready:    make(chan struct{}),
+		hostname: hostname,
+	}
+	for _, channel := range channels {
+		policy, err := policies.For(channel)
+		if err != nil {
+			return nil, err
+		}
+		b.queues[channel] = &queue{policy: policy}
+	}
+	return b, nil
+}
+
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, t := range b.retries {
+		t.Stop()
+	}
+	close(b.ready)
+}
+
+func (b *Broker) Send(ctx context.Context, msg types.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.queues[msg.Channel]; !ok {
+		return fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, msg.Channel)
+	}
+	if b.closed {
+		return fmt.Errorf("failed to publish a message: broker closed")
+	}
+
+	b.push(message{
+		id:        msg.ID,
+		channel:   msg.Channel,
+		payload:   msg.Payload,
+		priority:  msg.Priority,
+		firstSeen: time.Now(),
+		expiresAt: msg.ExpiresAt,
+	})
+	return nil
+}
+
+// SendBatch queues the messages and returns the error of each of them, nil for the queued ones
+func (b *Broker) SendBatch(ctx context.Context, messages []types.Message) []error {
+	errs := make([]error, len(messages))
+	for i, message := range messages {
+		errs[i] = b.Send(ctx, message)
+	}
+	return errs
+}
+
+// Read blocks until a message is available and returns the one with the highest priority,
+// messages of the same priority are returned in the order they were queued
+func (b *Broker) Read(ctx context.Context) (types.EventContext, error) {
+	for {
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			return types.EventContext{}, fmt.Errorf("consumer channel closed")
+		}
+
+		if msg, ok := b.pop(); ok {
+			b.seq++
+			tag := b.seq
+			b.inflight[tag] = msg
+			b.mu.Unlock()
+
+			return types.EventContext{
+				EventId:    strconv.FormatUint(tag, 10),
+				MessageId:  msg.id,
+				Queue:      msg.channel,
+				Payload:    msg.payload,
+				RetryCount: msg.retryCount,
+				Priority:   msg.priority,
+				FirstSeen:  msg.firstSeen,
+				ExpiresAt:  msg.expiresAt,
+			}, nil
+		}
+		ready := b.ready
+		b.mu.Unlock()
+
+		select {
+		case <-ready:
+		case <-ctx.Done():
+			return types.EventContext{}, ctx.Err()
+		}
+	}
+}
+
+func (b *Broker) Ack(event types.EventContext) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	_, err := b.takeInflight(event)
+	return err
+}
+
+// Nack retries the event after the backoff of its channel. Events failing with a permanent error
+// or exhausting the retry policy are moved to the DLQ together with the failure details.
+func (b *Broker) Nack(event types.EventContext, cause error) (types.Outcome, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg, err := b.takeInflight(event)
+	if err != nil {
+		return "", err
+	}
+
+	q := b.queues[msg.channel]
+	now := time.Now()
+
+	if types.ClassOf(cause).Permanent() || q.policy.Exhausted(msg.retryCount, msg.firstSeen, now) {
+		q.deadLetters = append(q.deadLetters, deadLetter{
+			message: msg,
+			info:    b.deadLetterInfo(msg, cause, now),
+		})
+		return types.DeadLetterOutcome(cause), nil
+	}
+
+	msg.retryCount++
+	b.seq++
+	key := b.seq
+	b.retries[key] = time.AfterFunc(types.RetryDelay(q.policy.Backoff(msg.retryCount), msg.expiresAt, now), func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.retries, key)
+		if !b.closed {
+			b.push(msg)
+		}
+	})
+	return types.OutcomeRetrying, nil
+}
+
+// ListDeadLetters returns up to limit messages of the channel DLQ starting at offset
+// together with the total number of messages in the DLQ
+func (b *Broker) ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[channel]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, channel)
+	}
+
+	var deadLetters []types.DeadLetter
+	for i := offset; i < offset+limit && i < len(q.deadLetters); i++ {
+		deadLetters = append(deadLetters, q.deadLetters[i].info)
+	}
+	return deadLetters, len(q.deadLetters), nil
+}
+
+// RequeueDeadLetters moves the dead letters matching the filter back to the channel queue with
+// a reset retry count. It returns the number of requeued messages.
+func (b *Broker) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[channel]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, channel)
+	}
+
+	var kept []deadLetter
+	requeued := 0
+	for _, d := range q.deadLetters {
+		if !filter.Matches(d.info) {
+			kept = append(kept, d)
+			continue
+		}
+
+		msg := d.message
+		msg.retryCount = 0
+		// the retry policy starts over, including its max age
+		msg.firstSeen = time.Now()
+		b.push(msg)
+		requeued++
+	}
+	q.deadLetters = kept
+
+	return requeued, nil
+}
+
+// PurgeDeadLetters deletes all the messages of the channel DLQ and returns their number
+func (b *Broker) PurgeDeadLetters(ctx context.Context, channel string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[channel]
+	if !ok {
+		return 0, fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, channel)
+	}
+
+	purged := len(q.deadLetters)
+	q.deadLetters = nil
+	return purged, nil
+}
+
+// push appends the message to its queue and wakes up the readers. Must be called with the lock held.
+func (b *Broker) push(msg message) {
+	b.seq++
+	msg.seq = b.seq
+
+	q := b.queues[msg.channel]
+	q.messages = append(q.messages, msg)
+
+	close(b.ready)
+	b.ready = make(chan struct{})
+}
+
+// pop removes the oldest message with the highest priority across all the queues. Must be called with the lock held.
+func (b *Broker) pop() (message, bool) {
+	var best *queue
+	bestIndex := -1
+	for _, q := range b.queues {
+		for i, msg := range q.messages {
+			if best == nil || msg.priority > best.messages[bestIndex].priority ||
+				(msg.priority == best.messages[bestIndex].priority && msg.seq < best.messages[bestIndex].seq) {
+				best, bestIndex = q, i
+			}
+		}
+	}
+	if best == nil {
+		return message{}, false
+	}
+
+	msg := best.messages[bestIndex]
+	best.messages = append(best.messages[:bestIndex], best.messages[bestIndex+1:]...)
+	return msg, true
+}
+
+// takeInflight removes the message of the event from the unacknowledged ones. Must be called with the lock held.
+func (b *Broker) takeInflight(event types.EventContext) (message, error) {
+	tag, err := strconv.ParseUint(event.EventId, 10, 64)
+	if err != nil {
+		return message{}, fmt.Errorf("error converting id to int: %v", err)
+	}
+
+	msg, ok := b.inflight[tag]
+	if !ok {
+		return message{}, fmt.Errorf("unknown delivery tag: %d", tag)
+	}
+	delete(b.inflight, tag)
+	return msg, nil
+}
+
+func (b *Broker) deadLetterInfo(msg message, cause error, now time.Time) types.DeadLetter {
+	lastError := "unknown error"
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	payload := json.RawMessage(msg.payload)
+	if !json.Valid(msg.payload) {
+		payload, _ = json.Marshal(string(msg.payload))
+	}
+
+	id := msg.id
+	if id == "" {
+		id = strconv.FormatUint(msg.seq, 10)
+	}
+
+	firstSeen := msg.firstSeen
+	return types.DeadLetter{
+		ID:           id,
+		Channel:      msg.channel,
+		Payload:      payload,
+		LastError:    lastError,
+		ErrorClass:   types.ClassOf(cause),
+		Attempts:     msg.retryCount + 1,
+		FirstSeen:    &firstSeen,
+		LastAttempt:  &now,
+		ConsumerHost: b.hostname,
+	}
+}
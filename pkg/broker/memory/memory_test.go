@@ -0,0 +1,168 @@
+package memory_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/broker/memory"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Broker", func() {
+	var (
+		broker *memory.Broker
+		ctx    context.Context
+		cancel context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		var err error
+		broker, err = memory.NewBroker([]string{"email", "sms"}, retry.Policies{
+			Default: retry.Policy{
+				InitialDelay: 10 * time.Millisecond,
+				Multiplier:   1,
+				MaxDelay:     10 * time.Millisecond,
+				Jitter:       retry.JitterNone,
+				MaxAttempts:  2,
+			},
+		})
+		Expect(err).ToNot(HaveOccurred())
+
+		ctx, cancel = context.WithTimeout(context.Background(), time.Second)
+	})
+
+	AfterEach(func() {
+		cancel()
+		broker.Close()
+	})
+
+	send := func(channel string, priority types.Priority, payload string) {
+		Expect(broker.Send(ctx, types.Message{Channel: channel, Priority: priority, Payload: []byte(payload)})).To(Succeed())
+	}
+
+	It("rejects unknown channels", func() {
+		err := broker.Send(ctx, types.Message{Channel: "fax"})
+		Expect(errors.Is(err, types.ErrUnsupportedChannel)).To(BeTrue())
+	})
+
+	It("reads the highest priority first and keeps the order within a priority", func() {
+		send("email", types.PriorityNormal, `"first"`)
+		send("sms", types.PriorityLow, `"low"`)
+		send("email", types.PriorityHigh, `"urgent"`)
+		send("sms", types.PriorityNormal, `"second"`)
+
+		var payloads []string
+		for i := 0; i < 4; i++ {
+			event, err := broker.Read(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(broker.Ack(event)).To(Succeed())
+			payloads = append(payloads, string(event.Payload))
+		}
+		Expect(payloads).To(Equal([]string{`"urgent"`, `"first"`, `"second"`, `"low"`}))
+	})
+
+	It("blocks until a message is sent", func() {
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			send("email", types.PriorityNormal, `"late"`)
+		}()
+
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(event.Queue).To(Equal("email"))
+		Expect(string(event.Payload)).To(Equal(`"late"`))
+	})
+
+	It("returns when the context is done", func() {
+		cancel()
+		_, err := broker.Read(ctx)
+		Expect(err).To(MatchError(context.Canceled))
+	})
+
+	It("retries and dead-letters once the policy is exhausted", func() {
+		send("email", types.PriorityNormal, `{"content":"hi"}`)
+
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(broker.Nack(event, errors.New("smtp down"))).To(Equal(types.OutcomeRetrying))
+
+		event, err = broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(event.RetryCount).To(Equal(1))
+		Expect(broker.Nack(event, errors.New("smtp down"))).To(Equal(types.OutcomeDeadLettered))
+
+		deadLetters, total, err := broker.ListDeadLetters(ctx, "email", 0, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(total).To(Equal(1))
+		Expect(deadLetters[0].LastError).To(Equal("smtp down"))
+		Expect(deadLetters[0].Attempts).To(Equal(2))
+		Expect(string(deadLetters[0].Payload)).To(Equal(`{"content":"hi"}`))
+	})
+
+	It("dead-letters permanent failures right away", func() {
+		send("sms", types.PriorityNormal, `"bad"`)
+
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(broker.Nack(event, types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad json")))).To(Equal(types.OutcomeFailed))
+
+		deadLetters, _, err := broker.ListDeadLetters(ctx, "sms", 0, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deadLetters).To(HaveLen(1))
+		Expect(deadLetters[0].ErrorClass).To(Equal(types.ErrorClassInvalidPayload))
+	})
+
+	It("requeues and purges dead letters", func() {
+		for _, payload := range []string{`"a"`, `"b"`} {
+			send("sms", types.PriorityNormal, payload)
+			event, err := broker.Read(ctx)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(broker.Nack(event, types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad")))).To(Equal(types.OutcomeFailed))
+		}
+
+		deadLetters, _, err := broker.ListDeadLetters(ctx, "sms", 0, 10)
+		Expect(err).ToNot(HaveOccurred())
+
+		requeued, err := broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{IDs: []string{deadLetters[0].ID}})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requeued).To(Equal(1))
+
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(string(event.Payload)).To(Equal(`"a"`))
+		Expect(event.RetryCount).To(Equal(0))
+
+		purged, err := broker.PurgeDeadLetters(ctx, "sms")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(purged).To(Equal(1))
+	})
+
+	It("keeps the expiry through retries and requeues", func() {
+		expiresAt := time.Now().Add(time.Minute)
+		Expect(broker.Send(ctx, types.Message{Channel: "sms", Payload: []byte(`"otp"`), ExpiresAt: expiresAt})).To(Succeed())
+
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(event.ExpiresAt).To(Equal(expiresAt))
+		Expect(broker.Nack(event, errors.New("timeout"))).To(Equal(types.OutcomeRetrying))
+
+		event, err = broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(event.ExpiresAt).To(Equal(expiresAt))
+		Expect(broker.Nack(event, errors.New("timeout"))).To(Equal(types.OutcomeDeadLettered))
+
+		_, err = broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{All: true})
+		Expect(err).ToNot(HaveOccurred())
+		event, err = broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(event.ExpiresAt).To(Equal(expiresAt))
+	})
+
+	It("rejects unknown delivery tags", func() {
+		Expect(broker.Ack(types.EventContext{EventId: "42"})).ToNot(Succeed())
+	})
+})
@@ -0,0 +1,118 @@
+package callback
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// Channel is the broker channel of the callback queue, it is consumed by the dispatcher and
+// never by the notification consumers, so slow callback receivers do not delay notifications
+const Channel = "callbacks"
+
+const (
+	EventDelivered = "notification.delivered"
+	EventFailed    = "notification.failed"
+	EventExpired   = "notification.expired"
+)
+
+// Event is the body posted to the callback url of a notification
+type Event struct {
+	// ID identifies the event, retries of the callback post the same id
+	ID             string `json:"id"`
+	Type           string `json:"type"`
+	NotificationID string `json:"notification_id"`
+	// State is delivered, failed, dead_lettered or expired
+	State    status.State `json:"state"`
+	Channel  string       `json:"channel"`
+	Attempts int          `json:"attempts"`
+	Error    string       `json:"error,omitempty"`
+	Time     time.Time    `json:"time"`
+}
+
+// task is a callback waiting in the callback queue
+type task struct {
+	URL   string `json:"url"`
+	Event Event  `json:"event"`
+}
+
+type Sender interface {
+	Send(ctx context.Context, message types.Message) error
+}
+
+// Notifier queues a callback once a notification is delivered, failed for good or expired
+type Notifier struct {
+	sender Sender
+}
+
+// NewNotifier creates a notifier publishing to the Channel of the sender
+func NewNotifier(sender Sender) *Notifier {
+	return &Notifier{
+		sender: sender,
+	}
+}
+
+func (n *Notifier) Delivered(ctx context.Context, event types.EventContext, channel, url string) {
+	n.enqueue(ctx, url, Event{
+		Type:           EventDelivered,
+		NotificationID: event.MessageId,
+		State:          status.StateDelivered,
+		Channel:        channel,
+		Attempts:       event.RetryCount + 1,
+		Time:           time.Now(),
+	})
+}
+
+// Failed queues a callback when the outcome of the failed attempt is final, retried attempts are not reported
+func (n *Notifier) Failed(ctx context.Context, event types.EventContext, channel, url string, cause error, outcome types.Outcome) {
+	state := status.FailedState(outcome)
+	if state == status.StateRetrying {
+		return
+	}
+
+	n.enqueue(ctx, url, Event{
+		Type:           EventFailed,
+		NotificationID: event.MessageId,
+		State:          state,
+		Channel:        channel,
+		Attempts:       event.RetryCount + 1,
+		Error:          cause.Error(),
+		Time:           time.Now(),
+	})
+}
+
+// Expired queues a callback for a notification which was dropped instead of sent as it expired
+func (n *Notifier) Expired(ctx context.Context, event types.EventContext, channel, url string) {
+	n.enqueue(ctx, url, Event{
+		Type:           EventExpired,
+		NotificationID: event.MessageId,
+		State:          status.StateExpired,
+		Channel:        channel,
+		Attempts:       event.RetryCount,
+		Time:           time.Now(),
+	})
+}
+
+// enqueue publishes the callback, failures are logged and never fail the notification
+func (n *Notifier) enqueue(ctx context.Context, url string, event Event) {
+	event.ID = types.NewMessageID()
+	payload, err := json.Marshal(task{URL: url, Event: event})
+	if err != nil {
+		logrus.Errorf("failed to marshal callback of notification %s: %v", event.NotificationID, err)
+		return
+	}
+
+	err = n.sender.Send(ctx, types.Message{
+		ID:       event.ID,
+		Channel:  Channel,
+		Priority: types.PriorityNormal,
+		Payload:  payload,
+	})
+	if err != nil {
+		logrus.Errorf("failed to queue callback of notification %s: %v", event.NotificationID, err)
+	}
+}
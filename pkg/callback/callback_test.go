@@ -0,0 +1,239 @@
+package callback_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/broker/memory"
+	"github.com/AlexTsIvanov/notification-system/pkg/callback"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// failingReader fails every read like a broker which is unavailable
+type failingReader struct {
+	reads atomic.Int32
+}
+
+func (r *failingReader) Read(ctx context.Context) (types.EventContext, error) {
+	r.reads.Add(1)
+	return types.EventContext{}, errors.New("connection refused")
+}
+
+func (r *failingReader) Ack(event types.EventContext) error {
+	return nil
+}
+
+func (r *failingReader) Nack(event types.EventContext, cause error) (types.Outcome, error) {
+	return types.OutcomeRetrying, nil
+}
+
+var _ = Describe("Callbacks", func() {
+	var (
+		queue      *memory.Broker
+		notifier   *callback.Notifier
+		dispatcher *callback.Dispatcher
+		server     *httptest.Server
+		statusCode int
+		mu         sync.Mutex
+		requests   []received
+		ctx        context.Context
+		cancel     context.CancelFunc
+		event      types.EventContext
+	)
+
+	policy := retry.Policy{InitialDelay: 10 * time.Millisecond, Multiplier: 1, MaxDelay: 10 * time.Millisecond, Jitter: retry.JitterNone, MaxAttempts: 2}
+
+	BeforeEach(func() {
+		var err error
+		queue, err = memory.NewBroker([]string{callback.Channel}, retry.Policies{Default: policy})
+		Expect(err).NotTo(HaveOccurred())
+
+		notifier = callback.NewNotifier(queue)
+		// the receiver runs on loopback, which is only allowed explicitly
+		dispatcher = callback.NewDispatcher(queue, "secret", time.Second, []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")})
+
+		statusCode = http.StatusOK
+		requests = nil
+		server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := io.ReadAll(r.Body)
+			mu.Lock()
+			requests = append(requests, received{header: r.Header, body: body})
+			code := statusCode
+			mu.Unlock()
+			w.WriteHeader(code)
+		}))
+
+		ctx, cancel = context.WithTimeout(context.Background(), 2*time.Second)
+		event = types.EventContext{MessageId: "n1", FirstSeen: time.Now()}
+	})
+
+	AfterEach(func() {
+		cancel()
+		server.Close()
+		queue.Close()
+	})
+
+	decode := func(r received) callback.Event {
+		var e callback.Event
+		Expect(json.Unmarshal(r.body, &e)).To(Succeed())
+		return e
+	}
+
+	It("posts a signed event for delivered notifications", func() {
+		notifier.Delivered(ctx, event, "sms", server.URL)
+		Expect(dispatcher.Dispatch(ctx)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		e := decode(requests[0])
+		Expect(e.Type).To(Equal(callback.EventDelivered))
+		Expect(e.NotificationID).To(Equal("n1"))
+		Expect(e.State).To(Equal(status.StateDelivered))
+		Expect(e.Channel).To(Equal("sms"))
+		Expect(e.Attempts).To(Equal(1))
+		Expect(requests[0].header.Get(callback.HeaderEventID)).To(Equal(e.ID))
+		Expect(callback.Verify([]byte("secret"), requests[0].header.Get(callback.HeaderSignature), requests[0].body, time.Minute, time.Now())).To(Succeed())
+	})
+
+	It("reports only the final failure of a notification", func() {
+		notifier.Failed(ctx, event, "sms", server.URL, errors.New("timeout"), types.OutcomeRetrying)
+		event.RetryCount = 1
+		notifier.Failed(ctx, event, "sms", server.URL, errors.New("timeout"), types.OutcomeDeadLettered)
+		Expect(dispatcher.Dispatch(ctx)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		e := decode(requests[0])
+		Expect(e.Type).To(Equal(callback.EventFailed))
+		Expect(e.State).To(Equal(status.StateDeadLettered))
+		Expect(e.Attempts).To(Equal(2))
+		Expect(e.Error).To(Equal("timeout"))
+	})
+
+	It("reports permanent failures right away", func() {
+		notifier.Failed(ctx, event, "sms", server.URL, types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad json")), types.OutcomeFailed)
+		Expect(dispatcher.Dispatch(ctx)).To(Succeed())
+
+		Expect(decode(requests[0]).State).To(Equal(status.StateFailed))
+	})
+
+	It("posts an event for expired notifications", func() {
+		event.RetryCount = 1
+		notifier.Expired(ctx, event, "sms", server.URL)
+		Expect(dispatcher.Dispatch(ctx)).To(Succeed())
+
+		Expect(requests).To(HaveLen(1))
+		e := decode(requests[0])
+		Expect(e.Type).To(Equal(callback.EventExpired))
+		Expect(e.State).To(Equal(status.StateExpired))
+		Expect(e.Attempts).To(Equal(1))
+	})
+
+	It("retries failed posts with the same event id", func() {
+		statusCode = http.StatusServiceUnavailable
+		notifier.Delivered(ctx, event, "sms", server.URL)
+		Expect(dispatcher.Dispatch(ctx)).To(MatchError(ContainSubstring("503")))
+
+		mu.Lock()
+		statusCode = http.StatusNoContent
+		mu.Unlock()
+		Expect(dispatcher.Dispatch(ctx)).To(Succeed())
+
+		Expect(requests).To(HaveLen(2))
+		Expect(decode(requests[1]).ID).To(Equal(decode(requests[0]).ID))
+	})
+
+	It("dead-letters callbacks the receiver rejects", func() {
+		statusCode = http.StatusGone
+		notifier.Delivered(ctx, event, "sms", server.URL)
+		err := dispatcher.Dispatch(ctx)
+		Expect(types.ClassOf(err)).To(Equal(types.ErrorClassRejected))
+
+		deadLetters, total, err := queue.ListDeadLetters(ctx, callback.Channel, 0, 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(total).To(Equal(1))
+		Expect(deadLetters[0].ErrorClass).To(Equal(types.ErrorClassRejected))
+	})
+
+	It("posts callbacks with several workers until the context is done", func() {
+		for i := 0; i < 5; i++ {
+			notifier.Delivered(ctx, event, "sms", server.URL)
+		}
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			dispatcher.Run(ctx, 3)
+		}()
+
+		Eventually(func() int {
+			mu.Lock()
+			defer mu.Unlock()
+			return len(requests)
+		}).Should(Equal(5))
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("backs off while reading the queue fails", func() {
+		reader := &failingReader{}
+		Expect(callback.NewDispatcher(reader, "secret", time.Second, nil).Dispatch(ctx)).To(MatchError(callback.ErrRead))
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			callback.NewDispatcher(reader, "secret", time.Second, nil).Run(ctx, 1)
+		}()
+
+		// reads after 0, 100ms and 300ms
+		time.Sleep(500 * time.Millisecond)
+		Expect(reader.reads.Load()).To(BeNumerically("<=", 5))
+
+		cancel()
+		Eventually(done).Should(BeClosed())
+	})
+
+	It("rejects callbacks to internal addresses", func() {
+		notifier.Delivered(ctx, event, "sms", server.URL)
+
+		err := callback.NewDispatcher(queue, "secret", time.Second, nil).Dispatch(ctx)
+		Expect(err).To(MatchError(ContainSubstring("callback address is not public: 127.0.0.1")))
+		Expect(types.ClassOf(err)).To(Equal(types.ErrorClassRejected))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("does not follow redirects", func() {
+		redirect := httptest.NewServer(http.RedirectHandler(server.URL, http.StatusFound))
+		defer redirect.Close()
+		notifier.Delivered(ctx, event, "sms", redirect.URL)
+
+		err := dispatcher.Dispatch(ctx)
+		Expect(err).To(MatchError(ContainSubstring("callback redirects are not followed")))
+		Expect(types.ClassOf(err)).To(Equal(types.ErrorClassRejected))
+		Expect(requests).To(BeEmpty())
+	})
+
+	It("parses the allowed networks", func() {
+		networks, err := callback.ParseNetworks([]string{"10.1.2.3/8", "::1/128"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(networks).To(Equal([]netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}))
+
+		_, err = callback.ParseNetworks([]string{"10.0.0.1"})
+		Expect(err).To(MatchError(ContainSubstring("invalid callback network")))
+	})
+})
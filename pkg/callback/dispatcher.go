@@ -0,0 +1,202 @@
+package callback
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// minReadDelay and maxReadDelay bound the backoff between reads while reading fails
+	minReadDelay = 100 * time.Millisecond
+	maxReadDelay = 5 * time.Second
+)
+
+// ErrRead is returned by Dispatch when the callback queue cannot be read
+var ErrRead = errors.New("error reading callback queue")
+
+var (
+	// errForbiddenAddress refuses callback urls resolving to internal addresses, so callers of the api
+	// cannot make the service post to hosts of its own network
+	errForbiddenAddress = errors.New("callback address is not public")
+	// errRedirect refuses redirects, which would lead past the check of the address
+	errRedirect = errors.New("callback redirects are not followed")
+)
+
+type Reader interface {
+	Read(ctx context.Context) (types.EventContext, error)
+	Ack(event types.EventContext) error
+	Nack(event types.EventContext, cause error) (types.Outcome, error)
+}
+
+// Dispatcher posts the queued callbacks. Failed posts are retried by the broker with the retry policy
+// of the Channel, callbacks the receiver rejects with a 4xx status are dead-lettered right away.
+type Dispatcher struct {
+	reader Reader
+	client *http.Client
+	secret []byte
+}
+
+// NewDispatcher creates a dispatcher signing the callbacks with the secret, a post
+// taking longer than the timeout fails and is retried. Callbacks are only posted to public
+// addresses and the addresses in the allowed networks, redirects are not followed.
+func NewDispatcher(reader Reader, secret string, timeout time.Duration, allowed []netip.Prefix) *Dispatcher {
+	dialer := &net.Dialer{
+		Timeout: 30 * time.Second,
+		// checks the resolved address of every connection, which a check of the url could not do
+		Control: func(network, address string, _ syscall.RawConn) error {
+			addrPort, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, address)
+			}
+			if !allowedAddr(addrPort.Addr().Unmap(), allowed) {
+				return fmt.Errorf("%w: %s", errForbiddenAddress, addrPort.Addr())
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would be dialed instead of the receiver
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &Dispatcher{
+		reader: reader,
+		client: &http.Client{
+			Timeout:   timeout,
+			Transport: transport,
+			CheckRedirect: func(req *http.Request, via []*http.Request) error {
+				return errRedirect
+			},
+		},
+		secret: []byte(secret),
+	}
+}
+
+// ParseNetworks parses the CIDR notation of the networks callbacks may be posted to besides public addresses
+func ParseNetworks(networks []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid callback network: %v", err)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+func allowedAddr(addr netip.Addr, allowed []netip.Prefix) bool {
+	for _, prefix := range allowed {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return addr.IsGlobalUnicast() && !addr.IsPrivate()
+}
+
+// Run posts callbacks with the number of workers until the context is done
+func (d *Dispatcher) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			delay := minReadDelay
+			for ctx.Err() == nil {
+				err := d.Dispatch(ctx)
+				if ctx.Err() != nil {
+					return
+				}
+				if errors.Is(err, ErrRead) {
+					// reading fails until the broker is available again, back off instead of spinning
+					logrus.Errorf("error dispatching callback, reading again in %s: %v", delay, err)
+					select {
+					case <-time.After(delay):
+					case <-ctx.Done():
+						return
+					}
+					delay = min(2*delay, maxReadDelay)
+					continue
+				}
+				delay = minReadDelay
+
+				if err != nil {
+					logrus.Infof("error dispatching callback: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Dispatch reads a single callback from the queue and posts it
+func (d *Dispatcher) Dispatch(ctx context.Context) (err error) {
+	event, err := d.reader.Read(ctx)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrRead, err)
+	}
+
+	defer func() {
+		if err != nil {
+			if _, nackErr := d.reader.Nack(event, err); nackErr != nil {
+				err = fmt.Errorf("%w; 2nd error: error sending negative acknowledgement: %v", err, nackErr)
+			}
+		} else if ackErr := d.reader.Ack(event); ackErr != nil {
+			logrus.Errorf("error sending acknowledgement: %v", ackErr)
+		}
+	}()
+
+	var t task
+	if err := json.Unmarshal(event.Payload, &t); err != nil {
+		return types.NewDeliveryError(types.ErrorClassInvalidPayload, fmt.Errorf("error unmarshaling callback: %v", err))
+	}
+	return d.post(ctx, t)
+}
+
+func (d *Dispatcher) post(ctx context.Context, t task) error {
+	body, err := json.Marshal(t.Event)
+	if err != nil {
+		return types.NewDeliveryError(types.ErrorClassInvalidPayload, fmt.Errorf("error marshaling callback: %v", err))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return types.NewDeliveryError(types.ErrorClassInvalidPayload, fmt.Errorf("error creating callback request: %v", err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEventID, t.Event.ID)
+	// signed on every attempt, so retries carry a fresh timestamp
+	req.Header.Set(HeaderSignature, Sign(d.secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if errors.Is(err, errForbiddenAddress) || errors.Is(err, errRedirect) {
+		return types.NewDeliveryError(types.ErrorClassRejected, fmt.Errorf("error posting callback: %v", err))
+	}
+	if err != nil {
+		return types.NewDeliveryError(types.ErrorClassSendFailed, fmt.Errorf("error posting callback: %v", err))
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 400 && resp.StatusCode < 500 && resp.StatusCode != http.StatusRequestTimeout && resp.StatusCode != http.StatusTooManyRequests:
+		return types.NewDeliveryError(types.ErrorClassRejected, fmt.Errorf("callback rejected with %s", resp.Status))
+	default:
+		return types.NewDeliveryError(types.ErrorClassSendFailed, fmt.Errorf("callback failed with %s", resp.Status))
+	}
+}
@@ -0,0 +1,62 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// HeaderSignature carries the signature of the callback body as t=<unix seconds>,v1=<hex hmac>
+	HeaderSignature = "X-Notification-Signature"
+	// HeaderEventID is the id of the event, receivers can use it to drop retried callbacks they already handled
+	HeaderEventID = "X-Notification-Event-Id"
+)
+
+var ErrInvalidSignature = errors.New("invalid callback signature")
+
+// Sign returns the HeaderSignature value of the body, the HMAC-SHA256 with the secret of "<timestamp>.<body>"
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, mac(secret, t, body))
+}
+
+// Verify checks the HeaderSignature value of a received callback, signatures older than
+// the tolerance are rejected so recorded callbacks cannot be replayed later
+func Verify(secret []byte, header string, body []byte, tolerance time.Duration, now time.Time) error {
+	var t, signature string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(part, "=")
+		switch key {
+		case "t":
+			t = value
+		case "v1":
+			signature = value
+		}
+	}
+
+	seconds, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || signature == "" {
+		return ErrInvalidSignature
+	}
+	if age := now.Sub(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(signature), []byte(mac(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func mac(secret []byte, timestamp string, body []byte) string {
+	h := hmac.New(sha256.New, secret)
+	h.Write([]byte(timestamp))
+	h.Write([]byte("."))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,29 @@
+package callback_test
+
+import (
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/callback"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Signature", func() {
+	var (
+		secret = []byte("secret")
+		body   = []byte(`{"id":"e1"}`)
+		now    = time.Unix(1792396800, 0)
+	)
+
+	It("verifies its own signatures", func() {
+		Expect(callback.Verify(secret, callback.Sign(secret, now, body), body, time.Minute, now.Add(30*time.Second))).To(Succeed())
+	})
+
+	It("rejects tampered, foreign and old signatures", func() {
+		signature := callback.Sign(secret, now, body)
+		Expect(callback.Verify(secret, signature, []byte(`{"id":"e2"}`), time.Minute, now)).To(MatchError(callback.ErrInvalidSignature))
+		Expect(callback.Verify([]byte("other"), signature, body, time.Minute, now)).To(MatchError(callback.ErrInvalidSignature))
+		Expect(callback.Verify(secret, signature, body, time.Minute, now.Add(2*time.Minute))).To(MatchError(callback.ErrInvalidSignature))
+		Expect(callback.Verify(secret, "v1=abc", body, time.Minute, now)).To(MatchError(callback.ErrInvalidSignature))
+	})
+})
@@ -0,0 +1,65 @@
+package capture
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Message is a notification recorded instead of being sent
+type Message struct {
+	Channel  string    `json:"channel"`
+	Content  string    `json:"content"`
+	Receiver string    `json:"receiver"`
+	SentAt   time.Time `json:"sent_at"`
+}
+
+// Outbox records the notifications of all the capturing senders, so
+// development setups and tests can check what would have been sent
+type Outbox struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func NewOutbox() *Outbox {
+	return &Outbox{}
+}
+
+// Sender returns a sender of the channel recording into the outbox
+func (o *Outbox) Sender(channel string) *Sender {
+	return &Sender{channel: channel, outbox: o}
+}
+
+// Messages returns the recorded notifications in the order they were sent
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]Message{}, o.messages...)
+}
+
+// Reset removes all the recorded notifications
+func (o *Outbox) Reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = nil
+}
+
+type Sender struct {
+	channel string
+	outbox  *Outbox
+}
+
+func (s *Sender) Send(message, recipient string) error {
+	logrus.Infof("captured %s notification to %s", s.channel, recipient)
+
+	s.outbox.mu.Lock()
+	defer s.outbox.mu.Unlock()
+	s.outbox.messages = append(s.outbox.messages, Message{
+		Channel:  s.channel,
+		Content:  message,
+		Receiver: recipient,
+		SentAt:   time.Now(),
+	})
+	return nil
+}
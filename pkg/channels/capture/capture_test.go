@@ -0,0 +1,60 @@
+package capture_test
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/channels/capture"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Outbox", func() {
+	var outbox *capture.Outbox
+
+	BeforeEach(func() {
+		outbox = capture.NewOutbox()
+	})
+
+	It("records the notifications of all the senders in order", func() {
+		Expect(outbox.Sender("email").Send("hi", "a@example.com")).To(Succeed())
+		Expect(outbox.Sender("sms").Send("code 1234", "+359888123456")).To(Succeed())
+
+		messages := outbox.Messages()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].Channel).To(Equal("email"))
+		Expect(messages[0].Content).To(Equal("hi"))
+		Expect(messages[0].Receiver).To(Equal("a@example.com"))
+		Expect(messages[1].Channel).To(Equal("sms"))
+		Expect(messages[1].SentAt).NotTo(BeZero())
+	})
+
+	It("returns a copy of the recorded notifications", func() {
+		Expect(outbox.Sender("email").Send("hi", "a@example.com")).To(Succeed())
+
+		messages := outbox.Messages()
+		messages[0].Content = "changed"
+		Expect(outbox.Messages()[0].Content).To(Equal("hi"))
+	})
+
+	It("removes the recorded notifications on reset", func() {
+		Expect(outbox.Sender("email").Send("hi", "a@example.com")).To(Succeed())
+
+		outbox.Reset()
+		Expect(outbox.Messages()).To(BeEmpty())
+	})
+
+	It("records concurrent sends", func() {
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				outbox.Sender("email").Send("hi", fmt.Sprint(i))
+			}(i)
+		}
+		wg.Wait()
+
+		Expect(outbox.Messages()).To(HaveLen(50))
+	})
+})
@@ -0,0 +1,146 @@
+package dedup
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store remembers the ids of delivered messages, so redeliveries of them can be skipped
+type Store interface {
+	// Seen reports whether the id was marked and its entry has not expired or been evicted yet
+	Seen(id string) (bool, error)
+	// Mark records the id as delivered
+	Mark(id string) error
+	Close() error
+}
+
+const (
+	StoreMemory = "memory"
+	StoreFile   = "file"
+	StoreNone   = "none"
+)
+
+type Config struct {
+	// Store is one of memory, file or none
+	Store    string
+	Capacity int
+	TTL      time.Duration
+	// File is the log of the file store
+	File string
+}
+
+// New creates the store selected by the config, it returns a nil store for none
+func New(config Config) (Store, error) {
+	switch config.Store {
+	case StoreMemory:
+		return NewMemoryStore(config.Capacity, config.TTL), nil
+	case StoreFile:
+		store, err := OpenFileStore(config.File, config.Capacity, config.TTL)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	case StoreNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown dedup store: %s", config.Store)
+	}
+}
+
+type entry struct {
+	id      string
+	expires time.Time
+}
+
+// MemoryStore is a Store keeping up to capacity ids for ttl, the least recently marked ids are
+// evicted first once it is full
+type MemoryStore struct {
+	capacity int
+	ttl      time.Duration
+
+	mu sync.Mutex
+	// entries are ordered from the most to the least recently marked
+	entries *list.List
+	index   map[string]*list.Element
+}
+
+func NewMemoryStore(capacity int, ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  list.New(),
+		index:    make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Seen(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.index[id]
+	if !ok {
+		return false, nil
+	}
+	if time.Now().After(elem.Value.(*entry).expires) {
+		s.remove(elem)
+		return false, nil
+	}
+	return true, nil
+}
+
+func (s *MemoryStore) Mark(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(id, time.Now().Add(s.ttl))
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Len returns the number of ids kept, including expired ones which were not dropped yet
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries.Len()
+}
+
+func (s *MemoryStore) add(id string, expires time.Time) {
+	if elem, ok := s.index[id]; ok {
+		elem.Value.(*entry).expires = expires
+		s.entries.MoveToFront(elem)
+		return
+	}
+
+	s.index[id] = s.entries.PushFront(&entry{id: id, expires: expires})
+
+	// expired entries are dropped before live ones are evicted
+	now := time.Now()
+	for back := s.entries.Back(); back != nil && now.After(back.Value.(*entry).expires); back = s.entries.Back() {
+		s.remove(back)
+	}
+	for s.capacity > 0 && s.entries.Len() > s.capacity {
+		s.remove(s.entries.Back())
+	}
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	s.entries.Remove(elem)
+	delete(s.index, elem.Value.(*entry).id)
+}
+
+// snapshot returns the live entries from the least to the most recently marked
+func (s *MemoryStore) snapshot() []entry {
+	now := time.Now()
+	entries := make([]entry, 0, s.entries.Len())
+	for elem := s.entries.Back(); elem != nil; elem = elem.Prev() {
+		if e := elem.Value.(*entry); !now.After(e.expires) {
+			entries = append(entries, *e)
+		}
+	}
+	return entries
+}
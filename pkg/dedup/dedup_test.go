@@ -0,0 +1,103 @@
+package dedup_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/dedup"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("MemoryStore", func() {
+	It("reports marked ids as seen", func() {
+		store := dedup.NewMemoryStore(10, time.Hour)
+
+		Expect(store.Seen("a")).To(BeFalse())
+		Expect(store.Mark("a")).To(Succeed())
+		Expect(store.Seen("a")).To(BeTrue())
+		Expect(store.Seen("b")).To(BeFalse())
+	})
+
+	It("forgets ids once their ttl passed", func() {
+		store := dedup.NewMemoryStore(10, 50*time.Millisecond)
+		Expect(store.Mark("a")).To(Succeed())
+
+		Expect(store.Seen("a")).To(BeTrue())
+		Eventually(func() (bool, error) { return store.Seen("a") }).Should(BeFalse())
+		Expect(store.Len()).To(Equal(0))
+	})
+
+	It("evicts the least recently marked ids once full", func() {
+		store := dedup.NewMemoryStore(3, time.Hour)
+		for _, id := range []string{"a", "b", "c", "a", "d"} {
+			Expect(store.Mark(id)).To(Succeed())
+		}
+
+		Expect(store.Len()).To(Equal(3))
+		Expect(store.Seen("b")).To(BeFalse())
+		for _, id := range []string{"a", "c", "d"} {
+			Expect(store.Seen(id)).To(BeTrue(), id)
+		}
+	})
+})
+
+var _ = Describe("FileStore", func() {
+	var path string
+
+	BeforeEach(func() {
+		path = filepath.Join(GinkgoT().TempDir(), "dedup", "dedup.log")
+	})
+
+	It("keeps the marked ids across restarts", func() {
+		store, err := dedup.OpenFileStore(path, 10, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(store.Mark("a")).To(Succeed())
+		Expect(store.Mark("b")).To(Succeed())
+		Expect(store.Close()).To(Succeed())
+
+		store, err = dedup.OpenFileStore(path, 10, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+
+		Expect(store.Seen("a")).To(BeTrue())
+		Expect(store.Seen("b")).To(BeTrue())
+		Expect(store.Seen("c")).To(BeFalse())
+	})
+
+	It("drops expired ids and torn lines on open", func() {
+		log := fmt.Sprintf("%d expired\n%d live\n%d torn", time.Now().Add(-time.Minute).UnixMilli(), time.Now().Add(time.Hour).UnixMilli(), time.Now().Add(time.Hour).UnixMilli())
+		Expect(os.MkdirAll(filepath.Dir(path), 0o755)).To(Succeed())
+		Expect(os.WriteFile(path, []byte(log[:len(log)-len(" torn")]), 0o644)).To(Succeed())
+
+		store, err := dedup.OpenFileStore(path, 10, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+
+		Expect(store.Seen("expired")).To(BeFalse())
+		Expect(store.Seen("live")).To(BeTrue())
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(string(data), "\n")).To(Equal(1))
+	})
+
+	It("compacts the log to the live entries", func() {
+		store, err := dedup.OpenFileStore(path, 10, time.Hour)
+		Expect(err).NotTo(HaveOccurred())
+		defer store.Close()
+
+		for i := 0; i < 2000; i++ {
+			Expect(store.Mark(fmt.Sprint(i))).To(Succeed())
+		}
+
+		data, err := os.ReadFile(path)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(strings.Count(string(data), "\n")).To(BeNumerically("<", 1100))
+		Expect(store.Seen("1999")).To(BeTrue())
+		Expect(store.Seen("0")).To(BeFalse())
+	})
+})
@@ -0,0 +1,152 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// the log is rewritten once it holds this many lines more than twice the live entries
+const compactThreshold = 1024
+
+// FileStore is a MemoryStore which appends every mark to a log file and loads the log on open, so the
+// delivered ids survive a restart. Every line holds the expiry in unix milliseconds and the id, the log
+// is compacted to the live entries when it grows. The file must not be shared between instances.
+type FileStore struct {
+	*MemoryStore
+
+	path string
+	file *os.File
+	// lines is the number of lines in the log
+	lines int
+}
+
+// OpenFileStore loads the log at path, creating it when it does not exist
+func OpenFileStore(path string, capacity int, ttl time.Duration) (*FileStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create dedup dir: %v", err)
+	}
+
+	s := &FileStore{
+		MemoryStore: NewMemoryStore(capacity, ttl),
+		path:        path,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	// drops the expired and evicted entries of the previous run
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileStore) load() error {
+	file, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open dedup log: %v", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		expires, id, ok := strings.Cut(scanner.Text(), " ")
+		millis, err := strconv.ParseInt(expires, 10, 64)
+		if !ok || err != nil || id == "" {
+			// a line torn by a crash, the id is delivered again at worst
+			logrus.Warnf("skipping invalid line in dedup log %s: %q", s.path, scanner.Text())
+			continue
+		}
+		s.add(id, time.UnixMilli(millis))
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read dedup log: %v", err)
+	}
+	return nil
+}
+
+func (s *FileStore) Mark(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return fmt.Errorf("dedup store closed")
+	}
+
+	expires := time.Now().Add(s.ttl)
+	s.add(id, expires)
+
+	if _, err := fmt.Fprintf(s.file, "%d %s\n", expires.UnixMilli(), id); err != nil {
+		return fmt.Errorf("failed to write to dedup log: %v", err)
+	}
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync dedup log: %v", err)
+	}
+	s.lines++
+
+	if s.lines > 2*s.entries.Len()+compactThreshold {
+		return s.compact()
+	}
+	return nil
+}
+
+// compact rewrites the log with the live entries to a temporary file which is renamed over the log
+func (s *FileStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create dedup log: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	entries := s.snapshot()
+	w := bufio.NewWriter(tmp)
+	for _, e := range entries {
+		fmt.Fprintf(w, "%d %s\n", e.expires.UnixMilli(), e.id)
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write dedup log: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync dedup log: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close dedup log: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("failed to replace dedup log: %v", err)
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open dedup log: %v", err)
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.lines = len(entries)
+	return nil
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
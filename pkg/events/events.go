@@ -0,0 +1,99 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Type is the CloudEvents type of an event, it is also the routing key on the events exchange
+type Type string
+
+const (
+	// TypeAccepted is emitted by the api once it validated a notification
+	TypeAccepted Type = "notification.accepted"
+	// TypeScheduled is emitted by the api for notifications with a send_at, the accepted event comes first
+	TypeScheduled Type = "notification.scheduled"
+	// TypeCanceled is emitted by the api once a scheduled notification is canceled
+	TypeCanceled Type = "notification.canceled"
+	// TypeSent is emitted by the service for every attempt handed to the channel sender
+	TypeSent Type = "notification.sent"
+	// TypeDelivered is emitted by the service once the channel provider accepted the notification
+	TypeDelivered Type = "notification.delivered"
+	// TypeFailed is emitted for every failed attempt which is retried, and for notifications which
+	// failed with an error retrying cannot fix, Data.State tells them apart
+	TypeFailed Type = "notification.failed"
+	// TypeDeadLettered is emitted by the service once a notification exhausted its retry policy
+	TypeDeadLettered Type = "notification.dead_lettered"
+	// TypeExpired is emitted by the service for notifications dropped instead of sent as they expired
+	TypeExpired Type = "notification.expired"
+)
+
+const (
+	// SpecVersion is the CloudEvents version of the events
+	SpecVersion = "1.0"
+	// ContentType is the content type of the published messages, the events use the structured mode
+	ContentType = "application/cloudevents+json"
+	// DataContentType is the content type of the Data of the events
+	DataContentType = "application/json"
+
+	SourceAPI     = "/notification-api"
+	SourceService = "/notification-service"
+)
+
+// Event is a CloudEvents 1.0 event in the JSON structured format
+type Event struct {
+	SpecVersion string `json:"specversion"`
+	// ID is unique per event, consumers can use it to drop redelivered events
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Type   Type   `json:"type"`
+	// Subject is the id of the notification
+	Subject         string    `json:"subject"`
+	Time            time.Time `json:"time"`
+	DataContentType string    `json:"datacontenttype"`
+	Data            Data      `json:"data"`
+}
+
+// Data describes the notification of an event, it never contains the content or the receiver
+type Data struct {
+	NotificationID string   `json:"notification_id"`
+	Channel        string   `json:"channel,omitempty"`
+	Priority       string   `json:"priority,omitempty"`
+	Tenant         string   `json:"tenant,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+	// State is the status of the notification after the event, e.g. retrying or failed for TypeFailed
+	State string `json:"state"`
+	// Attempt is the delivery attempt starting at 1, it is not set for the events of the api
+	Attempt    int    `json:"attempt,omitempty"`
+	Error      string `json:"error,omitempty"`
+	ErrorClass string `json:"error_class,omitempty"`
+	// Host is the name of the host which emitted the event
+	Host string `json:"host,omitempty"`
+}
+
+// New creates an event of the current time
+func New(id, source string, eventType Type, data Data) Event {
+	return Event{
+		SpecVersion:     SpecVersion,
+		ID:              id,
+		Source:          source,
+		Type:            eventType,
+		Subject:         data.NotificationID,
+		Time:            time.Now().UTC(),
+		DataContentType: DataContentType,
+		Data:            data,
+	}
+}
+
+// Parse decodes an event from the body of a message of the events exchange
+func Parse(body []byte) (Event, error) {
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil {
+		return Event{}, fmt.Errorf("failed to decode event: %v", err)
+	}
+	if event.SpecVersion != SpecVersion {
+		return Event{}, fmt.Errorf("unsupported specversion: %s", event.SpecVersion)
+	}
+	return event, nil
+}
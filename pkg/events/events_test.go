@@ -0,0 +1,35 @@
+package events_test
+
+import (
+	"encoding/json"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Event", func() {
+	It("round trips the structured format", func() {
+		event := events.New("e1", events.SourceAPI, events.TypeAccepted, events.Data{NotificationID: "n1", Channel: "email", State: "accepted"})
+		body, err := json.Marshal(event)
+		Expect(err).NotTo(HaveOccurred())
+
+		var fields map[string]any
+		Expect(json.Unmarshal(body, &fields)).To(Succeed())
+		Expect(fields).To(HaveKeyWithValue("specversion", "1.0"))
+		Expect(fields).To(HaveKeyWithValue("subject", "n1"))
+		Expect(fields).To(HaveKeyWithValue("datacontenttype", "application/json"))
+
+		parsed, err := events.Parse(body)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(parsed.ID).To(Equal("e1"))
+		Expect(parsed.Type).To(Equal(events.TypeAccepted))
+		Expect(parsed.Time.Equal(event.Time)).To(BeTrue())
+		Expect(parsed.Data).To(Equal(event.Data))
+	})
+
+	It("rejects other spec versions", func() {
+		_, err := events.Parse([]byte(`{"specversion":"0.3","id":"e1"}`))
+		Expect(err).To(MatchError(ContainSubstring("unsupported specversion")))
+	})
+})
@@ -0,0 +1,162 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite3"
+)
+
+var (
+	// ErrInFlight is returned while the first request with the key is still processed
+	ErrInFlight = errors.New("a request with the idempotency key is in progress")
+	// ErrMismatch is returned when the key was used by a request with a different fingerprint
+	ErrMismatch = errors.New("the idempotency key was used with a different request")
+)
+
+// Response is the response of the first request with a key, which is replayed to its retries
+type Response struct {
+	Status int
+	Body   []byte
+}
+
+// Store keeps the responses of requests by their idempotency key
+type Store interface {
+	// Reserve claims the key for a request with the fingerprint. It returns nil when the key is new,
+	// the stored response when the key was completed by a request with the same fingerprint,
+	// ErrInFlight while the key is reserved and ErrMismatch when the fingerprints differ.
+	Reserve(ctx context.Context, key, fingerprint string) (*Response, error)
+	// Complete stores the response of the reserved key
+	Complete(ctx context.Context, key string, response Response) error
+	// Release drops the reservation of a request which failed, so it can be retried with the same key
+	Release(ctx context.Context, key string) error
+	Close() error
+}
+
+// Open creates the store selected by kind keeping the keys for ttl, it returns a nil store when kind is
+// empty. The sql drivers have to be registered by the binary. The memory store is only shared within
+// the process, so retries reaching another replica are sent again.
+func Open(ctx context.Context, kind, dsn string, ttl time.Duration) (Store, error) {
+	var dialect sqldialect.Dialect
+	switch kind {
+	case "":
+		return nil, nil
+	case StoreMemory:
+		return NewMemoryStore(ttl), nil
+	case StorePostgres:
+		dialect = sqldialect.Postgres
+	case StoreSQLite:
+		dialect = sqldialect.SQLite
+	default:
+		return nil, fmt.Errorf("unknown idempotency store: %s", kind)
+	}
+
+	db, err := sql.Open(kind, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open idempotency store: %v", err)
+	}
+	store := NewSQLStore(db, dialect, ttl)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+type record struct {
+	key         string
+	fingerprint string
+	// response is nil while the request is in flight
+	response *Response
+	expires  time.Time
+}
+
+// MemoryStore is a Store keeping the keys in the process for ttl after they were first reserved
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu sync.Mutex
+	// records are ordered by their expiry, the ttl is the same for all of them
+	records *list.List
+	index   map[string]*list.Element
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		ttl:     ttl,
+		records: list.New(),
+		index:   make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryStore) Reserve(ctx context.Context, key, fingerprint string) (*Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire(time.Now())
+
+	if elem, ok := s.index[key]; ok {
+		rec := elem.Value.(*record)
+		if rec.fingerprint != fingerprint {
+			return nil, ErrMismatch
+		}
+		if rec.response == nil {
+			return nil, ErrInFlight
+		}
+		return rec.response, nil
+	}
+
+	s.index[key] = s.records.PushBack(&record{
+		key:         key,
+		fingerprint: fingerprint,
+		expires:     time.Now().Add(s.ttl),
+	})
+	return nil, nil
+}
+
+func (s *MemoryStore) Complete(ctx context.Context, key string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the key may have expired while the request was processed, the response is not replayed then
+	if elem, ok := s.index[key]; ok {
+		elem.Value.(*record).response = &response
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.index[key]; ok && elem.Value.(*record).response == nil {
+		s.remove(elem)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) expire(now time.Time) {
+	for front := s.records.Front(); front != nil && now.After(front.Value.(*record).expires); front = s.records.Front() {
+		s.remove(front)
+	}
+}
+
+func (s *MemoryStore) remove(elem *list.Element) {
+	s.records.Remove(elem)
+	delete(s.index, elem.Value.(*record).key)
+}
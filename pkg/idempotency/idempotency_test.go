@@ -0,0 +1,145 @@
+package idempotency_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/idempotency"
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// openSQLite opens a migrated store in a temporary sqlite database
+func openSQLite(ttl time.Duration) idempotency.Store {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(GinkgoT().TempDir(), "idempotency.db")+"?_busy_timeout=5000&_txlock=immediate")
+	Expect(err).NotTo(HaveOccurred())
+	store := idempotency.NewSQLStore(db, sqldialect.SQLite, ttl)
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	// migrating twice is a no-op
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	return store
+}
+
+var _ = Describe("Store", func() {
+	for _, backend := range []struct {
+		name string
+		open func(ttl time.Duration) idempotency.Store
+	}{
+		{name: "memory", open: func(ttl time.Duration) idempotency.Store { return idempotency.NewMemoryStore(ttl) }},
+		{name: "sqlite", open: openSQLite},
+	} {
+		backend := backend
+
+		Context("with the "+backend.name+" store", func() {
+			var (
+				store idempotency.Store
+				ctx   context.Context
+			)
+
+			BeforeEach(func() {
+				store = backend.open(time.Hour)
+				ctx = context.Background()
+			})
+
+			AfterEach(func() {
+				store.Close()
+			})
+
+			It("replays the response of a completed key", func() {
+				response, err := store.Reserve(ctx, "key", "a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response).To(BeNil())
+
+				_, err = store.Reserve(ctx, "key", "a")
+				Expect(err).To(MatchError(idempotency.ErrInFlight))
+
+				Expect(store.Complete(ctx, "key", idempotency.Response{Status: 202, Body: []byte(`"ok"`)})).To(Succeed())
+				response, err = store.Reserve(ctx, "key", "a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response).To(Equal(&idempotency.Response{Status: 202, Body: []byte(`"ok"`)}))
+			})
+
+			It("rejects a key reused with a different fingerprint", func() {
+				_, err := store.Reserve(ctx, "key", "a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.Complete(ctx, "key", idempotency.Response{Status: 202})).To(Succeed())
+
+				_, err = store.Reserve(ctx, "key", "b")
+				Expect(err).To(MatchError(idempotency.ErrMismatch))
+			})
+
+			It("frees released keys", func() {
+				_, err := store.Reserve(ctx, "key", "a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.Release(ctx, "key")).To(Succeed())
+
+				response, err := store.Reserve(ctx, "key", "b")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(response).To(BeNil())
+			})
+
+			It("forgets keys once the window passed", func() {
+				store.Close()
+				store = backend.open(50 * time.Millisecond)
+				_, err := store.Reserve(ctx, "key", "a")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.Complete(ctx, "key", idempotency.Response{Status: 202})).To(Succeed())
+
+				Eventually(func() (*idempotency.Response, error) {
+					return store.Reserve(ctx, "key", "b")
+				}).Should(BeNil())
+			})
+
+			It("reserves a key for a single one of concurrent requests", func() {
+				var (
+					wg       sync.WaitGroup
+					mu       sync.Mutex
+					reserved int
+				)
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						if response, err := store.Reserve(ctx, "key", "a"); err == nil && response == nil {
+							mu.Lock()
+							reserved++
+							mu.Unlock()
+						}
+					}()
+				}
+				wg.Wait()
+				Expect(reserved).To(Equal(1))
+			})
+		})
+	}
+})
+
+var _ = Describe("SQLStore", func() {
+	It("replays the response to retries reaching another replica", func() {
+		ctx := context.Background()
+		dsn := "file:" + filepath.Join(GinkgoT().TempDir(), "idempotency.db") + "?_busy_timeout=5000&_txlock=immediate"
+		replicas := make([]*idempotency.SQLStore, 2)
+		for i := range replicas {
+			db, err := sql.Open("sqlite3", dsn)
+			Expect(err).NotTo(HaveOccurred())
+			replicas[i] = idempotency.NewSQLStore(db, sqldialect.SQLite, time.Hour)
+			Expect(replicas[i].Migrate(ctx)).To(Succeed())
+			DeferCleanup(replicas[i].Close)
+		}
+
+		_, err := replicas[0].Reserve(ctx, "key", "a")
+		Expect(err).NotTo(HaveOccurred())
+		_, err = replicas[1].Reserve(ctx, "key", "a")
+		Expect(err).To(MatchError(idempotency.ErrInFlight))
+
+		Expect(replicas[0].Complete(ctx, "key", idempotency.Response{Status: 202, Body: []byte(`"ok"`)})).To(Succeed())
+		response, err := replicas[1].Reserve(ctx, "key", "a")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(response).To(Equal(&idempotency.Response{Status: 202, Body: []byte(`"ok"`)}))
+	})
+})
@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const keysTable = "idempotency_keys"
+
+// SQLStore is a Store in a postgres or sqlite database shared by the api replicas, so a retry is
+// recognized by any of them. The expiry is stored as unix milliseconds, in flight keys have status 0.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqldialect.Dialect
+	ttl     time.Duration
+}
+
+func NewSQLStore(db *sql.DB, dialect sqldialect.Dialect, ttl time.Duration) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect, ttl: ttl}
+}
+
+// Migrate creates the table of the store when it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	switch s.dialect {
+	case sqldialect.Postgres, sqldialect.SQLite:
+	default:
+		return fmt.Errorf("unsupported idempotency store dialect: %s", s.dialect)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + keysTable + ` (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint     TEXT NOT NULL,
+			status          INTEGER NOT NULL,
+			body            TEXT NOT NULL,
+			expires_at      BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + keysTable + `_expires_at ON ` + keysTable + ` (expires_at)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate idempotency store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Reserve(ctx context.Context, key, fingerprint string) (*Response, error) {
+	now := time.Now()
+	// the key is either inserted or read, an expired or released key read in between is inserted again
+	for i := 0; i < 3; i++ {
+		result, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+			"INSERT INTO "+keysTable+" (idempotency_key, fingerprint, status, body, expires_at) VALUES (?, ?, 0, '', ?) ON CONFLICT (idempotency_key) DO NOTHING"),
+			key, fingerprint, now.Add(s.ttl).UnixMilli(),
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to reserve idempotency key: %v", err)
+		}
+		if n, err := result.RowsAffected(); err != nil {
+			return nil, fmt.Errorf("failed to get affected rows: %v", err)
+		} else if n == 1 {
+			s.expire(ctx, now)
+			return nil, nil
+		}
+
+		var (
+			storedFingerprint string
+			status            int
+			body              string
+			expiresAt         int64
+		)
+		err = s.db.QueryRowContext(ctx, s.dialect.Rebind(
+			"SELECT fingerprint, status, body, expires_at FROM "+keysTable+" WHERE idempotency_key = ?"), key,
+		).Scan(&storedFingerprint, &status, &body, &expiresAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idempotency key: %v", err)
+		}
+
+		if expiresAt < now.UnixMilli() {
+			// conditioned on the expiry, so a key reserved again by another replica is kept
+			if _, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+				"DELETE FROM "+keysTable+" WHERE idempotency_key = ? AND expires_at = ?"), key, expiresAt,
+			); err != nil {
+				return nil, fmt.Errorf("failed to expire idempotency key: %v", err)
+			}
+			continue
+		}
+		if storedFingerprint != fingerprint {
+			return nil, ErrMismatch
+		}
+		if status == 0 {
+			return nil, ErrInFlight
+		}
+		return &Response{Status: status, Body: []byte(body)}, nil
+	}
+	return nil, fmt.Errorf("failed to reserve idempotency key: changed concurrently")
+}
+
+func (s *SQLStore) Complete(ctx context.Context, key string, response Response) error {
+	// the key may have expired while the request was processed, the response is not replayed then
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+keysTable+" SET status = ?, body = ? WHERE idempotency_key = ? AND status = 0"),
+		response.Status, string(response.Body), key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to complete idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Release(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"DELETE FROM "+keysTable+" WHERE idempotency_key = ? AND status = 0"), key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release idempotency key: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// expire deletes the expired keys, failing leaves them for the next reservation
+func (s *SQLStore) expire(ctx context.Context, now time.Time) {
+	s.db.ExecContext(ctx, s.dialect.Rebind("DELETE FROM "+keysTable+" WHERE expires_at < ?"), now.UnixMilli())
+}
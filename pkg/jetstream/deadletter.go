@@ -0,0 +1,163 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/nats-io/nats.go"
+	js "github.com/nats-io/nats.go/jetstream"
+)
+
+// ListDeadLetters returns up to limit messages of the channel DLQ starting at offset together with the
+// total number of messages in the DLQ. Messages are read by sequence, listing does not change the DLQ.
+func (b *JetStreamBroker) ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error) {
+	subject, err := b.deadLetterSubjectOf(channel)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	info, err := b.dlqStream.Info(ctx, js.WithSubjectFilter(subject))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to get DLQ stream info: %v", err)
+	}
+	total := int(info.State.Subjects[subject])
+
+	var deadLetters []types.DeadLetter
+	seq := uint64(1)
+	for i := 0; i < offset+limit && i < total; i++ {
+		msg, err := b.dlqStream.GetMsg(ctx, seq, js.WithGetMsgSubject(subject))
+		if errors.Is(err, js.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get message from %s: %v", subject, err)
+		}
+		if i >= offset {
+			deadLetters = append(deadLetters, toDeadLetter(msg, channel))
+		}
+		seq = msg.Sequence + 1
+	}
+
+	return deadLetters, total, nil
+}
+
+// RequeueDeadLetters publishes the dead letters matching the filter back to the channel subject with a
+// reset retry count and removes them from the DLQ. It returns the number of requeued messages.
+func (b *JetStreamBroker) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	subject, err := b.deadLetterSubjectOf(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	requeued := 0
+	seq := uint64(1)
+	for ctx.Err() == nil {
+		msg, err := b.dlqStream.GetMsg(ctx, seq, js.WithGetMsgSubject(subject))
+		if errors.Is(err, js.ErrMsgNotFound) {
+			break
+		}
+		if err != nil {
+			return requeued, fmt.Errorf("failed to get message from %s: %v", subject, err)
+		}
+		seq = msg.Sequence + 1
+
+		if !filter.Matches(toDeadLetter(msg, channel)) {
+			continue
+		}
+
+		// the copy gets a new stream timestamp, so the retry policy starts over including its max age
+		requeue := nats.NewMsg(fmt.Sprintf(subjectFormat, channel))
+		requeue.Data = msg.Data
+		requeue.Header.Set(headerPriority, msg.Header.Get(headerPriority))
+		// the id is restored without the Nats-Msg-Id header, with it the server would drop
+		// the copy as a duplicate within its duplicate window
+		if id := msg.Header.Get(headerOriginalMessageId); id != "" {
+			requeue.Header.Set(headerMessageId, id)
+		}
+		// the expiry does not start over, an expired message is dropped by the consumer
+		if expiresAt := msg.Header.Get(headerExpiresAt); expiresAt != "" {
+			requeue.Header.Set(headerExpiresAt, expiresAt)
+		}
+		if _, err := b.js.PublishMsg(ctx, requeue); err != nil {
+			return requeued, fmt.Errorf("failed to requeue message: %v", err)
+		}
+
+		if err := b.dlqStream.DeleteMsg(ctx, msg.Sequence); err != nil {
+			return requeued, fmt.Errorf("failed to remove requeued message from %s: %v", subject, err)
+		}
+		requeued++
+	}
+
+	return requeued, ctx.Err()
+}
+
+// PurgeDeadLetters deletes all the messages of the channel DLQ and returns their number
+func (b *JetStreamBroker) PurgeDeadLetters(ctx context.Context, channel string) (int, error) {
+	subject, err := b.deadLetterSubjectOf(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := b.dlqStream.Info(ctx, js.WithSubjectFilter(subject))
+	if err != nil {
+		return 0, fmt.Errorf("failed to get DLQ stream info: %v", err)
+	}
+
+	if err := b.dlqStream.Purge(ctx, js.WithPurgeSubject(subject)); err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %v", subject, err)
+	}
+	return int(info.State.Subjects[subject]), nil
+}
+
+func (b *JetStreamBroker) deadLetterSubjectOf(channel string) (string, error) {
+	if _, ok := b.consumers[fmt.Sprintf(subjectFormat, channel)]; !ok {
+		return "", fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, channel)
+	}
+	return fmt.Sprintf(deadLetterSubjectFormat, channel), nil
+}
+
+func toDeadLetter(msg *js.RawStreamMsg, channel string) types.DeadLetter {
+	payload := json.RawMessage(msg.Data)
+	if !json.Valid(msg.Data) {
+		payload, _ = json.Marshal(string(msg.Data))
+	}
+
+	headers := make(map[string]interface{}, len(msg.Header))
+	for k := range msg.Header {
+		headers[k] = msg.Header.Get(k)
+	}
+
+	id := msg.Header.Get(headerOriginalMessageId)
+	if id == "" {
+		// messages without id are told apart by their sequence in the DLQ stream
+		id = strconv.FormatUint(msg.Sequence, 10)
+	}
+
+	attempts, _ := strconv.Atoi(msg.Header.Get(headerAttempts))
+
+	return types.DeadLetter{
+		ID:           id,
+		Channel:      channel,
+		Payload:      payload,
+		LastError:    msg.Header.Get(headerLastError),
+		ErrorClass:   types.ErrorClass(msg.Header.Get(headerErrorClass)),
+		Attempts:     attempts,
+		FirstSeen:    headerTime(msg.Header, headerFirstSeen),
+		LastAttempt:  headerTime(msg.Header, headerLastAttempt),
+		ConsumerHost: msg.Header.Get(headerConsumerHost),
+		Headers:      headers,
+	}
+}
+
+func headerTime(headers nats.Header, key string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, headers.Get(key))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
@@ -0,0 +1,496 @@
+package jetstream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/nats-io/nats.go"
+	js "github.com/nats-io/nats.go/jetstream"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	subjectFormat           = "notification.%s"
+	deadLetterSubjectFormat = "dlq.notification.%s"
+	deadLetterStreamFormat  = "%s_DLQ"
+	consumerFormat          = "%s_%s"
+
+	// advisory published by the server when a message exceeded the max deliveries of its consumer
+	maxDeliveriesAdvisoryFormat = "$JS.EVENT.ADVISORY.CONSUMER.MAX_DELIVERIES.%s.*"
+
+	ackWait        = 30 * time.Second
+	requestTimeout = 5 * time.Second
+
+	// backoff of the fetching after an error
+	minFetchDelay = 100 * time.Millisecond
+	maxFetchDelay = 5 * time.Second
+
+	// ackWindow is the number of messages SendBatch publishes before waiting for their acks
+	ackWindow = 256
+)
+
+// headers of the messages, the failure headers have the same names as on the rabbitmq backend
+const (
+	headerPriority          = "x-priority"
+	headerMessageId         = "x-message-id"
+	headerLastError         = "x-last-error"
+	headerErrorClass        = "x-error-class"
+	headerChannel           = "x-channel"
+	headerAttempts          = "x-attempts"
+	headerFirstSeen         = "x-first-seen"
+	headerLastAttempt       = "x-last-attempt"
+	headerOriginalMessageId = "x-original-message-id"
+	headerConsumerHost      = "x-consumer-host"
+	// headerExpiresAt carries the expiry of a notification, JetStream has no per message expiration
+	headerExpiresAt = "x-expires-at"
+)
+
+type Config struct {
+	Url string
+	// Stream is the name of the work-queue stream, the dead letters are kept in <Stream>_DLQ
+	Stream   string
+	Channels []string
+	// Prefetch limits the unacknowledged messages per channel
+	Prefetch int
+	Retry    retry.Policies
+	// AckWait is how long a delivered message waits for its ack before it is redelivered, defaults to 30s
+	AckWait time.Duration
+}
+
+type channelConsumer struct {
+	channel string
+	policy  retry.Policy
+}
+
+// JetStreamBroker keeps the notifications in a work-queue stream with a durable consumer per channel.
+// Retries are redelivered by the server after the backoff of the retry policy, messages failing
+// permanently or exhausting the policy are moved to the DLQ stream.
+type JetStreamBroker struct {
+	conn      *nats.Conn
+	js        js.JetStream
+	stream    js.Stream
+	dlqStream js.Stream
+	// consumers maps the channel subjects to their channel
+	consumers map[string]channelConsumer
+	hostname  string
+
+	iterators  []js.MessagesContext
+	advisories *nats.Subscription
+	msgs       chan js.Msg
+	done       chan struct{}
+
+	mu       sync.Mutex
+	inflight map[string]js.Msg
+	nextId   uint64
+}
+
+// NewJetStreamBroker creates the work-queue stream for all the notification subjects and the DLQ stream.
+// When withConsumer is set a durable consumer is created for every configured channel, which
+// delivers a message at most MaxAttempts times, and the max deliveries advisories are
+// handled by moving the affected messages to the DLQ.
+func NewJetStreamBroker(config Config, withConsumer bool) (*JetStreamBroker, error) {
+	if len(config.Channels) == 0 {
+		return nil, fmt.Errorf("at least one notification channel is required")
+	}
+	if config.AckWait <= 0 {
+		config.AckWait = ackWait
+	}
+
+	consumers := make(map[string]channelConsumer, len(config.Channels))
+	for _, ch := range config.Channels {
+		policy, err := config.Retry.For(ch)
+		if err != nil {
+			return nil, err
+		}
+		consumers[fmt.Sprintf(subjectFormat, ch)] = channelConsumer{channel: ch, policy: policy}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	conn, err := nats.Connect(config.Url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %v", err)
+	}
+
+	b := &JetStreamBroker{
+		conn:      conn,
+		consumers: consumers,
+		hostname:  hostname,
+		inflight:  make(map[string]js.Msg),
+		done:      make(chan struct{}),
+	}
+	if err := b.setup(config, withConsumer); err != nil {
+		b.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+func (b *JetStreamBroker) setup(config Config, withConsumer bool) error {
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	var err error
+	b.js, err = js.New(b.conn)
+	if err != nil {
+		return fmt.Errorf("failed to create JetStream context: %v", err)
+	}
+
+	// the stream takes the subjects of all channels, so instances handling different channels share it
+	b.stream, err = b.js.CreateOrUpdateStream(ctx, js.StreamConfig{
+		Name:      config.Stream,
+		Subjects:  []string{fmt.Sprintf(subjectFormat, ">")},
+		Retention: js.WorkQueuePolicy,
+		Storage:   js.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stream %s: %v", config.Stream, err)
+	}
+
+	dlqName := fmt.Sprintf(deadLetterStreamFormat, config.Stream)
+	b.dlqStream, err = b.js.CreateOrUpdateStream(ctx, js.StreamConfig{
+		Name:     dlqName,
+		Subjects: []string{fmt.Sprintf(deadLetterSubjectFormat, ">")},
+		Storage:  js.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create DLQ stream %s: %v", dlqName, err)
+	}
+
+	if !withConsumer {
+		return nil
+	}
+
+	b.msgs = make(chan js.Msg)
+	for subject, consumer := range b.consumers {
+		name := fmt.Sprintf(consumerFormat, config.Stream, consumer.channel)
+
+		c, err := b.stream.CreateOrUpdateConsumer(ctx, js.ConsumerConfig{
+			Durable:       name,
+			FilterSubject: subject,
+			AckPolicy:     js.AckExplicitPolicy,
+			AckWait:       config.AckWait,
+			// the last delivery is dead-lettered by Nack, the limit only ends
+			// redeliveries of messages which are never acknowledged
+			MaxDeliver:    max(consumer.policy.MaxAttempts, 1),
+			MaxAckPending: config.Prefetch,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create consumer %s: %v", name, err)
+		}
+
+		it, err := c.Messages(js.PullMaxMessages(config.Prefetch))
+		if err != nil {
+			return fmt.Errorf("failed to consume %s: %v", name, err)
+		}
+		b.iterators = append(b.iterators, it)
+
+		go b.fetch(name, it)
+	}
+
+	// a queue group makes sure every advisory is handled by a single consumer instance
+	b.advisories, err = b.conn.QueueSubscribe(
+		fmt.Sprintf(maxDeliveriesAdvisoryFormat, config.Stream),
+		dlqName,
+		b.handleMaxDeliveries,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to max deliveries advisories: %v", err)
+	}
+
+	return nil
+}
+
+// fetch hands the messages of the consumer to Read until the broker is closed. Fetching is retried
+// with a backoff, e.g. while the server is unreachable.
+func (b *JetStreamBroker) fetch(name string, it js.MessagesContext) {
+	delay := minFetchDelay
+	for {
+		msg, err := it.Next()
+		if errors.Is(err, js.ErrMsgIteratorClosed) {
+			return
+		}
+		if err != nil {
+			logrus.Errorf("failed to fetch from %s, retrying in %s: %v", name, delay, err)
+			select {
+			case <-time.After(delay):
+			case <-b.done:
+				return
+			}
+			delay = min(2*delay, maxFetchDelay)
+			continue
+		}
+		delay = minFetchDelay
+
+		select {
+		case b.msgs <- msg:
+		case <-b.done:
+			return
+		}
+	}
+}
+
+func (b *JetStreamBroker) Close() {
+	close(b.done)
+	if b.advisories != nil {
+		b.advisories.Unsubscribe()
+	}
+	for _, it := range b.iterators {
+		it.Stop()
+	}
+	b.conn.Close()
+}
+
+func (b *JetStreamBroker) Send(ctx context.Context, message types.Message) error {
+	subject := fmt.Sprintf(subjectFormat, message.Channel)
+	if _, ok := b.consumers[subject]; !ok {
+		return fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, message.Channel)
+	}
+
+	if _, err := b.js.PublishMsg(ctx, newMsg(subject, message)); err != nil {
+		return fmt.Errorf("failed to publish a message: %w", err)
+	}
+	return nil
+}
+
+// SendBatch publishes the messages asynchronously and returns the error of each of them, nil for
+// the published ones. The acks are awaited per window of messages instead of per message.
+func (b *JetStreamBroker) SendBatch(ctx context.Context, messages []types.Message) []error {
+	errs := make([]error, len(messages))
+	for start := 0; start < len(messages); start += ackWindow {
+		end := min(start+ackWindow, len(messages))
+
+		futures := make(map[int]js.PubAckFuture)
+		for i := start; i < end; i++ {
+			subject := fmt.Sprintf(subjectFormat, messages[i].Channel)
+			if _, ok := b.consumers[subject]; !ok {
+				errs[i] = fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, messages[i].Channel)
+				continue
+			}
+			future, err := b.js.PublishMsgAsync(newMsg(subject, messages[i]))
+			if err != nil {
+				errs[i] = fmt.Errorf("failed to publish a message: %w", err)
+				continue
+			}
+			futures[i] = future
+		}
+
+		for i, future := range futures {
+			select {
+			case <-future.Ok():
+			case err := <-future.Err():
+				errs[i] = fmt.Errorf("failed to publish a message: %w", err)
+			case <-ctx.Done():
+				errs[i] = fmt.Errorf("failed to publish a message: %w", ctx.Err())
+			}
+		}
+	}
+	return errs
+}
+
+func newMsg(subject string, message types.Message) *nats.Msg {
+	msg := nats.NewMsg(subject)
+	msg.Data = message.Payload
+	msg.Header.Set(headerPriority, strconv.Itoa(int(message.Priority)))
+	if message.ID != "" {
+		msg.Header.Set(headerMessageId, message.ID)
+		// lets the server drop copies published again within its duplicate window, e.g. by the spool
+		msg.Header.Set(nats.MsgIdHdr, message.ID)
+	}
+	if !message.ExpiresAt.IsZero() {
+		msg.Header.Set(headerExpiresAt, message.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	return msg
+}
+
+// Read returns the next message of any channel. JetStream has no priorities, the priority
+// is carried in a header but messages are delivered in publishing order.
+func (b *JetStreamBroker) Read(ctx context.Context) (types.EventContext, error) {
+	if b.msgs == nil {
+		return types.EventContext{}, fmt.Errorf("no consumer set up")
+	}
+
+	select {
+	case msg := <-b.msgs:
+		meta, err := msg.Metadata()
+		if err != nil {
+			// without metadata the message cannot be retried correctly, let the server redeliver it
+			msg.Nak()
+			return types.EventContext{}, fmt.Errorf("error reading message metadata: %v", err)
+		}
+
+		priority, err := strconv.Atoi(msg.Headers().Get(headerPriority))
+		if err != nil {
+			priority = int(types.PriorityNormal)
+		}
+
+		b.mu.Lock()
+		b.nextId++
+		eventId := strconv.FormatUint(b.nextId, 10)
+		b.inflight[eventId] = msg
+		b.mu.Unlock()
+
+		event := types.EventContext{
+			EventId:    eventId,
+			MessageId:  msg.Headers().Get(headerMessageId),
+			Queue:      msg.Subject(),
+			Payload:    msg.Data(),
+			RetryCount: int(meta.NumDelivered) - 1,
+			Priority:   types.Priority(priority),
+			FirstSeen:  meta.Timestamp,
+		}
+		if expiresAt := headerTime(msg.Headers(), headerExpiresAt); expiresAt != nil {
+			event.ExpiresAt = *expiresAt
+		}
+		return event, nil
+	case <-b.done:
+		return types.EventContext{}, fmt.Errorf("consumer channel closed")
+	case <-ctx.Done():
+		return types.EventContext{}, ctx.Err()
+	}
+}
+
+func (b *JetStreamBroker) Ack(event types.EventContext) error {
+	msg, err := b.takeInflight(event)
+	if err != nil {
+		return err
+	}
+	return msg.Ack()
+}
+
+// Nack lets the server redeliver the event after the backoff of its channel. Events failing with a
+// permanent error or exhausting the retry policy are published to the DLQ with the failure details.
+func (b *JetStreamBroker) Nack(event types.EventContext, cause error) (types.Outcome, error) {
+	msg, err := b.takeInflight(event)
+	if err != nil {
+		return "", err
+	}
+
+	consumer, ok := b.consumers[event.Queue]
+	if !ok {
+		return types.OutcomeRetrying, msg.Nak()
+	}
+
+	now := time.Now()
+	if types.ClassOf(cause).Permanent() || consumer.policy.Exhausted(event.RetryCount, event.FirstSeen, now) {
+		dead := nats.NewMsg(fmt.Sprintf(deadLetterSubjectFormat, consumer.channel))
+		dead.Data = event.Payload
+		dead.Header = b.failureHeaders(event, consumer.channel, cause, now)
+
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		defer cancel()
+		if _, err := b.js.PublishMsg(ctx, dead); err != nil {
+			// the message is redelivered right away and dead-lettered on the next attempt
+			return types.OutcomeRetrying, msg.Nak()
+		}
+		return types.DeadLetterOutcome(cause), msg.Ack()
+	}
+
+	return types.OutcomeRetrying, msg.NakWithDelay(types.RetryDelay(consumer.policy.Backoff(event.RetryCount+1), event.ExpiresAt, now))
+}
+
+func (b *JetStreamBroker) takeInflight(event types.EventContext) (js.Msg, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	msg, ok := b.inflight[event.EventId]
+	if !ok {
+		return nil, fmt.Errorf("unknown event id: %s", event.EventId)
+	}
+	delete(b.inflight, event.EventId)
+	return msg, nil
+}
+
+// maxDeliveriesAdvisory is the part of io.nats.jetstream.advisory.v1.max_deliver the broker needs
+type maxDeliveriesAdvisory struct {
+	Stream     string `json:"stream"`
+	Consumer   string `json:"consumer"`
+	StreamSeq  uint64 `json:"stream_seq"`
+	Deliveries int    `json:"deliveries"`
+}
+
+// handleMaxDeliveries moves a message which was never acknowledged within its max deliveries,
+// e.g. because the consumers crashed while handling it, from the work-queue to the DLQ
+func (b *JetStreamBroker) handleMaxDeliveries(m *nats.Msg) {
+	var advisory maxDeliveriesAdvisory
+	if err := json.Unmarshal(m.Data, &advisory); err != nil {
+		logrus.Errorf("invalid max deliveries advisory: %v", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+	defer cancel()
+
+	raw, err := b.stream.GetMsg(ctx, advisory.StreamSeq)
+	if err != nil {
+		// already removed, e.g. acknowledged by a late consumer
+		logrus.Warnf("message %d of max deliveries advisory not found: %v", advisory.StreamSeq, err)
+		return
+	}
+
+	consumer, ok := b.consumers[raw.Subject]
+	if !ok {
+		return
+	}
+
+	event := types.EventContext{
+		MessageId:  raw.Header.Get(headerMessageId),
+		RetryCount: advisory.Deliveries - 1,
+		FirstSeen:  raw.Time,
+	}
+	if expiresAt := headerTime(raw.Header, headerExpiresAt); expiresAt != nil {
+		event.ExpiresAt = *expiresAt
+	}
+	dead := nats.NewMsg(fmt.Sprintf(deadLetterSubjectFormat, consumer.channel))
+	dead.Data = raw.Data
+	dead.Header = b.failureHeaders(event, consumer.channel, fmt.Errorf("maximum deliveries exceeded without acknowledgement"), time.Now())
+	if priority := raw.Header.Get(headerPriority); priority != "" {
+		dead.Header.Set(headerPriority, priority)
+	}
+
+	if _, err := b.js.PublishMsg(ctx, dead); err != nil {
+		logrus.Errorf("failed to dead-letter message %d: %v", advisory.StreamSeq, err)
+		return
+	}
+	if err := b.stream.DeleteMsg(ctx, advisory.StreamSeq); err != nil {
+		logrus.Errorf("failed to remove dead-lettered message %d: %v", advisory.StreamSeq, err)
+	}
+}
+
+// failureHeaders describe why and when the event failed so dead-lettered messages can be triaged
+func (b *JetStreamBroker) failureHeaders(event types.EventContext, channel string, cause error, now time.Time) nats.Header {
+	lastError := "unknown error"
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	headers := nats.Header{}
+	headers.Set(headerLastError, lastError)
+	headers.Set(headerErrorClass, string(types.ClassOf(cause)))
+	headers.Set(headerChannel, channel)
+	headers.Set(headerAttempts, strconv.Itoa(event.RetryCount+1))
+	headers.Set(headerLastAttempt, now.UTC().Format(time.RFC3339Nano))
+	headers.Set(headerConsumerHost, b.hostname)
+	headers.Set(headerPriority, strconv.Itoa(int(event.Priority)))
+	if !event.FirstSeen.IsZero() {
+		headers.Set(headerFirstSeen, event.FirstSeen.UTC().Format(time.RFC3339Nano))
+	}
+	if event.MessageId != "" {
+		headers.Set(headerOriginalMessageId, event.MessageId)
+	}
+	if !event.ExpiresAt.IsZero() {
+		headers.Set(headerExpiresAt, event.ExpiresAt.UTC().Format(time.RFC3339Nano))
+	}
+	return headers
+}
@@ -0,0 +1,199 @@
+package jetstream_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/jetstream"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/nats-io/nats-server/v2/server"
+	natstest "github.com/nats-io/nats-server/v2/test"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("JetStreamBroker", func() {
+	var (
+		natsServer *server.Server
+		config     jetstream.Config
+		broker     *jetstream.JetStreamBroker
+		ctx        context.Context
+		cancel     context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		opts := natstest.DefaultTestOptions
+		opts.Port = -1
+		opts.JetStream = true
+		opts.StoreDir = GinkgoT().TempDir()
+		natsServer = natstest.RunServer(&opts)
+
+		config = jetstream.Config{
+			Url:      natsServer.ClientURL(),
+			Stream:   "NOTIFICATIONS",
+			Channels: []string{"email", "sms"},
+			Prefetch: 10,
+			Retry: retry.Policies{
+				Default: retry.Policy{
+					InitialDelay: 200 * time.Millisecond,
+					Multiplier:   2,
+					MaxDelay:     time.Second,
+					Jitter:       retry.JitterNone,
+					MaxAttempts:  2,
+				},
+			},
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		broker, err = jetstream.NewJetStreamBroker(config, true)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+		if broker != nil {
+			broker.Close()
+		}
+		natsServer.Shutdown()
+	})
+
+	send := func(message types.Message) {
+		Expect(broker.Send(ctx, message)).To(Succeed())
+	}
+
+	read := func() types.EventContext {
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		return event
+	}
+
+	deadLetters := func(channel string) func() []types.DeadLetter {
+		return func() []types.DeadLetter {
+			deadLetters, _, err := broker.ListDeadLetters(ctx, channel, 0, 10)
+			Expect(err).ToNot(HaveOccurred())
+			return deadLetters
+		}
+	}
+
+	It("delivers the notifications of a channel with their headers", func() {
+		expiresAt := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+		send(types.Message{ID: "m1", Channel: "sms", Priority: types.PriorityHigh, Payload: []byte(`{"content":"hi"}`), ExpiresAt: expiresAt})
+
+		event := read()
+		Expect(event.MessageId).To(Equal("m1"))
+		Expect(event.Queue).To(Equal("notification.sms"))
+		Expect(event.Priority).To(Equal(types.PriorityHigh))
+		Expect(event.RetryCount).To(Equal(0))
+		Expect(event.ExpiresAt).To(BeTemporally("==", expiresAt))
+		Expect(broker.Ack(event)).To(Succeed())
+		Expect(broker.Ack(event)).To(MatchError("unknown event id: " + event.EventId))
+	})
+
+	It("rejects unknown channels", func() {
+		err := broker.Send(ctx, types.Message{Channel: "push", Payload: []byte(`{}`)})
+		Expect(errors.Is(err, types.ErrUnsupportedChannel)).To(BeTrue())
+	})
+
+	It("redelivers a failed notification after the backoff of its policy", func() {
+		send(types.Message{ID: "m1", Channel: "email", Payload: []byte(`{"content":"hi"}`)})
+		nacked := time.Now()
+		Expect(broker.Nack(read(), errors.New("timeout"))).To(Equal(types.OutcomeRetrying))
+
+		event := read()
+		Expect(event.MessageId).To(Equal("m1"))
+		Expect(event.RetryCount).To(Equal(1))
+		Expect(time.Since(nacked)).To(BeNumerically(">=", config.Retry.Default.InitialDelay))
+		Expect(broker.Ack(event)).To(Succeed())
+	})
+
+	It("dead-letters a notification once its policy is exhausted", func() {
+		send(types.Message{ID: "m1", Channel: "email", Payload: []byte(`{"content":"hi"}`)})
+		// MaxAttempts deliveries, the last one is dead-lettered
+		for i := 1; i < config.Retry.Default.MaxAttempts; i++ {
+			Expect(broker.Nack(read(), errors.New("timeout"))).To(Equal(types.OutcomeRetrying))
+		}
+		Expect(broker.Nack(read(), errors.New("timeout"))).To(Equal(types.OutcomeDeadLettered))
+
+		Eventually(deadLetters("email")).Should(HaveLen(1))
+		deadLetter := deadLetters("email")()[0]
+		Expect(deadLetter.ID).To(Equal("m1"))
+		Expect(deadLetter.Attempts).To(Equal(config.Retry.Default.MaxAttempts))
+		Expect(deadLetter.LastError).To(Equal("timeout"))
+	})
+
+	Context("with a consumer which never acknowledges", func() {
+		BeforeEach(func() {
+			config.AckWait = 100 * time.Millisecond
+			config.Retry.Default.MaxAttempts = 2
+		})
+
+		It("moves the notification to the DLQ with the max deliveries advisory", func() {
+			send(types.Message{ID: "m1", Channel: "sms", Payload: []byte(`{"content":"hi"}`)})
+			Expect(read().RetryCount).To(Equal(0))
+			Expect(read().RetryCount).To(Equal(1))
+
+			Eventually(deadLetters("sms")).Should(HaveLen(1))
+			deadLetter := deadLetters("sms")()[0]
+			Expect(deadLetter.ID).To(Equal("m1"))
+			Expect(deadLetter.Attempts).To(Equal(2))
+			Expect(deadLetter.LastError).To(Equal("maximum deliveries exceeded without acknowledgement"))
+
+			// the message was removed from the work-queue, it is not delivered again
+			readCtx, readCancel := context.WithTimeout(ctx, 300*time.Millisecond)
+			defer readCancel()
+			_, err := broker.Read(readCtx)
+			Expect(err).To(MatchError(context.DeadlineExceeded))
+		})
+	})
+
+	Context("with dead letters", func() {
+		JustBeforeEach(func() {
+			for _, id := range []string{"m1", "m2", "m3"} {
+				send(types.Message{ID: id, Channel: "sms", Payload: []byte(`{"content":"hi"}`)})
+				Expect(broker.Nack(read(), types.NewDeliveryError(types.ErrorClassRejected, errors.New("invalid receiver")))).To(Equal(types.OutcomeFailed))
+			}
+			Eventually(deadLetters("sms")).Should(HaveLen(3))
+		})
+
+		It("lists a page of them with the total", func() {
+			page, total, err := broker.ListDeadLetters(ctx, "sms", 1, 1)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(3))
+			Expect(page).To(HaveLen(1))
+			Expect(page[0].ID).To(Equal("m2"))
+			Expect(page[0].ErrorClass).To(Equal(types.ErrorClassRejected))
+
+			_, total, err = broker.ListDeadLetters(ctx, "email", 0, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(0))
+		})
+
+		It("requeues the matching ones with a reset retry count", func() {
+			requeued, err := broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{IDs: []string{"m2"}})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requeued).To(Equal(1))
+
+			event := read()
+			Expect(event.MessageId).To(Equal("m2"))
+			Expect(event.RetryCount).To(Equal(0))
+			Expect(deadLetters("sms")()).To(HaveLen(2))
+		})
+
+		It("purges them", func() {
+			purged, err := broker.PurgeDeadLetters(ctx, "sms")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(purged).To(Equal(3))
+			Expect(deadLetters("sms")()).To(BeEmpty())
+		})
+
+		It("rejects unknown channels", func() {
+			_, err := broker.PurgeDeadLetters(ctx, "push")
+			Expect(errors.Is(err, types.ErrUnsupportedChannel)).To(BeTrue())
+		})
+	})
+})
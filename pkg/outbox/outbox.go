@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+const DefaultTable = "notification_outbox"
+
+// Dialect selects the placeholder style of the SQL statements
+type Dialect = sqldialect.Dialect
+
+const (
+	DialectPostgres = sqldialect.Postgres
+	DialectMySQL    = sqldialect.MySQL
+	DialectSQLite   = sqldialect.SQLite
+)
+
+// Config describes the outbox table. The table has to be created by the migrations of the producer service:
+//
+//	CREATE TABLE notification_outbox (
+//		id            BIGSERIAL PRIMARY KEY, -- any auto increment integer key
+//		message_id    TEXT NOT NULL,
+//		channel       TEXT NOT NULL,
+//		priority      INTEGER NOT NULL,
+//		payload       TEXT NOT NULL,
+//		created_at    BIGINT NOT NULL,
+//		attempts      INTEGER NOT NULL DEFAULT 0,
+//		last_error    TEXT,
+//		claimed_by    TEXT,
+//		claimed_until BIGINT,
+//		sent_at       BIGINT,
+//		failed_at     BIGINT,
+//		send_at       BIGINT,
+//		expires_at    BIGINT
+//	);
+//	CREATE INDEX notification_outbox_pending ON notification_outbox (id) WHERE sent_at IS NULL AND failed_at IS NULL;
+//
+// All the times are unix milliseconds, so the statements are the same on every database.
+type Config struct {
+	// Table defaults to DefaultTable
+	Table   string
+	Dialect Dialect
+}
+
+func (c Config) table() string {
+	if c.Table == "" {
+		return DefaultTable
+	}
+	return c.Table
+}
+
+// query replaces the ? placeholders of the statement with the ones of the dialect
+func (c Config) query(statement string) string {
+	return c.Dialect.Rebind(statement)
+}
+
+// Notification has the fields of the notification-api send request
+type Notification struct {
+	Channel  string `json:"channel"`
+	Content  string `json:"content"`
+	Receiver string `json:"receiver"`
+	// Priority is one of low, normal or high
+	Priority string `json:"priority,omitempty"`
+	// Tenant and Tags are recorded with the status of the notification by the Recorder of the relay
+	Tenant string   `json:"tenant,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	// CallbackURL receives a signed POST once the notification is delivered or failed for good
+	CallbackURL string `json:"callback_url,omitempty"`
+	// SendAt holds the row back, it is relayed once the time is reached
+	SendAt *time.Time `json:"send_at,omitempty"`
+	// ExpiresAt or TTL drop the notification instead of sending it late. TTL is a duration like "10m"
+	// counted from the send_at, or from the enqueue without one.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	TTL       string     `json:"ttl,omitempty"`
+}
+
+// Writer adds notifications to the outbox table
+type Writer struct {
+	config Config
+}
+
+func NewWriter(config Config) *Writer {
+	return &Writer{config: config}
+}
+
+// Enqueue inserts the notification within the transaction of the caller, so it is relayed
+// to the broker if and only if the transaction commits. It returns the id of the outbox row.
+func (w *Writer) Enqueue(ctx context.Context, tx *sql.Tx, notification Notification) (int64, error) {
+	if notification.Channel == "" || notification.Content == "" || notification.Receiver == "" {
+		return 0, fmt.Errorf("channel, content and receiver are required")
+	}
+	priority, err := types.ParsePriority(notification.Priority)
+	if err != nil {
+		return 0, fmt.Errorf("error parsing priority: %v", err)
+	}
+	now := time.Now()
+	expiresAt, err := expiryOf(notification, now)
+	if err != nil {
+		return 0, err
+	}
+	var sendAt time.Time
+	if notification.SendAt != nil {
+		sendAt = *notification.SendAt
+	}
+
+	payload, err := json.Marshal(notification)
+	if err != nil {
+		return 0, fmt.Errorf("error marshaling notification: %v", err)
+	}
+
+	// the message id is fixed at insert, so a row published twice is recognized by the consumers
+	statement := fmt.Sprintf("INSERT INTO %s (message_id, channel, priority, payload, created_at, send_at, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?)", w.config.table())
+	args := []interface{}{types.NewMessageID(), notification.Channel, int(priority), string(payload), now.UnixMilli(), nullMillis(sendAt), nullMillis(expiresAt)}
+
+	// LastInsertId is not supported by the postgres drivers
+	if w.config.Dialect == DialectPostgres {
+		var id int64
+		err := tx.QueryRowContext(ctx, w.config.query(statement+" RETURNING id"), args...).Scan(&id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to insert into outbox: %v", err)
+		}
+		return id, nil
+	}
+
+	result, err := tx.ExecContext(ctx, w.config.query(statement), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert into outbox: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get outbox id: %v", err)
+	}
+	return id, nil
+}
+
+// expiryOf resolves the expires_at or ttl of the notification like the api does, zero if it never
+// expires. A notification expiring before it is sent is rejected.
+func expiryOf(notification Notification, now time.Time) (time.Time, error) {
+	sendAt := now
+	if notification.SendAt != nil && notification.SendAt.After(now) {
+		sendAt = *notification.SendAt
+	}
+
+	switch {
+	case notification.ExpiresAt != nil && notification.TTL != "":
+		return time.Time{}, fmt.Errorf("only one of expires_at and ttl can be set")
+	case notification.ExpiresAt != nil:
+		if !notification.ExpiresAt.After(sendAt) {
+			return time.Time{}, fmt.Errorf("expires_at is before the notification is sent")
+		}
+		return *notification.ExpiresAt, nil
+	case notification.TTL != "":
+		ttl, err := time.ParseDuration(notification.TTL)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("error parsing ttl: %v", err)
+		}
+		if ttl <= 0 {
+			return time.Time{}, fmt.Errorf("ttl has to be positive")
+		}
+		return sendAt.Add(ttl), nil
+	default:
+		return time.Time{}, nil
+	}
+}
+
+// nullMillis stores the zero time as NULL
+func nullMillis(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
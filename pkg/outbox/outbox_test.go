@@ -0,0 +1,336 @@
+package outbox_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/outbox"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+const schema = `CREATE TABLE notification_outbox (
+	id            INTEGER PRIMARY KEY AUTOINCREMENT,
+	message_id    TEXT NOT NULL,
+	channel       TEXT NOT NULL,
+	priority      INTEGER NOT NULL,
+	payload       TEXT NOT NULL,
+	created_at    BIGINT NOT NULL,
+	attempts      INTEGER NOT NULL DEFAULT 0,
+	last_error    TEXT,
+	claimed_by    TEXT,
+	claimed_until BIGINT,
+	sent_at       BIGINT,
+	failed_at     BIGINT,
+	send_at       BIGINT,
+	expires_at    BIGINT
+)`
+
+// fakeBroker records the published messages and fails while it is down
+type fakeBroker struct {
+	mu        sync.Mutex
+	down      bool
+	published []types.Message
+	// latency of every publish
+	latency time.Duration
+}
+
+func (b *fakeBroker) Send(ctx context.Context, message types.Message) error {
+	time.Sleep(b.latency)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if message.Channel == "fax" {
+		return fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, message.Channel)
+	}
+	if b.down {
+		return errors.New("connection refused")
+	}
+	b.published = append(b.published, message)
+	return nil
+}
+
+func (b *fakeBroker) messages() []types.Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]types.Message(nil), b.published...)
+}
+
+// fakeRecorder records the steps reported by the relay
+type fakeRecorder struct {
+	accepted []status.Notification
+	steps    []string
+}
+
+func (r *fakeRecorder) Accepted(ctx context.Context, notification status.Notification) {
+	r.accepted = append(r.accepted, notification)
+	r.steps = append(r.steps, "accepted "+notification.ID)
+}
+
+func (r *fakeRecorder) Queued(ctx context.Context, id string) {
+	r.steps = append(r.steps, "queued "+id)
+}
+
+func (r *fakeRecorder) Rejected(ctx context.Context, id string, cause error) {
+	r.steps = append(r.steps, "rejected "+id)
+}
+
+var _ = Describe("Outbox", func() {
+	var (
+		dsn    string
+		db     *sql.DB
+		writer *outbox.Writer
+		broker *fakeBroker
+		relay  *outbox.Relay
+		ctx    context.Context
+	)
+
+	openDB := func() *sql.DB {
+		conn, err := sql.Open("sqlite3", dsn)
+		Expect(err).NotTo(HaveOccurred())
+		return conn
+	}
+
+	enqueue := func(notification outbox.Notification, commit bool) {
+		tx, err := db.BeginTx(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		_, err = writer.Enqueue(ctx, tx, notification)
+		Expect(err).NotTo(HaveOccurred())
+		if commit {
+			Expect(tx.Commit()).To(Succeed())
+		} else {
+			Expect(tx.Rollback()).To(Succeed())
+		}
+	}
+
+	pending := func() int {
+		var n int
+		Expect(db.QueryRow("SELECT COUNT(*) FROM notification_outbox WHERE sent_at IS NULL AND failed_at IS NULL").Scan(&n)).To(Succeed())
+		return n
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		dsn = "file:" + filepath.Join(GinkgoT().TempDir(), "outbox.db") + "?_busy_timeout=5000&_journal_mode=WAL"
+		db = openDB()
+		_, err := db.Exec(schema)
+		Expect(err).NotTo(HaveOccurred())
+
+		writer = outbox.NewWriter(outbox.Config{Dialect: outbox.DialectSQLite})
+		broker = &fakeBroker{}
+		relay = outbox.NewRelay(db, broker, outbox.RelayConfig{
+			Config:       outbox.Config{Dialect: outbox.DialectSQLite},
+			ID:           "relay-1",
+			BatchSize:    10,
+			PollInterval: 10 * time.Millisecond,
+		})
+	})
+
+	AfterEach(func() {
+		db.Close()
+	})
+
+	It("relays committed notifications in order and marks them sent", func() {
+		enqueue(outbox.Notification{Channel: "email", Content: "first", Receiver: "a@example.com"}, true)
+		enqueue(outbox.Notification{Channel: "sms", Content: "dropped", Receiver: "+359"}, false)
+		enqueue(outbox.Notification{Channel: "sms", Content: "second", Receiver: "+359", Priority: "high"}, true)
+
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(2))
+
+		messages := broker.messages()
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].ID).NotTo(BeEmpty())
+		Expect(messages[1].ID).NotTo(Equal(messages[0].ID))
+		for i := range messages {
+			messages[i].ID = ""
+		}
+		Expect(messages).To(Equal([]types.Message{
+			{Channel: "email", Priority: types.PriorityNormal, Payload: []byte(`{"channel":"email","content":"first","receiver":"a@example.com"}`)},
+			{Channel: "sms", Priority: types.PriorityHigh, Payload: []byte(`{"channel":"sms","content":"second","receiver":"+359","priority":"high"}`)},
+		}))
+		Expect(pending()).To(Equal(0))
+
+		relayed, err = relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(0))
+	})
+
+	It("rejects invalid notifications", func() {
+		tx, err := db.BeginTx(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+
+		_, err = writer.Enqueue(ctx, tx, outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", Priority: "asap"})
+		Expect(err).To(MatchError("error parsing priority: unknown priority: asap"))
+		_, err = writer.Enqueue(ctx, tx, outbox.Notification{Channel: "email"})
+		Expect(err).To(HaveOccurred())
+	})
+
+	It("keeps the rows while the broker is down", func() {
+		enqueue(outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com"}, true)
+		broker.down = true
+
+		_, err := relay.RelayBatch(ctx)
+		Expect(err).To(MatchError(ContainSubstring("connection refused")))
+		Expect(pending()).To(Equal(1))
+
+		var attempts int
+		var lastError string
+		Expect(db.QueryRow("SELECT attempts, last_error FROM notification_outbox").Scan(&attempts, &lastError)).To(Succeed())
+		Expect(attempts).To(Equal(1))
+		Expect(lastError).To(Equal("connection refused"))
+
+		broker.down = false
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+	})
+
+	It("marks rows of unsupported channels failed", func() {
+		enqueue(outbox.Notification{Channel: "fax", Content: "hi", Receiver: "123"}, true)
+		enqueue(outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com"}, true)
+
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+		Expect(pending()).To(Equal(0))
+	})
+
+	It("does not relay rows claimed by another relay until their claim expires", func() {
+		enqueue(outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com"}, true)
+		_, err := db.Exec("UPDATE notification_outbox SET claimed_by = 'relay-2', claimed_until = ?", time.Now().Add(time.Minute).UnixMilli())
+		Expect(err).NotTo(HaveOccurred())
+
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(0))
+
+		_, err = db.Exec("UPDATE notification_outbox SET claimed_until = ?", time.Now().Add(-time.Second).UnixMilli())
+		Expect(err).NotTo(HaveOccurred())
+
+		relayed, err = relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+	})
+
+	It("publishes every row once with concurrent relays", func() {
+		for i := 0; i < 100; i++ {
+			enqueue(outbox.Notification{Channel: "email", Content: fmt.Sprint(i), Receiver: "a@example.com"}, true)
+		}
+		// keeps the rows of a batch claimed while the other relays poll
+		broker.latency = time.Millisecond
+
+		runCtx, cancel := context.WithCancel(ctx)
+		var wg sync.WaitGroup
+		for i := 0; i < 3; i++ {
+			// every relay has its own connections like relays of different processes
+			relayDB := openDB()
+			defer relayDB.Close()
+
+			r := outbox.NewRelay(relayDB, broker, outbox.RelayConfig{
+				Config:       outbox.Config{Dialect: outbox.DialectSQLite},
+				ID:           fmt.Sprintf("relay-%d", i),
+				BatchSize:    7,
+				PollInterval: 10 * time.Millisecond,
+			})
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				r.Run(runCtx)
+			}()
+		}
+
+		Eventually(pending, 10*time.Second).Should(Equal(0))
+		cancel()
+		wg.Wait()
+
+		contents := map[string]int{}
+		for _, msg := range broker.messages() {
+			contents[string(msg.Payload)]++
+		}
+		Expect(contents).To(HaveLen(100))
+		for payload, n := range contents {
+			Expect(n).To(Equal(1), payload)
+		}
+	})
+
+	It("relays scheduled rows once their send_at is reached with their expiry", func() {
+		sendAt := time.Now().Add(time.Hour)
+		expiresAt := time.Now().Add(2 * time.Hour).Truncate(time.Millisecond)
+		enqueue(outbox.Notification{Channel: "sms", Content: "later", Receiver: "+359", SendAt: &sendAt, TTL: "10m"}, true)
+		enqueue(outbox.Notification{Channel: "email", Content: "now", Receiver: "a@example.com", ExpiresAt: &expiresAt, CallbackURL: "https://example.com/hook"}, true)
+
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+		messages := broker.messages()
+		Expect(messages[0].ExpiresAt).To(BeTemporally("==", expiresAt))
+		Expect(messages[0].Payload).To(ContainSubstring(`"callback_url":"https://example.com/hook"`))
+
+		_, err = db.Exec("UPDATE notification_outbox SET send_at = ? WHERE channel = 'sms'", time.Now().UnixMilli())
+		Expect(err).NotTo(HaveOccurred())
+		relayed, err = relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+		messages = broker.messages()
+		Expect(messages[1].ExpiresAt).To(BeTemporally("~", sendAt.Add(10*time.Minute), time.Millisecond))
+	})
+
+	It("rejects notifications expiring before they are sent", func() {
+		tx, err := db.BeginTx(ctx, nil)
+		Expect(err).NotTo(HaveOccurred())
+		defer tx.Rollback()
+
+		sendAt := time.Now().Add(time.Hour)
+		expiresAt := time.Now().Add(time.Minute)
+		_, err = writer.Enqueue(ctx, tx, outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", SendAt: &sendAt, ExpiresAt: &expiresAt})
+		Expect(err).To(MatchError("expires_at is before the notification is sent"))
+		_, err = writer.Enqueue(ctx, tx, outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", ExpiresAt: &sendAt, TTL: "1m"})
+		Expect(err).To(MatchError("only one of expires_at and ttl can be set"))
+		_, err = writer.Enqueue(ctx, tx, outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", TTL: "-1m"})
+		Expect(err).To(MatchError("ttl has to be positive"))
+	})
+
+	It("records the status of the relayed notifications with their tenant and tags", func() {
+		recorder := &fakeRecorder{}
+		relay = outbox.NewRelay(db, broker, outbox.RelayConfig{
+			Config:   outbox.Config{Dialect: outbox.DialectSQLite},
+			Recorder: recorder,
+		})
+		enqueue(outbox.Notification{Channel: "email", Content: "hi", Receiver: "a@example.com", Tenant: "acme", Tags: []string{"welcome"}}, true)
+		enqueue(outbox.Notification{Channel: "fax", Content: "hi", Receiver: "123"}, true)
+		broker.down = true
+		_, err := relay.RelayBatch(ctx)
+		Expect(err).To(HaveOccurred())
+
+		broker.down = false
+		relayed, err := relay.RelayBatch(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(relayed).To(Equal(1))
+
+		messages := broker.messages()
+		Expect(recorder.accepted).To(HaveLen(2))
+		Expect(recorder.accepted[0]).To(Equal(status.Notification{
+			ID:       messages[0].ID,
+			Channel:  "email",
+			Receiver: "a@example.com",
+			Priority: "normal",
+			Tenant:   "acme",
+			Tags:     []string{"welcome"},
+		}))
+		fax := recorder.accepted[1].ID
+		// the failed publish accepted the row once
+		Expect(recorder.steps).To(Equal([]string{"accepted " + messages[0].ID, "queued " + messages[0].ID, "accepted " + fax, "rejected " + fax}))
+	})
+})
@@ -0,0 +1,247 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// MessageBroker publishes the relayed notifications, Send has to return only once the broker
+// confirmed the message, e.g. the rabbitmq backend with Confirm set
+type MessageBroker interface {
+	Send(ctx context.Context, message types.Message) error
+}
+
+// Recorder records the status of the relayed notifications, e.g. a status.Recorder on the store of the api
+type Recorder interface {
+	Accepted(ctx context.Context, notification status.Notification)
+	Queued(ctx context.Context, id string)
+	Rejected(ctx context.Context, id string, cause error)
+}
+
+type RelayConfig struct {
+	Config
+	// ID identifies the relay in the rows it claimed, defaults to the hostname and pid
+	ID string
+	// BatchSize is the number of rows claimed at once
+	BatchSize int
+	// PollInterval is the time between polls of an empty outbox and after a failed publish
+	PollInterval time.Duration
+	// ClaimTimeout is how long claimed rows are reserved, rows of a relay which crashed
+	// are taken over by the others afterwards
+	ClaimTimeout time.Duration
+	// Recorder records the notifications as accepted and queued like the api does on /send, with their
+	// tenant and tags, nil leaves them untracked
+	Recorder Recorder
+}
+
+type row struct {
+	id        int64
+	messageId string
+	channel   string
+	priority  int
+	payload   string
+	attempts  int
+	expiresAt sql.NullInt64
+}
+
+// Relay publishes the rows of the outbox table to the broker. Any number of relays can run against the
+// same table, every row is claimed by a single relay with a conditional update before it is published.
+// Rows are published in insert order by a relay once their send_at is reached, a row is only published again when its relay crashed
+// or exceeded the claim timeout before marking it sent, the copy has the same message id.
+type Relay struct {
+	db     *sql.DB
+	broker MessageBroker
+	config RelayConfig
+}
+
+func NewRelay(db *sql.DB, broker MessageBroker, config RelayConfig) *Relay {
+	if config.ID == "" {
+		hostname, _ := os.Hostname()
+		config.ID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.ClaimTimeout <= 0 {
+		config.ClaimTimeout = time.Minute
+	}
+
+	return &Relay{
+		db:     db,
+		broker: broker,
+		config: config,
+	}
+}
+
+// Run relays the outbox until the context is done
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		relayed, err := r.RelayBatch(ctx)
+		if err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to relay outbox: %v", err)
+		}
+		// a full batch means more rows are likely waiting
+		if err == nil && relayed == r.config.BatchSize {
+			continue
+		}
+
+		select {
+		case <-time.After(r.config.PollInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RelayBatch claims up to BatchSize pending rows, publishes them and marks them sent. It returns the
+// number of published rows and stops at the first failed publish, the remaining rows are released.
+func (r *Relay) RelayBatch(ctx context.Context) (int, error) {
+	rows, err := r.claim(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	relayed := 0
+	for i, row := range rows {
+		message := types.Message{
+			ID:       row.messageId,
+			Channel:  row.channel,
+			Priority: types.Priority(row.priority),
+			Payload:  []byte(row.payload),
+		}
+		if row.expiresAt.Valid {
+			message.ExpiresAt = time.UnixMilli(row.expiresAt.Int64)
+		}
+		// a row published before is accepted already
+		if r.config.Recorder != nil && row.attempts == 0 {
+			r.accepted(ctx, row)
+		}
+
+		err := r.broker.Send(ctx, message)
+		if errors.Is(err, types.ErrUnsupportedChannel) {
+			// retrying cannot fix it, the row is kept for inspection
+			logrus.Errorf("outbox row %d failed: %v", row.id, err)
+			if r.config.Recorder != nil {
+				r.config.Recorder.Rejected(ctx, row.messageId, err)
+			}
+			if updateErr := r.exec(ctx, "UPDATE %s SET failed_at = ?, last_error = ?, attempts = attempts + 1, claimed_by = NULL, claimed_until = NULL WHERE id = ? AND claimed_by = ?",
+				time.Now().UnixMilli(), err.Error(), row.id, r.config.ID); updateErr != nil {
+				return relayed, updateErr
+			}
+			continue
+		}
+		if err != nil {
+			r.release(rows[i+1:])
+			if updateErr := r.exec(ctx, "UPDATE %s SET last_error = ?, attempts = attempts + 1, claimed_by = NULL, claimed_until = NULL WHERE id = ? AND claimed_by = ?",
+				err.Error(), row.id, r.config.ID); updateErr != nil {
+				logrus.Errorf("failed to release outbox row %d: %v", row.id, updateErr)
+			}
+			return relayed, fmt.Errorf("failed to publish outbox row %d: %v", row.id, err)
+		}
+
+		if err := r.exec(ctx, "UPDATE %s SET sent_at = ?, attempts = attempts + 1, claimed_by = NULL, claimed_until = NULL WHERE id = ? AND claimed_by = ?",
+			time.Now().UnixMilli(), row.id, r.config.ID); err != nil {
+			r.release(rows[i+1:])
+			return relayed, err
+		}
+		if r.config.Recorder != nil {
+			r.config.Recorder.Queued(ctx, row.messageId)
+		}
+		relayed++
+	}
+	return relayed, nil
+}
+
+// claim reserves pending rows for the relay. The rows are selected first and every one is claimed with
+// an update conditioned on it still being unclaimed, so concurrent relays never claim the same row.
+func (r *Relay) claim(ctx context.Context) ([]row, error) {
+	now := time.Now()
+
+	candidates, err := r.db.QueryContext(ctx, r.config.query(fmt.Sprintf(
+		"SELECT id, message_id, channel, priority, payload, attempts, expires_at FROM %s WHERE sent_at IS NULL AND failed_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?) AND (send_at IS NULL OR send_at <= ?) ORDER BY id LIMIT %d",
+		r.config.table(), r.config.BatchSize,
+	)), now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, fmt.Errorf("failed to select outbox rows: %v", err)
+	}
+
+	var pending []row
+	for candidates.Next() {
+		var rw row
+		if err := candidates.Scan(&rw.id, &rw.messageId, &rw.channel, &rw.priority, &rw.payload, &rw.attempts, &rw.expiresAt); err != nil {
+			candidates.Close()
+			return nil, fmt.Errorf("failed to read outbox row: %v", err)
+		}
+		pending = append(pending, rw)
+	}
+	candidates.Close()
+	if err := candidates.Err(); err != nil {
+		return nil, fmt.Errorf("failed to select outbox rows: %v", err)
+	}
+
+	var claimed []row
+	for _, rw := range pending {
+		result, err := r.db.ExecContext(ctx, r.config.query(fmt.Sprintf(
+			"UPDATE %s SET claimed_by = ?, claimed_until = ? WHERE id = ? AND sent_at IS NULL AND failed_at IS NULL AND (claimed_until IS NULL OR claimed_until < ?)",
+			r.config.table(),
+		)), r.config.ID, now.Add(r.config.ClaimTimeout).UnixMilli(), rw.id, now.UnixMilli())
+		if err != nil {
+			r.release(claimed)
+			return nil, fmt.Errorf("failed to claim outbox row %d: %v", rw.id, err)
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 1 {
+			claimed = append(claimed, rw)
+		}
+	}
+	return claimed, nil
+}
+
+// accepted records the notification of the row before it is published, so the service never records a state before it
+func (r *Relay) accepted(ctx context.Context, rw row) {
+	var notification Notification
+	if err := json.Unmarshal([]byte(rw.payload), &notification); err != nil {
+		logrus.Errorf("failed to read outbox row %d: %v", rw.id, err)
+		return
+	}
+	r.config.Recorder.Accepted(ctx, status.Notification{
+		ID:       rw.messageId,
+		Channel:  rw.channel,
+		Receiver: notification.Receiver,
+		Priority: types.Priority(rw.priority).String(),
+		Tenant:   notification.Tenant,
+		Tags:     notification.Tags,
+	})
+}
+
+// release gives up the claims of the rows so they are relayed again by the next poll of any relay
+func (r *Relay) release(rows []row) {
+	// the context of the batch may be done already
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	for _, rw := range rows {
+		if err := r.exec(ctx, "UPDATE %s SET claimed_by = NULL, claimed_until = NULL WHERE id = ? AND claimed_by = ?",
+			rw.id, r.config.ID); err != nil {
+			logrus.Errorf("failed to release outbox row %d: %v", rw.id, err)
+		}
+	}
+}
+
+func (r *Relay) exec(ctx context.Context, statement string, args ...interface{}) error {
+	if _, err := r.db.ExecContext(ctx, r.config.query(fmt.Sprintf(statement, r.config.table())), args...); err != nil {
+		return fmt.Errorf("failed to update outbox: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package rabbitmq
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/streadway/amqp"
+)
+
+// maxDeadLetterPeek is the number of messages a listing may hold, see ListDeadLetters
+const maxDeadLetterPeek = 1000
+
+// ListDeadLetters returns up to limit messages of the channel DLQ starting at offset together with the
+// total number of messages in the DLQ. AMQP cannot browse a queue, so the first offset+limit messages are
+// fetched without being acknowledged and returned to the DLQ once the listing closes its channel. The content
+// of the DLQ does not change, but the messages are marked redelivered and the ones in front of the page
+// are fetched as well, which is why offset+limit is capped at maxDeadLetterPeek. While they are held the
+// messages are invisible to other listings and requeues.
+func (r *RabbitMQBroker) ListDeadLetters(ctx context.Context, channel string, offset, limit int) ([]types.DeadLetter, int, error) {
+	dlqName, err := r.deadLetterQueueOf(channel)
+	if err != nil {
+		return nil, 0, err
+	}
+	if offset+limit > maxDeadLetterPeek {
+		return nil, 0, fmt.Errorf("%w: offset and limit add up to more than %d", types.ErrPeekLimit, maxDeadLetterPeek)
+	}
+
+	ch, err := r.connection().Channel()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	// closing the channel returns all the unacknowledged messages to the DLQ
+	defer ch.Close()
+
+	queue, err := ch.QueueInspect(dlqName)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to inspect %s: %v", dlqName, err)
+	}
+
+	var deadLetters []types.DeadLetter
+	for i := 0; i < offset+limit && i < queue.Messages && ctx.Err() == nil; i++ {
+		d, ok, err := ch.Get(dlqName, false)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to get message from %s: %v", dlqName, err)
+		}
+		if !ok {
+			break
+		}
+		if i >= offset {
+			deadLetters = append(deadLetters, toDeadLetter(d, channel))
+		}
+	}
+
+	return deadLetters, queue.Messages, ctx.Err()
+}
+
+// RequeueDeadLetters publishes the dead letters matching the filter back to the channel queue with a
+// reset retry count and removes them from the DLQ. It returns the number of requeued messages. Dead letters
+// held by a concurrent listing are left in the DLQ.
+func (r *RabbitMQBroker) RequeueDeadLetters(ctx context.Context, channel string, filter types.DeadLetterFilter) (int, error) {
+	dlqName, err := r.deadLetterQueueOf(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	ch, err := r.connection().Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	// a dead letter is only removed once the broker confirmed its requeued copy
+	if err := ch.Confirm(false); err != nil {
+		return 0, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	confirms := ch.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	queue, err := ch.QueueInspect(dlqName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to inspect %s: %v", dlqName, err)
+	}
+
+	requeued := 0
+	for i := 0; i < queue.Messages && ctx.Err() == nil; i++ {
+		d, ok, err := ch.Get(dlqName, false)
+		if err != nil {
+			return requeued, fmt.Errorf("failed to get message from %s: %v", dlqName, err)
+		}
+		if !ok {
+			break
+		}
+		if !filter.Matches(toDeadLetter(d, channel)) {
+			continue
+		}
+
+		msg := amqp.Publishing{
+			ContentType:  d.ContentType,
+			Body:         d.Body,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    d.MessageId,
+			Priority:     d.Priority,
+			// the retry policy starts over, including its max age
+			Timestamp: time.Now(),
+		}
+		// the expiry does not start over, an expired message is dropped by the consumer
+		if expiresAt, ok := d.Headers[HeaderExpiresAt]; ok {
+			msg.Headers = amqp.Table{HeaderExpiresAt: expiresAt}
+		}
+
+		err = ch.Publish("", r.queues[channel], false, false, msg)
+		if err != nil {
+			return requeued, fmt.Errorf("failed to requeue message: %v", err)
+		}
+		if confirm := <-confirms; !confirm.Ack {
+			return requeued, fmt.Errorf("broker rejected requeued message")
+		}
+
+		if err := ch.Ack(d.DeliveryTag, false); err != nil {
+			return requeued, fmt.Errorf("failed to remove requeued message from %s: %v", dlqName, err)
+		}
+		requeued++
+	}
+
+	return requeued, ctx.Err()
+}
+
+// PurgeDeadLetters deletes all the messages of the channel DLQ and returns their number
+func (r *RabbitMQBroker) PurgeDeadLetters(ctx context.Context, channel string) (int, error) {
+	dlqName, err := r.deadLetterQueueOf(channel)
+	if err != nil {
+		return 0, err
+	}
+
+	ch, err := r.connection().Channel()
+	if err != nil {
+		return 0, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	defer ch.Close()
+
+	purged, err := ch.QueuePurge(dlqName, false)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %v", dlqName, err)
+	}
+	return purged, nil
+}
+
+func (r *RabbitMQBroker) deadLetterQueueOf(channel string) (string, error) {
+	queueName, ok := r.queues[channel]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, channel)
+	}
+	return fmt.Sprintf(deadLetterQueue, queueName), nil
+}
+
+func toDeadLetter(d amqp.Delivery, channel string) types.DeadLetter {
+	payload := json.RawMessage(d.Body)
+	if !json.Valid(d.Body) {
+		payload, _ = json.Marshal(string(d.Body))
+	}
+
+	headers := make(map[string]interface{}, len(d.Headers))
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+
+	id := d.MessageId
+	if id == "" {
+		// messages without id are told apart by their content and the time they failed
+		sum := sha256.Sum256(append([]byte(fmt.Sprint(d.Headers[HeaderLastAttempt])), d.Body...))
+		id = hex.EncodeToString(sum[:8])
+	}
+
+	attempts, _ := strconv.Atoi(fmt.Sprint(d.Headers[HeaderAttempts]))
+
+	return types.DeadLetter{
+		ID:           id,
+		Channel:      channel,
+		Payload:      payload,
+		LastError:    headerString(d.Headers, HeaderLastError),
+		ErrorClass:   types.ErrorClass(headerString(d.Headers, HeaderErrorClass)),
+		Attempts:     attempts,
+		FirstSeen:    headerTime(d.Headers, HeaderFirstSeen),
+		LastAttempt:  headerTime(d.Headers, HeaderLastAttempt),
+		ConsumerHost: headerString(d.Headers, HeaderConsumerHost),
+		Headers:      headers,
+	}
+}
+
+func headerString(headers amqp.Table, key string) string {
+	if v, ok := headers[key].(string); ok {
+		return v
+	}
+	return ""
+}
+
+func headerTime(headers amqp.Table, key string) *time.Time {
+	t, err := time.Parse(time.RFC3339Nano, headerString(headers, key))
+	if err != nil {
+		return nil
+	}
+	return &t
+}
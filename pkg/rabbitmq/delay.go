@@ -0,0 +1,258 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduler"
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+// backends publishing a message to a queue after an arbitrary delay
+const (
+	// DelayBackendQueues uses one retry queue per attempt with per message expiration
+	DelayBackendQueues = "queues"
+	// DelayBackendPlugin uses the rabbitmq-delayed-message-exchange plugin
+	DelayBackendPlugin = "plugin"
+	// DelayBackendWheel keeps the delayed messages in a durable in-process timing wheel
+	DelayBackendWheel = "wheel"
+	// DelayBackendAuto uses the plugin when the broker supports it and the wheel otherwise
+	DelayBackendAuto = "auto"
+)
+
+const (
+	delayedExchangeFormat = "%s.delayed"
+
+	wheelTick  = 100 * time.Millisecond
+	wheelSlots = 600
+)
+
+type delayer interface {
+	// declare sets up the topology the delayer needs for the queue
+	declare(channel *amqp.Channel, queueName string, policy retry.Policy) error
+	// delay publishes the message to the queue once the delay elapsed, channel is the current channel of the broker
+	delay(channel *amqp.Channel, queueName string, attempt int, msg amqp.Publishing, delay time.Duration) error
+	close()
+}
+
+// newDelayer creates the delayer of the configured backend, resolving auto by probing for the plugin.
+// mainChannel returns the current channel of the broker for the delayers publishing in the background.
+func newDelayer(conn *amqp.Connection, config Config, mainChannel func() (*amqp.Channel, error)) (delayer, error) {
+	backend := config.DelayBackend
+	if backend == DelayBackendAuto {
+		backend = DelayBackendWheel
+		if probeDelayedExchange(config.Uri, config.Exchange) == nil {
+			backend = DelayBackendPlugin
+		}
+		logrus.Infof("using %s delay backend", backend)
+	}
+
+	switch backend {
+	case "", DelayBackendQueues:
+		return &retryQueues{}, nil
+	case DelayBackendPlugin:
+		if err := declareDelayedExchange(conn, config.Exchange); err != nil {
+			return nil, fmt.Errorf("delayed message exchange plugin not available: %v", err)
+		}
+		return &delayedExchange{
+			exchange: fmt.Sprintf(delayedExchangeFormat, config.Exchange),
+		}, nil
+	case DelayBackendWheel:
+		return newWheelDelayer(mainChannel, config.SchedulerDir)
+	default:
+		return nil, fmt.Errorf("unknown delay backend: %s", config.DelayBackend)
+	}
+}
+
+// retryQueues publishes to the retry queue of the attempt, the message expires after the delay
+// and is dead-lettered back to its queue
+type retryQueues struct{}
+
+// one queue per attempt keeps messages with similar expiration together,
+// a message expires only when it reaches the head of its queue
+func (d *retryQueues) declare(channel *amqp.Channel, queueName string, policy retry.Policy) error {
+	dlxName := fmt.Sprintf(deadLetterExchange, queueName)
+
+	// the retries are the attempts after the first delivery
+	for attempt := 1; attempt < policy.MaxAttempts; attempt++ {
+		retryQueueName := fmt.Sprintf(retryQueueFormat, queueName, attempt)
+
+		_, err := channel.QueueDeclare(retryQueueName, true, false, false, false, amqp.Table{
+			"x-dead-letter-exchange":    dlxName,
+			"x-dead-letter-routing-key": queueName,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to declare retry queue %s: %v", retryQueueName, err)
+		}
+	}
+	return nil
+}
+
+func (d *retryQueues) delay(channel *amqp.Channel, queueName string, attempt int, msg amqp.Publishing, delay time.Duration) error {
+	msg.Expiration = strconv.FormatInt(delay.Milliseconds(), 10)
+	return channel.Publish("", fmt.Sprintf(retryQueueFormat, queueName, attempt), false, false, msg)
+}
+
+func (d *retryQueues) close() {}
+
+// delayedExchange publishes through an x-delayed-message exchange which holds the message for x-delay milliseconds
+type delayedExchange struct {
+	exchange string
+}
+
+// probeDelayedExchange declares the delayed exchange on its own connection,
+// as the broker closes the whole connection when the plugin is not enabled
+func probeDelayedExchange(uri, exchange string) error {
+	conn, err := amqp.Dial(uri)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return declareDelayedExchange(conn, exchange)
+}
+
+func declareDelayedExchange(conn *amqp.Connection, exchange string) error {
+	channel, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+
+	err = channel.ExchangeDeclare(fmt.Sprintf(delayedExchangeFormat, exchange), "x-delayed-message", true, false, false, false, amqp.Table{
+		"x-delayed-type": "direct",
+	})
+	if err != nil {
+		return err
+	}
+	return channel.Close()
+}
+
+func (d *delayedExchange) declare(channel *amqp.Channel, queueName string, _ retry.Policy) error {
+	if err := channel.QueueBind(queueName, queueName, d.exchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind queue %s to %s: %v", queueName, d.exchange, err)
+	}
+	return nil
+}
+
+func (d *delayedExchange) delay(channel *amqp.Channel, queueName string, _ int, msg amqp.Publishing, delay time.Duration) error {
+	headers := amqp.Table{}
+	for k, v := range msg.Headers {
+		headers[k] = v
+	}
+	headers["x-delay"] = delay.Milliseconds()
+	msg.Headers = headers
+
+	return channel.Publish(d.exchange, queueName, false, false, msg)
+}
+
+func (d *delayedExchange) close() {}
+
+// wheelMessage is the part of a publishing kept in the scheduler store
+type wheelMessage struct {
+	Queue        string                 `json:"queue"`
+	MessageId    string                 `json:"message_id,omitempty"`
+	ContentType  string                 `json:"content_type"`
+	Headers      map[string]interface{} `json:"headers"`
+	DeliveryMode uint8                  `json:"delivery_mode"`
+	Priority     uint8                  `json:"priority"`
+	Timestamp    time.Time              `json:"timestamp"`
+	Body         []byte                 `json:"body"`
+}
+
+// wheelDelayer keeps delayed messages in a timing wheel persisted in a local directory.
+// The messages are only released while the process is running, every consumer needs its own directory.
+type wheelDelayer struct {
+	// channel returns the current channel of the broker the released messages are published on
+	channel func() (*amqp.Channel, error)
+	wheel   *scheduler.Wheel
+	cancel  context.CancelFunc
+}
+
+func newWheelDelayer(channel func() (*amqp.Channel, error), dir string) (*wheelDelayer, error) {
+	store, err := scheduler.NewFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &wheelDelayer{channel: channel}
+	d.wheel, err = scheduler.NewWheel(store, wheelTick, wheelSlots, d.release)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load scheduled messages: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancel = cancel
+	go d.wheel.Run(ctx)
+
+	return d, nil
+}
+
+func (d *wheelDelayer) declare(*amqp.Channel, string, retry.Policy) error {
+	return nil
+}
+
+func (d *wheelDelayer) delay(_ *amqp.Channel, queueName string, _ int, msg amqp.Publishing, delay time.Duration) error {
+	payload, err := json.Marshal(wheelMessage{
+		Queue:        queueName,
+		MessageId:    msg.MessageId,
+		ContentType:  msg.ContentType,
+		Headers:      msg.Headers,
+		DeliveryMode: msg.DeliveryMode,
+		Priority:     msg.Priority,
+		Timestamp:    msg.Timestamp,
+		Body:         msg.Body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal delayed message: %v", err)
+	}
+
+	_, err = d.wheel.Schedule(scheduler.Entry{
+		Due:     time.Now().Add(delay),
+		Payload: payload,
+	})
+	return err
+}
+
+func (d *wheelDelayer) release(_ context.Context, entry scheduler.Entry) error {
+	var msg wheelMessage
+	if err := json.Unmarshal(entry.Payload, &msg); err != nil {
+		// a corrupt entry can never be released, drop it instead of retrying forever
+		logrus.Errorf("dropping unreadable delayed message %s: %v", entry.ID, err)
+		return nil
+	}
+
+	channel, err := d.channel()
+	if err != nil {
+		return err
+	}
+	return channel.Publish("", msg.Queue, false, false, amqp.Publishing{
+		MessageId:    msg.MessageId,
+		ContentType:  msg.ContentType,
+		Headers:      restoreHeaders(msg.Headers),
+		DeliveryMode: msg.DeliveryMode,
+		Priority:     msg.Priority,
+		Timestamp:    msg.Timestamp,
+		Body:         msg.Body,
+	})
+}
+
+func (d *wheelDelayer) close() {
+	d.cancel()
+}
+
+// restoreHeaders converts the numbers JSON decoded as floats back to the integers the consumer expects
+func restoreHeaders(headers map[string]interface{}) amqp.Table {
+	table := amqp.Table{}
+	for k, v := range headers {
+		if f, ok := v.(float64); ok && f == float64(int64(f)) {
+			v = int64(f)
+		}
+		table[k] = v
+	}
+	return table
+}
@@ -0,0 +1,142 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// dialTimeout bounds dialing and the handshake of a connection of the event publisher
+	dialTimeout = 5 * time.Second
+	// minRedialDelay and maxRedialDelay bound the backoff between dials while the connection is down
+	minRedialDelay = 100 * time.Millisecond
+	maxRedialDelay = 30 * time.Second
+)
+
+// EventPublisher publishes the lifecycle events of notifications to a topic exchange with the event
+// type as routing key, consumers bind their own queues, e.g. with notification.# for all events
+type EventPublisher struct {
+	uri      string
+	exchange string
+	// lock guards the connection and channel which are replaced when publishing reconnects, it is a
+	// channel so that waiting for it honors the context of the event
+	lock    chan struct{}
+	conn    *amqp.Connection
+	channel *amqp.Channel
+	// redialAt is the earliest time of the next dial after a failed one, events published before fail
+	// fast instead of dialing the unreachable server on every event
+	redialAt    time.Time
+	redialDelay time.Duration
+}
+
+// NewEventPublisher connects to RabbitMQ and declares the durable topic exchange of the events
+func NewEventPublisher(uri, exchange string) (*EventPublisher, error) {
+	p := &EventPublisher{uri: uri, exchange: exchange, lock: make(chan struct{}, 1)}
+	if err := p.connect(context.Background()); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *EventPublisher) connect(ctx context.Context) error {
+	conn, err := amqp.DialConfig(p.uri, amqp.Config{
+		Heartbeat: 10 * time.Second,
+		Locale:    "en_US",
+		Dial: func(network, addr string) (net.Conn, error) {
+			dialer := net.Dialer{Timeout: dialTimeout}
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			// the deadline of the handshake, it is cleared once the connection is open
+			deadline := time.Now().Add(dialTimeout)
+			if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+				deadline = d
+			}
+			if err := conn.SetDeadline(deadline); err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return conn, nil
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to connect to RabbitMQ: %v", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %v", err)
+	}
+	err = channel.ExchangeDeclare(p.exchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to declare exchange %s: %v", p.exchange, err)
+	}
+
+	p.conn = conn
+	p.channel = channel
+	return nil
+}
+
+// Publish publishes the JSON encoded event, a lost connection is dialed again by the next event. While
+// dialing fails the dials back off exponentially and the events in between fail without dialing.
+func (p *EventPublisher) Publish(ctx context.Context, eventType events.Type, id string, body []byte) error {
+	select {
+	case p.lock <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("failed to publish event: %w", ctx.Err())
+	}
+	defer func() { <-p.lock }()
+
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	if p.conn == nil || p.conn.IsClosed() {
+		if wait := time.Until(p.redialAt); wait > 0 {
+			return fmt.Errorf("failed to publish event: RabbitMQ unavailable, dialing again in %s", wait.Round(time.Millisecond))
+		}
+		if err := p.connect(ctx); err != nil {
+			p.redialDelay = min(max(2*p.redialDelay, minRedialDelay), maxRedialDelay)
+			p.redialAt = time.Now().Add(p.redialDelay)
+			return fmt.Errorf("failed to publish event: %w", err)
+		}
+		p.redialDelay = 0
+	}
+
+	err := p.channel.Publish(
+		p.exchange,
+		string(eventType),
+		false,
+		false,
+		amqp.Publishing{
+			ContentType:  events.ContentType,
+			DeliveryMode: amqp.Persistent,
+			MessageId:    id,
+			Type:         string(eventType),
+			Timestamp:    time.Now(),
+			Body:         body,
+		},
+	)
+	if err != nil {
+		// the channel is closed after an error, the next event dials again
+		p.conn.Close()
+		p.conn = nil
+		return fmt.Errorf("failed to publish event: %w", err)
+	}
+	return nil
+}
+
+func (p *EventPublisher) Close() {
+	p.lock <- struct{}{}
+	defer func() { <-p.lock }()
+
+	if p.conn != nil {
+		p.conn.Close()
+	}
+}
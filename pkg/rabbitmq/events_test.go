@@ -0,0 +1,95 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/amqptest"
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("EventPublisher", func() {
+	var (
+		server     *amqptest.Server
+		publisher  *rabbitmq.EventPublisher
+		conn       *amqp.Connection
+		deliveries <-chan amqp.Delivery
+		ctx        context.Context
+	)
+
+	BeforeEach(func() {
+		var err error
+		server, err = amqptest.NewServer(amqptest.Config{})
+		Expect(err).NotTo(HaveOccurred())
+		publisher, err = rabbitmq.NewEventPublisher(server.URI(), "notification-events")
+		Expect(err).NotTo(HaveOccurred())
+		ctx = context.Background()
+
+		conn, err = amqp.Dial(server.URI())
+		Expect(err).NotTo(HaveOccurred())
+		channel, err := conn.Channel()
+		Expect(err).NotTo(HaveOccurred())
+		_, err = channel.QueueDeclare("failures", true, false, false, false, nil)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(channel.QueueBind("failures", "notification.failed", "notification-events", false, nil)).To(Succeed())
+		Expect(channel.QueueBind("failures", "notification.dead_lettered", "notification-events", false, nil)).To(Succeed())
+		deliveries, err = channel.Consume("failures", "", true, false, false, false, nil)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		conn.Close()
+		publisher.Close()
+		server.Close()
+	})
+
+	It("declares a topic exchange", func() {
+		kind, ok := server.ExchangeType("notification-events")
+		Expect(ok).To(BeTrue())
+		Expect(kind).To(Equal("topic"))
+	})
+
+	It("routes the events by their type", func() {
+		Expect(publisher.Publish(ctx, events.TypeDelivered, "e1", []byte(`{}`))).To(Succeed())
+		Expect(publisher.Publish(ctx, events.TypeDeadLettered, "e2", []byte(`{"id":"e2"}`))).To(Succeed())
+
+		var d amqp.Delivery
+		Eventually(deliveries).Should(Receive(&d))
+		Expect(d.MessageId).To(Equal("e2"))
+		Expect(d.RoutingKey).To(Equal("notification.dead_lettered"))
+		Expect(d.ContentType).To(Equal(events.ContentType))
+		Expect(d.Body).To(MatchJSON(`{"id":"e2"}`))
+		Consistently(deliveries, 100*time.Millisecond).ShouldNot(Receive())
+	})
+
+	It("dials again after the connection was lost", func() {
+		server.CloseConnections()
+
+		Eventually(func() error {
+			return publisher.Publish(ctx, events.TypeFailed, "e3", []byte(`{}`))
+		}).Should(Succeed())
+	})
+
+	It("fails fast while the server is unreachable", func() {
+		server.Close()
+
+		Eventually(func() error {
+			return publisher.Publish(ctx, events.TypeFailed, "e4", []byte(`{}`))
+		}).Should(MatchError(ContainSubstring("failed to connect to RabbitMQ")))
+		err := publisher.Publish(ctx, events.TypeFailed, "e5", []byte(`{}`))
+		Expect(err).To(MatchError(ContainSubstring("dialing again in")))
+	})
+
+	It("does not publish when the context is done", func() {
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+
+		err := publisher.Publish(canceled, events.TypeFailed, "e6", []byte(`{}`))
+		Expect(err).To(MatchError(context.Canceled))
+		Consistently(deliveries, 100*time.Millisecond).ShouldNot(Receive())
+	})
+})
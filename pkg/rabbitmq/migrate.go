@@ -0,0 +1,307 @@
+package rabbitmq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/streadway/amqp"
+)
+
+const (
+	// migrationQueueFormat is the temporary queue taking the notifications of a channel queue while it is migrated
+	migrationQueueFormat = "%s.migration"
+
+	// legacyPollInterval is the time between moving the notifications the legacy delay queues return
+	// to the legacy queue
+	legacyPollInterval = 5 * time.Second
+)
+
+// migrateChannelQueue recreates a channel queue which an earlier version declared with other arguments,
+// e.g. without x-max-priority. RabbitMQ does not allow changing the arguments of a queue, so the queue
+// is replaced by a temporary one taking its messages and new notifications while it is declared again.
+// A notification published the moment the queue is bound again may be delivered twice, the copy is
+// dropped by the deduplication of the service. A migration which was interrupted is finished.
+func migrateChannelQueue(conn *amqp.Connection, exchange, queueName, routingKey string) error {
+	probe, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %v", err)
+	}
+	_, err = probe.QueueDeclare(queueName, true, false, false, false, channelQueueArgs(queueName))
+	var amqpErr *amqp.Error
+	if err != nil && (!errors.As(err, &amqpErr) || amqpErr.Code != amqp.PreconditionFailed) {
+		return fmt.Errorf("failed to declare queue %s: %v", queueName, err)
+	}
+	// a failed declare closes the channel
+	if err == nil {
+		probe.Close()
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open a channel: %v", err)
+	}
+	defer channel.Close()
+	if err := channel.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	dlxName := fmt.Sprintf(deadLetterExchange, queueName)
+	migrationQueue := fmt.Sprintf(migrationQueueFormat, queueName)
+	bindings := []struct{ key, exchange string }{{routingKey, exchange}, {queueName, dlxName}}
+
+	if amqpErr != nil {
+		logrus.Infof("migrating queue %s to its new arguments", queueName)
+
+		if _, err := channel.QueueDeclare(migrationQueue, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("failed to declare queue %s: %v", migrationQueue, err)
+		}
+		for _, b := range bindings {
+			if err := channel.QueueBind(migrationQueue, b.key, b.exchange, false, nil); err != nil {
+				return fmt.Errorf("failed to bind queue %s to %s: %v", migrationQueue, b.exchange, err)
+			}
+			if err := channel.QueueUnbind(queueName, b.key, b.exchange, nil); err != nil {
+				return fmt.Errorf("failed to unbind queue %s from %s: %v", queueName, b.exchange, err)
+			}
+		}
+		if _, err := moveMessages(channel, confirms, queueName, math.MaxInt, toQueue(migrationQueue)); err != nil {
+			return err
+		}
+		// consumers of earlier versions are canceled
+		if _, err := channel.QueueDelete(queueName, false, false, false); err != nil {
+			return fmt.Errorf("failed to delete queue %s: %v", queueName, err)
+		}
+		if err := declareChannelQueue(channel, exchange, queueName, routingKey); err != nil {
+			return err
+		}
+	} else if _, err := channel.QueueInspect(migrationQueue); err != nil {
+		// no migration to finish, the failed passive declare closed the channel
+		return nil
+	}
+
+	for _, b := range bindings {
+		if err := channel.QueueUnbind(migrationQueue, b.key, b.exchange, nil); err != nil {
+			return fmt.Errorf("failed to unbind queue %s from %s: %v", migrationQueue, b.exchange, err)
+		}
+	}
+	moved, err := moveMessages(channel, confirms, migrationQueue, math.MaxInt, toQueue(queueName))
+	if err != nil {
+		return err
+	}
+	if _, err := channel.QueueDelete(migrationQueue, false, false, false); err != nil {
+		return fmt.Errorf("failed to delete queue %s: %v", migrationQueue, err)
+	}
+	logrus.Infof("migrated queue %s with %d messages", queueName, moved)
+	return nil
+}
+
+// migrateLegacyQueue moves the notifications of the single queue of the first version, which has the
+// name of the queue prefix, to the queues of their channels and its dead letters to their DLQs. Its delay
+// queues keep returning their messages to it, so it is only deleted once they are drained. Notifications
+// of channels without a queue on this instance are left for the instances handling them. It reports
+// whether the migration is done.
+func migrateLegacyQueue(conn *amqp.Connection, exchange, queueName string, queues map[string]string) (bool, error) {
+	messages, ok, err := inspect(conn, queueName)
+	if err != nil || !ok {
+		return !ok, err
+	}
+	dlqName := fmt.Sprintf(deadLetterQueue, queueName)
+	deadLetters, hasDLQ, err := inspect(conn, dlqName)
+	if err != nil {
+		return false, err
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	defer channel.Close()
+	if err := channel.Confirm(false); err != nil {
+		return false, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	confirms := channel.NotifyPublish(make(chan amqp.Confirmation, 1))
+
+	toChannelQueue := func(d amqp.Delivery) (string, string, bool) {
+		ch, ok := legacyChannel(d, queues)
+		return exchange, fmt.Sprintf(routingKeyFormat, ch), ok
+	}
+	moved, err := moveMessages(channel, confirms, queueName, messages, toChannelQueue)
+	if err != nil {
+		return false, err
+	}
+	if hasDLQ {
+		dead, err := moveMessages(channel, confirms, dlqName, deadLetters, func(d amqp.Delivery) (string, string, bool) {
+			ch, ok := legacyChannel(d, queues)
+			return "", fmt.Sprintf(deadLetterQueue, queues[ch]), ok
+		})
+		if err != nil {
+			return false, err
+		}
+		moved += dead
+		if _, err := channel.QueueDelete(dlqName, false, true, false); err != nil {
+			return false, fmt.Errorf("failed to delete legacy DLQ %s: %v", dlqName, err)
+		}
+	}
+	if moved > 0 {
+		logrus.Infof("moved %d notifications of the legacy queue %s to the channel queues", moved, queueName)
+	}
+
+	if !deleteLegacyDelayQueues(conn, queueName) {
+		return false, nil
+	}
+	// the notifications the delay queues returned in the meantime
+	if messages, _, err = inspect(conn, queueName); err != nil {
+		return false, err
+	}
+	if _, err := moveMessages(channel, confirms, queueName, messages, toChannelQueue); err != nil {
+		return false, err
+	}
+	if _, err := channel.QueueDelete(queueName, false, true, false); err != nil {
+		logrus.Warnf("legacy queue %s not deleted, it has notifications of channels without a queue on this instance: %v", queueName, err)
+		return true, nil
+	}
+	if err := channel.ExchangeDelete(fmt.Sprintf(deadLetterExchange, queueName), false, false); err != nil {
+		logrus.Warnf("legacy DLX of %s not deleted: %v", queueName, err)
+	}
+	logrus.Infof("deleted the legacy queue %s", queueName)
+	return true, nil
+}
+
+// pollLegacyQueue migrates the legacy queue until it is done or the context is canceled
+func (r *RabbitMQBroker) pollLegacyQueue(ctx context.Context, exchange, queueName string) {
+	for {
+		select {
+		case <-time.After(legacyPollInterval):
+		case <-ctx.Done():
+			return
+		}
+
+		done, err := migrateLegacyQueue(r.connection(), exchange, queueName, r.queues)
+		if err != nil {
+			logrus.Errorf("failed to migrate the legacy queue %s: %v", queueName, err)
+			continue
+		}
+		if done {
+			return
+		}
+	}
+}
+
+// legacyChannel returns the channel of a notification of the legacy queue when it has a queue on this instance
+func legacyChannel(d amqp.Delivery, queues map[string]string) (string, bool) {
+	var notification struct {
+		Channel string `json:"channel"`
+	}
+	if err := json.Unmarshal(d.Body, &notification); err != nil {
+		return "", false
+	}
+	_, ok := queues[notification.Channel]
+	return notification.Channel, ok
+}
+
+// inspect returns the number of ready messages of the queue and whether it exists. The passive declare
+// closes its channel when the queue does not exist, so it gets a channel of its own.
+func inspect(conn *amqp.Connection, queueName string) (int, bool, error) {
+	channel, err := conn.Channel()
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	defer channel.Close()
+
+	q, err := channel.QueueInspect(queueName)
+	var amqpErr *amqp.Error
+	if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to inspect queue %s: %v", queueName, err)
+	}
+	return q.Messages, true, nil
+}
+
+// deleteLegacyDelayQueues removes the fixed TTL delay queues of the queue once they are drained, until then
+// they keep dead-lettering their messages back to the queue. It reports whether they are all gone. Deleting a
+// missing queue succeeds, so a single channel is used until a queue which is not empty closes it.
+func deleteLegacyDelayQueues(conn *amqp.Connection, queueName string) bool {
+	channel, err := conn.Channel()
+	if err != nil {
+		logrus.Warnf("failed to open channel to delete the legacy delay queues of %s: %v", queueName, err)
+		return false
+	}
+
+	deleted := true
+	for attempt := 1; attempt <= legacyDelayQueueLimit; attempt++ {
+		legacyQueueName := fmt.Sprintf(legacyDelayQueueFormat, queueName, attempt)
+		_, err := channel.QueueDelete(legacyQueueName, false, true, false)
+		if err == nil {
+			continue
+		}
+		logrus.Warnf("legacy delay queue %s not deleted: %v", legacyQueueName, err)
+		deleted = false
+
+		// the failed delete closed the channel
+		if channel, err = conn.Channel(); err != nil {
+			logrus.Warnf("failed to open channel to delete the legacy delay queues of %s: %v", queueName, err)
+			return false
+		}
+	}
+	channel.Close()
+	return deleted
+}
+
+// moveMessages moves up to limit messages of a queue with their properties to the exchange and routing
+// key returned by route, a message route does not take is left in the queue. Every message is only
+// removed once the channel, which has to be in confirm mode, confirmed its copy.
+func moveMessages(channel *amqp.Channel, confirms <-chan amqp.Confirmation, from string, limit int, route func(amqp.Delivery) (string, string, bool)) (int, error) {
+	moved := 0
+	for i := 0; i < limit; i++ {
+		d, ok, err := channel.Get(from, false)
+		if err != nil {
+			return moved, fmt.Errorf("failed to get message from %s: %v", from, err)
+		}
+		if !ok {
+			break
+		}
+
+		exchange, key, ok := route(d)
+		if !ok {
+			d.Nack(false, true)
+			continue
+		}
+		err = channel.Publish(exchange, key, false, false, amqp.Publishing{
+			Headers:         d.Headers,
+			ContentType:     d.ContentType,
+			ContentEncoding: d.ContentEncoding,
+			DeliveryMode:    d.DeliveryMode,
+			Priority:        d.Priority,
+			Expiration:      d.Expiration,
+			MessageId:       d.MessageId,
+			Timestamp:       d.Timestamp,
+			Body:            d.Body,
+		})
+		if err == nil && !(<-confirms).Ack {
+			err = fmt.Errorf("nacked by the broker")
+		}
+		if err != nil {
+			d.Nack(false, true)
+			return moved, fmt.Errorf("failed to move message from %s: %v", from, err)
+		}
+		if err := d.Ack(false); err != nil {
+			return moved, fmt.Errorf("failed to remove moved message from %s: %v", from, err)
+		}
+		moved++
+	}
+	return moved, nil
+}
+
+// toQueue routes all the messages to the queue
+func toQueue(queueName string) func(amqp.Delivery) (string, string, bool) {
+	return func(amqp.Delivery) (string, string, bool) {
+		return "", queueName, true
+	}
+}
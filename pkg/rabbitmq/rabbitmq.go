@@ -2,34 +2,128 @@ package rabbitmq
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"math"
+	"os"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
 	"github.com/AlexTsIvanov/notification-system/pkg/types"
 	"github.com/streadway/amqp"
 )
 
 const (
-	delayQueueFormat   = "%s.delay.%d"
+	routingKeyFormat   = "notification.%s"
+	channelQueueFormat = "%s.%s"
+	retryQueueFormat   = "%s.retry.%d"
 	deadLetterExchange = "%s.dlx"
 	deadLetterQueue    = "%s.dlq"
 
-	initialTTL        = 1000
-	exponentialFactor = 2
+	retryCountHeader = "x-retry-count"
+
+	// delay queues with a fixed queue TTL used before the retry policy was configurable
+	legacyDelayQueueFormat = "%s.delay.%d"
+	legacyDelayQueueLimit  = 10
+
+	// confirmWindow is the number of messages SendBatch publishes before waiting for their confirms,
+	// the confirms channel buffers as many so the connection never blocks on delivering them
+	confirmWindow = 256
+)
+
+// headers describing the failure of a dead-lettered message
+const (
+	HeaderLastError         = "x-last-error"
+	HeaderErrorClass        = "x-error-class"
+	HeaderChannel           = "x-channel"
+	HeaderAttempts          = "x-attempts"
+	HeaderFirstSeen         = "x-first-seen"
+	HeaderLastAttempt       = "x-last-attempt"
+	HeaderOriginalMessageId = "x-original-message-id"
+	HeaderConsumerHost      = "x-consumer-host"
 )
 
+// HeaderExpiresAt carries the expiry of a notification through retries and the DLQ,
+// the AMQP expiration is only set when it is published and replaced by the retry delays
+const HeaderExpiresAt = "x-expires-at"
+
+type Config struct {
+	Uri      string
+	Exchange string
+	// Queue is the prefix of the channel queue names
+	Queue    string
+	Channels []string
+	Prefetch int
+	Retry    retry.Policies
+	// DelayBackend publishes the retries, one of the DelayBackend constants
+	DelayBackend string
+	// SchedulerDir stores the delayed messages of the wheel backend
+	SchedulerDir string
+	// Confirm makes Send wait until RabbitMQ confirmed the message
+	Confirm bool
+}
+
+// channelQueue is the queue consuming the notifications of a channel
+type channelQueue struct {
+	channel string
+	policy  retry.Policy
+}
+
 type RabbitMQBroker struct {
-	conn                *amqp.Connection
-	channel             *amqp.Channel
-	mainQueueName       string
-	deadLetterQueueName string
-	maxRetries          int
-	msgs                <-chan amqp.Delivery
+	uri string
+	// mu guards the connection, the channels, the publisher and the deliveries, which are replaced
+	// once the connection is lost
+	mu        sync.Mutex
+	conn      *amqp.Connection
+	channel   *amqp.Channel
+	publisher *publisher
+	confirm   bool
+	// consumer is the channel of the consumers and msgs their deliveries, both are nil until Read
+	// consumes again after the channel was closed
+	consumer  *amqp.Channel
+	msgs      <-chan amqp.Delivery
+	consuming bool
+	prefetch  int
+	publishMu sync.Mutex
+	exchange  string
+	// queues maps the channels to their queue names
+	queues map[string]string
+	// channelQueues maps the queue names to their channel
+	channelQueues map[string]channelQueue
+	delayer       delayer
+	hostname      string
+	// stopMigration stops migrating the legacy queue, nil when there is none
+	stopMigration context.CancelFunc
 }
 
-func NewRabbitMQBroker(uri, mainQueueName string, maxRetry int, withConsumer bool) (*RabbitMQBroker, error) {
-	conn, err := amqp.Dial(uri)
+// NewRabbitMQBroker declares a topic exchange routing notification.<channel> to a dedicated
+// priority queue per channel, each with its own retry queues and DLQ. When withConsumer is set
+// the broker consumes from the queues of all the configured channels with at most Prefetch
+// unacknowledged messages per queue, which lets the broker hand out urgent messages first.
+func NewRabbitMQBroker(config Config, withConsumer bool) (*RabbitMQBroker, error) {
+	if len(config.Channels) == 0 {
+		return nil, fmt.Errorf("at least one notification channel is required")
+	}
+
+	channelQueues := make(map[string]channelQueue, len(config.Channels))
+	queues := make(map[string]string, len(config.Channels))
+	for _, ch := range config.Channels {
+		policy, err := config.Retry.For(ch)
+		if err != nil {
+			return nil, err
+		}
+		queueName := fmt.Sprintf(channelQueueFormat, config.Queue, ch)
+		queues[ch] = queueName
+		channelQueues[queueName] = channelQueue{channel: ch, policy: policy}
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	conn, err := amqp.Dial(config.Uri)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to RabbitMQ: %v", err)
 	}
@@ -39,50 +133,119 @@ func NewRabbitMQBroker(uri, mainQueueName string, maxRetry int, withConsumer boo
 		return nil, fmt.Errorf("failed to open a channel: %v", err)
 	}
 
-	dlqName := fmt.Sprintf(deadLetterQueue, mainQueueName)
-	dlxName := fmt.Sprintf(deadLetterExchange, mainQueueName)
+	err = channel.ExchangeDeclare(config.Exchange, "topic", true, false, false, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare exchange %s: %v", config.Exchange, err)
+	}
+
+	r := &RabbitMQBroker{
+		uri:           config.Uri,
+		conn:          conn,
+		channel:       channel,
+		confirm:       config.Confirm,
+		consuming:     withConsumer,
+		prefetch:      config.Prefetch,
+		exchange:      config.Exchange,
+		queues:        queues,
+		channelQueues: channelQueues,
+		hostname:      hostname,
+	}
+	r.delayer, err = newDelayer(conn, config, r.mainChannel)
+	if err != nil {
+		return nil, err
+	}
+
+	for ch, queueName := range queues {
+		routingKey := fmt.Sprintf(routingKeyFormat, ch)
+		if err := migrateChannelQueue(conn, config.Exchange, queueName, routingKey); err != nil {
+			return nil, err
+		}
+		if err := declareChannelQueue(channel, config.Exchange, queueName, routingKey); err != nil {
+			return nil, err
+		}
+		if err := r.delayer.declare(channel, queueName, channelQueues[queueName].policy); err != nil {
+			return nil, err
+		}
+		deleteLegacyDelayQueues(conn, queueName)
+	}
+
+	migrated, err := migrateLegacyQueue(conn, config.Exchange, config.Queue, queues)
+	if err != nil {
+		return nil, err
+	}
+
+	if withConsumer {
+		if _, err := r.deliveries(); err != nil {
+			return nil, err
+		}
+	}
+
+	r.publisher, err = newPublisher(conn, channel, config.Confirm)
+	if err != nil {
+		return nil, err
+	}
+
+	if !migrated {
+		ctx, cancel := context.WithCancel(context.Background())
+		r.stopMigration = cancel
+		go r.pollLegacyQueue(ctx, config.Exchange, config.Queue)
+	}
+	return r, nil
+}
+
+// declareChannelQueue declares the queue of a single channel together with its DLX and DLQ
+func declareChannelQueue(channel *amqp.Channel, exchange, queueName, routingKey string) error {
+	dlqName := fmt.Sprintf(deadLetterQueue, queueName)
+	dlxName := fmt.Sprintf(deadLetterExchange, queueName)
 
-	_, err = channel.QueueDeclare(dlqName, true, false, false, false, nil)
+	_, err := channel.QueueDeclare(dlqName, true, false, false, false, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare a DLQ: %v", err)
+		return fmt.Errorf("failed to declare DLQ %s: %v", dlqName, err)
 	}
 
 	err = channel.ExchangeDeclare(dlxName, "direct", true, false, false, false, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare DLX: %v", err)
+		return fmt.Errorf("failed to declare DLX %s: %v", dlxName, err)
 	}
 
-	err = channel.QueueBind(mainQueueName, mainQueueName, dlxName, false, nil)
+	_, err = channel.QueueDeclare(queueName, true, false, false, false, channelQueueArgs(queueName))
 	if err != nil {
-		return nil, fmt.Errorf("failed to bind main queue to DLX: %v", err)
+		return fmt.Errorf("failed to declare queue %s: %v", queueName, err)
 	}
 
-	_, err = channel.QueueDeclare(mainQueueName, true, false, false, false, amqp.Table{
-		"x-dead-letter-exchange": dlxName,
-	})
+	err = channel.QueueBind(queueName, queueName, dlxName, false, nil)
 	if err != nil {
-		return nil, fmt.Errorf("failed to declare the main queue: %v", err)
+		return fmt.Errorf("failed to bind queue %s to DLX: %v", queueName, err)
 	}
 
-	for attempt := 1; attempt <= maxRetry; attempt++ {
-		delayQueueName := fmt.Sprintf(delayQueueFormat, mainQueueName, attempt)
-		ttl := initialTTL * int(math.Pow(float64(exponentialFactor), float64(attempt-1)))
+	err = channel.QueueBind(queueName, routingKey, exchange, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to bind queue %s to exchange %s: %v", queueName, exchange, err)
+	}
 
-		_, err = channel.QueueDeclare(delayQueueName, true, false, false, false, amqp.Table{
-			"x-dead-letter-exchange":    dlxName,
-			"x-message-ttl":             ttl,
-			"x-dead-letter-routing-key": mainQueueName,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to declare delay queue %s: %v", delayQueueName, err)
-		}
+	return nil
+}
+
+// channelQueueArgs are the arguments of a channel queue, a queue declared by an earlier version
+// with other arguments is migrated by migrateChannelQueue
+func channelQueueArgs(queueName string) amqp.Table {
+	return amqp.Table{
+		"x-dead-letter-exchange": fmt.Sprintf(deadLetterExchange, queueName),
+		"x-max-priority":         int(types.MaxPriority),
 	}
+}
 
-	var msgs <-chan amqp.Delivery
-	if withConsumer {
-		msgs, err = channel.Consume(
-			mainQueueName,
-			"",
+// consume starts a consumer on every queue and merges the deliveries into a single stream
+// which is closed once all consumers are gone. The queue name is used as consumer tag
+// so every delivery can be traced back to its queue.
+func consume(channel *amqp.Channel, queues map[string]string) (<-chan amqp.Delivery, error) {
+	out := make(chan amqp.Delivery)
+	var wg sync.WaitGroup
+
+	for _, queueName := range queues {
+		deliveries, err := channel.Consume(
+			queueName,
+			queueName,
 			false,
 			false,
 			false,
@@ -90,129 +253,518 @@ func NewRabbitMQBroker(uri, mainQueueName string, maxRetry int, withConsumer boo
 			nil,
 		)
 		if err != nil {
-			return nil, fmt.Errorf("failed to set up consumer: %v", err)
+			return nil, fmt.Errorf("failed to set up consumer for %s: %v", queueName, err)
 		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for d := range deliveries {
+				out <- d
+			}
+		}()
 	}
 
-	return &RabbitMQBroker{
-		conn:                conn,
-		channel:             channel,
-		mainQueueName:       mainQueueName,
-		deadLetterQueueName: dlqName,
-		maxRetries:          maxRetry,
-		msgs:                msgs,
-	}, nil
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+
+	return out, nil
 }
 
 func (r *RabbitMQBroker) Close() {
+	r.delayer.close()
+	if r.stopMigration != nil {
+		r.stopMigration()
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.consumer != nil {
+		r.consumer.Close()
+	}
+	if r.publisher.channel != r.channel {
+		r.publisher.channel.Close()
+	}
 	r.channel.Close()
 	r.conn.Close()
 }
 
-func (r *RabbitMQBroker) Send(ctx context.Context, message []byte) error {
-	err := r.channel.Publish(
-		"",
-		r.mainQueueName,
-		false,
-		false,
-		amqp.Publishing{
-			ContentType: "text/plain",
-			Body:        message,
-		},
-	)
+// connection returns the current connection of the broker
+func (r *RabbitMQBroker) connection() *amqp.Connection {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.conn
+}
+
+// publisher is the channel Send publishes on
+type publisher struct {
+	channel *amqp.Channel
+	// confirms is only set in confirm mode, published counts the messages published in confirm mode
+	confirms  <-chan amqp.Confirmation
+	published uint64
+}
+
+// newPublisher uses the channel for publishing, in confirm mode a dedicated channel is opened
+// so the confirms of the messages published by the delayer do not have to be consumed
+func newPublisher(conn *amqp.Connection, channel *amqp.Channel, confirm bool) (*publisher, error) {
+	if !confirm {
+		return &publisher{channel: channel}, nil
+	}
+
+	channel, err := conn.Channel()
 	if err != nil {
-		return fmt.Errorf("failed to publish a message: %w", err)
+		return nil, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	if err := channel.Confirm(false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to enable publisher confirms: %v", err)
+	}
+	return &publisher{
+		channel:  channel,
+		confirms: channel.NotifyPublish(make(chan amqp.Confirmation, confirmWindow)),
+	}, nil
+}
+
+// currentPublisher returns the publisher of the broker, reconnecting once the connection is lost
+func (r *RabbitMQBroker) currentPublisher() (*publisher, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reconnect(); err != nil {
+		return nil, err
+	}
+	return r.publisher, nil
+}
+
+// mainChannel returns the channel the retries and dead letters are published on, reconnecting once
+// the connection is lost
+func (r *RabbitMQBroker) mainChannel() (*amqp.Channel, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.reconnect(); err != nil {
+		return nil, err
+	}
+	return r.channel, nil
+}
+
+// reconnect dials a new connection once the connection is lost, e.g. while RabbitMQ restarts, so
+// publishing and consuming recover without restarting the service. The topology is durable and not
+// declared again, the consumers are started again by the next Read. Must be called with the lock held.
+func (r *RabbitMQBroker) reconnect() error {
+	if !r.conn.IsClosed() {
+		return nil
+	}
+
+	conn, err := amqp.Dial(r.uri)
+	if err != nil {
+		return fmt.Errorf("failed to reconnect to RabbitMQ: %v", err)
+	}
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to open a channel: %v", err)
+	}
+	publisher, err := newPublisher(conn, channel, r.confirm)
+	if err != nil {
+		conn.Close()
+		return err
 	}
 
+	r.conn, r.channel, r.publisher = conn, channel, publisher
+	// the deliveries of the lost connection are closed, their messages are redelivered
+	r.consumer, r.msgs = nil, nil
 	return nil
 }
 
+// deliveries returns the deliveries of the consumers. Once the channel of the consumers was closed,
+// e.g. by a lost connection, they are started again on a new channel.
+func (r *RabbitMQBroker) deliveries() (<-chan amqp.Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.msgs != nil {
+		return r.msgs, nil
+	}
+	if err := r.reconnect(); err != nil {
+		return nil, err
+	}
+
+	channel, err := r.conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a channel: %v", err)
+	}
+	// without a prefetch limit all ready messages are pushed to the consumer
+	// and the queue priority has no effect
+	if err := channel.Qos(r.prefetch, 0, false); err != nil {
+		channel.Close()
+		return nil, fmt.Errorf("failed to set prefetch count: %v", err)
+	}
+	msgs, err := consume(channel, r.queues)
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	r.consumer, r.msgs = channel, msgs
+	return msgs, nil
+}
+
+// consumerClosed lets the next Read consume again once the deliveries were closed
+func (r *RabbitMQBroker) consumerClosed(msgs <-chan amqp.Delivery) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.msgs == msgs {
+		r.consumer.Close()
+		r.consumer, r.msgs = nil, nil
+	}
+}
+
+// Send publishes the message to the exchange, in confirm mode it returns once RabbitMQ confirmed the message
+func (r *RabbitMQBroker) Send(ctx context.Context, message types.Message) error {
+	if _, ok := r.queues[message.Channel]; !ok {
+		return fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, message.Channel)
+	}
+
+	if r.confirm {
+		// the confirms are matched to the messages by their order
+		r.publishMu.Lock()
+		defer r.publishMu.Unlock()
+	}
+
+	p, err := r.currentPublisher()
+	if err != nil {
+		return fmt.Errorf("failed to publish a message: %w", err)
+	}
+
+	if err := r.publish(p, message); err != nil {
+		return fmt.Errorf("failed to publish a message: %w", err)
+	}
+
+	if p.confirms == nil {
+		return nil
+	}
+	p.published++
+	for {
+		select {
+		case confirm, ok := <-p.confirms:
+			if !ok {
+				return fmt.Errorf("failed to publish a message: channel closed before the confirm")
+			}
+			if confirm.DeliveryTag < p.published {
+				// confirm of a message whose Send gave up waiting
+				continue
+			}
+			if !confirm.Ack {
+				return fmt.Errorf("failed to publish a message: rejected by the broker")
+			}
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("failed to publish a message: %w", ctx.Err())
+		}
+	}
+}
+
+// SendBatch publishes the messages and returns the error of each of them, nil for the published ones.
+// In confirm mode the confirms are awaited per window of messages instead of per message.
+func (r *RabbitMQBroker) SendBatch(ctx context.Context, messages []types.Message) []error {
+	errs := make([]error, len(messages))
+	for i, message := range messages {
+		if _, ok := r.queues[message.Channel]; !ok {
+			errs[i] = fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, message.Channel)
+		}
+	}
+
+	if r.confirm {
+		r.publishMu.Lock()
+		defer r.publishMu.Unlock()
+	}
+
+	p, err := r.currentPublisher()
+	if err != nil {
+		fail(errs, 0, fmt.Errorf("failed to publish a message: %w", err))
+		return errs
+	}
+
+	for start := 0; start < len(messages); start += confirmWindow {
+		end := min(start+confirmWindow, len(messages))
+
+		// pending maps the delivery tags of the published messages to their index
+		pending := make(map[uint64]int)
+		for i := start; i < end; i++ {
+			if errs[i] != nil {
+				continue
+			}
+			if err := r.publish(p, messages[i]); err != nil {
+				// the channel is closed after a failed publish
+				fail(errs, i, fmt.Errorf("failed to publish a message: %w", err))
+				break
+			}
+			if p.confirms != nil {
+				p.published++
+				pending[p.published] = i
+			}
+		}
+
+		for len(pending) > 0 {
+			select {
+			case confirm, ok := <-p.confirms:
+				if !ok {
+					for _, i := range pending {
+						errs[i] = fmt.Errorf("failed to publish a message: channel closed before the confirm")
+					}
+					fail(errs, end, fmt.Errorf("failed to publish a message: channel closed"))
+					return errs
+				}
+				// confirms of messages whose Send gave up waiting are not pending
+				i, ok := pending[confirm.DeliveryTag]
+				if !ok {
+					continue
+				}
+				delete(pending, confirm.DeliveryTag)
+				if !confirm.Ack {
+					errs[i] = fmt.Errorf("failed to publish a message: rejected by the broker")
+				}
+			case <-ctx.Done():
+				for _, i := range pending {
+					errs[i] = fmt.Errorf("failed to publish a message: %w", ctx.Err())
+				}
+				fail(errs, end, fmt.Errorf("failed to publish a message: %w", ctx.Err()))
+				return errs
+			}
+		}
+	}
+	return errs
+}
+
+// publish publishes the message on the channel of the publisher. An expiring message carries its expiry
+// as header but no AMQP expiration: RabbitMQ would dead-letter it with its routing key, which the DLX of
+// the queue is not bound to, so it stays in the queue and the consumer records it as expired instead.
+func (r *RabbitMQBroker) publish(p *publisher, message types.Message) error {
+	now := time.Now()
+	msg := amqp.Publishing{
+		ContentType: "text/plain",
+		MessageId:   message.ID,
+		Priority:    uint8(message.Priority),
+		Timestamp:   now,
+		Body:        message.Payload,
+	}
+	if !message.ExpiresAt.IsZero() {
+		msg.Headers = amqp.Table{HeaderExpiresAt: message.ExpiresAt.UTC().Format(time.RFC3339Nano)}
+	}
+
+	return p.channel.Publish(
+		r.exchange,
+		fmt.Sprintf(routingKeyFormat, message.Channel),
+		false,
+		false,
+		msg,
+	)
+}
+
+// fail sets the error of the messages from the index on which have no error yet
+func fail(errs []error, from int, err error) {
+	for i := from; i < len(errs); i++ {
+		if errs[i] == nil {
+			errs[i] = err
+		}
+	}
+}
+
 func (r *RabbitMQBroker) Read(ctx context.Context) (types.EventContext, error) {
-	if r.msgs == nil {
+	if !r.consuming {
 		return types.EventContext{}, fmt.Errorf("no consumer set up")
 	}
+	msgs, err := r.deliveries()
+	if err != nil {
+		return types.EventContext{}, err
+	}
 
 	select {
-	case d := <-r.msgs:
-		headerValueStr := fmt.Sprintf("%v", d.Headers["x-retry-count"])
+	case d, ok := <-msgs:
+		if !ok {
+			r.consumerClosed(msgs)
+			return types.EventContext{}, fmt.Errorf("consumer channel closed")
+		}
+
+		headerValueStr := fmt.Sprintf("%v", d.Headers[retryCountHeader])
 
 		retryCount, err := strconv.Atoi(headerValueStr)
 		if err != nil {
 			retryCount = 0
 		}
 
-		return types.EventContext{
+		event := types.EventContext{
 			EventId:    fmt.Sprint(d.DeliveryTag),
+			MessageId:  d.MessageId,
+			Queue:      d.ConsumerTag,
 			Payload:    d.Body,
 			RetryCount: retryCount,
-		}, nil
+			Priority:   types.Priority(d.Priority),
+			FirstSeen:  d.Timestamp,
+			// the delivery tag is only valid on the channel of the delivery
+			Acknowledger: d.Acknowledger,
+		}
+		if expiresAt := headerTime(d.Headers, HeaderExpiresAt); expiresAt != nil {
+			event.ExpiresAt = *expiresAt
+		}
+		return event, nil
 	case <-ctx.Done():
 		return types.EventContext{}, ctx.Err()
 	}
 }
 
+// Ack acknowledges the event on the channel it was delivered on
 func (c *RabbitMQBroker) Ack(event types.EventContext) error {
-	deliveryTag, err := strconv.ParseUint(event.EventId, 10, 64)
+	d, err := deliveryOf(event)
 	if err != nil {
-		return fmt.Errorf("error converting id to int: %v", err)
+		return err
 	}
-
-	return c.channel.Ack(deliveryTag, false)
+	return d.ack()
 }
 
-func (c *RabbitMQBroker) Nack(event types.EventContext) error {
-	deliveryTag, err := strconv.ParseUint(event.EventId, 10, 64)
+// Nack retries the event with the backoff of its channel. Events failing with a permanent error
+// or exhausting the retry policy are published to the DLQ together with the failure details.
+func (c *RabbitMQBroker) Nack(event types.EventContext, cause error) (types.Outcome, error) {
+	d, err := deliveryOf(event)
 	if err != nil {
-		return fmt.Errorf("error converting id to int: %v", err)
+		return "", err
+	}
+
+	queue, ok := c.channelQueues[event.Queue]
+	if !ok {
+		// we cannot tell which retry queue to use so return the message to its queue
+		return types.OutcomeRetrying, d.requeue()
 	}
 
 	retryCount := event.RetryCount
+	now := time.Now()
+
+	channel, err := c.mainChannel()
+	if err != nil {
+		return types.OutcomeRetrying, d.requeue()
+	}
 
-	if retryCount >= c.maxRetries {
+	if types.ClassOf(cause).Permanent() || queue.policy.Exhausted(retryCount, event.FirstSeen, now) {
 
-		err := c.channel.Publish(
+		err := channel.Publish(
 			"",
-			c.deadLetterQueueName,
+			fmt.Sprintf(deadLetterQueue, event.Queue),
 			false,
 			false,
 			amqp.Publishing{
 				ContentType:  "application/json",
 				Body:         event.Payload,
+				Headers:      c.failureHeaders(event, queue.channel, cause, now),
 				DeliveryMode: amqp.Persistent,
+				MessageId:    event.MessageId,
+				Priority:     uint8(event.Priority),
+				Timestamp:    event.FirstSeen,
 			},
 		)
 		if err != nil {
 			// if we cannot publish the message to the delay queue
 			// we Nack it and will be returned at the end of the queue it was
-			return c.channel.Nack(deliveryTag, false, true)
+			return types.OutcomeRetrying, d.requeue()
 		}
 
-		return c.channel.Ack(deliveryTag, false)
+		return types.DeadLetterOutcome(cause), d.ack()
 	} else {
-		delayQueueName := fmt.Sprintf(delayQueueFormat, c.mainQueueName, retryCount+1)
-
 		retryHeaders := amqp.Table{
-			"x-retry-count": retryCount + 1,
+			retryCountHeader: retryCount + 1,
+		}
+		if !event.ExpiresAt.IsZero() {
+			retryHeaders[HeaderExpiresAt] = event.ExpiresAt.UTC().Format(time.RFC3339Nano)
 		}
 
-		err := c.channel.Publish(
-			"",
-			delayQueueName,
-			false,
-			false,
+		err := c.delayer.delay(
+			channel,
+			event.Queue,
+			retryCount+1,
 			amqp.Publishing{
 				ContentType:  "application/json",
 				Body:         event.Payload,
 				Headers:      retryHeaders,
 				DeliveryMode: amqp.Persistent,
+				MessageId:    event.MessageId,
+				// kept so the message regains its place when it returns to the channel queue
+				Priority:  uint8(event.Priority),
+				Timestamp: event.FirstSeen,
 			},
+			types.RetryDelay(queue.policy.Backoff(retryCount+1), event.ExpiresAt, now),
 		)
 		if err != nil {
 			// if we cannot publish the message to the delay queue
 			// we Nack it and will be returned at the end of the queue it was
-			return c.channel.Nack(deliveryTag, false, true)
+			return types.OutcomeRetrying, d.requeue()
 		}
 
-		return c.channel.Ack(deliveryTag, false)
+		return types.OutcomeRetrying, d.ack()
+	}
+}
+
+// delivery is the channel an event was delivered on with its delivery tag. A tag is only valid on its
+// channel, once the channel is closed RabbitMQ redelivers the message and the tag is dropped.
+type delivery struct {
+	acknowledger amqp.Acknowledger
+	tag          uint64
+}
+
+func deliveryOf(event types.EventContext) (delivery, error) {
+	tag, err := strconv.ParseUint(event.EventId, 10, 64)
+	if err != nil {
+		return delivery{}, fmt.Errorf("error converting id to int: %v", err)
+	}
+	acknowledger, ok := event.Acknowledger.(amqp.Acknowledger)
+	if !ok {
+		return delivery{}, fmt.Errorf("event %s was not delivered by this broker", event.EventId)
+	}
+	return delivery{acknowledger: acknowledger, tag: tag}, nil
+}
+
+func (d delivery) ack() error {
+	return closedDelivery(d.acknowledger.Ack(d.tag, false))
+}
+
+func (d delivery) requeue() error {
+	return closedDelivery(d.acknowledger.Nack(d.tag, false, true))
+}
+
+// closedDelivery explains the error of a delivery whose channel was closed
+func closedDelivery(err error) error {
+	if errors.Is(err, amqp.ErrClosed) {
+		return fmt.Errorf("channel of the delivery closed, the message is redelivered: %w", err)
+	}
+	return err
+}
+
+// failureHeaders describe why and when the event failed so dead-lettered messages can be triaged
+func (c *RabbitMQBroker) failureHeaders(event types.EventContext, channel string, cause error, now time.Time) amqp.Table {
+	lastError := "unknown error"
+	if cause != nil {
+		lastError = cause.Error()
+	}
+
+	headers := amqp.Table{
+		retryCountHeader:   event.RetryCount,
+		HeaderLastError:    lastError,
+		HeaderErrorClass:   string(types.ClassOf(cause)),
+		HeaderChannel:      channel,
+		HeaderAttempts:     event.RetryCount + 1,
+		HeaderLastAttempt:  now.UTC().Format(time.RFC3339Nano),
+		HeaderConsumerHost: c.hostname,
+	}
+	if !event.FirstSeen.IsZero() {
+		headers[HeaderFirstSeen] = event.FirstSeen.UTC().Format(time.RFC3339Nano)
+	}
+	if event.MessageId != "" {
+		headers[HeaderOriginalMessageId] = event.MessageId
+	}
+	if !event.ExpiresAt.IsZero() {
+		headers[HeaderExpiresAt] = event.ExpiresAt.UTC().Format(time.RFC3339Nano)
 	}
+	return headers
 }
@@ -0,0 +1,620 @@
+package rabbitmq_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/amqptest"
+	"github.com/AlexTsIvanov/notification-system/pkg/rabbitmq"
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/streadway/amqp"
+)
+
+var _ = Describe("RabbitMQBroker", func() {
+	var (
+		serverConfig amqptest.Config
+		server       *amqptest.Server
+		config       rabbitmq.Config
+		broker       *rabbitmq.RabbitMQBroker
+		ctx          context.Context
+		cancel       context.CancelFunc
+	)
+
+	BeforeEach(func() {
+		serverConfig = amqptest.Config{}
+		config = rabbitmq.Config{
+			Exchange: "notifications",
+			Queue:    "notifications",
+			Channels: []string{"email", "sms"},
+			Prefetch: 10,
+			Retry: retry.Policies{
+				Default: retry.Policy{
+					InitialDelay: 20 * time.Millisecond,
+					Multiplier:   2,
+					MaxDelay:     time.Second,
+					Jitter:       retry.JitterNone,
+					MaxAttempts:  3,
+				},
+			},
+			DelayBackend: rabbitmq.DelayBackendQueues,
+			SchedulerDir: GinkgoT().TempDir(),
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	})
+
+	JustBeforeEach(func() {
+		var err error
+		server, err = amqptest.NewServer(serverConfig)
+		Expect(err).ToNot(HaveOccurred())
+		config.Uri = server.URI()
+
+		broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+		Expect(err).ToNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		cancel()
+		if broker != nil {
+			broker.Close()
+		}
+		server.Close()
+	})
+
+	send := func(channel string, priority types.Priority, payload string) {
+		Expect(broker.Send(ctx, types.Message{Channel: channel, Priority: priority, Payload: []byte(payload)})).To(Succeed())
+	}
+
+	read := func() types.EventContext {
+		event, err := broker.Read(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		return event
+	}
+
+	queueLength := func(name string) func() int {
+		return func() int {
+			info, _ := server.Queue(name)
+			return info.Messages
+		}
+	}
+
+	It("declares a queue with retry queues and a DLQ per channel", func() {
+		Expect(server.QueueNames()).To(ConsistOf(
+			"notifications.email", "notifications.email.dlq", "notifications.email.retry.1", "notifications.email.retry.2",
+			"notifications.sms", "notifications.sms.dlq", "notifications.sms.retry.1", "notifications.sms.retry.2",
+		))
+
+		info, _ := server.Queue("notifications.sms")
+		Expect(info.Arguments).To(HaveKeyWithValue("x-dead-letter-exchange", "notifications.sms.dlx"))
+		Expect(info.Consumers).To(Equal(1))
+	})
+
+	It("routes notifications to the queue of their channel", func() {
+		send("sms", types.PriorityHigh, `{"content":"hi"}`)
+
+		event := read()
+		Expect(event.Queue).To(Equal("notifications.sms"))
+		Expect(event.Priority).To(Equal(types.PriorityHigh))
+		Expect(string(event.Payload)).To(Equal(`{"content":"hi"}`))
+		Expect(event.RetryCount).To(Equal(0))
+		Expect(broker.Ack(event)).To(Succeed())
+	})
+
+	It("rejects unknown channels", func() {
+		err := broker.Send(ctx, types.Message{Channel: "fax"})
+		Expect(errors.Is(err, types.ErrUnsupportedChannel)).To(BeTrue())
+	})
+
+	It("publishes batches", func() {
+		errs := broker.SendBatch(ctx, []types.Message{
+			{ID: "m1", Channel: "sms", Payload: []byte(`{"content":"hi"}`)},
+			{ID: "m2", Channel: "email", Payload: []byte(`{"content":"hi"}`)},
+		})
+		Expect(errs).To(Equal([]error{nil, nil}))
+		Expect([]string{read().MessageId, read().MessageId}).To(ConsistOf("m1", "m2"))
+	})
+
+	It("reconnects for publishing once the connection is lost", func() {
+		server.CloseConnections()
+
+		// sends racing the detection of the lost connection may fail or get lost
+		Eventually(func() int {
+			broker.Send(ctx, types.Message{Channel: "sms", Payload: []byte(`{"content":"hi"}`)})
+			return queueLength("notifications.sms")()
+		}).Should(BeNumerically(">=", 1))
+	})
+
+	It("consumes again once the connection is lost and drops the delivery tags of the lost channel", func() {
+		Expect(broker.Send(ctx, types.Message{ID: "m1", Channel: "sms", Payload: []byte(`{"content":"hi"}`)})).To(Succeed())
+		event := read()
+		server.CloseConnections()
+
+		Eventually(func() error { return broker.Ack(event) }).Should(MatchError(ContainSubstring("the message is redelivered")))
+
+		// the reads racing the detection of the lost connection fail until the consumers are started again
+		Eventually(func() string {
+			event, _ := broker.Read(ctx)
+			return event.MessageId
+		}).Should(Equal("m1"))
+	})
+
+	It("rejects events it did not deliver", func() {
+		Expect(broker.Ack(types.EventContext{EventId: "1"})).To(MatchError("event 1 was not delivered by this broker"))
+	})
+
+	Context("with publisher confirms", func() {
+		BeforeEach(func() {
+			config.Confirm = true
+		})
+
+		It("returns once the message is confirmed", func() {
+			for i := 0; i < 3; i++ {
+				send("sms", types.PriorityNormal, `{"content":"hi"}`)
+			}
+			// the consumer of the broker takes them right away
+			info, _ := server.Queue("notifications.sms")
+			Expect(info.Messages + info.Unacked).To(Equal(3))
+		})
+
+		It("confirms batches larger than the confirm window", func() {
+			messages := make([]types.Message, 300)
+			for i := range messages {
+				messages[i] = types.Message{Channel: "sms", Payload: []byte(`{"content":"hi"}`)}
+			}
+			messages[7].Channel = "fax"
+
+			errs := broker.SendBatch(ctx, messages)
+			Expect(errs).To(HaveLen(300))
+			for i, err := range errs {
+				if i == 7 {
+					Expect(err).To(MatchError(types.ErrUnsupportedChannel))
+				} else {
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}
+			info, _ := server.Queue("notifications.sms")
+			Expect(info.Messages + info.Unacked).To(Equal(299))
+
+			// the confirms of the batch do not leak into the next send
+			send("sms", types.PriorityNormal, `{"content":"hi"}`)
+		})
+
+		It("returns the nacked messages of a batch as their errors", func() {
+			server.RejectPublishes("notifications.email", true)
+
+			errs := broker.SendBatch(ctx, []types.Message{
+				{Channel: "sms", Payload: []byte(`{"content":"hi"}`)},
+				{Channel: "email", Payload: []byte(`{"content":"hi"}`)},
+				{Channel: "sms", Payload: []byte(`{"content":"hi"}`)},
+			})
+			Expect(errs).To(HaveLen(3))
+			Expect(errs[0]).NotTo(HaveOccurred())
+			Expect(errs[1]).To(MatchError(ContainSubstring("rejected by the broker")))
+			Expect(errs[2]).NotTo(HaveOccurred())
+
+			err := broker.Send(ctx, types.Message{Channel: "email", Payload: []byte(`{"content":"hi"}`)})
+			Expect(err).To(MatchError(ContainSubstring("rejected by the broker")))
+		})
+
+		It("confirms after reconnecting", func() {
+			server.CloseConnections()
+
+			Eventually(func() error {
+				return broker.Send(ctx, types.Message{Channel: "sms", Payload: []byte(`{"content":"hi"}`)})
+			}).Should(Succeed())
+			Expect(queueLength("notifications.sms")()).To(Equal(1))
+		})
+	})
+
+	It("retries through the retry queues and dead-letters once the policy is exhausted", func() {
+		send("email", types.PriorityNormal, `{"content":"hi"}`)
+
+		// MaxAttempts deliveries, the last one is dead-lettered
+		for attempt := 1; attempt <= 3; attempt++ {
+			event := read()
+			Expect(event.RetryCount).To(Equal(attempt - 1))
+			outcome := types.OutcomeRetrying
+			if attempt == 3 {
+				outcome = types.OutcomeDeadLettered
+			}
+			Expect(broker.Nack(event, errors.New("smtp down"))).To(Equal(outcome))
+		}
+
+		Eventually(queueLength("notifications.email.dlq")).Should(Equal(1))
+		deadLetters, total, err := broker.ListDeadLetters(ctx, "email", 0, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(total).To(Equal(1))
+		Expect(deadLetters[0].LastError).To(Equal("smtp down"))
+		Expect(deadLetters[0].ErrorClass).To(Equal(types.ErrorClassUnknown))
+		Expect(deadLetters[0].Attempts).To(Equal(3))
+
+		// listing leaves the dead letters in place
+		Eventually(queueLength("notifications.email.dlq")).Should(Equal(1))
+	})
+
+	It("dead-letters permanent failures right away and requeues them on request", func() {
+		send("sms", types.PriorityNormal, `"bad"`)
+		event := read()
+		Expect(broker.Nack(event, types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad json")))).To(Equal(types.OutcomeFailed))
+		Eventually(queueLength("notifications.sms.dlq")).Should(Equal(1))
+
+		requeued, err := broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{ErrorClass: types.ErrorClassInvalidPayload})
+		Expect(err).ToNot(HaveOccurred())
+		Expect(requeued).To(Equal(1))
+
+		event = read()
+		Expect(string(event.Payload)).To(Equal(`"bad"`))
+		Expect(event.RetryCount).To(Equal(0))
+		Expect(broker.Nack(event, types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad json")))).To(Equal(types.OutcomeFailed))
+
+		Eventually(queueLength("notifications.sms.dlq")).Should(Equal(1))
+		purged, err := broker.PurgeDeadLetters(ctx, "sms")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(purged).To(Equal(1))
+	})
+
+	Context("with dead letters", func() {
+		var raw *amqp.Channel
+
+		JustBeforeEach(func() {
+			for i := 1; i <= 3; i++ {
+				Expect(broker.Send(ctx, types.Message{ID: fmt.Sprint("m", i), Channel: "sms", Payload: []byte(`{"content":"hi"}`)})).To(Succeed())
+				Expect(broker.Nack(read(), types.NewDeliveryError(types.ErrorClassRejected, errors.New("blocked")))).To(Equal(types.OutcomeFailed))
+			}
+			Eventually(queueLength("notifications.sms.dlq")).Should(Equal(3))
+
+			conn, err := amqp.Dial(server.URI())
+			Expect(err).ToNot(HaveOccurred())
+			DeferCleanup(func() { conn.Close() })
+			raw, err = conn.Channel()
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("lists the same dead letters again although listing marks them redelivered", func() {
+			first, _, err := broker.ListDeadLetters(ctx, "sms", 1, 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(first).To(HaveLen(2))
+			Expect(first[0].ID).To(Equal("m2"))
+
+			d, ok, err := raw.Get("notifications.sms.dlq", false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(d.Redelivered).To(BeTrue())
+			Expect(d.Nack(false, true)).To(Succeed())
+
+			second, total, err := broker.ListDeadLetters(ctx, "sms", 1, 2)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(total).To(Equal(3))
+			Expect(second).To(Equal(first))
+		})
+
+		It("rejects pages beyond the peek limit", func() {
+			_, _, err := broker.ListDeadLetters(ctx, "sms", 990, 11)
+			Expect(errors.Is(err, types.ErrPeekLimit)).To(BeTrue())
+		})
+
+		It("leaves the dead letters held by a concurrent listing in the DLQ when requeueing", func() {
+			held, ok, err := raw.Get("notifications.sms.dlq", false)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ok).To(BeTrue())
+
+			requeued, err := broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{All: true})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(requeued).To(Equal(2))
+			Expect([]string{read().MessageId, read().MessageId}).To(ConsistOf("m2", "m3"))
+
+			Expect(raw.Close()).To(Succeed())
+			Eventually(queueLength("notifications.sms.dlq")).Should(Equal(1))
+			deadLetters, _, err := broker.ListDeadLetters(ctx, "sms", 0, 10)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(deadLetters).To(HaveLen(1))
+			Expect(deadLetters[0].ID).To(Equal(held.MessageId))
+		})
+	})
+
+	It("carries the expiry through the retries and the DLQ", func() {
+		expiresAt := time.Now().Add(time.Minute).Truncate(time.Millisecond)
+		Expect(broker.Send(ctx, types.Message{ID: "m1", Channel: "sms", Payload: []byte(`{"content":"hi"}`), ExpiresAt: expiresAt})).To(Succeed())
+
+		event := read()
+		Expect(event.ExpiresAt).To(BeTemporally("==", expiresAt))
+		Expect(broker.Nack(event, errors.New("timeout"))).To(Equal(types.OutcomeRetrying))
+
+		event = read()
+		Expect(event.RetryCount).To(Equal(1))
+		Expect(event.ExpiresAt).To(BeTemporally("==", expiresAt))
+		Expect(broker.Nack(event, types.NewDeliveryError(types.ErrorClassRejected, errors.New("blocked")))).To(Equal(types.OutcomeFailed))
+		Eventually(queueLength("notifications.sms.dlq")).Should(Equal(1))
+
+		deadLetters, _, err := broker.ListDeadLetters(ctx, "sms", 0, 10)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(deadLetters[0].Headers).To(HaveKey(rabbitmq.HeaderExpiresAt))
+
+		_, err = broker.RequeueDeadLetters(ctx, "sms", types.DeadLetterFilter{All: true})
+		Expect(err).ToNot(HaveOccurred())
+		event = read()
+		Expect(event.RetryCount).To(Equal(0))
+		Expect(event.ExpiresAt).To(BeTemporally("==", expiresAt))
+	})
+
+	Context("with a backoff longer than the expiry", func() {
+		BeforeEach(func() {
+			config.Retry.Default.InitialDelay = time.Minute
+			config.Retry.Default.MaxDelay = time.Minute
+		})
+
+		It("returns the message once it expired instead of after the backoff", func() {
+			expiresAt := time.Now().Add(200 * time.Millisecond)
+			Expect(broker.Send(ctx, types.Message{Channel: "sms", Payload: []byte(`{"content":"hi"}`), ExpiresAt: expiresAt})).To(Succeed())
+			Expect(broker.Nack(read(), errors.New("timeout"))).To(Equal(types.OutcomeRetrying))
+
+			event := read()
+			Expect(event.RetryCount).To(Equal(1))
+			Expect(time.Now()).To(BeTemporally("~", expiresAt, 100*time.Millisecond))
+		})
+	})
+
+	Context("with a paused consumer", func() {
+		JustBeforeEach(func() {
+			// the consumer of the outer JustBeforeEach would take the message off the queue
+			broker.Close()
+			var err error
+			broker, err = rabbitmq.NewRabbitMQBroker(config, false)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("keeps a message which expired in the queue for the consumer", func() {
+			expiresAt := time.Now().Add(50 * time.Millisecond).Truncate(time.Millisecond)
+			Expect(broker.Send(ctx, types.Message{ID: "m1", Channel: "sms", Payload: []byte(`{"content":"hi"}`), ExpiresAt: expiresAt})).To(Succeed())
+			Eventually(queueLength("notifications.sms")).Should(Equal(1))
+			Consistently(queueLength("notifications.sms"), 200*time.Millisecond).Should(Equal(1))
+
+			broker.Close()
+			var err error
+			broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+			Expect(err).ToNot(HaveOccurred())
+
+			event := read()
+			Expect(event.ExpiresAt).To(BeTemporally("==", expiresAt))
+			Expect(event.Expired(time.Now())).To(BeTrue())
+		})
+	})
+
+	Context("with legacy delay queues", func() {
+		var conn *amqp.Connection
+
+		JustBeforeEach(func() {
+			// the broker of the outer JustBeforeEach already ran, declare the legacy queues and restart it
+			broker.Close()
+
+			var err error
+			conn, err = amqp.Dial(server.URI())
+			Expect(err).ToNot(HaveOccurred())
+			ch, err := conn.Channel()
+			Expect(err).ToNot(HaveOccurred())
+			for _, name := range []string{"notifications.sms.delay.1", "notifications.sms.delay.2"} {
+				_, err := ch.QueueDeclare(name, true, false, false, false, amqp.Table{"x-message-ttl": 60000})
+				Expect(err).ToNot(HaveOccurred())
+			}
+			Expect(ch.Publish("", "notifications.sms.delay.2", false, false, amqp.Publishing{Body: []byte("pending")})).To(Succeed())
+			Eventually(queueLength("notifications.sms.delay.2")).Should(Equal(1))
+
+			broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("deletes them once they are drained", func() {
+			Expect(server.QueueNames()).ToNot(ContainElement("notifications.sms.delay.1"))
+			Expect(server.QueueNames()).To(ContainElement("notifications.sms.delay.2"))
+		})
+	})
+
+	Context("with the single queue of the first version", func() {
+		var (
+			conn    *amqp.Connection
+			pending bool
+		)
+
+		BeforeEach(func() {
+			pending = false
+		})
+
+		JustBeforeEach(func() {
+			// the broker of the outer JustBeforeEach already ran, declare the legacy topology and restart it
+			broker.Close()
+
+			var err error
+			conn, err = amqp.Dial(server.URI())
+			Expect(err).ToNot(HaveOccurred())
+			ch, err := conn.Channel()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ch.QueueDeclare("notifications.dlq", true, false, false, false, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ch.ExchangeDeclare("notifications.dlx", "direct", true, false, false, false, nil)).To(Succeed())
+			_, err = ch.QueueDeclare("notifications", true, false, false, false, amqp.Table{"x-dead-letter-exchange": "notifications.dlx"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ch.QueueBind("notifications", "notifications", "notifications.dlx", false, nil)).To(Succeed())
+			_, err = ch.QueueDeclare("notifications.delay.1", true, false, false, false, amqp.Table{
+				"x-dead-letter-exchange":    "notifications.dlx",
+				"x-message-ttl":             60000,
+				"x-dead-letter-routing-key": "notifications",
+			})
+			Expect(err).ToNot(HaveOccurred())
+
+			for _, body := range []string{`{"channel":"sms","content":"retried"}`, `{"channel":"email","content":"hi"}`, `{"channel":"push","content":"hi"}`} {
+				Expect(ch.Publish("", "notifications", false, false, amqp.Publishing{
+					Headers: amqp.Table{"x-retry-count": 1},
+					Body:    []byte(body),
+				})).To(Succeed())
+			}
+			Expect(ch.Publish("", "notifications.dlq", false, false, amqp.Publishing{Body: []byte(`{"channel":"email","content":"dead"}`)})).To(Succeed())
+			if pending {
+				Expect(ch.Publish("", "notifications.delay.1", false, false, amqp.Publishing{Body: []byte(`{"channel":"sms","content":"pending"}`)})).To(Succeed())
+				Eventually(queueLength("notifications.delay.1")).Should(Equal(1))
+			}
+			Eventually(queueLength("notifications")).Should(Equal(3))
+
+			broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("moves the notifications to the queues of their channels", func() {
+			events := map[string]types.EventContext{}
+			for i := 0; i < 2; i++ {
+				event := read()
+				events[event.Queue] = event
+				Expect(broker.Ack(event)).To(Succeed())
+			}
+			Expect(events).To(HaveKey("notifications.sms"))
+			Expect(events["notifications.sms"].RetryCount).To(Equal(1))
+			Expect(events["notifications.sms"].Payload).To(MatchJSON(`{"channel":"sms","content":"retried"}`))
+			Expect(events).To(HaveKey("notifications.email"))
+
+			Expect(queueLength("notifications.email.dlq")()).To(Equal(1))
+			Expect(server.QueueNames()).ToNot(ContainElements("notifications.dlq", "notifications.delay.1"))
+		})
+
+		It("keeps the queue with the notifications of channels without a queue", func() {
+			Expect(queueLength("notifications")()).To(Equal(1))
+		})
+
+		Context("with notifications in its delay queues", func() {
+			BeforeEach(func() {
+				pending = true
+			})
+
+			It("keeps the queue and its delay queues until they are drained", func() {
+				Expect(server.QueueNames()).To(ContainElements("notifications", "notifications.delay.1"))
+				Expect(queueLength("notifications.dlq")()).To(Equal(0))
+				Expect(read().RetryCount).To(Equal(1))
+			})
+		})
+	})
+
+	Context("with a channel queue of an earlier version", func() {
+		var conn *amqp.Connection
+
+		JustBeforeEach(func() {
+			// the broker of the outer JustBeforeEach already ran, declare the queue without priorities and restart it
+			broker.Close()
+
+			var err error
+			conn, err = amqp.Dial(server.URI())
+			Expect(err).ToNot(HaveOccurred())
+			ch, err := conn.Channel()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ch.QueueDelete("notifications.sms", false, false, false)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ch.QueueDeclare("notifications.sms", true, false, false, false, amqp.Table{"x-dead-letter-exchange": "notifications.sms.dlx"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ch.QueueBind("notifications.sms", "notification.sms", "notifications", false, nil)).To(Succeed())
+			for _, id := range []string{"m1", "m2"} {
+				Expect(ch.Publish("notifications", "notification.sms", false, false, amqp.Publishing{
+					MessageId: id,
+					Headers:   amqp.Table{"x-retry-count": 1},
+					Body:      []byte(`{"content":"hi"}`),
+				})).To(Succeed())
+			}
+			Eventually(queueLength("notifications.sms")).Should(Equal(2))
+
+			broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		AfterEach(func() {
+			conn.Close()
+		})
+
+		It("declares it again with priorities and keeps its messages", func() {
+			info, ok := server.Queue("notifications.sms")
+			Expect(ok).To(BeTrue())
+			Expect(info.Arguments).To(HaveKey("x-max-priority"))
+			Expect(server.QueueNames()).ToNot(ContainElement("notifications.sms.migration"))
+
+			for _, id := range []string{"m1", "m2"} {
+				event := read()
+				Expect(event.MessageId).To(Equal(id))
+				Expect(event.RetryCount).To(Equal(1))
+				Expect(broker.Ack(event)).To(Succeed())
+			}
+
+			send("sms", types.PriorityNormal, `{"content":"new"}`)
+			Expect(read().Payload).To(MatchJSON(`{"content":"new"}`))
+		})
+	})
+
+	Context("with an interrupted migration", func() {
+		JustBeforeEach(func() {
+			broker.Close()
+
+			conn, err := amqp.Dial(server.URI())
+			Expect(err).ToNot(HaveOccurred())
+			defer conn.Close()
+			ch, err := conn.Channel()
+			Expect(err).ToNot(HaveOccurred())
+			_, err = ch.QueueDeclare("notifications.sms.migration", true, false, false, false, nil)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(ch.QueueBind("notifications.sms.migration", "notification.sms", "notifications", false, nil)).To(Succeed())
+			Expect(ch.Publish("", "notifications.sms.migration", false, false, amqp.Publishing{MessageId: "m1", Body: []byte(`{"content":"hi"}`)})).To(Succeed())
+			Eventually(queueLength("notifications.sms.migration")).Should(Equal(1))
+
+			broker, err = rabbitmq.NewRabbitMQBroker(config, true)
+			Expect(err).ToNot(HaveOccurred())
+		})
+
+		It("moves the messages of the temporary queue back", func() {
+			Expect(server.QueueNames()).ToNot(ContainElement("notifications.sms.migration"))
+			Expect(read().MessageId).To(Equal("m1"))
+		})
+	})
+
+	for _, backend := range []struct {
+		name   string
+		plugin bool
+		// exchange is the delayed exchange the backend is expected to declare
+		exchange bool
+	}{
+		{name: rabbitmq.DelayBackendPlugin, plugin: true, exchange: true},
+		{name: rabbitmq.DelayBackendWheel},
+		{name: rabbitmq.DelayBackendAuto, plugin: true, exchange: true},
+		{name: rabbitmq.DelayBackendAuto},
+	} {
+		backend := backend
+
+		Context(fmt.Sprintf("with the %s delay backend and plugin enabled %v", backend.name, backend.plugin), func() {
+			BeforeEach(func() {
+				serverConfig.DelayedMessageExchange = backend.plugin
+				config.DelayBackend = backend.name
+			})
+
+			It("retries after the backoff", func() {
+				_, ok := server.ExchangeType("notifications.delayed")
+				Expect(ok).To(Equal(backend.exchange))
+				Expect(server.QueueNames()).ToNot(ContainElement("notifications.email.retry.1"))
+
+				Expect(broker.Send(ctx, types.Message{ID: "msg-1", Channel: "email", Priority: types.PriorityHigh, Payload: []byte(`{"content":"hi"}`)})).To(Succeed())
+				event := read()
+				Expect(event.MessageId).To(Equal("msg-1"))
+				Expect(broker.Nack(event, errors.New("smtp down"))).To(Equal(types.OutcomeRetrying))
+
+				event = read()
+				Expect(event.RetryCount).To(Equal(1))
+				Expect(event.Priority).To(Equal(types.PriorityHigh))
+				Expect(event.MessageId).To(Equal("msg-1"))
+				Expect(broker.Ack(event)).To(Succeed())
+			})
+		})
+	}
+})
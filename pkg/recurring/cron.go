@@ -0,0 +1,69 @@
+package recurring
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// the timezones are embedded, the api images may not have a zoneinfo database
+	_ "time/tzdata"
+
+	"github.com/robfig/cron/v3"
+)
+
+// parser accepts the standard 5 field expressions and the descriptors like @daily
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// Cron is a cron expression evaluated in a timezone
+type Cron struct {
+	schedule *cron.SpecSchedule
+	location *time.Location
+}
+
+// ParseCron parses a standard 5 field cron expression, e.g. "0 9 * * 1-5", in the IANA timezone,
+// e.g. Europe/Sofia, an empty timezone is UTC
+func ParseCron(expression, timezone string) (Cron, error) {
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return Cron{}, fmt.Errorf("unknown timezone %q", timezone)
+	}
+	expression = strings.TrimSpace(expression)
+	if strings.HasPrefix(expression, "TZ=") || strings.HasPrefix(expression, "CRON_TZ=") {
+		return Cron{}, fmt.Errorf("the timezone of the cron expression is set by the timezone field")
+	}
+
+	parsed, err := parser.Parse(expression)
+	if err != nil {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: %v", expression, err)
+	}
+	// @every runs at intervals which have nothing to do with the calendar or the timezone
+	schedule, ok := parsed.(*cron.SpecSchedule)
+	if !ok {
+		return Cron{}, fmt.Errorf("invalid cron expression %q: @every is not supported", expression)
+	}
+
+	c := Cron{schedule: schedule, location: location}
+	if c.Next(time.Now()).IsZero() {
+		return Cron{}, fmt.Errorf("the cron expression %q never runs", expression)
+	}
+	return c, nil
+}
+
+// Next returns the first run after the time in the timezone of the expression, or the zero time when
+// the expression has no run within the next five years
+func (c Cron) Next(after time.Time) time.Time {
+	// a spec schedule without a location of its own runs in the location of the time
+	return c.schedule.Next(after.In(c.location))
+}
+
+// NextRuns returns up to n runs after the time
+func (c Cron) NextRuns(after time.Time, n int) []time.Time {
+	runs := make([]time.Time, 0, n)
+	for len(runs) < n {
+		after = c.Next(after)
+		if after.IsZero() {
+			break
+		}
+		runs = append(runs, after)
+	}
+	return runs
+}
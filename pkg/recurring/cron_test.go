@@ -0,0 +1,53 @@
+package recurring_test
+
+import (
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Cron", func() {
+	sofia, _ := time.LoadLocation("Europe/Sofia")
+
+	It("runs in the timezone of the expression", func() {
+		cron, err := recurring.ParseCron("0 9 * * 1-5", "Europe/Sofia")
+		Expect(err).NotTo(HaveOccurred())
+
+		// a friday after 09:00
+		runs := cron.NextRuns(time.Date(2026, 10, 16, 10, 0, 0, 0, sofia), 3)
+		Expect(runs).To(HaveLen(3))
+		Expect(runs[0]).To(BeTemporally("==", time.Date(2026, 10, 19, 9, 0, 0, 0, sofia)))
+		Expect(runs[1]).To(BeTemporally("==", time.Date(2026, 10, 20, 9, 0, 0, 0, sofia)))
+		Expect(runs[2]).To(BeTemporally("==", time.Date(2026, 10, 21, 9, 0, 0, 0, sofia)))
+		Expect(runs[0].Location()).To(Equal(sofia))
+	})
+
+	It("keeps the local time across daylight saving changes", func() {
+		cron, err := recurring.ParseCron("0 9 * * *", "Europe/Sofia")
+		Expect(err).NotTo(HaveOccurred())
+
+		// the clocks go back on 25 october
+		runs := cron.NextRuns(time.Date(2026, 10, 24, 10, 0, 0, 0, time.UTC), 1)
+		Expect(runs[0].UTC()).To(Equal(time.Date(2026, 10, 25, 7, 0, 0, 0, time.UTC)))
+	})
+
+	It("runs in UTC without a timezone", func() {
+		cron, err := recurring.ParseCron("@daily", "")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cron.Next(time.Date(2026, 10, 16, 10, 0, 0, 0, time.UTC))).To(BeTemporally("==", time.Date(2026, 10, 17, 0, 0, 0, 0, time.UTC)))
+	})
+
+	DescribeTable("rejects", func(expression, timezone, message string) {
+		_, err := recurring.ParseCron(expression, timezone)
+		Expect(err).To(MatchError(ContainSubstring(message)))
+	},
+		Entry("an unknown timezone", "0 9 * * *", "Europe/Atlantis", `unknown timezone "Europe/Atlantis"`),
+		Entry("an expression with seconds", "0 0 9 * * *", "", "invalid cron expression"),
+		Entry("an out of range field", "0 25 * * *", "", "invalid cron expression"),
+		Entry("an interval", "@every 1m", "", "@every is not supported"),
+		Entry("a timezone in the expression", "CRON_TZ=Europe/Sofia 0 9 * * *", "", "set by the timezone field"),
+		Entry("an expression which never runs", "0 9 30 2 *", "", "never runs"),
+	)
+})
@@ -0,0 +1,198 @@
+package recurring
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// occurrenceKey identifies an occurrence, a schedule runs at most once at a time
+type occurrenceKey struct {
+	scheduleID string
+	time       int64
+}
+
+// MemoryStore is a Store kept in the process, it is meant for development and tests
+type MemoryStore struct {
+	mu          sync.Mutex
+	schedules   map[string]Schedule
+	occurrences map[occurrenceKey]Occurrence
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		schedules:   make(map[string]Schedule),
+		occurrences: make(map[occurrenceKey]Occurrence),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule.Version = 1
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Schedule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	schedule, ok := s.schedules[id]
+	if !ok {
+		return Schedule{}, ErrNotFound
+	}
+	return schedule, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, query Query) (Page, error) {
+	s.mu.Lock()
+	var schedules []Schedule
+	for _, schedule := range s.schedules {
+		if (query.Channel == "" || schedule.Channel == query.Channel) && (query.Tenant == "" || schedule.Tenant == query.Tenant) {
+			schedules = append(schedules, schedule)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(schedules, func(i, j int) bool {
+		if !schedules[i].CreatedAt.Equal(schedules[j].CreatedAt) {
+			return schedules[i].CreatedAt.Before(schedules[j].CreatedAt)
+		}
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	page := Page{Schedules: []Schedule{}, Total: len(schedules)}
+	if query.Offset < len(schedules) {
+		page.Schedules = schedules[query.Offset:min(query.Offset+query.Limit, len(schedules))]
+	}
+	return page, nil
+}
+
+func (s *MemoryStore) Update(ctx context.Context, schedule Schedule) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[schedule.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	schedule.Version = current.Version + 1
+	s.schedules[schedule.ID] = schedule
+	return nil
+}
+
+func (s *MemoryStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.schedules[id]; !ok {
+		return ErrNotFound
+	}
+	delete(s.schedules, id)
+	for key := range s.occurrences {
+		if key.scheduleID == id {
+			delete(s.occurrences, key)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Schedule, error) {
+	s.mu.Lock()
+	var due []Schedule
+	for _, schedule := range s.schedules {
+		if !schedule.Paused && !schedule.NextRun.After(now) {
+			due = append(due, schedule)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].NextRun.Before(due[j].NextRun)
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, schedule Schedule, next time.Time, occurrence Occurrence) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.schedules[schedule.ID]
+	if !ok || current.Version != schedule.Version {
+		return false, nil
+	}
+	current.LastRun = occurrence.Time
+	current.NextRun = next
+	current.Version++
+	s.schedules[schedule.ID] = current
+	s.occurrences[occurrenceKey{occurrence.ScheduleID, occurrence.Time.UnixMilli()}] = occurrence
+	return true, nil
+}
+
+func (s *MemoryStore) Abandoned(ctx context.Context, now time.Time, limit int) ([]Occurrence, error) {
+	s.mu.Lock()
+	var abandoned []Occurrence
+	for _, occurrence := range s.occurrences {
+		if occurrence.ClaimedUntil.Before(now) {
+			abandoned = append(abandoned, occurrence)
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Slice(abandoned, func(i, j int) bool {
+		return abandoned[i].Time.Before(abandoned[j].Time)
+	})
+	if len(abandoned) > limit {
+		abandoned = abandoned[:limit]
+	}
+	return abandoned, nil
+}
+
+func (s *MemoryStore) Reclaim(ctx context.Context, occurrence Occurrence, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := occurrenceKey{occurrence.ScheduleID, occurrence.Time.UnixMilli()}
+	current, ok := s.occurrences[key]
+	if !ok || !current.ClaimedUntil.Before(now) {
+		return false, nil
+	}
+	current.ClaimedBy = occurrence.ClaimedBy
+	current.ClaimedUntil = occurrence.ClaimedUntil
+	s.occurrences[key] = current
+	return true, nil
+}
+
+func (s *MemoryStore) Sent(ctx context.Context, occurrence Occurrence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := occurrenceKey{occurrence.ScheduleID, occurrence.Time.UnixMilli()}
+	if current, ok := s.occurrences[key]; ok && current.ClaimedBy == occurrence.ClaimedBy {
+		delete(s.occurrences, key)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, occurrence Occurrence) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := occurrenceKey{occurrence.ScheduleID, occurrence.Time.UnixMilli()}
+	if current, ok := s.occurrences[key]; ok && current.ClaimedBy == occurrence.ClaimedBy {
+		current.ClaimedBy = ""
+		current.ClaimedUntil = time.Time{}
+		s.occurrences[key] = current
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
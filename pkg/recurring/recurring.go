@@ -0,0 +1,125 @@
+package recurring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite3"
+)
+
+var ErrNotFound = errors.New("recurring schedule not found")
+
+// Schedule sends its notification at every run of its cron expression
+type Schedule struct {
+	ID       string `json:"id"`
+	Cron     string `json:"cron"`
+	Timezone string `json:"timezone"`
+	// Channel and Tenant are the ones of the notification, the schedules are listed by them
+	Channel string `json:"channel"`
+	Tenant  string `json:"tenant,omitempty"`
+	// Notification is the request sent at every run, it is opaque to the store
+	Notification []byte `json:"notification"`
+	// Paused schedules are skipped by the runners until they are resumed
+	Paused bool `json:"paused"`
+	// NextRun is the next occurrence to send, an occurrence is claimed by moving it to the following run
+	NextRun time.Time `json:"next_run"`
+	// LastRun is the latest claimed occurrence, zero until the first run
+	LastRun time.Time `json:"last_run"`
+	// Version changes with every write, a claim only succeeds on the version the runner read
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Occurrence is a run of a schedule claimed by a runner, it is kept until its notification is sent
+type Occurrence struct {
+	ScheduleID string    `json:"schedule_id"`
+	Time       time.Time `json:"time"`
+	// NotificationID is fixed when the occurrence is claimed, so an occurrence sent again after its
+	// runner crashed has the same id and is recognized by the deduplication of the service
+	NotificationID string    `json:"notification_id"`
+	Notification   []byte    `json:"notification"`
+	ClaimedBy      string    `json:"claimed_by"`
+	ClaimedUntil   time.Time `json:"claimed_until"`
+}
+
+// Query filters the schedules, empty fields match all of them
+type Query struct {
+	Channel string
+	Tenant  string
+	Offset  int
+	Limit   int
+}
+
+// Page is a page of the schedules ordered by their creation, Total counts all the matching schedules
+type Page struct {
+	Schedules []Schedule
+	Total     int
+}
+
+// Store keeps the schedules and their claimed occurrences, it is shared by all the api replicas
+type Store interface {
+	Create(ctx context.Context, schedule Schedule) error
+	// Get returns the schedule or ErrNotFound
+	Get(ctx context.Context, id string) (Schedule, error)
+	List(ctx context.Context, query Query) (Page, error)
+	// Update replaces the schedule and increments its version, or returns ErrNotFound
+	Update(ctx context.Context, schedule Schedule) error
+	// Delete removes the schedule with its unsent occurrences, or returns ErrNotFound
+	Delete(ctx context.Context, id string) error
+
+	// Due returns up to limit schedules which are not paused and have a next run at or before now
+	Due(ctx context.Context, now time.Time, limit int) ([]Schedule, error)
+	// Claim moves the next run of the schedule to next and stores the occurrence in one step, only when the
+	// schedule still has the version it was read with. It returns false when another runner claimed the
+	// occurrence first or the schedule changed.
+	Claim(ctx context.Context, schedule Schedule, next time.Time, occurrence Occurrence) (bool, error)
+	// Abandoned returns up to limit occurrences whose claim expired before they were sent
+	Abandoned(ctx context.Context, now time.Time, limit int) ([]Occurrence, error)
+	// Reclaim claims an abandoned occurrence for occurrence.ClaimedBy until occurrence.ClaimedUntil,
+	// it returns false when another runner reclaimed it first
+	Reclaim(ctx context.Context, occurrence Occurrence, now time.Time) (bool, error)
+	// Sent removes the occurrence once its notification is sent
+	Sent(ctx context.Context, occurrence Occurrence) error
+	// Release gives up the claim of the occurrence, so any runner sends it with its next poll
+	Release(ctx context.Context, occurrence Occurrence) error
+	Close() error
+}
+
+// Open creates the store selected by kind, it returns a nil store when kind is empty. The sql
+// drivers have to be registered by the binary. The memory store is only shared within the process.
+func Open(ctx context.Context, kind, dsn string) (Store, error) {
+	var dialect sqldialect.Dialect
+	switch kind {
+	case "":
+		return nil, nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		dialect = sqldialect.Postgres
+	case StoreSQLite:
+		dialect = sqldialect.SQLite
+	default:
+		return nil, fmt.Errorf("unknown recurring store: %s", kind)
+	}
+
+	db, err := sql.Open(kind, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open recurring store: %v", err)
+	}
+	store := NewSQLStore(db, dialect)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
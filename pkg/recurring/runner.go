@@ -0,0 +1,151 @@
+package recurring
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// SendFunc sends the notification of an occurrence, an occurrence which fails is sent again with the next poll
+type SendFunc func(ctx context.Context, occurrence Occurrence) error
+
+type RunnerConfig struct {
+	// ID identifies the runner in the occurrences it claimed, defaults to the hostname and pid
+	ID string
+	// BatchSize is the number of due schedules and abandoned occurrences read by a poll
+	BatchSize int
+	// PollInterval is the time between polls, it is the precision of the runs
+	PollInterval time.Duration
+	// ClaimTimeout is how long claimed occurrences are reserved, occurrences of a runner which crashed
+	// are taken over by the others afterwards
+	ClaimTimeout time.Duration
+}
+
+// Runner sends the occurrences of the due schedules. Any number of runners can share a store, an occurrence
+// is claimed by a single runner which moves the next run of its schedule from the version it read. A claimed
+// occurrence is only sent again when its runner crashed or exceeded the claim timeout before it was sent,
+// the copy has the same notification id.
+type Runner struct {
+	store  Store
+	send   SendFunc
+	config RunnerConfig
+}
+
+func NewRunner(store Store, send SendFunc, config RunnerConfig) *Runner {
+	if config.ID == "" {
+		hostname, _ := os.Hostname()
+		config.ID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.ClaimTimeout <= 0 {
+		config.ClaimTimeout = time.Minute
+	}
+
+	return &Runner{
+		store:  store,
+		send:   send,
+		config: config,
+	}
+}
+
+// Run sends the occurrences until the context is done
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to run recurring schedules: %v", err)
+		}
+
+		select {
+		case <-time.After(r.config.PollInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce sends the abandoned occurrences and claims and sends the occurrences of the due schedules,
+// it returns the number of sent occurrences
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	sent := 0
+
+	abandoned, err := r.store.Abandoned(ctx, now, r.config.BatchSize)
+	if err != nil {
+		return sent, err
+	}
+	for _, occurrence := range abandoned {
+		occurrence.ClaimedBy = r.config.ID
+		occurrence.ClaimedUntil = now.Add(r.config.ClaimTimeout)
+		claimed, err := r.store.Reclaim(ctx, occurrence, now)
+		if err != nil {
+			return sent, err
+		}
+		if claimed && r.sendOccurrence(ctx, occurrence) {
+			sent++
+		}
+	}
+
+	due, err := r.store.Due(ctx, now, r.config.BatchSize)
+	if err != nil {
+		return sent, err
+	}
+	for _, schedule := range due {
+		cron, err := ParseCron(schedule.Cron, schedule.Timezone)
+		if err != nil {
+			logrus.Errorf("skipping recurring schedule %s: %v", schedule.ID, err)
+			continue
+		}
+		// the runs missed while no runner was running are sent once, as the occurrence of the next run
+		next := cron.Next(now)
+		if next.IsZero() {
+			logrus.Errorf("skipping recurring schedule %s: it has no run after %s", schedule.ID, now)
+			continue
+		}
+
+		occurrence := Occurrence{
+			ScheduleID:     schedule.ID,
+			Time:           schedule.NextRun,
+			NotificationID: types.NewMessageID(),
+			Notification:   schedule.Notification,
+			ClaimedBy:      r.config.ID,
+			ClaimedUntil:   now.Add(r.config.ClaimTimeout),
+		}
+		claimed, err := r.store.Claim(ctx, schedule, next, occurrence)
+		if err != nil {
+			return sent, err
+		}
+		if claimed && r.sendOccurrence(ctx, occurrence) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendOccurrence sends a claimed occurrence and removes it, an occurrence which fails is released
+func (r *Runner) sendOccurrence(ctx context.Context, occurrence Occurrence) bool {
+	if err := r.send(ctx, occurrence); err != nil {
+		logrus.Errorf("failed to send occurrence %s of recurring schedule %s: %v", occurrence.Time, occurrence.ScheduleID, err)
+		// the context of the poll may be done already
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.store.Release(releaseCtx, occurrence); err != nil {
+			logrus.Errorf("failed to release occurrence %s of recurring schedule %s: %v", occurrence.Time, occurrence.ScheduleID, err)
+		}
+		return false
+	}
+
+	if err := r.store.Sent(ctx, occurrence); err != nil {
+		// the claim expires and another runner sends it again, the copy is dropped by the deduplication
+		logrus.Errorf("failed to remove occurrence %s of recurring schedule %s: %v", occurrence.Time, occurrence.ScheduleID, err)
+	}
+	return true
+}
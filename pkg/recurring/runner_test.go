@@ -0,0 +1,114 @@
+package recurring_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runner", func() {
+	var (
+		store recurring.Store
+		ctx   context.Context
+		mu    sync.Mutex
+		sent  []recurring.Occurrence
+		fail  bool
+	)
+
+	send := func(ctx context.Context, occurrence recurring.Occurrence) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("connection closed")
+		}
+		sent = append(sent, occurrence)
+		return nil
+	}
+
+	runner := func(id string) *recurring.Runner {
+		return recurring.NewRunner(store, send, recurring.RunnerConfig{ID: id, ClaimTimeout: time.Minute})
+	}
+
+	BeforeEach(func() {
+		store = openSQLite()
+		ctx = context.Background()
+		sent = nil
+		fail = false
+		DeferCleanup(store.Close)
+
+		now := time.Now()
+		Expect(store.Create(ctx, recurring.Schedule{
+			ID:           "s1",
+			Cron:         "0 9 * * *",
+			Timezone:     "Europe/Sofia",
+			Channel:      "sms",
+			Notification: []byte(`{"channel":"sms","content":"Standup in 15 minutes"}`),
+			// missed for two days
+			NextRun:   now.Add(-48 * time.Hour),
+			CreatedAt: now,
+			UpdatedAt: now,
+		})).To(Succeed())
+	})
+
+	It("sends an occurrence once with any number of runners", func() {
+		var wg sync.WaitGroup
+		for _, id := range []string{"api-1", "api-2", "api-3", "api-4"} {
+			r := runner(id)
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					_, err := r.RunOnce(ctx)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(sent).To(HaveLen(1))
+		Expect(string(sent[0].Notification)).To(ContainSubstring("Standup in 15 minutes"))
+		Expect(sent[0].NotificationID).NotTo(BeEmpty())
+
+		// the missed runs are sent once, the next run is the upcoming one
+		s, err := store.Get(ctx, "s1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(s.NextRun).To(BeTemporally(">", time.Now()))
+		Expect(s.NextRun).To(BeTemporally("<=", time.Now().Add(24*time.Hour)))
+		Expect(store.Abandoned(ctx, time.Now().Add(time.Hour), 10)).To(BeEmpty())
+	})
+
+	It("sends a failed occurrence again with the same notification id", func() {
+		fail = true
+		n, err := runner("api-1").RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+
+		abandoned, err := store.Abandoned(ctx, time.Now(), 10)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(abandoned).To(HaveLen(1))
+
+		fail = false
+		n, err = runner("api-2").RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(sent).To(HaveLen(1))
+		Expect(sent[0].NotificationID).To(Equal(abandoned[0].NotificationID))
+		Expect(sent[0].ClaimedBy).To(Equal("api-2"))
+	})
+
+	It("skips paused schedules", func() {
+		s, err := store.Get(ctx, "s1")
+		Expect(err).NotTo(HaveOccurred())
+		s.Paused = true
+		Expect(store.Update(ctx, s)).To(Succeed())
+
+		Expect(runner("api-1").RunOnce(ctx)).To(BeZero())
+		Expect(sent).To(BeEmpty())
+	})
+})
@@ -0,0 +1,355 @@
+package recurring
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	schedulesTable   = "recurring_schedules"
+	occurrencesTable = "recurring_occurrences"
+
+	scheduleColumns   = "id, cron, timezone, channel, tenant, notification, paused, next_run, last_run, version, created_at, updated_at"
+	occurrenceColumns = "schedule_id, time, notification_id, notification, claimed_by, claimed_until"
+)
+
+// SQLStore is a Store in a postgres or sqlite database shared by the api replicas. All the times are
+// stored as unix milliseconds, a zero time as 0.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqldialect.Dialect
+}
+
+func NewSQLStore(db *sql.DB, dialect sqldialect.Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// Migrate creates the tables of the store when they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	switch s.dialect {
+	case sqldialect.Postgres, sqldialect.SQLite:
+	default:
+		return fmt.Errorf("unsupported recurring store dialect: %s", s.dialect)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + schedulesTable + ` (
+			id           TEXT PRIMARY KEY,
+			cron         TEXT NOT NULL,
+			timezone     TEXT NOT NULL,
+			channel      TEXT NOT NULL,
+			tenant       TEXT NOT NULL,
+			notification TEXT NOT NULL,
+			paused       BOOLEAN NOT NULL,
+			next_run     BIGINT NOT NULL,
+			last_run     BIGINT NOT NULL,
+			version      BIGINT NOT NULL,
+			created_at   BIGINT NOT NULL,
+			updated_at   BIGINT NOT NULL
+		)`,
+		// an occurrence is only inserted by the runner which moved the next run of its schedule
+		`CREATE TABLE IF NOT EXISTS ` + occurrencesTable + ` (
+			schedule_id     TEXT NOT NULL,
+			time            BIGINT NOT NULL,
+			notification_id TEXT NOT NULL,
+			notification    TEXT NOT NULL,
+			claimed_by      TEXT NOT NULL,
+			claimed_until   BIGINT NOT NULL,
+			PRIMARY KEY (schedule_id, time)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + schedulesTable + `_next_run ON ` + schedulesTable + ` (next_run)`,
+		`CREATE INDEX IF NOT EXISTS ` + schedulesTable + `_created ON ` + schedulesTable + ` (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS ` + occurrencesTable + `_claimed ON ` + occurrencesTable + ` (claimed_until)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate recurring store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, schedule Schedule) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"INSERT INTO "+schedulesTable+" ("+scheduleColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, 1, ?, ?)"),
+		schedule.ID, schedule.Cron, schedule.Timezone, schedule.Channel, schedule.Tenant, string(schedule.Notification),
+		schedule.Paused, millis(schedule.NextRun), millis(schedule.LastRun), millis(schedule.CreatedAt), millis(schedule.UpdatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert recurring schedule: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Schedule, error) {
+	schedule, err := scanSchedule(s.db.QueryRowContext(ctx, s.dialect.Rebind(
+		"SELECT "+scheduleColumns+" FROM "+schedulesTable+" WHERE id = ?"), id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schedule{}, ErrNotFound
+	}
+	if err != nil {
+		return Schedule{}, fmt.Errorf("failed to get recurring schedule: %v", err)
+	}
+	return schedule, nil
+}
+
+func (s *SQLStore) List(ctx context.Context, query Query) (Page, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if query.Channel != "" {
+		conditions = append(conditions, "channel = ?")
+		args = append(args, query.Channel)
+	}
+	if query.Tenant != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, query.Tenant)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := Page{Schedules: []Schedule{}}
+	if err := s.db.QueryRowContext(ctx, s.dialect.Rebind("SELECT COUNT(*) FROM "+schedulesTable+where), args...).Scan(&page.Total); err != nil {
+		return Page{}, fmt.Errorf("failed to count recurring schedules: %v", err)
+	}
+
+	schedules, err := s.querySchedules(ctx, "SELECT "+scheduleColumns+" FROM "+schedulesTable+where+" ORDER BY created_at, id LIMIT ? OFFSET ?",
+		append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to list recurring schedules: %v", err)
+	}
+	page.Schedules = append(page.Schedules, schedules...)
+	return page, nil
+}
+
+func (s *SQLStore) Update(ctx context.Context, schedule Schedule) error {
+	result, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+schedulesTable+" SET cron = ?, timezone = ?, channel = ?, tenant = ?, notification = ?, paused = ?, next_run = ?, version = version + 1, updated_at = ? WHERE id = ?"),
+		schedule.Cron, schedule.Timezone, schedule.Channel, schedule.Tenant, string(schedule.Notification),
+		schedule.Paused, millis(schedule.NextRun), millis(schedule.UpdatedAt), schedule.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update recurring schedule: %v", err)
+	}
+	return found(result)
+}
+
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, s.dialect.Rebind("DELETE FROM "+schedulesTable+" WHERE id = ?"), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete recurring schedule: %v", err)
+		}
+		if err := found(result); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.dialect.Rebind("DELETE FROM "+occurrencesTable+" WHERE schedule_id = ?"), id); err != nil {
+			return fmt.Errorf("failed to delete recurring occurrences: %v", err)
+		}
+		return nil
+	})
+}
+
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]Schedule, error) {
+	schedules, err := s.querySchedules(ctx, "SELECT "+scheduleColumns+" FROM "+schedulesTable+" WHERE NOT paused AND next_run <= ? ORDER BY next_run LIMIT ?",
+		millis(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due recurring schedules: %v", err)
+	}
+	return schedules, nil
+}
+
+func (s *SQLStore) Claim(ctx context.Context, schedule Schedule, next time.Time, occurrence Occurrence) (bool, error) {
+	claimed := false
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, s.dialect.Rebind(
+			"UPDATE "+schedulesTable+" SET next_run = ?, last_run = ?, version = version + 1 WHERE id = ? AND version = ?"),
+			millis(next), millis(occurrence.Time), schedule.ID, schedule.Version,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim recurring schedule: %v", err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to claim recurring schedule: %v", err)
+		}
+		if n != 1 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind(
+			"INSERT INTO "+occurrencesTable+" ("+occurrenceColumns+") VALUES (?, ?, ?, ?, ?, ?)"),
+			occurrence.ScheduleID, millis(occurrence.Time), occurrence.NotificationID, string(occurrence.Notification),
+			occurrence.ClaimedBy, millis(occurrence.ClaimedUntil),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert recurring occurrence: %v", err)
+		}
+		claimed = true
+		return nil
+	})
+	return claimed, err
+}
+
+func (s *SQLStore) Abandoned(ctx context.Context, now time.Time, limit int) ([]Occurrence, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(
+		"SELECT "+occurrenceColumns+" FROM "+occurrencesTable+" WHERE claimed_until < ? ORDER BY time LIMIT ?"),
+		millis(now), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select abandoned recurring occurrences: %v", err)
+	}
+	defer rows.Close()
+
+	var occurrences []Occurrence
+	for rows.Next() {
+		var (
+			o               Occurrence
+			t, claimedUntil int64
+			notification    string
+		)
+		if err := rows.Scan(&o.ScheduleID, &t, &o.NotificationID, &notification, &o.ClaimedBy, &claimedUntil); err != nil {
+			return nil, fmt.Errorf("failed to read recurring occurrence: %v", err)
+		}
+		o.Time = fromMillis(t)
+		o.Notification = []byte(notification)
+		o.ClaimedUntil = fromMillis(claimedUntil)
+		occurrences = append(occurrences, o)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read recurring occurrences: %v", err)
+	}
+	return occurrences, nil
+}
+
+func (s *SQLStore) Reclaim(ctx context.Context, occurrence Occurrence, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+occurrencesTable+" SET claimed_by = ?, claimed_until = ? WHERE schedule_id = ? AND time = ? AND claimed_until < ?"),
+		occurrence.ClaimedBy, millis(occurrence.ClaimedUntil), occurrence.ScheduleID, millis(occurrence.Time), millis(now),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reclaim recurring occurrence: %v", err)
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1, err
+}
+
+func (s *SQLStore) Sent(ctx context.Context, occurrence Occurrence) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"DELETE FROM "+occurrencesTable+" WHERE schedule_id = ? AND time = ? AND claimed_by = ?"),
+		occurrence.ScheduleID, millis(occurrence.Time), occurrence.ClaimedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete recurring occurrence: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Release(ctx context.Context, occurrence Occurrence) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+occurrencesTable+" SET claimed_by = '', claimed_until = 0 WHERE schedule_id = ? AND time = ? AND claimed_by = ?"),
+		occurrence.ScheduleID, millis(occurrence.Time), occurrence.ClaimedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release recurring occurrence: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanSchedule reads the scheduleColumns of a row
+func scanSchedule(row scanner) (Schedule, error) {
+	var (
+		schedule                               Schedule
+		notification                           string
+		nextRun, lastRun, createdAt, updatedAt int64
+	)
+	err := row.Scan(&schedule.ID, &schedule.Cron, &schedule.Timezone, &schedule.Channel, &schedule.Tenant, &notification,
+		&schedule.Paused, &nextRun, &lastRun, &schedule.Version, &createdAt, &updatedAt)
+	if err != nil {
+		return Schedule{}, err
+	}
+	schedule.Notification = []byte(notification)
+	schedule.NextRun = fromMillis(nextRun)
+	schedule.LastRun = fromMillis(lastRun)
+	schedule.CreatedAt = fromMillis(createdAt)
+	schedule.UpdatedAt = fromMillis(updatedAt)
+	return schedule, nil
+}
+
+func (s *SQLStore) querySchedules(ctx context.Context, statement string, args ...interface{}) ([]Schedule, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var schedules []Schedule
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// found returns ErrNotFound when the statement affected no row
+func found(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
@@ -0,0 +1,196 @@
+package recurring_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/recurring"
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// openSQLite opens a migrated store in a temporary sqlite database
+func openSQLite() recurring.Store {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(GinkgoT().TempDir(), "recurring.db")+"?_busy_timeout=5000&_txlock=immediate")
+	Expect(err).NotTo(HaveOccurred())
+	store := recurring.NewSQLStore(db, sqldialect.SQLite)
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	// migrating twice is a no-op
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	return store
+}
+
+var _ = Describe("Store", func() {
+	for _, backend := range []struct {
+		name string
+		open func() recurring.Store
+	}{
+		{name: "memory", open: func() recurring.Store { return recurring.NewMemoryStore() }},
+		{name: "sqlite", open: openSQLite},
+	} {
+		backend := backend
+
+		Context("with the "+backend.name+" store", func() {
+			var (
+				store recurring.Store
+				ctx   context.Context
+				start time.Time
+			)
+
+			at := func(seconds int) time.Time {
+				return start.Add(time.Duration(seconds) * time.Second)
+			}
+
+			schedule := func(id, tenant string, nextRun time.Time) recurring.Schedule {
+				return recurring.Schedule{
+					ID:           id,
+					Cron:         "* * * * *",
+					Channel:      "sms",
+					Tenant:       tenant,
+					Notification: []byte(`{"channel":"sms"}`),
+					NextRun:      nextRun,
+					CreatedAt:    nextRun,
+					UpdatedAt:    nextRun,
+				}
+			}
+
+			BeforeEach(func() {
+				store = backend.open()
+				ctx = context.Background()
+				start = time.UnixMilli(time.Now().UnixMilli())
+			})
+
+			AfterEach(func() {
+				store.Close()
+			})
+
+			It("keeps the schedules", func() {
+				Expect(store.Create(ctx, schedule("s1", "acme", at(0)))).To(Succeed())
+				Expect(store.Create(ctx, schedule("s2", "globex", at(1)))).To(Succeed())
+				Expect(store.Create(ctx, schedule("s3", "acme", at(2)))).To(Succeed())
+
+				s, err := store.Get(ctx, "s1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s.Tenant).To(Equal("acme"))
+				Expect(string(s.Notification)).To(Equal(`{"channel":"sms"}`))
+				Expect(s.NextRun).To(BeTemporally("==", at(0)))
+				Expect(s.LastRun.IsZero()).To(BeTrue())
+				Expect(s.Version).To(Equal(int64(1)))
+
+				page, err := store.List(ctx, recurring.Query{Tenant: "acme", Limit: 10})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(page.Total).To(Equal(2))
+				Expect(page.Schedules).To(HaveLen(2))
+				Expect(page.Schedules[0].ID).To(Equal("s1"))
+				Expect(page.Schedules[1].ID).To(Equal("s3"))
+
+				page, err = store.List(ctx, recurring.Query{Offset: 1, Limit: 1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(page.Total).To(Equal(3))
+				Expect(page.Schedules[0].ID).To(Equal("s2"))
+
+				s.Paused = true
+				Expect(store.Update(ctx, s)).To(Succeed())
+				s, err = store.Get(ctx, "s1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s.Paused).To(BeTrue())
+				Expect(s.Version).To(Equal(int64(2)))
+
+				Expect(store.Delete(ctx, "s1")).To(Succeed())
+				_, err = store.Get(ctx, "s1")
+				Expect(err).To(MatchError(recurring.ErrNotFound))
+				Expect(store.Delete(ctx, "s1")).To(MatchError(recurring.ErrNotFound))
+				Expect(store.Update(ctx, s)).To(MatchError(recurring.ErrNotFound))
+			})
+
+			It("returns the due schedules which are not paused", func() {
+				Expect(store.Create(ctx, schedule("due", "", at(0)))).To(Succeed())
+				Expect(store.Create(ctx, schedule("later", "", at(60)))).To(Succeed())
+				paused := schedule("paused", "", at(0))
+				paused.Paused = true
+				Expect(store.Create(ctx, paused)).To(Succeed())
+
+				due, err := store.Due(ctx, at(1), 10)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(due).To(HaveLen(1))
+				Expect(due[0].ID).To(Equal("due"))
+			})
+
+			It("claims an occurrence once", func() {
+				Expect(store.Create(ctx, schedule("s1", "", at(0)))).To(Succeed())
+				due, err := store.Due(ctx, at(1), 10)
+				Expect(err).NotTo(HaveOccurred())
+
+				occurrence := recurring.Occurrence{ScheduleID: "s1", Time: at(0), NotificationID: "n1", Notification: []byte("{}"), ClaimedBy: "runner-1", ClaimedUntil: at(60)}
+				claimed, err := store.Claim(ctx, due[0], at(60), occurrence)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(claimed).To(BeTrue())
+
+				// a second runner read the same version
+				occurrence.ClaimedBy = "runner-2"
+				claimed, err = store.Claim(ctx, due[0], at(60), occurrence)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(claimed).To(BeFalse())
+
+				s, err := store.Get(ctx, "s1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(s.NextRun).To(BeTemporally("==", at(60)))
+				Expect(s.LastRun).To(BeTemporally("==", at(0)))
+			})
+
+			It("hands abandoned occurrences over to another runner", func() {
+				Expect(store.Create(ctx, schedule("s1", "", at(0)))).To(Succeed())
+				due, err := store.Due(ctx, at(1), 10)
+				Expect(err).NotTo(HaveOccurred())
+				occurrence := recurring.Occurrence{ScheduleID: "s1", Time: at(0), NotificationID: "n1", Notification: []byte("{}"), ClaimedBy: "runner-1", ClaimedUntil: at(60)}
+				_, err = store.Claim(ctx, due[0], at(60), occurrence)
+				Expect(err).NotTo(HaveOccurred())
+
+				abandoned, err := store.Abandoned(ctx, at(30), 10)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(abandoned).To(BeEmpty())
+
+				abandoned, err = store.Abandoned(ctx, at(61), 10)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(abandoned).To(HaveLen(1))
+				Expect(abandoned[0].NotificationID).To(Equal("n1"))
+
+				reclaimed := abandoned[0]
+				reclaimed.ClaimedBy = "runner-2"
+				reclaimed.ClaimedUntil = at(120)
+				ok, err := store.Reclaim(ctx, reclaimed, at(61))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeTrue())
+				ok, err = store.Reclaim(ctx, reclaimed, at(61))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(ok).To(BeFalse())
+
+				// the first runner lost its claim
+				Expect(store.Sent(ctx, occurrence)).To(Succeed())
+				Expect(store.Abandoned(ctx, at(121), 10)).To(HaveLen(1))
+				Expect(store.Sent(ctx, reclaimed)).To(Succeed())
+				Expect(store.Abandoned(ctx, at(121), 10)).To(BeEmpty())
+			})
+
+			It("releases an occurrence to any runner", func() {
+				Expect(store.Create(ctx, schedule("s1", "", at(0)))).To(Succeed())
+				due, err := store.Due(ctx, at(1), 10)
+				Expect(err).NotTo(HaveOccurred())
+				occurrence := recurring.Occurrence{ScheduleID: "s1", Time: at(0), NotificationID: "n1", Notification: []byte("{}"), ClaimedBy: "runner-1", ClaimedUntil: at(60)}
+				_, err = store.Claim(ctx, due[0], at(60), occurrence)
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(store.Release(ctx, occurrence)).To(Succeed())
+				Expect(store.Abandoned(ctx, at(1), 10)).To(HaveLen(1))
+
+				// deleting the schedule drops its unsent occurrences
+				Expect(store.Delete(ctx, "s1")).To(Succeed())
+				Expect(store.Abandoned(ctx, at(1), 10)).To(BeEmpty())
+			})
+		})
+	}
+})
@@ -0,0 +1,13 @@
+package recurring_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestRecurring(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Recurring Suite")
+}
@@ -0,0 +1,62 @@
+package retry
+
+import (
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// defaultMaxAttempts is the RETRY_MAX_ATTEMPTS when neither it nor RABBITMQ_MAX_RETRIES is set,
+// the first delivery and the 3 retries RABBITMQ_MAX_RETRIES defaulted to
+const defaultMaxAttempts = 4
+
+// Env is the retry configuration shared by the binaries, it is embedded in their env config
+type Env struct {
+	RetryInitialDelay time.Duration `envconfig:"RETRY_INITIAL_DELAY" default:"1s"`
+	RetryMultiplier   float64       `envconfig:"RETRY_MULTIPLIER" default:"2"`
+	RetryMaxDelay     time.Duration `envconfig:"RETRY_MAX_DELAY" default:"1m"`
+	RetryJitter       string        `envconfig:"RETRY_JITTER" default:"none"`
+	RetryMaxAttempts  *int          `envconfig:"RETRY_MAX_ATTEMPTS"`
+	RetryMaxAge       time.Duration `envconfig:"RETRY_MAX_AGE" default:"0"`
+	// RetryPolicyOverrides are per channel retry policies in JSON, e.g. {"sms":{"initial_delay":"5s"}}
+	RetryPolicyOverrides Overrides `envconfig:"RETRY_POLICY_OVERRIDES"`
+
+	// RabbitMQMaxRetries is the deprecated RABBITMQ_MAX_RETRIES, its retries plus the first delivery are
+	// used as RETRY_MAX_ATTEMPTS when that is not set
+	RabbitMQMaxRetries *int `envconfig:"RABBITMQ_MAX_RETRIES"`
+}
+
+// RetryPolicies returns the configured default retry policy with its per channel overrides
+func (e Env) RetryPolicies() Policies {
+	maxAttempts := defaultMaxAttempts
+	if e.RabbitMQMaxRetries != nil {
+		maxAttempts = *e.RabbitMQMaxRetries + 1
+	}
+	if e.RetryMaxAttempts != nil {
+		maxAttempts = *e.RetryMaxAttempts
+	}
+
+	return Policies{
+		Default: Policy{
+			InitialDelay: e.RetryInitialDelay,
+			Multiplier:   e.RetryMultiplier,
+			MaxDelay:     e.RetryMaxDelay,
+			Jitter:       Jitter(e.RetryJitter),
+			MaxAttempts:  maxAttempts,
+			MaxAge:       e.RetryMaxAge,
+		},
+		Overrides: e.RetryPolicyOverrides,
+	}
+}
+
+// WarnDeprecated logs the deprecated variables which are set
+func (e Env) WarnDeprecated() {
+	if e.RabbitMQMaxRetries == nil {
+		return
+	}
+	if e.RetryMaxAttempts != nil {
+		logrus.Warn("RABBITMQ_MAX_RETRIES is deprecated and ignored as RETRY_MAX_ATTEMPTS is set")
+		return
+	}
+	logrus.Warn("RABBITMQ_MAX_RETRIES is deprecated, use RETRY_MAX_ATTEMPTS instead")
+}
@@ -0,0 +1,41 @@
+package retry_test
+
+import (
+	"os"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	"github.com/kelseyhightower/envconfig"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Env", func() {
+	setenv := func(key, value string) {
+		Expect(os.Setenv(key, value)).To(Succeed())
+		DeferCleanup(os.Unsetenv, key)
+	}
+
+	load := func() retry.Policies {
+		var env retry.Env
+		Expect(envconfig.Process("", &env)).To(Succeed())
+		return env.RetryPolicies()
+	}
+
+	It("should default to 4 attempts", func() {
+		policies := load()
+		Expect(policies.Default.MaxAttempts).To(Equal(4))
+		Expect(policies.Default.InitialDelay).To(Equal(time.Second))
+	})
+
+	It("should fall back to the deprecated RABBITMQ_MAX_RETRIES after the first attempt", func() {
+		setenv("RABBITMQ_MAX_RETRIES", "5")
+		Expect(load().Default.MaxAttempts).To(Equal(6))
+	})
+
+	It("should prefer RETRY_MAX_ATTEMPTS over RABBITMQ_MAX_RETRIES", func() {
+		setenv("RABBITMQ_MAX_RETRIES", "5")
+		setenv("RETRY_MAX_ATTEMPTS", "0")
+		Expect(load().Default.MaxAttempts).To(Equal(0))
+	})
+})
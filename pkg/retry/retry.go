@@ -0,0 +1,173 @@
+package retry
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter strategy applied on top of the exponential delay
+type Jitter string
+
+const (
+	// JitterNone always waits the exact exponential delay
+	JitterNone Jitter = "none"
+	// JitterFull waits a random duration between zero and the exponential delay
+	JitterFull Jitter = "full"
+	// JitterEqual waits half of the exponential delay plus a random duration up to the other half
+	JitterEqual Jitter = "equal"
+)
+
+// Policy describes when and how often a failed notification is retried
+type Policy struct {
+	InitialDelay time.Duration
+	Multiplier   float64
+	MaxDelay     time.Duration
+	Jitter       Jitter
+	// MaxAttempts is the number of deliveries of a notification including the first one, 0 and 1 never retry
+	MaxAttempts int
+	// MaxAge limits the total time since the notification was first published, zero means no limit
+	MaxAge time.Duration
+}
+
+func (p Policy) Validate() error {
+	if p.InitialDelay <= 0 {
+		return fmt.Errorf("initial delay must be positive")
+	}
+	if p.Multiplier < 1 {
+		return fmt.Errorf("multiplier must be at least 1")
+	}
+	if p.MaxDelay < p.InitialDelay {
+		return fmt.Errorf("max delay must not be lower than the initial delay")
+	}
+	if p.MaxAttempts < 0 {
+		return fmt.Errorf("max attempts must not be negative")
+	}
+	if p.MaxAge < 0 {
+		return fmt.Errorf("max age must not be negative")
+	}
+	switch p.Jitter {
+	case JitterNone, JitterFull, JitterEqual:
+	default:
+		return fmt.Errorf("unknown jitter strategy: %s", p.Jitter)
+	}
+	return nil
+}
+
+// Delay returns the exponential delay before the given retry attempt, starting from 1, capped by MaxDelay
+func (p Policy) Delay(attempt int) time.Duration {
+	delay := float64(p.InitialDelay) * math.Pow(p.Multiplier, float64(attempt-1))
+	if delay > float64(p.MaxDelay) {
+		return p.MaxDelay
+	}
+	return time.Duration(delay)
+}
+
+// Backoff returns the delay before the given retry attempt with the jitter strategy applied
+func (p Policy) Backoff(attempt int) time.Duration {
+	delay := p.Delay(attempt)
+
+	switch p.Jitter {
+	case JitterFull:
+		return time.Duration(rand.Int63n(int64(delay) + 1))
+	case JitterEqual:
+		half := delay / 2
+		return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+	default:
+		return delay
+	}
+}
+
+// Exhausted reports whether a notification that already had the given number of retries
+// and was first published at firstSeen must not be retried anymore
+func (p Policy) Exhausted(retries int, firstSeen, now time.Time) bool {
+	// the failed delivery was attempt retries+1
+	if retries+1 >= p.MaxAttempts {
+		return true
+	}
+	if p.MaxAge > 0 && !firstSeen.IsZero() && now.Sub(firstSeen)+p.Delay(retries+1) > p.MaxAge {
+		return true
+	}
+	return false
+}
+
+// UnmarshalJSON only overwrites the fields present in data, which allows
+// decoding a partial per channel override on top of the default policy
+func (p *Policy) UnmarshalJSON(data []byte) error {
+	var fields struct {
+		InitialDelay *string  `json:"initial_delay"`
+		Multiplier   *float64 `json:"multiplier"`
+		MaxDelay     *string  `json:"max_delay"`
+		Jitter       *Jitter  `json:"jitter"`
+		MaxAttempts  *int     `json:"max_attempts"`
+		MaxAge       *string  `json:"max_age"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	durations := []struct {
+		value *string
+		dest  *time.Duration
+	}{
+		{fields.InitialDelay, &p.InitialDelay},
+		{fields.MaxDelay, &p.MaxDelay},
+		{fields.MaxAge, &p.MaxAge},
+	}
+	for _, d := range durations {
+		if d.value == nil {
+			continue
+		}
+		parsed, err := time.ParseDuration(*d.value)
+		if err != nil {
+			return err
+		}
+		*d.dest = parsed
+	}
+
+	if fields.Multiplier != nil {
+		p.Multiplier = *fields.Multiplier
+	}
+	if fields.Jitter != nil {
+		p.Jitter = *fields.Jitter
+	}
+	if fields.MaxAttempts != nil {
+		p.MaxAttempts = *fields.MaxAttempts
+	}
+	return nil
+}
+
+// Overrides holds the per channel policy fields that differ from the default policy, e.g.
+// {"sms":{"initial_delay":"5s","max_attempts":5}}
+type Overrides map[string]json.RawMessage
+
+// Decode implements envconfig.Decoder
+func (o *Overrides) Decode(value string) error {
+	if value == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(value), o)
+}
+
+// Policies resolves the retry policy of every channel
+type Policies struct {
+	Default   Policy
+	Overrides Overrides
+}
+
+// For returns the default policy with the overrides of the channel applied
+func (p Policies) For(channel string) (Policy, error) {
+	policy := p.Default
+	if override, ok := p.Overrides[channel]; ok {
+		if err := json.Unmarshal(override, &policy); err != nil {
+			return Policy{}, fmt.Errorf("invalid retry policy override for %s: %v", channel, err)
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return Policy{}, fmt.Errorf("invalid retry policy for %s: %v", channel, err)
+	}
+	return policy, nil
+}
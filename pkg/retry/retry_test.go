@@ -0,0 +1,118 @@
+package retry_test
+
+import (
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/retry"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Policy", func() {
+	var policy retry.Policy
+
+	BeforeEach(func() {
+		policy = retry.Policy{
+			InitialDelay: time.Second,
+			Multiplier:   2,
+			MaxDelay:     5 * time.Second,
+			Jitter:       retry.JitterNone,
+			MaxAttempts:  5,
+		}
+	})
+
+	It("should grow the delay exponentially up to the max delay", func() {
+		Expect(policy.Delay(1)).To(Equal(time.Second))
+		Expect(policy.Delay(2)).To(Equal(2 * time.Second))
+		Expect(policy.Delay(3)).To(Equal(4 * time.Second))
+		Expect(policy.Delay(4)).To(Equal(5 * time.Second))
+	})
+
+	When("using equal jitter", func() {
+		BeforeEach(func() {
+			policy.Jitter = retry.JitterEqual
+		})
+
+		It("should wait at least half of the delay", func() {
+			for i := 0; i < 100; i++ {
+				Expect(policy.Backoff(2)).To(BeNumerically(">=", time.Second))
+				Expect(policy.Backoff(2)).To(BeNumerically("<=", 2*time.Second))
+			}
+		})
+	})
+
+	When("using full jitter", func() {
+		BeforeEach(func() {
+			policy.Jitter = retry.JitterFull
+		})
+
+		It("should never wait longer than the delay", func() {
+			for i := 0; i < 100; i++ {
+				Expect(policy.Backoff(3)).To(BeNumerically("<=", 4*time.Second))
+			}
+		})
+	})
+
+	It("should be exhausted after max attempts", func() {
+		now := time.Now()
+		// the 4th delivery had 3 retries, the 5th is the last one
+		Expect(policy.Exhausted(3, now, now)).To(BeFalse())
+		Expect(policy.Exhausted(4, now, now)).To(BeTrue())
+
+		policy.MaxAttempts = 1
+		Expect(policy.Exhausted(0, now, now)).To(BeTrue())
+	})
+
+	It("should be exhausted when the next retry would exceed the max age", func() {
+		policy.MaxAge = time.Minute
+		now := time.Now()
+		Expect(policy.Exhausted(1, now.Add(-50*time.Second), now)).To(BeFalse())
+		Expect(policy.Exhausted(1, now.Add(-59*time.Second), now)).To(BeTrue())
+	})
+
+	It("should reject an unknown jitter strategy", func() {
+		policy.Jitter = "random"
+		Expect(policy.Validate()).To(MatchError("unknown jitter strategy: random"))
+	})
+})
+
+var _ = Describe("Policies", func() {
+	var policies retry.Policies
+
+	BeforeEach(func() {
+		policies = retry.Policies{
+			Default: retry.Policy{
+				InitialDelay: time.Second,
+				Multiplier:   2,
+				MaxDelay:     time.Minute,
+				Jitter:       retry.JitterNone,
+				MaxAttempts:  3,
+			},
+		}
+		Expect(policies.Overrides.Decode(`{"sms":{"initial_delay":"5s","max_attempts":5,"jitter":"full"}}`)).To(Succeed())
+	})
+
+	It("should apply the channel overrides on top of the default policy", func() {
+		policy, err := policies.For("sms")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal(retry.Policy{
+			InitialDelay: 5 * time.Second,
+			Multiplier:   2,
+			MaxDelay:     time.Minute,
+			Jitter:       retry.JitterFull,
+			MaxAttempts:  5,
+		}))
+	})
+
+	It("should return the default policy for channels without overrides", func() {
+		policy, err := policies.For("email")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(policy).To(Equal(policies.Default))
+	})
+
+	It("should reject invalid overrides", func() {
+		Expect(policies.Overrides.Decode(`{"slack":{"max_delay":"10ms"}}`)).To(Succeed())
+		_, err := policies.For("slack")
+		Expect(err).To(MatchError("invalid retry policy for slack: max delay must not be lower than the initial delay"))
+	})
+})
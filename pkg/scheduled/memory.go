@@ -0,0 +1,148 @@
+package scheduled
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStore is a Store kept in the process, it is meant for development and tests
+type MemoryStore struct {
+	mu            sync.Mutex
+	notifications map[string]Notification
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		notifications: make(map[string]Notification),
+	}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, notification Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.notifications[notification.ID] = notification
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, ok := s.notifications[id]
+	if !ok {
+		return Notification{}, ErrNotFound
+	}
+	return notification, nil
+}
+
+func (s *MemoryStore) List(ctx context.Context, query Query) (Page, error) {
+	s.mu.Lock()
+	var notifications []Notification
+	for _, notification := range s.notifications {
+		if (query.Channel == "" || notification.Channel == query.Channel) && (query.Tenant == "" || notification.Tenant == query.Tenant) {
+			notifications = append(notifications, notification)
+		}
+	}
+	s.mu.Unlock()
+
+	sortBySendAt(notifications)
+	page := Page{Notifications: []Notification{}, Total: len(notifications)}
+	if query.Offset < len(notifications) {
+		page.Notifications = notifications[query.Offset:min(query.Offset+query.Limit, len(notifications))]
+	}
+	return page, nil
+}
+
+func (s *MemoryStore) Reschedule(ctx context.Context, id string, sendAt, now time.Time) (Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, ok := s.notifications[id]
+	if !ok || !notification.ClaimedUntil.Before(now) {
+		return Notification{}, ErrNotFound
+	}
+	notification.SendAt = sendAt
+	s.notifications[id] = notification
+	return notification, nil
+}
+
+func (s *MemoryStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification, ok := s.notifications[id]
+	if !ok || !notification.ClaimedUntil.Before(now) {
+		return ErrNotFound
+	}
+	delete(s.notifications, id)
+	return nil
+}
+
+func (s *MemoryStore) Due(ctx context.Context, now time.Time, limit int) ([]Notification, error) {
+	s.mu.Lock()
+	var due []Notification
+	for _, notification := range s.notifications {
+		if !notification.SendAt.After(now) && notification.ClaimedUntil.Before(now) {
+			due = append(due, notification)
+		}
+	}
+	s.mu.Unlock()
+
+	sortBySendAt(due)
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (s *MemoryStore) Claim(ctx context.Context, notification Notification, now time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.notifications[notification.ID]
+	if !ok || !current.ClaimedUntil.Before(now) || current.SendAt.After(now) {
+		return false, nil
+	}
+	current.ClaimedBy = notification.ClaimedBy
+	current.ClaimedUntil = notification.ClaimedUntil
+	s.notifications[notification.ID] = current
+	return true, nil
+}
+
+func (s *MemoryStore) Sent(ctx context.Context, notification Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.notifications[notification.ID]; ok && current.ClaimedBy == notification.ClaimedBy {
+		delete(s.notifications, notification.ID)
+	}
+	return nil
+}
+
+func (s *MemoryStore) Release(ctx context.Context, notification Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.notifications[notification.ID]; ok && current.ClaimedBy == notification.ClaimedBy {
+		current.ClaimedBy = ""
+		current.ClaimedUntil = time.Time{}
+		s.notifications[notification.ID] = current
+	}
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func sortBySendAt(notifications []Notification) {
+	sort.Slice(notifications, func(i, j int) bool {
+		if !notifications[i].SendAt.Equal(notifications[j].SendAt) {
+			return notifications[i].SendAt.Before(notifications[j].SendAt)
+		}
+		return notifications[i].ID < notifications[j].ID
+	})
+}
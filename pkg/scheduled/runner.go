@@ -0,0 +1,114 @@
+package scheduled
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SendFunc sends a due notification, a notification which fails is sent again with the next poll
+type SendFunc func(ctx context.Context, notification Notification) error
+
+type RunnerConfig struct {
+	// ID identifies the runner in the notifications it claimed, defaults to the hostname and pid
+	ID string
+	// BatchSize is the number of due notifications read by a poll
+	BatchSize int
+	// PollInterval is the time between polls, it is the precision of the send_at
+	PollInterval time.Duration
+	// ClaimTimeout is how long claimed notifications are reserved, notifications of a runner which
+	// crashed are taken over by the others afterwards
+	ClaimTimeout time.Duration
+}
+
+// Runner sends the due notifications. Any number of runners can share a store, a notification is claimed
+// by a single runner and only sent again when its runner crashed or exceeded the claim timeout before it
+// was sent, the copy has the same notification id.
+type Runner struct {
+	store  Store
+	send   SendFunc
+	config RunnerConfig
+}
+
+func NewRunner(store Store, send SendFunc, config RunnerConfig) *Runner {
+	if config.ID == "" {
+		hostname, _ := os.Hostname()
+		config.ID = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.ClaimTimeout <= 0 {
+		config.ClaimTimeout = time.Minute
+	}
+
+	return &Runner{
+		store:  store,
+		send:   send,
+		config: config,
+	}
+}
+
+// Run sends the due notifications until the context is done
+func (r *Runner) Run(ctx context.Context) {
+	for {
+		if _, err := r.RunOnce(ctx); err != nil && ctx.Err() == nil {
+			logrus.Errorf("failed to send scheduled notifications: %v", err)
+		}
+
+		select {
+		case <-time.After(r.config.PollInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// RunOnce claims and sends the due notifications, it returns the number of sent notifications
+func (r *Runner) RunOnce(ctx context.Context) (int, error) {
+	now := time.Now()
+	sent := 0
+
+	due, err := r.store.Due(ctx, now, r.config.BatchSize)
+	if err != nil {
+		return sent, err
+	}
+	for _, notification := range due {
+		notification.ClaimedBy = r.config.ID
+		notification.ClaimedUntil = now.Add(r.config.ClaimTimeout)
+		claimed, err := r.store.Claim(ctx, notification, now)
+		if err != nil {
+			return sent, err
+		}
+		if claimed && r.sendNotification(ctx, notification) {
+			sent++
+		}
+	}
+	return sent, nil
+}
+
+// sendNotification sends a claimed notification and removes it, a notification which fails is released
+func (r *Runner) sendNotification(ctx context.Context, notification Notification) bool {
+	if err := r.send(ctx, notification); err != nil {
+		logrus.Errorf("failed to send scheduled notification %s: %v", notification.ID, err)
+		// the context of the poll may be done already
+		releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := r.store.Release(releaseCtx, notification); err != nil {
+			logrus.Errorf("failed to release scheduled notification %s: %v", notification.ID, err)
+		}
+		return false
+	}
+
+	if err := r.store.Sent(ctx, notification); err != nil {
+		// the claim expires and another runner sends it again, the copy is dropped by the deduplication
+		logrus.Errorf("failed to remove scheduled notification %s: %v", notification.ID, err)
+	}
+	return true
+}
@@ -0,0 +1,90 @@
+package scheduled_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Runner", func() {
+	var (
+		store scheduled.Store
+		ctx   context.Context
+		mu    sync.Mutex
+		sent  []scheduled.Notification
+		fail  bool
+	)
+
+	send := func(ctx context.Context, notification scheduled.Notification) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if fail {
+			return errors.New("connection closed")
+		}
+		sent = append(sent, notification)
+		return nil
+	}
+
+	runner := func(id string) *scheduled.Runner {
+		return scheduled.NewRunner(store, send, scheduled.RunnerConfig{ID: id, ClaimTimeout: time.Minute})
+	}
+
+	BeforeEach(func() {
+		store = openSQLite()
+		ctx = context.Background()
+		sent = nil
+		fail = false
+		DeferCleanup(store.Close)
+
+		now := time.Now()
+		for _, n := range []scheduled.Notification{
+			{ID: "due", SendAt: now.Add(-time.Minute), Channel: "sms", Message: []byte(`{"channel":"sms"}`), CreatedAt: now},
+			{ID: "later", SendAt: now.Add(time.Hour), Channel: "sms", Message: []byte(`{"channel":"sms"}`), CreatedAt: now},
+		} {
+			Expect(store.Create(ctx, n)).To(Succeed())
+		}
+	})
+
+	It("sends a due notification once with any number of runners", func() {
+		var wg sync.WaitGroup
+		for _, id := range []string{"api-1", "api-2", "api-3", "api-4"} {
+			r := runner(id)
+			wg.Add(1)
+			go func() {
+				defer GinkgoRecover()
+				defer wg.Done()
+				for i := 0; i < 5; i++ {
+					_, err := r.RunOnce(ctx)
+					Expect(err).NotTo(HaveOccurred())
+				}
+			}()
+		}
+		wg.Wait()
+
+		Expect(sent).To(HaveLen(1))
+		Expect(sent[0].ID).To(Equal("due"))
+		_, err := store.Get(ctx, "due")
+		Expect(err).To(MatchError(scheduled.ErrNotFound))
+		_, err = store.Get(ctx, "later")
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("sends a failed notification again", func() {
+		fail = true
+		n, err := runner("api-1").RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(BeZero())
+
+		fail = false
+		n, err = runner("api-2").RunOnce(ctx)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n).To(Equal(1))
+		Expect(sent).To(HaveLen(1))
+		Expect(sent[0].ClaimedBy).To(Equal("api-2"))
+	})
+})
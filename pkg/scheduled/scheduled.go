@@ -0,0 +1,103 @@
+package scheduled
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite3"
+)
+
+var ErrNotFound = errors.New("scheduled notification not found")
+
+// Notification is a notification waiting for its send_at
+type Notification struct {
+	ID     string    `json:"id"`
+	SendAt time.Time `json:"send_at"`
+	// Channel and Tenant are the ones of the notification, the scheduled notifications are listed by them
+	Channel string `json:"channel"`
+	Tenant  string `json:"tenant,omitempty"`
+	// Message is published once the notification is due, it is opaque to the store
+	Message []byte `json:"message"`
+	// ClaimedBy is the runner sending the due notification until ClaimedUntil, empty while it waits
+	ClaimedBy    string    `json:"claimed_by"`
+	ClaimedUntil time.Time `json:"claimed_until"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Query filters the scheduled notifications, empty fields match all of them
+type Query struct {
+	Channel string
+	Tenant  string
+	Offset  int
+	Limit   int
+}
+
+// Page is a page of the scheduled notifications ordered by their send_at, Total counts all the matching ones
+type Page struct {
+	Notifications []Notification
+	Total         int
+}
+
+// Store keeps the scheduled notifications until they are sent, it is shared by all the api replicas
+type Store interface {
+	// Create adds the notification, its id has to be unique
+	Create(ctx context.Context, notification Notification) error
+	// Get returns the notification or ErrNotFound
+	Get(ctx context.Context, id string) (Notification, error)
+	List(ctx context.Context, query Query) (Page, error)
+	// Reschedule moves the notification to sendAt and returns it, or ErrNotFound when it is
+	// unknown or claimed by a runner at now
+	Reschedule(ctx context.Context, id string, sendAt, now time.Time) (Notification, error)
+	// Cancel removes the notification, or returns ErrNotFound when it is unknown or claimed by a runner at now
+	Cancel(ctx context.Context, id string, now time.Time) error
+
+	// Due returns up to limit notifications whose send_at is at or before now and which are not claimed,
+	// including the ones whose claim expired before they were sent
+	Due(ctx context.Context, now time.Time, limit int) ([]Notification, error)
+	// Claim reserves the notification for notification.ClaimedBy until notification.ClaimedUntil, it
+	// returns false when another runner claimed it first or it was moved or canceled
+	Claim(ctx context.Context, notification Notification, now time.Time) (bool, error)
+	// Sent removes the notification once it is sent
+	Sent(ctx context.Context, notification Notification) error
+	// Release gives up the claim of the notification, so any runner sends it with its next poll
+	Release(ctx context.Context, notification Notification) error
+	Close() error
+}
+
+// Open creates the store selected by kind, it returns a nil store when kind is empty. The sql
+// drivers have to be registered by the binary. The memory store is only shared within the process.
+func Open(ctx context.Context, kind, dsn string) (Store, error) {
+	var dialect sqldialect.Dialect
+	switch kind {
+	case "":
+		return nil, nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		dialect = sqldialect.Postgres
+	case StoreSQLite:
+		dialect = sqldialect.SQLite
+	default:
+		return nil, fmt.Errorf("unknown schedule store: %s", kind)
+	}
+
+	db, err := sql.Open(kind, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open schedule store: %v", err)
+	}
+	store := NewSQLStore(db, dialect)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
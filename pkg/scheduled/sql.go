@@ -0,0 +1,279 @@
+package scheduled
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	notificationsTable = "scheduled_notifications"
+
+	notificationColumns = "id, send_at, channel, tenant, message, claimed_by, claimed_until, created_at"
+)
+
+// SQLStore is a Store in a postgres or sqlite database shared by the api replicas. All the times are
+// stored as unix milliseconds, a zero time as 0.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqldialect.Dialect
+}
+
+func NewSQLStore(db *sql.DB, dialect sqldialect.Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// Migrate creates the table of the store when it does not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	switch s.dialect {
+	case sqldialect.Postgres, sqldialect.SQLite:
+	default:
+		return fmt.Errorf("unsupported schedule store dialect: %s", s.dialect)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + notificationsTable + ` (
+			id            TEXT PRIMARY KEY,
+			send_at       BIGINT NOT NULL,
+			channel       TEXT NOT NULL,
+			tenant        TEXT NOT NULL,
+			message       TEXT NOT NULL,
+			claimed_by    TEXT NOT NULL,
+			claimed_until BIGINT NOT NULL,
+			created_at    BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_send_at ON ` + notificationsTable + ` (send_at, id)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate schedule store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, notification Notification) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"INSERT INTO "+notificationsTable+" ("+notificationColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?)"),
+		notification.ID, millis(notification.SendAt), notification.Channel, notification.Tenant, string(notification.Message),
+		notification.ClaimedBy, millis(notification.ClaimedUntil), millis(notification.CreatedAt),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert scheduled notification: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Notification, error) {
+	notification, err := scanNotification(s.db.QueryRowContext(ctx, s.dialect.Rebind(
+		"SELECT "+notificationColumns+" FROM "+notificationsTable+" WHERE id = ?"), id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotFound
+	}
+	if err != nil {
+		return Notification{}, fmt.Errorf("failed to get scheduled notification: %v", err)
+	}
+	return notification, nil
+}
+
+func (s *SQLStore) List(ctx context.Context, query Query) (Page, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	if query.Channel != "" {
+		conditions = append(conditions, "channel = ?")
+		args = append(args, query.Channel)
+	}
+	if query.Tenant != "" {
+		conditions = append(conditions, "tenant = ?")
+		args = append(args, query.Tenant)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	page := Page{Notifications: []Notification{}}
+	if err := s.db.QueryRowContext(ctx, s.dialect.Rebind("SELECT COUNT(*) FROM "+notificationsTable+where), args...).Scan(&page.Total); err != nil {
+		return Page{}, fmt.Errorf("failed to count scheduled notifications: %v", err)
+	}
+
+	notifications, err := s.queryNotifications(ctx, "SELECT "+notificationColumns+" FROM "+notificationsTable+where+" ORDER BY send_at, id LIMIT ? OFFSET ?",
+		append(args, query.Limit, query.Offset)...)
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to list scheduled notifications: %v", err)
+	}
+	page.Notifications = append(page.Notifications, notifications...)
+	return page, nil
+}
+
+func (s *SQLStore) Reschedule(ctx context.Context, id string, sendAt, now time.Time) (Notification, error) {
+	var notification Notification
+	err := s.inTx(ctx, func(tx *sql.Tx) error {
+		result, err := tx.ExecContext(ctx, s.dialect.Rebind(
+			"UPDATE "+notificationsTable+" SET send_at = ? WHERE id = ? AND claimed_until < ?"),
+			millis(sendAt), id, millis(now),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to reschedule notification: %v", err)
+		}
+		if err := found(result); err != nil {
+			return err
+		}
+
+		notification, err = scanNotification(tx.QueryRowContext(ctx, s.dialect.Rebind(
+			"SELECT "+notificationColumns+" FROM "+notificationsTable+" WHERE id = ?"), id,
+		))
+		if err != nil {
+			return fmt.Errorf("failed to get scheduled notification: %v", err)
+		}
+		return nil
+	})
+	return notification, err
+}
+
+func (s *SQLStore) Cancel(ctx context.Context, id string, now time.Time) error {
+	result, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"DELETE FROM "+notificationsTable+" WHERE id = ? AND claimed_until < ?"), id, millis(now),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to cancel scheduled notification: %v", err)
+	}
+	return found(result)
+}
+
+func (s *SQLStore) Due(ctx context.Context, now time.Time, limit int) ([]Notification, error) {
+	notifications, err := s.queryNotifications(ctx, "SELECT "+notificationColumns+" FROM "+notificationsTable+" WHERE send_at <= ? AND claimed_until < ? ORDER BY send_at, id LIMIT ?",
+		millis(now), millis(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to select due scheduled notifications: %v", err)
+	}
+	return notifications, nil
+}
+
+func (s *SQLStore) Claim(ctx context.Context, notification Notification, now time.Time) (bool, error) {
+	result, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+notificationsTable+" SET claimed_by = ?, claimed_until = ? WHERE id = ? AND send_at <= ? AND claimed_until < ?"),
+		notification.ClaimedBy, millis(notification.ClaimedUntil), notification.ID, millis(now), millis(now),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim scheduled notification: %v", err)
+	}
+	n, err := result.RowsAffected()
+	return err == nil && n == 1, err
+}
+
+func (s *SQLStore) Sent(ctx context.Context, notification Notification) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"DELETE FROM "+notificationsTable+" WHERE id = ? AND claimed_by = ?"),
+		notification.ID, notification.ClaimedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete scheduled notification: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Release(ctx context.Context, notification Notification) error {
+	_, err := s.db.ExecContext(ctx, s.dialect.Rebind(
+		"UPDATE "+notificationsTable+" SET claimed_by = '', claimed_until = 0 WHERE id = ? AND claimed_by = ?"),
+		notification.ID, notification.ClaimedBy,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to release scheduled notification: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanNotification reads the notificationColumns of a row
+func scanNotification(row scanner) (Notification, error) {
+	var (
+		notification                    Notification
+		message                         string
+		sendAt, claimedUntil, createdAt int64
+	)
+	err := row.Scan(&notification.ID, &sendAt, &notification.Channel, &notification.Tenant, &message,
+		&notification.ClaimedBy, &claimedUntil, &createdAt)
+	if err != nil {
+		return Notification{}, err
+	}
+	notification.Message = []byte(message)
+	notification.SendAt = fromMillis(sendAt)
+	notification.ClaimedUntil = fromMillis(claimedUntil)
+	notification.CreatedAt = fromMillis(createdAt)
+	return notification, nil
+}
+
+func (s *SQLStore) queryNotifications(ctx context.Context, statement string, args ...interface{}) ([]Notification, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			return nil, err
+		}
+		notifications = append(notifications, notification)
+	}
+	return notifications, rows.Err()
+}
+
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+func found(result sql.Result) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get affected rows: %v", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func millis(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func fromMillis(ms int64) time.Time {
+	if ms == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(ms)
+}
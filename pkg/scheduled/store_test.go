@@ -0,0 +1,171 @@
+package scheduled_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduled"
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// openSQLite opens a migrated store in a temporary sqlite database
+func openSQLite() scheduled.Store {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(GinkgoT().TempDir(), "scheduled.db")+"?_busy_timeout=5000&_txlock=immediate")
+	Expect(err).NotTo(HaveOccurred())
+	store := scheduled.NewSQLStore(db, sqldialect.SQLite)
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	// migrating twice is a no-op
+	Expect(store.Migrate(context.Background())).To(Succeed())
+	return store
+}
+
+var _ = Describe("Store", func() {
+	for _, backend := range []struct {
+		name string
+		open func() scheduled.Store
+	}{
+		{name: "memory", open: func() scheduled.Store { return scheduled.NewMemoryStore() }},
+		{name: "sqlite", open: openSQLite},
+	} {
+		backend := backend
+
+		Context("with the "+backend.name+" store", func() {
+			var (
+				store scheduled.Store
+				ctx   context.Context
+				start time.Time
+			)
+
+			at := func(seconds int) time.Time {
+				return start.Add(time.Duration(seconds) * time.Second)
+			}
+
+			notification := func(id, tenant string, sendAt time.Time) scheduled.Notification {
+				return scheduled.Notification{
+					ID:        id,
+					SendAt:    sendAt,
+					Channel:   "sms",
+					Tenant:    tenant,
+					Message:   []byte(`{"channel":"sms"}`),
+					CreatedAt: start,
+				}
+			}
+
+			claim := func(id, runner string, now time.Time) (scheduled.Notification, bool) {
+				n, err := store.Get(ctx, id)
+				Expect(err).NotTo(HaveOccurred())
+				n.ClaimedBy = runner
+				n.ClaimedUntil = now.Add(time.Minute)
+				claimed, err := store.Claim(ctx, n, now)
+				Expect(err).NotTo(HaveOccurred())
+				return n, claimed
+			}
+
+			BeforeEach(func() {
+				store = backend.open()
+				ctx = context.Background()
+				start = time.UnixMilli(time.Now().UnixMilli())
+			})
+
+			AfterEach(func() {
+				store.Close()
+			})
+
+			It("keeps the notifications ordered by their send_at", func() {
+				Expect(store.Create(ctx, notification("n1", "acme", at(2)))).To(Succeed())
+				Expect(store.Create(ctx, notification("n2", "globex", at(1)))).To(Succeed())
+				Expect(store.Create(ctx, notification("n3", "acme", at(0)))).To(Succeed())
+
+				n, err := store.Get(ctx, "n1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n.Tenant).To(Equal("acme"))
+				Expect(string(n.Message)).To(Equal(`{"channel":"sms"}`))
+				Expect(n.SendAt).To(BeTemporally("==", at(2)))
+				Expect(n.ClaimedUntil.IsZero()).To(BeTrue())
+
+				page, err := store.List(ctx, scheduled.Query{Tenant: "acme", Limit: 10})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(page.Total).To(Equal(2))
+				Expect(page.Notifications).To(HaveLen(2))
+				Expect(page.Notifications[0].ID).To(Equal("n3"))
+				Expect(page.Notifications[1].ID).To(Equal("n1"))
+
+				page, err = store.List(ctx, scheduled.Query{Offset: 1, Limit: 1})
+				Expect(err).NotTo(HaveOccurred())
+				Expect(page.Total).To(Equal(3))
+				Expect(page.Notifications[0].ID).To(Equal("n2"))
+			})
+
+			It("moves and cancels the notifications which are not claimed", func() {
+				Expect(store.Create(ctx, notification("n1", "", at(60)))).To(Succeed())
+
+				n, err := store.Reschedule(ctx, "n1", at(1), at(0))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n.SendAt).To(BeTemporally("==", at(1)))
+
+				_, claimed := claim("n1", "runner-1", at(1))
+				Expect(claimed).To(BeTrue())
+				_, err = store.Reschedule(ctx, "n1", at(120), at(2))
+				Expect(err).To(MatchError(scheduled.ErrNotFound))
+				Expect(store.Cancel(ctx, "n1", at(2))).To(MatchError(scheduled.ErrNotFound))
+
+				// the claim of a crashed runner expired
+				Expect(store.Cancel(ctx, "n1", at(120))).To(Succeed())
+				_, err = store.Get(ctx, "n1")
+				Expect(err).To(MatchError(scheduled.ErrNotFound))
+				Expect(store.Cancel(ctx, "n1", at(120))).To(MatchError(scheduled.ErrNotFound))
+				_, err = store.Reschedule(ctx, "n1", at(1), at(120))
+				Expect(err).To(MatchError(scheduled.ErrNotFound))
+			})
+
+			It("claims a due notification once", func() {
+				Expect(store.Create(ctx, notification("due", "", at(0)))).To(Succeed())
+				Expect(store.Create(ctx, notification("later", "", at(60)))).To(Succeed())
+
+				due, err := store.Due(ctx, at(1), 10)
+				Expect(err).NotTo(HaveOccurred())
+				Expect(due).To(HaveLen(1))
+				Expect(due[0].ID).To(Equal("due"))
+
+				_, claimed := claim("due", "runner-1", at(1))
+				Expect(claimed).To(BeTrue())
+				_, claimed = claim("due", "runner-2", at(1))
+				Expect(claimed).To(BeFalse())
+				_, claimed = claim("later", "runner-2", at(1))
+				Expect(claimed).To(BeFalse())
+				Expect(store.Due(ctx, at(1), 10)).To(BeEmpty())
+			})
+
+			It("hands the notifications of a crashed runner over to another one", func() {
+				Expect(store.Create(ctx, notification("n1", "", at(0)))).To(Succeed())
+				first, _ := claim("n1", "runner-1", at(1))
+
+				Expect(store.Due(ctx, at(30), 10)).To(BeEmpty())
+				Expect(store.Due(ctx, at(62), 10)).To(HaveLen(1))
+				second, claimed := claim("n1", "runner-2", at(62))
+				Expect(claimed).To(BeTrue())
+
+				// the first runner lost its claim
+				Expect(store.Sent(ctx, first)).To(Succeed())
+				_, err := store.Get(ctx, "n1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(store.Sent(ctx, second)).To(Succeed())
+				_, err = store.Get(ctx, "n1")
+				Expect(err).To(MatchError(scheduled.ErrNotFound))
+			})
+
+			It("releases a notification to any runner", func() {
+				Expect(store.Create(ctx, notification("n1", "", at(0)))).To(Succeed())
+				n, _ := claim("n1", "runner-1", at(1))
+
+				Expect(store.Release(ctx, n)).To(Succeed())
+				Expect(store.Due(ctx, at(1), 10)).To(HaveLen(1))
+			})
+		})
+	}
+})
@@ -0,0 +1,13 @@
+package scheduled_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestScheduled(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Scheduled Suite")
+}
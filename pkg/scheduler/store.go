@@ -0,0 +1,105 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const entryFileExt = ".json"
+
+// Entry is a payload that has to be released at the due time
+type Entry struct {
+	ID      string    `json:"id"`
+	Due     time.Time `json:"due"`
+	Payload []byte    `json:"payload"`
+}
+
+// Store persists the pending entries so they survive a restart
+type Store interface {
+	Save(entry Entry) error
+	Delete(id string) error
+	Load() ([]Entry, error)
+}
+
+// FileStore keeps every entry in its own file inside a directory
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create scheduler dir: %v", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Save writes the entry to a temporary file which is synced and renamed,
+// so a crash never leaves a partially written entry behind
+func (s *FileStore) Save(entry Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal entry: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(s.dir, "tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create entry file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write entry: %v", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to sync entry: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close entry file: %v", err)
+	}
+
+	return os.Rename(tmp.Name(), s.path(entry.ID))
+}
+
+func (s *FileStore) Delete(id string) error {
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete entry %s: %v", id, err)
+	}
+	return nil
+}
+
+func (s *FileStore) Load() ([]Entry, error) {
+	files, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scheduler dir: %v", err)
+	}
+
+	var entries []Entry
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), entryFileExt) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read entry %s: %v", f.Name(), err)
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal entry %s: %v", f.Name(), err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func (s *FileStore) path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id)+entryFileExt)
+}
@@ -0,0 +1,236 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// delay before an entry is released again when releasing it failed
+const releaseRetryDelay = time.Second
+
+// ReleaseFunc is called once an entry is due, the entry is kept and released again on error
+type ReleaseFunc func(ctx context.Context, entry Entry) error
+
+type timer struct {
+	entry  Entry
+	rounds int
+}
+
+// Wheel is a hashed timing wheel which schedules entries with an arbitrary delay.
+// Every slot covers one tick, entries further away than a full revolution wait
+// for the number of rounds they need before being released.
+type Wheel struct {
+	mu      sync.Mutex
+	store   Store
+	release ReleaseFunc
+	tick    time.Duration
+	slots   []map[string]*timer
+	index   map[string]int
+	cursor  int
+	// advanced is the time the cursor last moved, the next slot is due one tick later
+	advanced time.Time
+}
+
+// NewWheel creates a wheel and reloads the pending entries of the store
+func NewWheel(store Store, tick time.Duration, slots int, release ReleaseFunc) (*Wheel, error) {
+	if tick <= 0 || slots <= 0 {
+		return nil, fmt.Errorf("tick and slots must be positive")
+	}
+
+	w := &Wheel{
+		store:   store,
+		release: release,
+		tick:    tick,
+		slots:   make([]map[string]*timer, slots),
+		index:   make(map[string]int),
+		// Run starts the ticker, until then the wheel does not move
+		advanced: time.Now(),
+	}
+	for i := range w.slots {
+		w.slots[i] = make(map[string]*timer)
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		w.insert(entry, time.Now())
+	}
+
+	return w, nil
+}
+
+// Schedule persists the entry and adds it to the wheel, an entry with an existing ID is replaced
+func (w *Wheel) Schedule(entry Entry) (Entry, error) {
+	if entry.ID == "" {
+		entry.ID = newID()
+	}
+
+	if err := w.store.Save(entry); err != nil {
+		return Entry{}, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.remove(entry.ID)
+	w.insert(entry, time.Now())
+
+	return entry, nil
+}
+
+// Cancel removes a pending entry, it reports false when the entry was not found
+func (w *Wheel) Cancel(id string) (bool, error) {
+	w.mu.Lock()
+	found := w.remove(id)
+	w.mu.Unlock()
+
+	if !found {
+		return false, nil
+	}
+	return true, w.store.Delete(id)
+}
+
+// Get returns a pending entry, it reports false when the entry was not found
+func (w *Wheel) Get(id string) (Entry, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot, ok := w.index[id]
+	if !ok {
+		return Entry{}, false
+	}
+	return w.slots[slot][id].entry, true
+}
+
+// Reschedule moves a pending entry to the due time, it reports false when the entry was not found.
+// Unlike Schedule it never adds an entry which was released or canceled in the meantime.
+func (w *Wheel) Reschedule(id string, due time.Time) (Entry, bool, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	slot, ok := w.index[id]
+	if !ok {
+		return Entry{}, false, nil
+	}
+	entry := w.slots[slot][id].entry
+	entry.Due = due
+	// saved with the lock held, so a concurrent Cancel cannot delete the entry before it is saved
+	if err := w.store.Save(entry); err != nil {
+		return Entry{}, true, err
+	}
+	w.remove(id)
+	w.insert(entry, time.Now())
+	return entry, true, nil
+}
+
+// Pending returns all the entries which are not released yet
+func (w *Wheel) Pending() []Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	entries := make([]Entry, 0, len(w.index))
+	for _, slot := range w.slots {
+		for _, t := range slot {
+			entries = append(entries, t.entry)
+		}
+	}
+	return entries
+}
+
+// Run advances the wheel every tick until the context is done
+func (w *Wheel) Run(ctx context.Context) {
+	w.mu.Lock()
+	w.advanced = time.Now()
+	ticker := time.NewTicker(w.tick)
+	w.mu.Unlock()
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			for _, entry := range w.advance() {
+				w.fire(ctx, entry)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// advance moves the cursor to the next slot and collects the due entries
+func (w *Wheel) advance() []Entry {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.cursor = (w.cursor + 1) % len(w.slots)
+	w.advanced = time.Now()
+
+	var due []Entry
+	for id, t := range w.slots[w.cursor] {
+		if t.rounds > 0 {
+			t.rounds--
+			continue
+		}
+		due = append(due, t.entry)
+		delete(w.slots[w.cursor], id)
+		delete(w.index, id)
+	}
+	return due
+}
+
+func (w *Wheel) fire(ctx context.Context, entry Entry) {
+	if err := w.release(ctx, entry); err != nil {
+		logrus.Errorf("failed to release scheduled entry %s: %v", entry.ID, err)
+
+		// inserting relative to a point in time before the due time delays the entry by releaseRetryDelay
+		w.mu.Lock()
+		w.insert(entry, entry.Due.Add(-releaseRetryDelay))
+		w.mu.Unlock()
+		return
+	}
+
+	if err := w.store.Delete(entry.ID); err != nil {
+		logrus.Errorf("failed to delete released entry %s: %v", entry.ID, err)
+	}
+}
+
+// insert places the entry in the slot its due time falls into, relative to now. The ticks are counted from
+// the last move of the cursor, so an entry is never released before it is due. Must be called with the lock held.
+func (w *Wheel) insert(entry Entry, now time.Time) {
+	elapsed := max(time.Since(w.advanced), 0)
+	ticks := int((entry.Due.Sub(now) + elapsed + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+
+	slot := (w.cursor + ticks) % len(w.slots)
+	w.slots[slot][entry.ID] = &timer{
+		entry:  entry,
+		rounds: (ticks - 1) / len(w.slots),
+	}
+	w.index[entry.ID] = slot
+}
+
+// remove deletes the entry from its slot. Must be called with the lock held.
+func (w *Wheel) remove(id string) bool {
+	slot, ok := w.index[id]
+	if !ok {
+		return false
+	}
+	delete(w.slots[slot], id)
+	delete(w.index, id)
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,158 @@
+package scheduler_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/scheduler"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Wheel", func() {
+	var (
+		store    *scheduler.FileStore
+		wheel    *scheduler.Wheel
+		ctx      context.Context
+		cancel   context.CancelFunc
+		mu       sync.Mutex
+		released []string
+		failures int
+	)
+
+	releasedIDs := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), released...)
+	}
+
+	release := func(_ context.Context, entry scheduler.Entry) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if failures > 0 {
+			failures--
+			return errors.New("broker unavailable")
+		}
+		released = append(released, entry.ID)
+		return nil
+	}
+
+	BeforeEach(func() {
+		var err error
+		store, err = scheduler.NewFileStore(GinkgoT().TempDir())
+		Expect(err).NotTo(HaveOccurred())
+
+		released = nil
+		failures = 0
+		// a small wheel makes sure entries further away than one revolution are covered
+		wheel, err = scheduler.NewWheel(store, 10*time.Millisecond, 4, release)
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel = context.WithCancel(context.Background())
+		go wheel.Run(ctx)
+	})
+
+	AfterEach(func() {
+		cancel()
+	})
+
+	It("should release entries in the order they are due", func() {
+		_, err := wheel.Schedule(scheduler.Entry{ID: "late", Due: time.Now().Add(150 * time.Millisecond)})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = wheel.Schedule(scheduler.Entry{ID: "early", Due: time.Now().Add(20 * time.Millisecond)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(releasedIDs).Should(Equal([]string{"early", "late"}))
+
+		entries, err := store.Load()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+
+	It("should never release an entry before it is due", func() {
+		var releasedAt time.Time
+		early, err := scheduler.NewWheel(store, 50*time.Millisecond, 4, func(_ context.Context, entry scheduler.Entry) error {
+			mu.Lock()
+			defer mu.Unlock()
+			releasedAt = time.Now()
+			return nil
+		})
+		Expect(err).NotTo(HaveOccurred())
+		go early.Run(ctx)
+
+		// scheduled in the middle of a tick
+		time.Sleep(30 * time.Millisecond)
+		due := time.Now().Add(60 * time.Millisecond)
+		_, err = early.Schedule(scheduler.Entry{ID: "on-time", Due: due})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(func() time.Time {
+			mu.Lock()
+			defer mu.Unlock()
+			return releasedAt
+		}).ShouldNot(BeZero())
+		Expect(releasedAt).NotTo(BeTemporally("<", due))
+	})
+
+	It("should not release a cancelled entry", func() {
+		_, err := wheel.Schedule(scheduler.Entry{ID: "cancelled", Due: time.Now().Add(50 * time.Millisecond)})
+		Expect(err).NotTo(HaveOccurred())
+
+		found, err := wheel.Cancel("cancelled")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+
+		Consistently(releasedIDs, 100*time.Millisecond).Should(BeEmpty())
+		Expect(wheel.Pending()).To(BeEmpty())
+	})
+
+	It("should release a rescheduled entry at its new due time", func() {
+		_, err := wheel.Schedule(scheduler.Entry{ID: "moved", Due: time.Now().Add(time.Hour)})
+		Expect(err).NotTo(HaveOccurred())
+
+		due := time.Now().Add(20 * time.Millisecond)
+		entry, found, err := wheel.Reschedule("moved", due)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeTrue())
+		Expect(entry.Due).To(BeTemporally("==", due))
+
+		Eventually(releasedIDs).Should(Equal([]string{"moved"}))
+		_, found = wheel.Get("moved")
+		Expect(found).To(BeFalse())
+	})
+
+	It("should not reschedule an entry which is not pending", func() {
+		_, found, err := wheel.Reschedule("unknown", time.Now())
+		Expect(err).NotTo(HaveOccurred())
+		Expect(found).To(BeFalse())
+		Expect(wheel.Pending()).To(BeEmpty())
+	})
+
+	It("should keep an entry until it is released successfully", func() {
+		mu.Lock()
+		failures = 1
+		mu.Unlock()
+
+		_, err := wheel.Schedule(scheduler.Entry{ID: "retried", Due: time.Now()})
+		Expect(err).NotTo(HaveOccurred())
+
+		Eventually(releasedIDs, 2*time.Second).Should(Equal([]string{"retried"}))
+	})
+
+	It("should reload the pending entries from the store", func() {
+		_, err := wheel.Schedule(scheduler.Entry{ID: "persisted", Due: time.Now().Add(time.Hour)})
+		Expect(err).NotTo(HaveOccurred())
+		cancel()
+
+		reloaded, err := scheduler.NewWheel(store, 10*time.Millisecond, 4, release)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(reloaded.Pending()).To(HaveLen(1))
+		Expect(reloaded.Pending()[0].ID).To(Equal("persisted"))
+
+		entry, found := reloaded.Get("persisted")
+		Expect(found).To(BeTrue())
+		Expect(entry.ID).To(Equal("persisted"))
+	})
+})
@@ -0,0 +1,152 @@
+package spool
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+// MessageBroker is the broker the spooled messages are forwarded to
+type MessageBroker interface {
+	Send(ctx context.Context, message types.Message) error
+	SendBatch(ctx context.Context, messages []types.Message) []error
+}
+
+// Forwarder publishes messages to the broker and spools them while the broker is unavailable. Once the
+// spool holds messages new ones are appended behind them, so the broker receives all messages in the
+// order they were accepted. Run drains the spool as soon as the broker accepts messages again. Publishing
+// is not serialized, messages sent concurrently have no order to keep.
+type Forwarder struct {
+	spool  *Spool
+	broker MessageBroker
+	// retryInterval is the time between attempts to forward while the broker is unavailable
+	retryInterval time.Duration
+
+	spooled chan struct{}
+}
+
+func NewForwarder(spool *Spool, broker MessageBroker, retryInterval time.Duration) *Forwarder {
+	return &Forwarder{
+		spool:         spool,
+		broker:        broker,
+		retryInterval: retryInterval,
+		spooled:       make(chan struct{}, 1),
+	}
+}
+
+// Send publishes the message right away when the spool is empty and spools it otherwise or when
+// publishing fails. Messages the broker can never accept, like those of unknown channels, are not spooled.
+func (f *Forwarder) Send(ctx context.Context, message types.Message) error {
+	if f.spool.Depth() == 0 {
+		err := f.broker.Send(ctx, message)
+		if err == nil || errors.Is(err, types.ErrUnsupportedChannel) {
+			return err
+		}
+		logrus.Warnf("spooling notification, failed to publish: %v", err)
+	}
+
+	if _, err := f.spool.Append(message); err != nil {
+		return err
+	}
+
+	select {
+	case f.spooled <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// SendBatch publishes the messages like Send, as a single batch when the spool is empty. The messages
+// failing to publish are spooled in their order.
+func (f *Forwarder) SendBatch(ctx context.Context, messages []types.Message) []error {
+	errs := make([]error, len(messages))
+	published := f.spool.Depth() == 0
+	if published {
+		errs = f.broker.SendBatch(ctx, messages)
+	}
+
+	spooled := 0
+	for i, err := range errs {
+		if published && (err == nil || errors.Is(err, types.ErrUnsupportedChannel)) {
+			continue
+		}
+		if _, err := f.spool.Append(messages[i]); err != nil {
+			errs[i] = err
+			continue
+		}
+		errs[i] = nil
+		spooled++
+	}
+	if spooled == 0 {
+		return errs
+	}
+	if published {
+		logrus.Warnf("spooling %d notifications of a batch, failed to publish them", spooled)
+	}
+
+	select {
+	case f.spooled <- struct{}{}:
+	default:
+	}
+	return errs
+}
+
+// Run forwards the spooled messages until the context is done
+func (f *Forwarder) Run(ctx context.Context) {
+	ticker := time.NewTicker(f.retryInterval)
+	defer ticker.Stop()
+
+	for {
+		f.drain(ctx)
+
+		select {
+		case <-f.spooled:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// drain forwards spooled messages in order until the spool is empty or the broker fails
+func (f *Forwarder) drain(ctx context.Context) {
+	forwarded := 0
+	defer func() {
+		if forwarded > 0 {
+			logrus.Infof("forwarded %d spooled notifications, %d left", forwarded, f.spool.Depth())
+		}
+	}()
+
+	for ctx.Err() == nil {
+		rec, ok, err := f.spool.Peek()
+		if err != nil {
+			logrus.Errorf("failed to read spool: %v", err)
+			return
+		}
+		if !ok {
+			return
+		}
+
+		err = f.broker.Send(ctx, rec.Message)
+		if errors.Is(err, types.ErrUnsupportedChannel) {
+			// the channel was removed from the config while the message was spooled
+			logrus.Errorf("dropping spooled notification %d: %v", rec.Seq, err)
+		} else if err != nil {
+			return
+		}
+
+		if err := f.spool.Commit(rec); err != nil {
+			logrus.Errorf("failed to commit spooled notification %d: %v", rec.Seq, err)
+			return
+		}
+		forwarded++
+	}
+}
+
+// Stats describe the messages waiting in the spool
+func (f *Forwarder) Stats() Stats {
+	return f.spool.Stats()
+}
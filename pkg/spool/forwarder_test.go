@@ -0,0 +1,163 @@
+package spool_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/spool"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// fakeBroker records the published payloads and fails while it is down. Publishing the payload "slow"
+// waits until stall is closed.
+type fakeBroker struct {
+	mu        sync.Mutex
+	down      bool
+	published []string
+	stall     chan struct{}
+}
+
+func (b *fakeBroker) Send(ctx context.Context, message types.Message) error {
+	if string(message.Payload) == "slow" {
+		<-b.stall
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if message.Channel != "email" {
+		return fmt.Errorf("%w: %s", types.ErrUnsupportedChannel, message.Channel)
+	}
+	if b.down {
+		return errors.New("connection refused")
+	}
+	b.published = append(b.published, string(message.Payload))
+	return nil
+}
+
+func (b *fakeBroker) SendBatch(ctx context.Context, messages []types.Message) []error {
+	errs := make([]error, len(messages))
+	for i, message := range messages {
+		errs[i] = b.Send(ctx, message)
+	}
+	return errs
+}
+
+func (b *fakeBroker) setDown(down bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.down = down
+}
+
+func (b *fakeBroker) payloads() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]string(nil), b.published...)
+}
+
+var _ = Describe("Forwarder", func() {
+	var (
+		s         *spool.Spool
+		broker    *fakeBroker
+		forwarder *spool.Forwarder
+		ctx       context.Context
+		cancel    context.CancelFunc
+		done      chan struct{}
+	)
+
+	send := func(channel, payload string) error {
+		return forwarder.Send(ctx, types.Message{Channel: channel, Payload: []byte(payload)})
+	}
+
+	BeforeEach(func() {
+		var err error
+		s, err = spool.Open(spool.Config{Dir: GinkgoT().TempDir(), SegmentSize: 1024})
+		Expect(err).NotTo(HaveOccurred())
+
+		broker = &fakeBroker{}
+		forwarder = spool.NewForwarder(s, broker, 10*time.Millisecond)
+
+		ctx, cancel = context.WithCancel(context.Background())
+		done = make(chan struct{})
+		go func() {
+			defer close(done)
+			forwarder.Run(ctx)
+		}()
+	})
+
+	AfterEach(func() {
+		cancel()
+		<-done
+		s.Close()
+	})
+
+	It("publishes right away while the broker is available", func() {
+		Expect(send("email", "1")).To(Succeed())
+		Expect(broker.payloads()).To(Equal([]string{"1"}))
+		Expect(forwarder.Stats().Depth).To(Equal(0))
+	})
+
+	It("spools while the broker is down and forwards in order once it recovers", func() {
+		broker.setDown(true)
+		Expect(send("email", "1")).To(Succeed())
+		Expect(send("email", "2")).To(Succeed())
+		Expect(forwarder.Stats().Depth).To(Equal(2))
+
+		broker.setDown(false)
+		// accepted while the spool is drained, it must not overtake the spooled messages
+		Expect(send("email", "3")).To(Succeed())
+
+		Eventually(broker.payloads).Should(Equal([]string{"1", "2", "3"}))
+		Expect(forwarder.Stats().Depth).To(Equal(0))
+	})
+
+	It("spools the messages of a batch while the broker is down", func() {
+		batch := func(channels ...string) []error {
+			messages := make([]types.Message, len(channels))
+			for i, channel := range channels {
+				messages[i] = types.Message{Channel: channel, Payload: []byte(fmt.Sprint(i))}
+			}
+			return forwarder.SendBatch(ctx, messages)
+		}
+
+		Expect(batch("email", "email")).To(Equal([]error{nil, nil}))
+		Expect(broker.payloads()).To(Equal([]string{"0", "1"}))
+
+		broker.setDown(true)
+		errs := batch("email", "fax", "email")
+		Expect(errs[0]).NotTo(HaveOccurred())
+		Expect(errors.Is(errs[1], types.ErrUnsupportedChannel)).To(BeTrue())
+		Expect(errs[2]).NotTo(HaveOccurred())
+		Expect(forwarder.Stats().Depth).To(Equal(2))
+
+		broker.setDown(false)
+		Eventually(broker.payloads).Should(Equal([]string{"0", "1", "0", "2"}))
+	})
+
+	It("does not hold up other messages while the broker publishes slowly", func() {
+		broker.stall = make(chan struct{})
+		slow := make(chan error)
+		go func() {
+			slow <- send("email", "slow")
+		}()
+		Consistently(slow).ShouldNot(Receive())
+
+		Expect(send("email", "1")).To(Succeed())
+		Expect(broker.payloads()).To(Equal([]string{"1"}))
+
+		close(broker.stall)
+		Expect(<-slow).To(Succeed())
+		Expect(broker.payloads()).To(Equal([]string{"1", "slow"}))
+	})
+
+	It("does not spool messages of unknown channels", func() {
+		broker.setDown(true)
+		err := send("fax", "1")
+		Expect(errors.Is(err, types.ErrUnsupportedChannel)).To(BeTrue())
+		Expect(forwarder.Stats().Depth).To(Equal(0))
+	})
+})
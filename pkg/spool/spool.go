@@ -0,0 +1,510 @@
+package spool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	segmentFileExt = ".seg"
+	cursorFile     = "cursor"
+
+	// a record starts with the length of its body followed by the checksum of the body
+	recordHeaderSize = 8
+	// the body starts with the sequence, the priority, the length of the channel and the length
+	// of the message id, followed by the channel, the message id and the payload
+	bodyHeaderSize = 12
+	// expiryFlag is set in the priority of a message which expires, the expiry in unix nanoseconds
+	// follows its message id. Records written before expiring messages never have it.
+	expiryFlag = 0x80
+	expirySize = 8
+
+	// maxIDSize and maxChannelSize are the longest message id and channel the lengths in the body header hold
+	maxIDSize      = math.MaxUint8
+	maxChannelSize = math.MaxUint16
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var errCorrupt = errors.New("corrupt record")
+
+type Config struct {
+	Dir string
+	// SegmentSize is the size in bytes after which appends go to a new segment file
+	SegmentSize int64
+	// SyncInterval is how often appended records are synced to disk, with 0 every
+	// record is synced before Append returns
+	SyncInterval time.Duration
+}
+
+// Record is a spooled message with its position in the spool
+type Record struct {
+	Seq     uint64
+	Message types.Message
+}
+
+// Stats describe the content of the spool
+type Stats struct {
+	// Depth is the number of records not forwarded yet
+	Depth    int   `json:"depth"`
+	Segments int   `json:"segments"`
+	Bytes    int64 `json:"bytes"`
+}
+
+type segment struct {
+	firstSeq uint64
+	path     string
+	size     int64
+}
+
+// Spool is a write-ahead log of messages split into segment files. Records carry a checksum, a record
+// torn by a crash at the end of the last segment is dropped when the spool is opened. The sequence
+// of the last forwarded record is kept in a cursor file and segments are deleted once forwarded.
+type Spool struct {
+	config Config
+
+	mu       sync.Mutex
+	segments []*segment
+	active   *os.File
+	nextSeq  uint64
+	// forwarded is the sequence of the last record handed over to the broker
+	forwarded uint64
+	// the next record to forward starts at readOffset of segments[readSegment]
+	readSegment int
+	readOffset  int64
+	reader      *os.File
+	// peekedSize is the size of the record returned by Peek, 0 when nothing is peeked
+	peekedSize int64
+	unsynced   bool
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Open loads the spool from the config dir, creating it when it does not exist
+func Open(config Config) (*Spool, error) {
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir: %v", err)
+	}
+
+	s := &Spool{
+		config:  config,
+		nextSeq: 1,
+		stop:    make(chan struct{}),
+	}
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	if config.SyncInterval > 0 {
+		s.wg.Add(1)
+		go s.syncLoop()
+	}
+	return s, nil
+}
+
+func (s *Spool) load() error {
+	forwarded, err := s.readCursor()
+	if err != nil {
+		return err
+	}
+	s.forwarded = forwarded
+
+	files, err := filepath.Glob(filepath.Join(s.config.Dir, "*"+segmentFileExt))
+	if err != nil {
+		return fmt.Errorf("failed to list spool segments: %v", err)
+	}
+	for _, file := range files {
+		firstSeq, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(file), segmentFileExt), 10, 64)
+		if err != nil {
+			logrus.Warnf("ignoring unknown file %s in spool dir", file)
+			continue
+		}
+		s.segments = append(s.segments, &segment{firstSeq: firstSeq, path: file})
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i].firstSeq < s.segments[j].firstSeq })
+
+	readFound := false
+	for i, seg := range s.segments {
+		last := i == len(s.segments)-1
+
+		data, err := os.ReadFile(seg.path)
+		if err != nil {
+			return fmt.Errorf("failed to read spool segment %s: %v", seg.path, err)
+		}
+
+		var offset int64
+		for offset < int64(len(data)) {
+			rec, size, err := decodeRecord(data[offset:])
+			if err != nil {
+				if !last {
+					return fmt.Errorf("spool segment %s at offset %d: %v", seg.path, offset, err)
+				}
+				// only the last write can be torn by a crash, the records before it are intact
+				logrus.Warnf("truncating spool segment %s at offset %d: %v", seg.path, offset, err)
+				if err := os.Truncate(seg.path, offset); err != nil {
+					return fmt.Errorf("failed to truncate spool segment %s: %v", seg.path, err)
+				}
+				break
+			}
+
+			if !readFound && rec.Seq > s.forwarded {
+				s.readSegment, s.readOffset, readFound = i, offset, true
+			}
+			s.nextSeq = rec.Seq + 1
+			offset += size
+		}
+		seg.size = offset
+	}
+
+	if s.nextSeq <= s.forwarded {
+		// all the records were forwarded and their segments deleted
+		s.nextSeq = s.forwarded + 1
+	}
+	if !readFound && len(s.segments) > 0 {
+		s.readSegment, s.readOffset = len(s.segments)-1, s.segments[len(s.segments)-1].size
+	}
+	if err := s.deleteForwardedSegments(); err != nil {
+		return err
+	}
+
+	if len(s.segments) == 0 {
+		return s.rotate()
+	}
+	active := s.segments[len(s.segments)-1]
+	s.active, err = os.OpenFile(active.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment %s: %v", active.path, err)
+	}
+	return nil
+}
+
+// Append writes the message to the end of the spool and returns its sequence
+func (s *Spool) Append(message types.Message) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.active == nil {
+		return 0, fmt.Errorf("spool closed")
+	}
+	if len(message.ID) > maxIDSize {
+		return 0, fmt.Errorf("message id longer than %d bytes", maxIDSize)
+	}
+	if len(message.Channel) > maxChannelSize {
+		return 0, fmt.Errorf("channel longer than %d bytes", maxChannelSize)
+	}
+
+	if s.segments[len(s.segments)-1].size >= s.config.SegmentSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	seq := s.nextSeq
+	data := encodeRecord(Record{Seq: seq, Message: message})
+	if _, err := s.active.Write(data); err != nil {
+		return 0, fmt.Errorf("failed to write to spool: %v", err)
+	}
+	if s.config.SyncInterval == 0 {
+		if err := s.active.Sync(); err != nil {
+			return 0, fmt.Errorf("failed to sync spool: %v", err)
+		}
+	} else {
+		s.unsynced = true
+	}
+
+	s.segments[len(s.segments)-1].size += int64(len(data))
+	s.nextSeq++
+	return seq, nil
+}
+
+// Peek returns the oldest record which was not forwarded yet, it reports false when the spool is empty
+func (s *Spool) Peek() (Record, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for s.readOffset >= s.segments[s.readSegment].size {
+		if s.readSegment == len(s.segments)-1 {
+			return Record{}, false, nil
+		}
+		s.readSegment++
+		s.readOffset = 0
+		if s.reader != nil {
+			s.reader.Close()
+			s.reader = nil
+		}
+	}
+
+	if s.reader == nil {
+		reader, err := os.Open(s.segments[s.readSegment].path)
+		if err != nil {
+			return Record{}, false, fmt.Errorf("failed to open spool segment: %v", err)
+		}
+		s.reader = reader
+	}
+
+	var header [recordHeaderSize]byte
+	if _, err := s.reader.ReadAt(header[:], s.readOffset); err != nil {
+		return Record{}, false, fmt.Errorf("failed to read spool record: %v", err)
+	}
+	data := make([]byte, recordHeaderSize+int(binary.BigEndian.Uint32(header[0:4])))
+	if _, err := s.reader.ReadAt(data, s.readOffset); err != nil {
+		return Record{}, false, fmt.Errorf("failed to read spool record: %v", err)
+	}
+
+	rec, size, err := decodeRecord(data)
+	if err != nil {
+		return Record{}, false, err
+	}
+	s.peekedSize = size
+	return rec, true, nil
+}
+
+// Commit marks the record returned by the last Peek as forwarded
+func (s *Spool) Commit(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.peekedSize == 0 {
+		return fmt.Errorf("no record to commit")
+	}
+	s.readOffset += s.peekedSize
+	s.peekedSize = 0
+	s.forwarded = rec.Seq
+
+	if err := s.writeCursor(); err != nil {
+		return err
+	}
+	return s.deleteForwardedSegments()
+}
+
+// Depth returns the number of records which were not forwarded yet
+func (s *Spool) Depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int(s.nextSeq - 1 - s.forwarded)
+}
+
+func (s *Spool) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stats := Stats{
+		Depth:    int(s.nextSeq - 1 - s.forwarded),
+		Segments: len(s.segments),
+	}
+	for _, seg := range s.segments {
+		stats.Bytes += seg.size
+	}
+	return stats
+}
+
+func (s *Spool) Close() error {
+	close(s.stop)
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	if s.active != nil {
+		err = s.active.Sync()
+	}
+	s.closeFiles()
+	return err
+}
+
+func (s *Spool) closeFiles() {
+	if s.active != nil {
+		s.active.Close()
+		s.active = nil
+	}
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+func (s *Spool) syncLoop() {
+	defer s.wg.Done()
+
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.unsynced && s.active != nil {
+				if err := s.active.Sync(); err != nil {
+					logrus.Errorf("failed to sync spool: %v", err)
+				} else {
+					s.unsynced = false
+				}
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// rotate starts a new segment for the next appended record. Must be called with the lock held.
+func (s *Spool) rotate() error {
+	if s.active != nil {
+		if err := s.active.Sync(); err != nil {
+			return fmt.Errorf("failed to sync spool segment: %v", err)
+		}
+		s.active.Close()
+		s.active = nil
+	}
+
+	path := filepath.Join(s.config.Dir, fmt.Sprintf("%020d%s", s.nextSeq, segmentFileExt))
+	active, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create spool segment: %v", err)
+	}
+	s.active = active
+	s.segments = append(s.segments, &segment{firstSeq: s.nextSeq, path: path})
+	return nil
+}
+
+// deleteForwardedSegments removes the segments before the one of the next record to forward,
+// the segment appended to is kept. Must be called with the lock held.
+func (s *Spool) deleteForwardedSegments() error {
+	for s.readSegment > 0 {
+		if err := os.Remove(s.segments[0].path); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to delete spool segment: %v", err)
+		}
+		s.segments = s.segments[1:]
+		s.readSegment--
+	}
+	return nil
+}
+
+func (s *Spool) readCursor() (uint64, error) {
+	data, err := os.ReadFile(filepath.Join(s.config.Dir, cursorFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read spool cursor: %v", err)
+	}
+
+	forwarded, err := strconv.ParseUint(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid spool cursor: %v", err)
+	}
+	return forwarded, nil
+}
+
+// writeCursor replaces the cursor file, a crash before the new cursor is written
+// makes the last records to be forwarded again. Must be called with the lock held.
+func (s *Spool) writeCursor() error {
+	tmp, err := os.CreateTemp(s.config.Dir, "cursor-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spool cursor: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(strconv.FormatUint(s.forwarded, 10)); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write spool cursor: %v", err)
+	}
+	if s.config.SyncInterval == 0 {
+		if err := tmp.Sync(); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to sync spool cursor: %v", err)
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close spool cursor: %v", err)
+	}
+
+	return os.Rename(tmp.Name(), filepath.Join(s.config.Dir, cursorFile))
+}
+
+func encodeRecord(rec Record) []byte {
+	msg := rec.Message
+	bodySize := bodyHeaderSize + len(msg.Channel) + len(msg.ID) + len(msg.Payload)
+	if !msg.ExpiresAt.IsZero() {
+		bodySize += expirySize
+	}
+	data := make([]byte, recordHeaderSize+bodySize)
+
+	body := data[recordHeaderSize:]
+	binary.BigEndian.PutUint64(body[0:8], rec.Seq)
+	body[8] = byte(msg.Priority)
+	binary.BigEndian.PutUint16(body[9:11], uint16(len(msg.Channel)))
+	body[11] = byte(len(msg.ID))
+	n := copy(body[bodyHeaderSize:], msg.Channel)
+	n += copy(body[bodyHeaderSize+n:], msg.ID)
+	if !msg.ExpiresAt.IsZero() {
+		body[8] |= expiryFlag
+		binary.BigEndian.PutUint64(body[bodyHeaderSize+n:], uint64(msg.ExpiresAt.UnixNano()))
+		n += expirySize
+	}
+	copy(body[bodyHeaderSize+n:], msg.Payload)
+
+	binary.BigEndian.PutUint32(data[0:4], uint32(bodySize))
+	binary.BigEndian.PutUint32(data[4:8], crc32.Checksum(body, crcTable))
+	return data
+}
+
+// decodeRecord reads the record at the start of data and returns it together with its size
+func decodeRecord(data []byte) (Record, int64, error) {
+	if len(data) < recordHeaderSize {
+		return Record{}, 0, errCorrupt
+	}
+	bodySize := int(binary.BigEndian.Uint32(data[0:4]))
+	if bodySize < bodyHeaderSize || len(data) < recordHeaderSize+bodySize {
+		return Record{}, 0, errCorrupt
+	}
+
+	body := data[recordHeaderSize : recordHeaderSize+bodySize]
+	if crc32.Checksum(body, crcTable) != binary.BigEndian.Uint32(data[4:8]) {
+		return Record{}, 0, errCorrupt
+	}
+
+	channelEnd := bodyHeaderSize + int(binary.BigEndian.Uint16(body[9:11]))
+	idEnd := channelEnd + int(body[11])
+	payloadStart := idEnd
+	if body[8]&expiryFlag != 0 {
+		payloadStart += expirySize
+	}
+	if payloadStart > bodySize {
+		return Record{}, 0, errCorrupt
+	}
+
+	payload := make([]byte, bodySize-payloadStart)
+	copy(payload, body[payloadStart:])
+
+	rec := Record{
+		Seq: binary.BigEndian.Uint64(body[0:8]),
+		Message: types.Message{
+			ID:       string(body[channelEnd:idEnd]),
+			Channel:  string(body[bodyHeaderSize:channelEnd]),
+			Priority: types.Priority(body[8] &^ expiryFlag),
+			Payload:  payload,
+		},
+	}
+	if payloadStart > idEnd {
+		rec.Message.ExpiresAt = time.Unix(0, int64(binary.BigEndian.Uint64(body[idEnd:payloadStart])))
+	}
+	return rec, int64(recordHeaderSize + bodySize), nil
+}
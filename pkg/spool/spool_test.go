@@ -0,0 +1,196 @@
+package spool_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/spool"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Spool", func() {
+	var (
+		config spool.Config
+		s      *spool.Spool
+	)
+
+	message := func(i int) types.Message {
+		return types.Message{ID: fmt.Sprint("id-", i), Channel: "email", Priority: types.PriorityHigh, Payload: []byte(fmt.Sprintf(`{"content":"%d"}`, i))}
+	}
+
+	open := func() {
+		var err error
+		s, err = spool.Open(config)
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	reopen := func() {
+		Expect(s.Close()).To(Succeed())
+		open()
+	}
+
+	// forward commits the next n records and returns their messages
+	forward := func(n int) []types.Message {
+		var messages []types.Message
+		for i := 0; i < n; i++ {
+			rec, ok, err := s.Peek()
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ok).To(BeTrue())
+			Expect(s.Commit(rec)).To(Succeed())
+			messages = append(messages, rec.Message)
+		}
+		return messages
+	}
+
+	segmentFiles := func() []string {
+		files, _ := filepath.Glob(filepath.Join(config.Dir, "*.seg"))
+		return files
+	}
+
+	BeforeEach(func() {
+		config = spool.Config{Dir: GinkgoT().TempDir(), SegmentSize: 1024}
+		open()
+	})
+
+	AfterEach(func() {
+		s.Close()
+	})
+
+	It("returns the records in the order they were appended", func() {
+		for i := 1; i <= 3; i++ {
+			seq, err := s.Append(message(i))
+			Expect(err).NotTo(HaveOccurred())
+			Expect(seq).To(Equal(uint64(i)))
+		}
+		Expect(s.Depth()).To(Equal(3))
+
+		Expect(forward(3)).To(Equal([]types.Message{message(1), message(2), message(3)}))
+		Expect(s.Depth()).To(Equal(0))
+
+		_, ok, err := s.Peek()
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ok).To(BeFalse())
+	})
+
+	It("keeps the records which were not forwarded across restarts", func() {
+		for i := 1; i <= 3; i++ {
+			s.Append(message(i))
+		}
+		forward(1)
+
+		reopen()
+
+		Expect(s.Depth()).To(Equal(2))
+		Expect(forward(2)).To(Equal([]types.Message{message(2), message(3)}))
+
+		seq, err := s.Append(message(4))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(seq).To(Equal(uint64(4)))
+	})
+
+	It("keeps the expiry of the messages across restarts", func() {
+		expiring := message(1)
+		expiring.ExpiresAt = time.Now().Add(time.Minute)
+		s.Append(expiring)
+		s.Append(message(2))
+
+		reopen()
+
+		messages := forward(2)
+		Expect(messages[0].ExpiresAt).To(BeTemporally("==", expiring.ExpiresAt))
+		Expect(messages[0].Priority).To(Equal(types.PriorityHigh))
+		Expect(messages[0].Payload).To(Equal(expiring.Payload))
+		Expect(messages[1]).To(Equal(message(2)))
+	})
+
+	It("rejects message ids which do not fit the record", func() {
+		long := message(1)
+		long.ID = strings.Repeat("x", 256)
+		_, err := s.Append(long)
+		Expect(err).To(MatchError("message id longer than 255 bytes"))
+
+		long.ID = strings.Repeat("x", 255)
+		_, err = s.Append(long)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(forward(1)).To(Equal([]types.Message{long}))
+	})
+
+	It("splits the records into segments and deletes them once forwarded", func() {
+		for i := 1; i <= 100; i++ {
+			_, err := s.Append(message(i))
+			Expect(err).NotTo(HaveOccurred())
+		}
+		segments := len(segmentFiles())
+		Expect(segments).To(BeNumerically(">", 2))
+		Expect(s.Stats().Segments).To(Equal(segments))
+
+		forward(60)
+		Expect(len(segmentFiles())).To(BeNumerically("<", segments))
+
+		forward(40)
+		Expect(segmentFiles()).To(HaveLen(1))
+
+		reopen()
+		Expect(s.Depth()).To(Equal(0))
+		seq, _ := s.Append(message(101))
+		Expect(seq).To(Equal(uint64(101)))
+	})
+
+	It("drops a torn record at the end of the last segment", func() {
+		s.Append(message(1))
+		s.Append(message(2))
+		Expect(s.Close()).To(Succeed())
+
+		file := segmentFiles()[0]
+		info, err := os.Stat(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(os.Truncate(file, info.Size()-3)).To(Succeed())
+
+		open()
+		Expect(s.Depth()).To(Equal(1))
+		Expect(forward(1)).To(Equal([]types.Message{message(1)}))
+
+		seq, _ := s.Append(message(3))
+		Expect(seq).To(Equal(uint64(2)))
+		Expect(forward(1)).To(Equal([]types.Message{message(3)}))
+	})
+
+	It("refuses to open with a corrupt record before the last segment", func() {
+		for i := 1; i <= 100; i++ {
+			s.Append(message(i))
+		}
+		Expect(s.Close()).To(Succeed())
+
+		file := segmentFiles()[0]
+		data, err := os.ReadFile(file)
+		Expect(err).NotTo(HaveOccurred())
+		data[20] ^= 0xff
+		Expect(os.WriteFile(file, data, 0o644)).To(Succeed())
+
+		_, err = spool.Open(config)
+		Expect(err).To(MatchError(ContainSubstring("corrupt record")))
+
+		// leave a spool behind for AfterEach
+		Expect(os.WriteFile(file, nil, 0o644)).To(Succeed())
+		open()
+	})
+
+	Context("with a sync interval", func() {
+		BeforeEach(func() {
+			s.Close()
+			config.SyncInterval = 10 * time.Millisecond
+			open()
+		})
+
+		It("keeps the appended records across restarts", func() {
+			s.Append(message(1))
+			reopen()
+			Expect(forward(1)).To(Equal([]types.Message{message(1)}))
+		})
+	})
+})
@@ -0,0 +1,36 @@
+package sqldialect
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Dialect selects the placeholder style of SQL statements
+type Dialect string
+
+const (
+	// Postgres uses $1, $2, ... placeholders
+	Postgres Dialect = "postgres"
+	// MySQL uses ? placeholders, which SQLite understands as well
+	MySQL  Dialect = "mysql"
+	SQLite Dialect = "sqlite"
+)
+
+// Rebind replaces the ? placeholders of the statement with the ones of the dialect
+func (d Dialect) Rebind(statement string) string {
+	if d != Postgres {
+		return statement
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range statement {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package status
+
+import "errors"
+
+var ErrBatchNotFound = errors.New("batch not found")
+
+// BatchProgress is the aggregate state of the notifications of a batch
+type BatchProgress struct {
+	ID string `json:"id"`
+	// Total is the number of notifications of the batch the api accepted
+	Total int `json:"total"`
+	// States counts the notifications by their current state
+	States map[State]int `json:"states"`
+	// Completed counts the notifications which are delivered, failed, dead-lettered, canceled or expired
+	Completed int `json:"completed"`
+	// Done is set once all notifications of the batch are completed
+	Done bool `json:"done"`
+}
+
+// Final reports if no more attempts follow the state, dead-lettered notifications
+// only move on when they are requeued
+func (s State) Final() bool {
+	return s == StateDelivered || s == StateFailed || s == StateDeadLettered || s == StateCanceled || s == StateExpired
+}
+
+// newBatchProgress sums up the counts of the states, a batch without notifications is not found
+func newBatchProgress(id string, states map[State]int) (BatchProgress, error) {
+	progress := BatchProgress{ID: id, States: states}
+	for state, count := range states {
+		progress.Total += count
+		if state.Final() {
+			progress.Completed += count
+		}
+	}
+	if progress.Total == 0 {
+		return BatchProgress{}, ErrBatchNotFound
+	}
+	progress.Done = progress.Completed == progress.Total
+	return progress, nil
+}
@@ -0,0 +1,138 @@
+package status
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+type EventPublisher interface {
+	Publish(ctx context.Context, eventType events.Type, id string, body []byte) error
+}
+
+// Emitter publishes the lifecycle of notifications as events. Publishing is best effort like
+// recording, failures are logged and never fail a notification.
+type Emitter struct {
+	publisher EventPublisher
+	source    string
+	host      string
+}
+
+// NewEmitter creates an emitter of the events of the source
+func NewEmitter(publisher EventPublisher, source string) *Emitter {
+	hostname, _ := os.Hostname()
+	return &Emitter{
+		publisher: publisher,
+		source:    source,
+		host:      hostname,
+	}
+}
+
+func (e *Emitter) Accepted(ctx context.Context, notification Notification) {
+	e.emit(ctx, events.TypeAccepted, events.Data{
+		NotificationID: notification.ID,
+		Channel:        notification.Channel,
+		Priority:       notification.Priority,
+		Tenant:         notification.Tenant,
+		Tags:           notification.Tags,
+		State:          string(StateAccepted),
+	})
+}
+
+func (e *Emitter) Scheduled(ctx context.Context, id string) {
+	e.emit(ctx, events.TypeScheduled, events.Data{NotificationID: id, State: string(StateScheduled)})
+}
+
+func (e *Emitter) Canceled(ctx context.Context, id string) {
+	e.emit(ctx, events.TypeCanceled, events.Data{NotificationID: id, State: string(StateCanceled)})
+}
+
+// Queued emits nothing, the notification stays accepted until the service picks it up
+func (e *Emitter) Queued(ctx context.Context, id string) {}
+
+func (e *Emitter) Rejected(ctx context.Context, id string, cause error) {
+	e.emit(ctx, events.TypeFailed, events.Data{
+		NotificationID: id,
+		State:          string(StateFailed),
+		Error:          cause.Error(),
+		ErrorClass:     string(types.ClassOf(cause)),
+	})
+}
+
+func (e *Emitter) Sending(ctx context.Context, event types.EventContext) {
+	data := e.attemptData(event, "")
+	data.State = string(StateSending)
+	e.emit(ctx, events.TypeSent, data)
+}
+
+func (e *Emitter) Delivered(ctx context.Context, event types.EventContext) {
+	data := e.attemptData(event, "")
+	data.State = string(StateDelivered)
+	e.emit(ctx, events.TypeDelivered, data)
+}
+
+func (e *Emitter) Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome) {
+	state := FailedState(outcome)
+	eventType := events.TypeFailed
+	if state == StateDeadLettered {
+		eventType = events.TypeDeadLettered
+	}
+
+	data := e.attemptData(event, channel)
+	data.State = string(state)
+	data.Error = cause.Error()
+	data.ErrorClass = string(types.ClassOf(cause))
+	e.emit(ctx, eventType, data)
+}
+
+func (e *Emitter) Expired(ctx context.Context, event types.EventContext) {
+	data := e.attemptData(event, "")
+	data.State = string(StateExpired)
+	data.Attempt = event.RetryCount
+	e.emit(ctx, events.TypeExpired, data)
+}
+
+// attemptData describes the notification of a delivery attempt from the request the api published
+func (e *Emitter) attemptData(event types.EventContext, channel string) events.Data {
+	var request struct {
+		Channel string   `json:"channel"`
+		Tenant  string   `json:"tenant"`
+		Tags    []string `json:"tags"`
+	}
+	// an invalid payload still gets its event, only without these fields
+	json.Unmarshal(event.Payload, &request)
+	if channel == "" {
+		channel = request.Channel
+	}
+
+	return events.Data{
+		NotificationID: event.MessageId,
+		Channel:        channel,
+		Priority:       event.Priority.String(),
+		Tenant:         request.Tenant,
+		Tags:           request.Tags,
+		Attempt:        event.RetryCount + 1,
+	}
+}
+
+func (e *Emitter) emit(ctx context.Context, eventType events.Type, data events.Data) {
+	// messages published before the api assigned ids cannot be followed
+	if data.NotificationID == "" {
+		return
+	}
+	data.Host = e.host
+
+	event := events.New(types.NewMessageID(), e.source, eventType, data)
+	body, err := json.Marshal(event)
+	if err != nil {
+		logrus.Errorf("failed to marshal %s event of notification %s: %v", eventType, data.NotificationID, err)
+		return
+	}
+	if err := e.publisher.Publish(ctx, eventType, event.ID, body); err != nil {
+		logrus.Errorf("failed to publish %s event of notification %s: %v", eventType, data.NotificationID, err)
+	}
+}
@@ -0,0 +1,145 @@
+package status_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/events"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type publisher struct {
+	events []events.Event
+}
+
+func (p *publisher) Publish(ctx context.Context, eventType events.Type, id string, body []byte) error {
+	event, err := events.Parse(body)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(event.Type).To(Equal(eventType))
+	Expect(event.ID).To(Equal(id))
+	p.events = append(p.events, event)
+	return nil
+}
+
+var _ = Describe("Emitter", func() {
+	var (
+		published *publisher
+		emitter   *status.Emitter
+		ctx       context.Context
+		event     types.EventContext
+	)
+
+	BeforeEach(func() {
+		published = &publisher{}
+		emitter = status.NewEmitter(published, events.SourceService)
+		ctx = context.Background()
+		event = types.EventContext{
+			MessageId: "n1",
+			Priority:  types.PriorityHigh,
+			FirstSeen: time.Now(),
+			Payload:   []byte(`{"channel":"email","receiver":"a@example.com","tenant":"acme","tags":["welcome"]}`),
+		}
+	})
+
+	It("emits the accepted notification without its receiver", func() {
+		emitter.Accepted(ctx, status.Notification{ID: "n1", Channel: "email", Receiver: "a@example.com", Priority: "high", Tenant: "acme", Tags: []string{"welcome"}})
+
+		Expect(published.events).To(HaveLen(1))
+		e := published.events[0]
+		Expect(e.Type).To(Equal(events.TypeAccepted))
+		Expect(e.Source).To(Equal(events.SourceService))
+		Expect(e.Subject).To(Equal("n1"))
+		Expect(e.Data).To(Equal(events.Data{
+			NotificationID: "n1",
+			Channel:        "email",
+			Priority:       "high",
+			Tenant:         "acme",
+			Tags:           []string{"welcome"},
+			State:          "accepted",
+			Host:           e.Data.Host,
+		}))
+	})
+
+	It("emits the attempts with the fields of the payload", func() {
+		emitter.Sending(ctx, event)
+		emitter.Delivered(ctx, event)
+
+		Expect(published.events).To(HaveLen(2))
+		Expect(published.events[0].Type).To(Equal(events.TypeSent))
+		Expect(published.events[0].Data.State).To(Equal("sending"))
+		Expect(published.events[1].Type).To(Equal(events.TypeDelivered))
+		delivered := published.events[1].Data
+		Expect(delivered).To(Equal(events.Data{
+			NotificationID: "n1",
+			Channel:        "email",
+			Priority:       "high",
+			Tenant:         "acme",
+			Tags:           []string{"welcome"},
+			State:          "delivered",
+			Attempt:        1,
+			Host:           delivered.Host,
+		}))
+		Expect(published.events[0].ID).NotTo(Equal(published.events[1].ID))
+	})
+
+	It("tells retried failures from dead-lettered ones", func() {
+		cause := types.NewDeliveryError(types.ErrorClassSendFailed, errors.New("smtp down"))
+		emitter.Failed(ctx, event, "email", cause, types.OutcomeRetrying)
+		event.RetryCount = 2
+		emitter.Failed(ctx, event, "email", cause, types.OutcomeDeadLettered)
+
+		Expect(published.events).To(HaveLen(2))
+		Expect(published.events[0].Type).To(Equal(events.TypeFailed))
+		Expect(published.events[0].Data.State).To(Equal("retrying"))
+		Expect(published.events[0].Data.ErrorClass).To(Equal("send_failed"))
+		Expect(published.events[1].Type).To(Equal(events.TypeDeadLettered))
+		Expect(published.events[1].Data.State).To(Equal("dead_lettered"))
+		Expect(published.events[1].Data.Attempt).To(Equal(3))
+	})
+
+	It("emits expired notifications", func() {
+		emitter.Expired(ctx, event)
+
+		Expect(published.events).To(HaveLen(1))
+		Expect(published.events[0].Type).To(Equal(events.TypeExpired))
+		Expect(published.events[0].Data.State).To(Equal("expired"))
+		Expect(published.events[0].Data.Channel).To(Equal("email"))
+		Expect(published.events[0].Data.Attempt).To(BeZero())
+	})
+
+	It("emits rejected notifications as failed", func() {
+		emitter.Rejected(ctx, "n1", errors.New("broker down"))
+
+		Expect(published.events).To(HaveLen(1))
+		Expect(published.events[0].Type).To(Equal(events.TypeFailed))
+		Expect(published.events[0].Data.State).To(Equal("failed"))
+	})
+
+	It("skips notifications without an id", func() {
+		event.MessageId = ""
+		emitter.Delivered(ctx, event)
+		emitter.Queued(ctx, "n1")
+
+		Expect(published.events).To(BeEmpty())
+	})
+
+	It("passes every step to all observers", func() {
+		store := status.NewMemoryStore()
+		observers := status.Observers{
+			status.NewRecorder(store, status.Receivers{}),
+			emitter,
+		}
+
+		observers.Accepted(ctx, status.Notification{ID: "n1", Channel: "email"})
+		observers.Delivered(ctx, event)
+
+		n, err := store.Get(ctx, "n1")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.State).To(Equal(status.StateDelivered))
+		Expect(published.events).To(HaveLen(2))
+	})
+})
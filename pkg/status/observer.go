@@ -0,0 +1,84 @@
+package status
+
+import (
+	"context"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+)
+
+// Observer follows the lifecycle of notifications, the api reports the steps until a notification
+// is published and the service the delivery attempts
+type Observer interface {
+	Accepted(ctx context.Context, notification Notification)
+	Scheduled(ctx context.Context, id string)
+	Canceled(ctx context.Context, id string)
+	Queued(ctx context.Context, id string)
+	Rejected(ctx context.Context, id string, cause error)
+	Sending(ctx context.Context, event types.EventContext)
+	Delivered(ctx context.Context, event types.EventContext)
+	// Failed reports a failed attempt with the outcome the broker applied to it
+	Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome)
+	Expired(ctx context.Context, event types.EventContext)
+}
+
+var (
+	_ Observer = (*Recorder)(nil)
+	_ Observer = (*Emitter)(nil)
+)
+
+// Observers passes every step to all of its observers in order
+type Observers []Observer
+
+func (o Observers) Accepted(ctx context.Context, notification Notification) {
+	for _, observer := range o {
+		observer.Accepted(ctx, notification)
+	}
+}
+
+func (o Observers) Scheduled(ctx context.Context, id string) {
+	for _, observer := range o {
+		observer.Scheduled(ctx, id)
+	}
+}
+
+func (o Observers) Canceled(ctx context.Context, id string) {
+	for _, observer := range o {
+		observer.Canceled(ctx, id)
+	}
+}
+
+func (o Observers) Queued(ctx context.Context, id string) {
+	for _, observer := range o {
+		observer.Queued(ctx, id)
+	}
+}
+
+func (o Observers) Rejected(ctx context.Context, id string, cause error) {
+	for _, observer := range o {
+		observer.Rejected(ctx, id, cause)
+	}
+}
+
+func (o Observers) Sending(ctx context.Context, event types.EventContext) {
+	for _, observer := range o {
+		observer.Sending(ctx, event)
+	}
+}
+
+func (o Observers) Delivered(ctx context.Context, event types.EventContext) {
+	for _, observer := range o {
+		observer.Delivered(ctx, event)
+	}
+}
+
+func (o Observers) Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome) {
+	for _, observer := range o {
+		observer.Failed(ctx, event, channel, cause, outcome)
+	}
+}
+
+func (o Observers) Expired(ctx context.Context, event types.EventContext) {
+	for _, observer := range o {
+		observer.Expired(ctx, event)
+	}
+}
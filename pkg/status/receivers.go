@@ -0,0 +1,50 @@
+package status
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Receivers hashes the receivers of notifications so they can be searched, and masks them
+// before they are stored when the store must not keep them in clear text
+type Receivers struct {
+	key  []byte
+	mask bool
+}
+
+// NewReceivers creates the hashing of receivers. With a key receivers are hashed with HMAC-SHA256,
+// without it with plain SHA-256, which is easy to reverse for phone numbers and should only be
+// used when the receivers are not masked.
+func NewReceivers(key string, mask bool) Receivers {
+	return Receivers{key: []byte(key), mask: mask}
+}
+
+// Hash returns the hex encoded hash of the receiver, receivers are trimmed and
+// lowercased first so e.g. emails match regardless of their case
+func (r Receivers) Hash(receiver string) string {
+	normalized := []byte(strings.ToLower(strings.TrimSpace(receiver)))
+	if len(r.key) == 0 {
+		sum := sha256.Sum256(normalized)
+		return hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, r.key)
+	mac.Write(normalized)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Mask returns the receiver as it is stored, when masking is enabled only the first letter and the
+// domain of emails and the last 4 characters of other receivers are kept
+func (r Receivers) Mask(receiver string) string {
+	if !r.mask {
+		return receiver
+	}
+	if at := strings.LastIndex(receiver, "@"); at > 0 {
+		return receiver[:1] + "***" + receiver[at:]
+	}
+	if len(receiver) <= 4 {
+		return strings.Repeat("*", len(receiver))
+	}
+	return strings.Repeat("*", len(receiver)-4) + receiver[len(receiver)-4:]
+}
@@ -0,0 +1,25 @@
+package status_test
+
+import (
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Receivers", func() {
+	It("hashes normalized receivers with the key", func() {
+		receivers := status.NewReceivers("key", false)
+		Expect(receivers.Hash("A@Example.com ")).To(Equal(receivers.Hash("a@example.com")))
+		Expect(receivers.Hash("a@example.com")).NotTo(Equal(status.NewReceivers("other", false).Hash("a@example.com")))
+		Expect(receivers.Hash("a@example.com")).To(HaveLen(64))
+	})
+
+	It("masks receivers only when enabled", func() {
+		Expect(status.NewReceivers("", false).Mask("+359888123456")).To(Equal("+359888123456"))
+
+		receivers := status.NewReceivers("", true)
+		Expect(receivers.Mask("john@example.com")).To(Equal("j***@example.com"))
+		Expect(receivers.Mask("+359888123456")).To(Equal("*********3456"))
+		Expect(receivers.Mask("123")).To(Equal("***"))
+	})
+})
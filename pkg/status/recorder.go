@@ -0,0 +1,149 @@
+package status
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	StoreMemory   = "memory"
+	StorePostgres = "postgres"
+	StoreSQLite   = "sqlite3"
+)
+
+// Open creates the store selected by kind, it returns a nil store when kind is empty. The sql
+// drivers have to be registered by the binary. The memory store is only shared within the process.
+func Open(ctx context.Context, kind, dsn string) (Store, error) {
+	var dialect sqldialect.Dialect
+	switch kind {
+	case "":
+		return nil, nil
+	case StoreMemory:
+		return NewMemoryStore(), nil
+	case StorePostgres:
+		dialect = sqldialect.Postgres
+	case StoreSQLite:
+		dialect = sqldialect.SQLite
+	default:
+		return nil, fmt.Errorf("unknown status store: %s", kind)
+	}
+
+	db, err := sql.Open(kind, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open status store: %v", err)
+	}
+	store := NewSQLStore(db, dialect)
+	if err := store.Migrate(ctx); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return store, nil
+}
+
+// Recorder records the lifecycle of notifications in a store. Recording is best effort,
+// failures are logged and never fail the delivery of a notification.
+type Recorder struct {
+	store     Store
+	receivers Receivers
+	host      string
+}
+
+// NewRecorder creates a recorder, receivers hashes and masks the receivers of accepted notifications
+func NewRecorder(store Store, receivers Receivers) *Recorder {
+	hostname, _ := os.Hostname()
+	return &Recorder{
+		store:     store,
+		receivers: receivers,
+		host:      hostname,
+	}
+}
+
+// Accepted creates the notification in the accepted state
+func (r *Recorder) Accepted(ctx context.Context, notification Notification) {
+	now := time.Now()
+	notification.ReceiverHash = r.receivers.Hash(notification.Receiver)
+	notification.Receiver = r.receivers.Mask(notification.Receiver)
+	notification.State = StateAccepted
+	notification.CreatedAt = now
+	notification.UpdatedAt = now
+
+	event := Event{NotificationID: notification.ID, State: StateAccepted, Host: r.host, Time: now}
+	if err := r.store.Create(ctx, notification, event); err != nil {
+		logrus.Errorf("failed to record notification %s: %v", notification.ID, err)
+	}
+}
+
+func (r *Recorder) Scheduled(ctx context.Context, id string) {
+	r.record(ctx, Event{NotificationID: id, State: StateScheduled})
+}
+
+func (r *Recorder) Canceled(ctx context.Context, id string) {
+	r.record(ctx, Event{NotificationID: id, State: StateCanceled})
+}
+
+func (r *Recorder) Queued(ctx context.Context, id string) {
+	r.record(ctx, Event{NotificationID: id, State: StateQueued})
+}
+
+// Rejected records a notification the api could not publish
+func (r *Recorder) Rejected(ctx context.Context, id string, cause error) {
+	r.record(ctx, Event{NotificationID: id, State: StateFailed, Error: cause.Error()})
+}
+
+func (r *Recorder) Sending(ctx context.Context, event types.EventContext) {
+	r.record(ctx, Event{NotificationID: event.MessageId, State: StateSending, Attempt: event.RetryCount + 1})
+}
+
+func (r *Recorder) Delivered(ctx context.Context, event types.EventContext) {
+	r.record(ctx, Event{NotificationID: event.MessageId, State: StateDelivered, Attempt: event.RetryCount + 1})
+}
+
+// FailedState returns the state the outcome of a failed attempt leaves the notification in
+func FailedState(outcome types.Outcome) State {
+	switch outcome {
+	case types.OutcomeFailed:
+		return StateFailed
+	case types.OutcomeDeadLettered:
+		return StateDeadLettered
+	default:
+		return StateRetrying
+	}
+}
+
+// Failed records a failed attempt with the outcome the broker applied to it
+func (r *Recorder) Failed(ctx context.Context, event types.EventContext, channel string, cause error, outcome types.Outcome) {
+	r.record(ctx, Event{
+		NotificationID: event.MessageId,
+		State:          FailedState(outcome),
+		Attempt:        event.RetryCount + 1,
+		Error:          cause.Error(),
+	})
+}
+
+// Expired records a notification the service dropped instead of sending as it expired,
+// the attempts are the ones which failed before
+func (r *Recorder) Expired(ctx context.Context, event types.EventContext) {
+	r.record(ctx, Event{NotificationID: event.MessageId, State: StateExpired, Attempt: event.RetryCount})
+}
+
+func (r *Recorder) record(ctx context.Context, event Event) {
+	// messages published before the api assigned ids cannot be tracked
+	if event.NotificationID == "" {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	event.Host = r.host
+
+	if err := r.store.Record(ctx, event); err != nil {
+		logrus.Errorf("failed to record %s state of notification %s: %v", event.State, event.NotificationID, err)
+	}
+}
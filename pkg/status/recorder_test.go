@@ -0,0 +1,124 @@
+package status_test
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	"github.com/AlexTsIvanov/notification-system/pkg/types"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		store    *status.MemoryStore
+		recorder *status.Recorder
+		ctx      context.Context
+		event    types.EventContext
+	)
+
+	BeforeEach(func() {
+		store = status.NewMemoryStore()
+		recorder = status.NewRecorder(store, status.NewReceivers("key", true))
+		ctx = context.Background()
+		event = types.EventContext{MessageId: "n1", FirstSeen: time.Now()}
+
+		recorder.Accepted(ctx, status.Notification{ID: "n1", Channel: "email", Receiver: "a@example.com", Priority: "normal"})
+		recorder.Queued(ctx, "n1")
+	})
+
+	state := func() status.Notification {
+		n, err := store.Get(ctx, "n1")
+		Expect(err).NotTo(HaveOccurred())
+		return n
+	}
+
+	It("records the outcomes of the failed attempts", func() {
+		for retries := 0; retries < 2; retries++ {
+			event.RetryCount = retries
+			recorder.Sending(ctx, event)
+			recorder.Failed(ctx, event, "email", errors.New("smtp down"), types.OutcomeRetrying)
+			Expect(state().State).To(Equal(status.StateRetrying))
+		}
+
+		event.RetryCount = 2
+		recorder.Sending(ctx, event)
+		recorder.Failed(ctx, event, "email", errors.New("smtp down"), types.OutcomeDeadLettered)
+
+		n := state()
+		Expect(n.State).To(Equal(status.StateDeadLettered))
+		Expect(n.Attempts).To(Equal(3))
+		Expect(n.History).To(HaveLen(8))
+		Expect(n.History[7].Error).To(Equal("smtp down"))
+	})
+
+	It("records permanent failures as failed", func() {
+		recorder.Sending(ctx, event)
+		recorder.Failed(ctx, event, "email", types.NewDeliveryError(types.ErrorClassInvalidPayload, errors.New("bad json")), types.OutcomeFailed)
+
+		Expect(state().State).To(Equal(status.StateFailed))
+	})
+
+	It("records deliveries", func() {
+		recorder.Sending(ctx, event)
+		recorder.Delivered(ctx, event)
+
+		n := state()
+		Expect(n.State).To(Equal(status.StateDelivered))
+		Expect(n.Channel).To(Equal("email"))
+		Expect(n.History[0].State).To(Equal(status.StateAccepted))
+		Expect(n.History[0].Host).NotTo(BeEmpty())
+	})
+
+	It("records scheduled notifications as queued once they are released", func() {
+		recorder.Accepted(ctx, status.Notification{ID: "n2", Channel: "sms", Receiver: "+359888123456", Priority: "normal"})
+		recorder.Scheduled(ctx, "n2")
+		n, err := store.Get(ctx, "n2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.State).To(Equal(status.StateScheduled))
+
+		recorder.Queued(ctx, "n2")
+		n, err = store.Get(ctx, "n2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.State).To(Equal(status.StateQueued))
+	})
+
+	It("records canceled notifications", func() {
+		recorder.Accepted(ctx, status.Notification{ID: "n2", Channel: "sms", Receiver: "+359888123456", Priority: "normal"})
+		recorder.Scheduled(ctx, "n2")
+		recorder.Canceled(ctx, "n2")
+
+		n, err := store.Get(ctx, "n2")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(n.State).To(Equal(status.StateCanceled))
+		Expect(n.State.Final()).To(BeTrue())
+	})
+
+	It("records expired notifications", func() {
+		event.RetryCount = 1
+		recorder.Expired(ctx, event)
+
+		n := state()
+		Expect(n.State).To(Equal(status.StateExpired))
+		Expect(n.State.Final()).To(BeTrue())
+		Expect(n.Attempts).To(Equal(1))
+	})
+
+	It("stores the masked receiver with its hash", func() {
+		n := state()
+		Expect(n.Receiver).To(Equal("a***@example.com"))
+		Expect(n.ReceiverHash).To(Equal(status.NewReceivers("key", false).Hash(" A@example.com")))
+
+		page, err := store.Search(ctx, status.Query{ReceiverHash: n.ReceiverHash})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(page.Items).To(HaveLen(1))
+	})
+
+	It("ignores messages without id", func() {
+		recorder.Sending(ctx, types.EventContext{})
+		_, err := store.Get(ctx, "")
+		Expect(err).To(MatchError(status.ErrNotFound))
+	})
+})
@@ -0,0 +1,226 @@
+package status
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+const defaultSearchLimit = 50
+
+// Sort is the order of search results, notifications with the same time are ordered by id
+type Sort string
+
+const (
+	SortCreatedAsc  Sort = "created_at"
+	SortCreatedDesc Sort = "-created_at"
+	SortUpdatedAsc  Sort = "updated_at"
+	SortUpdatedDesc Sort = "-updated_at"
+)
+
+// ParseSort parses the sort of a search, an empty string sorts the newest notifications first
+func ParseSort(s string) (Sort, error) {
+	switch sort := Sort(s); sort {
+	case "":
+		return SortCreatedDesc, nil
+	case SortCreatedAsc, SortCreatedDesc, SortUpdatedAsc, SortUpdatedDesc:
+		return sort, nil
+	default:
+		return "", fmt.Errorf("unknown sort: %s", s)
+	}
+}
+
+func (s Sort) descending() bool {
+	return strings.HasPrefix(string(s), "-")
+}
+
+// column is the column of the notification table the results are ordered by
+func (s Sort) column() string {
+	return strings.TrimPrefix(string(s), "-")
+}
+
+func (s Sort) key(n Notification) int64 {
+	if s.column() == "updated_at" {
+		return n.UpdatedAt.UnixMilli()
+	}
+	return n.CreatedAt.UnixMilli()
+}
+
+// ParseState validates a state of a search filter
+func ParseState(s string) (State, error) {
+	switch state := State(s); state {
+	case StateAccepted, StateScheduled, StateQueued, StateSending, StateRetrying, StateDelivered, StateFailed, StateDeadLettered, StateCanceled, StateExpired:
+		return state, nil
+	default:
+		return "", fmt.Errorf("unknown state: %s", s)
+	}
+}
+
+// Query filters the notifications of a search, empty fields match all notifications
+type Query struct {
+	// ReceiverHash matches the notifications sent to the receiver with the hash of Receivers.Hash
+	ReceiverHash string
+	Channel      string
+	// States matches notifications in any of the states
+	States []State
+	Tenant string
+	Batch  string
+	// Tags matches notifications with all the tags
+	Tags []string
+	// From and To bound the creation time of the notifications, From is inclusive and To exclusive
+	From, To time.Time
+
+	Sort Sort
+	// Cursor continues a search from the NextCursor of its previous page, it is only
+	// valid with the same filters and sort
+	Cursor string
+	Limit  int
+}
+
+// Page is a page of search results, the notifications are returned without their history
+type Page struct {
+	Items []Notification `json:"items"`
+	// NextCursor continues the search, it is empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// cursor is the position of the last notification of a page in the sort order
+type cursor struct {
+	key int64
+	id  string
+}
+
+func encodeCursor(sort Sort, n Notification) string {
+	raw := fmt.Sprintf("%s|%d|%s", sort, sort.key(n), n.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor returns nil for an empty cursor, cursors of another sort are invalid
+func decodeCursor(sort Sort, s string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 || Sort(parts[0]) != sort {
+		return nil, ErrInvalidCursor
+	}
+	key, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &cursor{key: key, id: parts[2]}, nil
+}
+
+// after reports if the notification comes after the cursor in the sort order
+func (c *cursor) after(sort Sort, n Notification) bool {
+	key := sort.key(n)
+	if key == c.key {
+		if sort.descending() {
+			return n.ID < c.id
+		}
+		return n.ID > c.id
+	}
+	if sort.descending() {
+		return key < c.key
+	}
+	return key > c.key
+}
+
+// withDefaults returns the query with the default sort and limit when they are not set
+func (q Query) withDefaults() Query {
+	if q.Sort == "" {
+		q.Sort = SortCreatedDesc
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultSearchLimit
+	}
+	return q
+}
+
+func (q Query) matches(n Notification) bool {
+	if q.ReceiverHash != "" && n.ReceiverHash != q.ReceiverHash {
+		return false
+	}
+	if q.Channel != "" && n.Channel != q.Channel {
+		return false
+	}
+	if q.Tenant != "" && n.Tenant != q.Tenant {
+		return false
+	}
+	if q.Batch != "" && n.Batch != q.Batch {
+		return false
+	}
+	if len(q.States) > 0 && !containsState(q.States, n.State) {
+		return false
+	}
+	for _, tag := range q.Tags {
+		if !containsTag(n.Tags, tag) {
+			return false
+		}
+	}
+	created := n.CreatedAt.UnixMilli()
+	if !q.From.IsZero() && created < q.From.UnixMilli() {
+		return false
+	}
+	if !q.To.IsZero() && created >= q.To.UnixMilli() {
+		return false
+	}
+	return true
+}
+
+// sortNotifications orders the notifications by the sort and their id
+func sortNotifications(notifications []Notification, s Sort) {
+	sort.Slice(notifications, func(i, j int) bool {
+		ki, kj := s.key(notifications[i]), s.key(notifications[j])
+		if ki == kj {
+			if s.descending() {
+				return notifications[i].ID > notifications[j].ID
+			}
+			return notifications[i].ID < notifications[j].ID
+		}
+		if s.descending() {
+			return ki > kj
+		}
+		return ki < kj
+	})
+}
+
+// page cuts the page from the results fetched with one more notification than the limit
+func page(notifications []Notification, q Query) Page {
+	if len(notifications) <= q.Limit {
+		if notifications == nil {
+			notifications = []Notification{}
+		}
+		return Page{Items: notifications}
+	}
+	items := notifications[:q.Limit]
+	return Page{Items: items, NextCursor: encodeCursor(q.Sort, items[len(items)-1])}
+}
+
+func containsState(states []State, state State) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,423 @@
+package status
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+)
+
+const (
+	notificationsTable = "notification_status"
+	eventsTable        = "notification_status_events"
+	tagsTable          = "notification_status_tags"
+
+	notificationColumns = "id, channel, receiver, priority, receiver_hash, tenant, tags, batch_id, state, attempts, created_at, updated_at"
+	eventColumns        = "seq, notification_id, state, attempt, error, host, time"
+
+	// postgresSettle is how long events are held back from streams on postgres, where the events of
+	// concurrent transactions can commit after events with a higher seq were already read
+	postgresSettle = time.Second
+)
+
+// SQLStore is a Store in a postgres or sqlite database shared by the api and the service instances.
+// All the times are stored as unix milliseconds.
+type SQLStore struct {
+	db      *sql.DB
+	dialect sqldialect.Dialect
+}
+
+func NewSQLStore(db *sql.DB, dialect sqldialect.Dialect) *SQLStore {
+	return &SQLStore{db: db, dialect: dialect}
+}
+
+// Migrate creates the tables of the store when they do not exist
+func (s *SQLStore) Migrate(ctx context.Context) error {
+	seqColumn := "seq INTEGER PRIMARY KEY AUTOINCREMENT"
+	switch s.dialect {
+	case sqldialect.Postgres:
+		seqColumn = "seq BIGSERIAL PRIMARY KEY"
+	case sqldialect.SQLite:
+	default:
+		return fmt.Errorf("unsupported status store dialect: %s", s.dialect)
+	}
+
+	statements := []string{
+		`CREATE TABLE IF NOT EXISTS ` + notificationsTable + ` (
+			id            TEXT PRIMARY KEY,
+			channel       TEXT NOT NULL,
+			receiver      TEXT NOT NULL,
+			priority      TEXT NOT NULL,
+			receiver_hash TEXT NOT NULL,
+			tenant        TEXT NOT NULL,
+			tags          TEXT NOT NULL,
+			batch_id      TEXT NOT NULL,
+			state         TEXT NOT NULL,
+			attempts      INTEGER NOT NULL,
+			created_at    BIGINT NOT NULL,
+			updated_at    BIGINT NOT NULL
+		)`,
+		`CREATE TABLE IF NOT EXISTS ` + eventsTable + ` (
+			` + seqColumn + `,
+			notification_id TEXT NOT NULL,
+			state           TEXT NOT NULL,
+			attempt         INTEGER NOT NULL,
+			error           TEXT NOT NULL,
+			host            TEXT NOT NULL,
+			time            BIGINT NOT NULL
+		)`,
+		// the tags are kept as JSON in the notification for reading and in their own table for searching
+		`CREATE TABLE IF NOT EXISTS ` + tagsTable + ` (
+			tag             TEXT NOT NULL,
+			notification_id TEXT NOT NULL,
+			PRIMARY KEY (tag, notification_id)
+		)`,
+		`CREATE INDEX IF NOT EXISTS ` + eventsTable + `_notification ON ` + eventsTable + ` (notification_id, seq)`,
+		// the searches are ordered by created_at or updated_at, the filters narrow them down by time
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_created ON ` + notificationsTable + ` (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_updated ON ` + notificationsTable + ` (updated_at, id)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_receiver ON ` + notificationsTable + ` (receiver_hash, created_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_tenant ON ` + notificationsTable + ` (tenant, created_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_channel ON ` + notificationsTable + ` (channel, created_at)`,
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_state ON ` + notificationsTable + ` (state, created_at)`,
+		// the progress of a batch counts its notifications by state
+		`CREATE INDEX IF NOT EXISTS ` + notificationsTable + `_batch ON ` + notificationsTable + ` (batch_id, state)`,
+	}
+	for _, statement := range statements {
+		if _, err := s.db.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to migrate status store: %v", err)
+		}
+	}
+	return nil
+}
+
+func (s *SQLStore) Create(ctx context.Context, notification Notification, event Event) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		tags, err := json.Marshal(notification.Tags)
+		if err != nil {
+			return fmt.Errorf("failed to marshal tags: %v", err)
+		}
+		_, err = tx.ExecContext(ctx, s.dialect.Rebind(
+			"INSERT INTO "+notificationsTable+" ("+notificationColumns+") VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"),
+			notification.ID, notification.Channel, notification.Receiver, notification.Priority, notification.ReceiverHash,
+			notification.Tenant, string(tags), notification.Batch, string(notification.State), notification.Attempts,
+			notification.CreatedAt.UnixMilli(), notification.UpdatedAt.UnixMilli(),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to insert notification: %v", err)
+		}
+		seen := make(map[string]bool, len(notification.Tags))
+		for _, tag := range notification.Tags {
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+			_, err := tx.ExecContext(ctx, s.dialect.Rebind("INSERT INTO "+tagsTable+" (tag, notification_id) VALUES (?, ?)"), tag, notification.ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert notification tag: %v", err)
+			}
+		}
+		return s.insertEvent(ctx, tx, event)
+	})
+}
+
+func (s *SQLStore) Record(ctx context.Context, event Event) error {
+	return s.inTx(ctx, func(tx *sql.Tx) error {
+		var (
+			state    string
+			attempts int
+		)
+		query := "SELECT state, attempts FROM " + notificationsTable + " WHERE id = ?"
+		if s.dialect == sqldialect.Postgres {
+			// the api and the service may record events of the same notification at once, sqlite has no
+			// row locks, its dsn should set _txlock=immediate to lock the database for the transaction
+			query += " FOR UPDATE"
+		}
+		err := tx.QueryRowContext(ctx, s.dialect.Rebind(query), event.NotificationID).Scan(&state, &attempts)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			_, err = tx.ExecContext(ctx, s.dialect.Rebind(
+				"INSERT INTO "+notificationsTable+" ("+notificationColumns+") VALUES (?, '', '', '', '', '', 'null', '', ?, ?, ?, ?)"),
+				event.NotificationID, string(event.State), event.Attempt, event.Time.UnixMilli(), event.Time.UnixMilli(),
+			)
+		case err != nil:
+			return fmt.Errorf("failed to get notification: %v", err)
+		default:
+			if event.Attempt > attempts {
+				attempts = event.Attempt
+			}
+			_, err = tx.ExecContext(ctx, s.dialect.Rebind("UPDATE "+notificationsTable+" SET state = ?, attempts = ?, updated_at = ? WHERE id = ?"),
+				string(nextState(State(state), event)), attempts, event.Time.UnixMilli(), event.NotificationID,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update notification: %v", err)
+		}
+		return s.insertEvent(ctx, tx, event)
+	})
+}
+
+func (s *SQLStore) Get(ctx context.Context, id string) (Notification, error) {
+	n, err := scanNotification(s.db.QueryRowContext(ctx, s.dialect.Rebind(
+		"SELECT "+notificationColumns+" FROM "+notificationsTable+" WHERE id = ?"), id,
+	))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Notification{}, ErrNotFound
+	}
+	if err != nil {
+		return Notification{}, fmt.Errorf("failed to get notification: %v", err)
+	}
+
+	n.History, err = s.queryEvents(ctx, "SELECT "+eventColumns+" FROM "+eventsTable+" WHERE notification_id = ? ORDER BY seq", id)
+	if err != nil {
+		return Notification{}, fmt.Errorf("failed to get notification history: %v", err)
+	}
+	return n, nil
+}
+
+func (s *SQLStore) Search(ctx context.Context, query Query) (Page, error) {
+	query = query.withDefaults()
+	after, err := decodeCursor(query.Sort, query.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	where := func(condition string, values ...interface{}) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if query.ReceiverHash != "" {
+		where("receiver_hash = ?", query.ReceiverHash)
+	}
+	if query.Channel != "" {
+		where("channel = ?", query.Channel)
+	}
+	if query.Tenant != "" {
+		where("tenant = ?", query.Tenant)
+	}
+	if query.Batch != "" {
+		where("batch_id = ?", query.Batch)
+	}
+	if len(query.States) > 0 {
+		states := make([]interface{}, len(query.States))
+		for i, state := range query.States {
+			states[i] = string(state)
+		}
+		where("state IN ("+strings.TrimSuffix(strings.Repeat("?, ", len(states)), ", ")+")", states...)
+	}
+	for _, tag := range query.Tags {
+		where("id IN (SELECT notification_id FROM "+tagsTable+" WHERE tag = ?)", tag)
+	}
+	if !query.From.IsZero() {
+		where("created_at >= ?", query.From.UnixMilli())
+	}
+	if !query.To.IsZero() {
+		where("created_at < ?", query.To.UnixMilli())
+	}
+
+	column, direction, op := query.Sort.column(), "ASC", ">"
+	if query.Sort.descending() {
+		direction, op = "DESC", "<"
+	}
+	if after != nil {
+		where(fmt.Sprintf("(%s, id) %s (?, ?)", column, op), after.key, after.id)
+	}
+
+	statement := "SELECT " + notificationColumns + " FROM " + notificationsTable
+	if len(conditions) > 0 {
+		statement += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	statement += fmt.Sprintf(" ORDER BY %s %s, id %s LIMIT ?", column, direction, direction)
+	// one more than the limit tells if there is a next page
+	args = append(args, query.Limit+1)
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(statement), args...)
+	if err != nil {
+		return Page{}, fmt.Errorf("failed to search notifications: %v", err)
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		n, err := scanNotification(rows)
+		if err != nil {
+			return Page{}, fmt.Errorf("failed to read notification: %v", err)
+		}
+		notifications = append(notifications, n)
+	}
+	if err := rows.Err(); err != nil {
+		return Page{}, fmt.Errorf("failed to read notifications: %v", err)
+	}
+	return page(notifications, query), nil
+}
+
+func (s *SQLStore) Events(ctx context.Context, query EventQuery) ([]Event, error) {
+	query = query.withDefaults()
+
+	statement := "SELECT e." + strings.ReplaceAll(eventColumns, ", ", ", e.") + " FROM " + eventsTable + " e"
+	if query.Tenant != "" || query.Batch != "" {
+		statement += " JOIN " + notificationsTable + " n ON n.id = e.notification_id"
+	}
+	statement += " WHERE e.seq > ?"
+	args := []interface{}{query.After}
+	if len(query.IDs) > 0 {
+		statement += " AND e.notification_id IN (" + strings.TrimSuffix(strings.Repeat("?, ", len(query.IDs)), ", ") + ")"
+		for _, id := range query.IDs {
+			args = append(args, id)
+		}
+	}
+	if query.Tenant != "" {
+		statement += " AND n.tenant = ?"
+		args = append(args, query.Tenant)
+	}
+	if query.Batch != "" {
+		statement += " AND n.batch_id = ?"
+		args = append(args, query.Batch)
+	}
+	statement += " ORDER BY e.seq LIMIT ?"
+	args = append(args, query.Limit)
+
+	events, err := s.queryEvents(ctx, statement, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get notification events: %v", err)
+	}
+
+	if s.dialect == sqldialect.Postgres {
+		// the stream continues after the last returned event, so the events are cut at the first recent
+		// one, sqlite locks the database for every transaction and commits the events in seq order
+		settled := time.Now().Add(-postgresSettle)
+		for i, e := range events {
+			if e.Time.After(settled) {
+				return events[:i], nil
+			}
+		}
+	}
+	return events, nil
+}
+
+func (s *SQLStore) LastSeq(ctx context.Context) (int64, error) {
+	var seq sql.NullInt64
+	if err := s.db.QueryRowContext(ctx, "SELECT MAX(seq) FROM "+eventsTable).Scan(&seq); err != nil {
+		return 0, fmt.Errorf("failed to get last event: %v", err)
+	}
+	return seq.Int64, nil
+}
+
+func (s *SQLStore) Batch(ctx context.Context, id string) (BatchProgress, error) {
+	// notifications sent on their own have no batch
+	if id == "" {
+		return BatchProgress{}, ErrBatchNotFound
+	}
+
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(
+		"SELECT state, COUNT(*) FROM "+notificationsTable+" WHERE batch_id = ? GROUP BY state"), id)
+	if err != nil {
+		return BatchProgress{}, fmt.Errorf("failed to get batch: %v", err)
+	}
+	defer rows.Close()
+
+	states := make(map[State]int)
+	for rows.Next() {
+		var (
+			state string
+			count int
+		)
+		if err := rows.Scan(&state, &count); err != nil {
+			return BatchProgress{}, fmt.Errorf("failed to read batch: %v", err)
+		}
+		states[State(state)] = count
+	}
+	if err := rows.Err(); err != nil {
+		return BatchProgress{}, fmt.Errorf("failed to read batch: %v", err)
+	}
+	return newBatchProgress(id, states)
+}
+
+func (s *SQLStore) Close() error {
+	return s.db.Close()
+}
+
+// scanner is a *sql.Row or *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanNotification reads the notificationColumns of a row
+func scanNotification(row scanner) (Notification, error) {
+	var (
+		n                    Notification
+		tags, state          string
+		createdAt, updatedAt int64
+	)
+	err := row.Scan(&n.ID, &n.Channel, &n.Receiver, &n.Priority, &n.ReceiverHash, &n.Tenant, &tags, &n.Batch, &state, &n.Attempts, &createdAt, &updatedAt)
+	if err != nil {
+		return Notification{}, err
+	}
+	if err := json.Unmarshal([]byte(tags), &n.Tags); err != nil {
+		return Notification{}, fmt.Errorf("failed to unmarshal tags: %v", err)
+	}
+	n.State = State(state)
+	n.CreatedAt = time.UnixMilli(createdAt)
+	n.UpdatedAt = time.UnixMilli(updatedAt)
+	return n, nil
+}
+
+// queryEvents reads the eventColumns of the rows of the statement
+func (s *SQLStore) queryEvents(ctx context.Context, statement string, args ...interface{}) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, s.dialect.Rebind(statement), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var (
+			e     Event
+			state string
+			t     int64
+		)
+		if err := rows.Scan(&e.Seq, &e.NotificationID, &state, &e.Attempt, &e.Error, &e.Host, &t); err != nil {
+			return nil, err
+		}
+		e.State = State(state)
+		e.Time = time.UnixMilli(t)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+func (s *SQLStore) insertEvent(ctx context.Context, tx *sql.Tx, event Event) error {
+	_, err := tx.ExecContext(ctx, s.dialect.Rebind(
+		"INSERT INTO "+eventsTable+" (notification_id, state, attempt, error, host, time) VALUES (?, ?, ?, ?, ?, ?)"),
+		event.NotificationID, string(event.State), event.Attempt, event.Error, event.Host, event.Time.UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert notification event: %v", err)
+	}
+	return nil
+}
+
+func (s *SQLStore) inTx(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package status
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// State is a step in the lifecycle of a notification
+type State string
+
+const (
+	// StateAccepted notifications passed the validation of the api
+	StateAccepted State = "accepted"
+	// StateScheduled notifications wait in the scheduler of the api for their send_at
+	StateScheduled State = "scheduled"
+	// StateQueued notifications were published to the broker, or spooled by the api
+	StateQueued State = "queued"
+	// StateSending notifications are handed to the channel sender
+	StateSending State = "sending"
+	// StateRetrying notifications failed an attempt and are retried after the backoff
+	StateRetrying State = "retrying"
+	// StateDelivered notifications were accepted by the channel provider
+	StateDelivered State = "delivered"
+	// StateFailed notifications failed with an error retrying cannot fix, the api could not publish
+	// them or the service dead-lettered them right away
+	StateFailed State = "failed"
+	// StateDeadLettered notifications exhausted the retry policy
+	StateDeadLettered State = "dead_lettered"
+	// StateCanceled notifications were scheduled and canceled before their send_at
+	StateCanceled State = "canceled"
+	// StateExpired notifications reached their expires_at before they were delivered and are never sent
+	StateExpired State = "expired"
+)
+
+var ErrNotFound = errors.New("notification not found")
+
+// Event is a state change of a notification
+type Event struct {
+	// Seq orders the events of all notifications, it is assigned by the store
+	Seq            int64  `json:"seq"`
+	NotificationID string `json:"notification_id"`
+	State          State  `json:"state"`
+	// Attempt is the delivery attempt of the event starting at 1, 0 for events of the api
+	Attempt int    `json:"attempt,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Host is the name of the host which recorded the event
+	Host string    `json:"host,omitempty"`
+	Time time.Time `json:"time"`
+}
+
+// Notification is a tracked notification with its current state
+type Notification struct {
+	ID       string `json:"id"`
+	Channel  string `json:"channel"`
+	Receiver string `json:"receiver"`
+	Priority string `json:"priority"`
+	// ReceiverHash is the hash of the receiver by Receivers.Hash, it matches the receiver when it is masked
+	ReceiverHash string   `json:"receiver_hash,omitempty"`
+	Tenant       string   `json:"tenant,omitempty"`
+	Tags         []string `json:"tags,omitempty"`
+	// Batch is the id of the batch the notification was sent with
+	Batch string `json:"batch_id,omitempty"`
+	State State  `json:"state"`
+	// Attempts is the number of delivery attempts so far
+	Attempts  int       `json:"attempts"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// History is filled by Get, ordered from the oldest event
+	History []Event `json:"history,omitempty"`
+}
+
+// Store keeps the notifications and the history of their states
+type Store interface {
+	// Create stores the notification in its state together with an event of that state
+	Create(ctx context.Context, notification Notification, event Event) error
+	// Record appends the event to the history of its notification and moves the notification to the state
+	// of the event. Notifications which were not created, e.g. published by the outbox relay, are created
+	// from the event, their channel and receiver stay empty.
+	Record(ctx context.Context, event Event) error
+	// Get returns the notification with its history or ErrNotFound
+	Get(ctx context.Context, id string) (Notification, error)
+	// Search returns a page of the notifications matching the query, or ErrInvalidCursor
+	Search(ctx context.Context, query Query) (Page, error)
+	// Events returns the events matching the query after its seq, ordered by seq
+	Events(ctx context.Context, query EventQuery) ([]Event, error)
+	// LastSeq returns the seq of the latest event, 0 when there are none
+	LastSeq(ctx context.Context) (int64, error)
+	// Batch returns the progress of the notifications of a batch or ErrBatchNotFound
+	Batch(ctx context.Context, id string) (BatchProgress, error)
+	Close() error
+}
+
+// nextState is the state of a notification after the event, a queued event recorded by the api after
+// the service already picked up the notification does not move it back
+func nextState(current State, event Event) State {
+	if event.State == StateQueued && current != StateAccepted && current != StateScheduled {
+		return current
+	}
+	return event.State
+}
+
+// MemoryStore is a Store kept in the process, it is meant for development and tests
+type MemoryStore struct {
+	mu            sync.Mutex
+	notifications map[string]*Notification
+	events        []Event
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{notifications: make(map[string]*Notification)}
+}
+
+func (s *MemoryStore) Create(ctx context.Context, notification Notification, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	notification.History = nil
+	s.notifications[notification.ID] = &notification
+	s.append(event)
+	return nil
+}
+
+func (s *MemoryStore) Record(ctx context.Context, event Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[event.NotificationID]
+	if !ok {
+		n = &Notification{ID: event.NotificationID, State: event.State, CreatedAt: event.Time}
+		s.notifications[event.NotificationID] = n
+	}
+
+	n.State = nextState(n.State, event)
+	if event.Attempt > n.Attempts {
+		n.Attempts = event.Attempt
+	}
+	n.UpdatedAt = event.Time
+	s.append(event)
+	return nil
+}
+
+func (s *MemoryStore) Get(ctx context.Context, id string) (Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.notifications[id]
+	if !ok {
+		return Notification{}, ErrNotFound
+	}
+
+	notification := *n
+	for _, e := range s.events {
+		if e.NotificationID == id {
+			notification.History = append(notification.History, e)
+		}
+	}
+	return notification, nil
+}
+
+func (s *MemoryStore) Search(ctx context.Context, query Query) (Page, error) {
+	query = query.withDefaults()
+	after, err := decodeCursor(query.Sort, query.Cursor)
+	if err != nil {
+		return Page{}, err
+	}
+
+	s.mu.Lock()
+	var matches []Notification
+	for _, n := range s.notifications {
+		if query.matches(*n) && (after == nil || after.after(query.Sort, *n)) {
+			matches = append(matches, *n)
+		}
+	}
+	s.mu.Unlock()
+
+	sortNotifications(matches, query.Sort)
+	if len(matches) > query.Limit+1 {
+		matches = matches[:query.Limit+1]
+	}
+	return page(matches, query), nil
+}
+
+func (s *MemoryStore) Events(ctx context.Context, query EventQuery) ([]Event, error) {
+	query = query.withDefaults()
+	ids := make(map[string]bool, len(query.IDs))
+	for _, id := range query.IDs {
+		ids[id] = true
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// the seq of an event is its position in the events
+	var events []Event
+	for i := int(max(query.After, 0)); i < len(s.events) && len(events) < query.Limit; i++ {
+		e := s.events[i]
+		if len(ids) > 0 && !ids[e.NotificationID] {
+			continue
+		}
+		if n := s.notifications[e.NotificationID]; (query.Tenant != "" && n.Tenant != query.Tenant) || (query.Batch != "" && n.Batch != query.Batch) {
+			continue
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (s *MemoryStore) LastSeq(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return int64(len(s.events)), nil
+}
+
+func (s *MemoryStore) Batch(ctx context.Context, id string) (BatchProgress, error) {
+	if id == "" {
+		return BatchProgress{}, ErrBatchNotFound
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	states := make(map[State]int)
+	for _, n := range s.notifications {
+		if n.Batch == id {
+			states[n.State]++
+		}
+	}
+	return newBatchProgress(id, states)
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+func (s *MemoryStore) append(event Event) {
+	event.Seq = int64(len(s.events)) + 1
+	s.events = append(s.events, event)
+}
@@ -0,0 +1,300 @@
+package status_test
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"time"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/sqldialect"
+	"github.com/AlexTsIvanov/notification-system/pkg/status"
+	_ "github.com/mattn/go-sqlite3"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Store", func() {
+	for _, backend := range []struct {
+		name string
+		open func() status.Store
+	}{
+		{name: "memory", open: func() status.Store { return status.NewMemoryStore() }},
+		{name: "sqlite", open: func() status.Store {
+			db, err := sql.Open("sqlite3", "file:"+filepath.Join(GinkgoT().TempDir(), "status.db")+"?_busy_timeout=5000&_txlock=immediate")
+			Expect(err).NotTo(HaveOccurred())
+			store := status.NewSQLStore(db, sqldialect.SQLite)
+			Expect(store.Migrate(context.Background())).To(Succeed())
+			// migrating twice is a no-op
+			Expect(store.Migrate(context.Background())).To(Succeed())
+			return store
+		}},
+	} {
+		backend := backend
+
+		Context("with the "+backend.name+" store", func() {
+			var (
+				store status.Store
+				ctx   context.Context
+				start time.Time
+			)
+
+			at := func(seconds int) time.Time {
+				return start.Add(time.Duration(seconds) * time.Second)
+			}
+
+			BeforeEach(func() {
+				store = backend.open()
+				ctx = context.Background()
+				start = time.UnixMilli(time.Now().UnixMilli())
+			})
+
+			AfterEach(func() {
+				store.Close()
+			})
+
+			It("tracks the state and history of a notification", func() {
+				Expect(store.Create(ctx,
+					status.Notification{ID: "n1", Channel: "sms", Receiver: "+359", Priority: "high", State: status.StateAccepted, CreatedAt: at(0), UpdatedAt: at(0)},
+					status.Event{NotificationID: "n1", State: status.StateAccepted, Host: "api-1", Time: at(0)},
+				)).To(Succeed())
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateSending, Attempt: 1, Host: "svc-1", Time: at(1)})).To(Succeed())
+				// the api records queued after the service picked the notification up
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateQueued, Host: "api-1", Time: at(1)})).To(Succeed())
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateRetrying, Attempt: 1, Error: "timeout", Host: "svc-1", Time: at(2)})).To(Succeed())
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateSending, Attempt: 2, Host: "svc-1", Time: at(3)})).To(Succeed())
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateDelivered, Attempt: 2, Host: "svc-1", Time: at(4)})).To(Succeed())
+
+				n, err := store.Get(ctx, "n1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n.Channel).To(Equal("sms"))
+				Expect(n.Receiver).To(Equal("+359"))
+				Expect(n.Priority).To(Equal("high"))
+				Expect(n.State).To(Equal(status.StateDelivered))
+				Expect(n.Attempts).To(Equal(2))
+				Expect(n.CreatedAt).To(BeTemporally("==", at(0)))
+				Expect(n.UpdatedAt).To(BeTemporally("==", at(4)))
+
+				var states []status.State
+				for i, e := range n.History {
+					states = append(states, e.State)
+					if i > 0 {
+						Expect(e.Seq).To(BeNumerically(">", n.History[i-1].Seq))
+					}
+				}
+				Expect(states).To(Equal([]status.State{
+					status.StateAccepted, status.StateSending, status.StateQueued, status.StateRetrying, status.StateSending, status.StateDelivered,
+				}))
+				Expect(n.History[3].Error).To(Equal("timeout"))
+				Expect(n.History[3].Host).To(Equal("svc-1"))
+				Expect(n.History[3].Time).To(BeTemporally("==", at(2)))
+			})
+
+			It("moves accepted notifications to queued", func() {
+				Expect(store.Create(ctx,
+					status.Notification{ID: "n1", Channel: "sms", State: status.StateAccepted, CreatedAt: at(0), UpdatedAt: at(0)},
+					status.Event{NotificationID: "n1", State: status.StateAccepted, Time: at(0)},
+				)).To(Succeed())
+				Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateQueued, Time: at(1)})).To(Succeed())
+
+				n, err := store.Get(ctx, "n1")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n.State).To(Equal(status.StateQueued))
+			})
+
+			It("creates notifications first seen by the service", func() {
+				Expect(store.Record(ctx, status.Event{NotificationID: "n2", State: status.StateSending, Attempt: 1, Time: at(0)})).To(Succeed())
+
+				n, err := store.Get(ctx, "n2")
+				Expect(err).NotTo(HaveOccurred())
+				Expect(n.State).To(Equal(status.StateSending))
+				Expect(n.Attempts).To(Equal(1))
+				Expect(n.History).To(HaveLen(1))
+			})
+
+			It("returns ErrNotFound for unknown notifications", func() {
+				_, err := store.Get(ctx, "unknown")
+				Expect(err).To(MatchError(status.ErrNotFound))
+			})
+
+			Context("searching notifications", func() {
+				ids := func(page status.Page) []string {
+					var ids []string
+					for _, n := range page.Items {
+						ids = append(ids, n.ID)
+					}
+					return ids
+				}
+
+				search := func(query status.Query) []string {
+					page, err := store.Search(ctx, query)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(page.NextCursor).To(BeEmpty())
+					return ids(page)
+				}
+
+				BeforeEach(func() {
+					for _, n := range []status.Notification{
+						{ID: "n1", Channel: "sms", ReceiverHash: "h1", Tenant: "acme", Tags: []string{"otp"}, CreatedAt: at(0)},
+						{ID: "n2", Channel: "email", ReceiverHash: "h2", Tenant: "acme", Tags: []string{"marketing"}, CreatedAt: at(1)},
+						{ID: "n3", Channel: "sms", ReceiverHash: "h1", Tenant: "globex", Tags: []string{"otp", "login"}, CreatedAt: at(2)},
+						{ID: "n4", Channel: "sms", ReceiverHash: "h1", Tenant: "acme", Tags: []string{"otp", "login", "otp"}, Batch: "b1", CreatedAt: at(3)},
+						{ID: "n5", Channel: "sms", ReceiverHash: "h1", Tenant: "acme", Batch: "b1", CreatedAt: at(3)},
+					} {
+						n.State = status.StateAccepted
+						n.UpdatedAt = n.CreatedAt
+						Expect(store.Create(ctx, n, status.Event{NotificationID: n.ID, State: status.StateAccepted, Time: n.CreatedAt})).To(Succeed())
+					}
+					Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateDelivered, Attempt: 1, Time: at(10)})).To(Succeed())
+					Expect(store.Record(ctx, status.Event{NotificationID: "n3", State: status.StateFailed, Attempt: 1, Time: at(5)})).To(Succeed())
+				})
+
+				It("filters by receiver and channel, newest first", func() {
+					Expect(search(status.Query{ReceiverHash: "h1", Channel: "sms"})).To(Equal([]string{"n5", "n4", "n3", "n1"}))
+				})
+
+				It("filters by tenant, tags, states and time range", func() {
+					Expect(search(status.Query{Tenant: "acme", Tags: []string{"otp", "login"}})).To(Equal([]string{"n4"}))
+					Expect(search(status.Query{States: []status.State{status.StateDelivered, status.StateFailed}})).To(Equal([]string{"n3", "n1"}))
+					Expect(search(status.Query{From: at(1), To: at(3)})).To(Equal([]string{"n3", "n2"}))
+					Expect(search(status.Query{Batch: "b1"})).To(Equal([]string{"n5", "n4"}))
+				})
+
+				It("sums up the progress of a batch", func() {
+					Expect(store.Record(ctx, status.Event{NotificationID: "n4", State: status.StateDelivered, Attempt: 1, Time: at(6)})).To(Succeed())
+
+					progress, err := store.Batch(ctx, "b1")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(progress).To(Equal(status.BatchProgress{
+						ID:        "b1",
+						Total:     2,
+						States:    map[status.State]int{status.StateAccepted: 1, status.StateDelivered: 1},
+						Completed: 1,
+					}))
+
+					Expect(store.Record(ctx, status.Event{NotificationID: "n5", State: status.StateDeadLettered, Attempt: 3, Time: at(7)})).To(Succeed())
+					progress, err = store.Batch(ctx, "b1")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(progress.Done).To(BeTrue())
+
+					_, err = store.Batch(ctx, "b2")
+					Expect(err).To(MatchError(status.ErrBatchNotFound))
+					_, err = store.Batch(ctx, "")
+					Expect(err).To(MatchError(status.ErrBatchNotFound))
+				})
+
+				It("returns the tags and the batch of the notifications", func() {
+					page, err := store.Search(ctx, status.Query{Tenant: "globex"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(page.Items[0].Tags).To(Equal([]string{"otp", "login"}))
+					Expect(page.Items[0].State).To(Equal(status.StateFailed))
+
+					n, err := store.Get(ctx, "n5")
+					Expect(err).NotTo(HaveOccurred())
+					Expect(n.Batch).To(Equal("b1"))
+				})
+
+				It("sorts by the update time", func() {
+					Expect(search(status.Query{Sort: status.SortUpdatedDesc})).To(Equal([]string{"n1", "n3", "n5", "n4", "n2"}))
+				})
+
+				It("returns an empty page when nothing matches", func() {
+					page, err := store.Search(ctx, status.Query{Tenant: "initech"})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(page.Items).To(BeEmpty())
+					Expect(page.Items).NotTo(BeNil())
+				})
+
+				for _, sort := range []status.Sort{status.SortCreatedAsc, status.SortCreatedDesc} {
+					sort := sort
+
+					It("pages through the results with cursors sorted by "+string(sort), func() {
+						var (
+							pages  [][]string
+							cursor string
+						)
+						for {
+							page, err := store.Search(ctx, status.Query{Sort: sort, Limit: 2, Cursor: cursor})
+							Expect(err).NotTo(HaveOccurred())
+							pages = append(pages, ids(page))
+							if page.NextCursor == "" {
+								break
+							}
+							cursor = page.NextCursor
+						}
+
+						if sort == status.SortCreatedAsc {
+							Expect(pages).To(Equal([][]string{{"n1", "n2"}, {"n3", "n4"}, {"n5"}}))
+						} else {
+							Expect(pages).To(Equal([][]string{{"n5", "n4"}, {"n3", "n2"}, {"n1"}}))
+						}
+					})
+				}
+
+				It("rejects invalid cursors", func() {
+					page, err := store.Search(ctx, status.Query{Limit: 1})
+					Expect(err).NotTo(HaveOccurred())
+
+					_, err = store.Search(ctx, status.Query{Sort: status.SortUpdatedAsc, Cursor: page.NextCursor})
+					Expect(err).To(MatchError(status.ErrInvalidCursor))
+					_, err = store.Search(ctx, status.Query{Cursor: "not a cursor"})
+					Expect(err).To(MatchError(status.ErrInvalidCursor))
+				})
+			})
+
+			Context("reading events", func() {
+				seqs := func(query status.EventQuery) []int64 {
+					events, err := store.Events(ctx, query)
+					Expect(err).NotTo(HaveOccurred())
+					var seqs []int64
+					for _, e := range events {
+						seqs = append(seqs, e.Seq)
+					}
+					return seqs
+				}
+
+				BeforeEach(func() {
+					last, err := store.LastSeq(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(last).To(BeZero())
+
+					for _, n := range []status.Notification{
+						{ID: "n1", Channel: "sms", Tenant: "acme", CreatedAt: at(0)},
+						{ID: "n2", Channel: "email", Tenant: "globex", Batch: "b1", CreatedAt: at(0)},
+					} {
+						n.State = status.StateAccepted
+						n.UpdatedAt = n.CreatedAt
+						Expect(store.Create(ctx, n, status.Event{NotificationID: n.ID, State: status.StateAccepted, Time: n.CreatedAt})).To(Succeed())
+					}
+					Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateSending, Attempt: 1, Time: at(-3)})).To(Succeed())
+					Expect(store.Record(ctx, status.Event{NotificationID: "n2", State: status.StateSending, Attempt: 1, Time: at(-2)})).To(Succeed())
+					Expect(store.Record(ctx, status.Event{NotificationID: "n1", State: status.StateDelivered, Attempt: 1, Time: at(-1)})).To(Succeed())
+				})
+
+				It("returns the events after the seq in order", func() {
+					Expect(seqs(status.EventQuery{})).To(Equal([]int64{1, 2, 3, 4, 5}))
+					Expect(seqs(status.EventQuery{After: 3})).To(Equal([]int64{4, 5}))
+					Expect(seqs(status.EventQuery{After: 1, Limit: 2})).To(Equal([]int64{2, 3}))
+					Expect(seqs(status.EventQuery{After: 5})).To(BeEmpty())
+
+					last, err := store.LastSeq(ctx)
+					Expect(err).NotTo(HaveOccurred())
+					Expect(last).To(Equal(int64(5)))
+				})
+
+				It("filters by notifications and tenant", func() {
+					Expect(seqs(status.EventQuery{IDs: []string{"n2"}})).To(Equal([]int64{2, 4}))
+					Expect(seqs(status.EventQuery{IDs: []string{"n1", "n2"}, After: 2})).To(Equal([]int64{3, 4, 5}))
+					Expect(seqs(status.EventQuery{Tenant: "acme"})).To(Equal([]int64{1, 3, 5}))
+					Expect(seqs(status.EventQuery{Tenant: "acme", IDs: []string{"n2"}})).To(BeEmpty())
+					Expect(seqs(status.EventQuery{Batch: "b1"})).To(Equal([]int64{2, 4}))
+				})
+
+				It("returns the fields of the events", func() {
+					events, err := store.Events(ctx, status.EventQuery{After: 4})
+					Expect(err).NotTo(HaveOccurred())
+					Expect(events).To(Equal([]status.Event{{Seq: 5, NotificationID: "n1", State: status.StateDelivered, Attempt: 1, Time: at(-1)}}))
+				})
+			})
+		})
+	}
+})
@@ -0,0 +1,23 @@
+package status
+
+const defaultEventLimit = 100
+
+// EventQuery selects the events of a status stream, empty fields match all events
+type EventQuery struct {
+	// IDs matches the events of any of the notifications
+	IDs []string
+	// Tenant matches the events of the notifications of the tenant
+	Tenant string
+	// Batch matches the events of the notifications of the batch
+	Batch string
+	// After is the Seq of the last event the stream already has
+	After int64
+	Limit int
+}
+
+func (q EventQuery) withDefaults() EventQuery {
+	if q.Limit <= 0 {
+		q.Limit = defaultEventLimit
+	}
+	return q
+}
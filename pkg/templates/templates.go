@@ -0,0 +1,84 @@
+package templates
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Extension is the file extension of the templates in the template directory
+const Extension = ".tmpl"
+
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// Templates renders the content of notifications from named text/template templates,
+// the variables are referenced as {{.name}}
+type Templates struct {
+	templates map[string]*template.Template
+}
+
+// Load parses the templates of the directory, every <name>.tmpl file is the template <name>
+func Load(dir string) (*Templates, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+Extension))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list templates: %v", err)
+	}
+
+	t := &Templates{templates: make(map[string]*template.Template, len(files))}
+	for _, file := range files {
+		text, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read template %s: %v", file, err)
+		}
+		if err := t.Add(strings.TrimSuffix(filepath.Base(file), Extension), string(text)); err != nil {
+			return nil, err
+		}
+	}
+	return t, nil
+}
+
+// Add parses the text as the template of the name, it replaces a template of the same name
+func (t *Templates) Add(name, text string) error {
+	parsed, err := template.New(name).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return fmt.Errorf("failed to parse template %s: %v", name, err)
+	}
+	if t.templates == nil {
+		t.templates = make(map[string]*template.Template)
+	}
+	t.templates[name] = parsed
+	return nil
+}
+
+func (t *Templates) Has(name string) bool {
+	_, ok := t.templates[name]
+	return ok
+}
+
+// Names returns the names of the templates in order
+func (t *Templates) Names() []string {
+	names := make([]string, 0, len(t.templates))
+	for name := range t.templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Render executes the template with the variables, referencing a missing variable fails
+func (t *Templates) Render(name string, vars map[string]string) (string, error) {
+	parsed, ok := t.templates[name]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	var content strings.Builder
+	if err := parsed.Execute(&content, vars); err != nil {
+		return "", fmt.Errorf("failed to render template %s: %v", name, err)
+	}
+	return content.String(), nil
+}
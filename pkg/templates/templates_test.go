@@ -0,0 +1,50 @@
+package templates_test
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/AlexTsIvanov/notification-system/pkg/templates"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Templates", func() {
+	var t *templates.Templates
+
+	BeforeEach(func() {
+		dir := GinkgoT().TempDir()
+		Expect(os.WriteFile(filepath.Join(dir, "welcome.tmpl"), []byte("Hi {{.name}}, your code is {{.code}}"), 0o644)).To(Succeed())
+		Expect(os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a template"), 0o644)).To(Succeed())
+
+		var err error
+		t, err = templates.Load(dir)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("loads the templates of the directory by name", func() {
+		Expect(t.Has("welcome")).To(BeTrue())
+		Expect(t.Has("notes")).To(BeFalse())
+		Expect(t.Names()).To(Equal([]string{"welcome"}))
+	})
+
+	It("renders a template with the variables", func() {
+		content, err := t.Render("welcome", map[string]string{"name": "Ana", "code": "1234"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(content).To(Equal("Hi Ana, your code is 1234"))
+	})
+
+	It("fails on a missing variable", func() {
+		_, err := t.Render("welcome", map[string]string{"name": "Ana"})
+		Expect(err).To(MatchError(ContainSubstring(`map has no entry for key "code"`)))
+	})
+
+	It("fails on an unknown template", func() {
+		_, err := t.Render("reminder", nil)
+		Expect(err).To(MatchError(templates.ErrUnknownTemplate))
+	})
+
+	It("rejects a template which does not parse", func() {
+		Expect(t.Add("broken", "Hi {{.name")).To(MatchError(ContainSubstring("failed to parse template broken")))
+	})
+})
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// DeadLetter is a message of a DLQ together with the details of its failure
+type DeadLetter struct {
+	// ID is the message id of the notification or, for messages without one, a fingerprint of the message
+	ID           string                 `json:"id"`
+	Channel      string                 `json:"channel"`
+	Payload      json.RawMessage        `json:"payload"`
+	LastError    string                 `json:"last_error"`
+	ErrorClass   ErrorClass             `json:"error_class"`
+	Attempts     int                    `json:"attempts"`
+	FirstSeen    *time.Time             `json:"first_seen,omitempty"`
+	LastAttempt  *time.Time             `json:"last_attempt,omitempty"`
+	ConsumerHost string                 `json:"consumer_host"`
+	Headers      map[string]interface{} `json:"headers"`
+}
+
+// DeadLetterFilter selects the dead letters to requeue
+type DeadLetterFilter struct {
+	IDs        []string   `json:"ids,omitempty"`
+	ErrorClass ErrorClass `json:"error_class,omitempty"`
+	// All has to be set explicitly to select every dead letter
+	All bool `json:"all,omitempty"`
+}
+
+// Empty reports whether the filter selects nothing
+func (f DeadLetterFilter) Empty() bool {
+	return !f.All && len(f.IDs) == 0 && f.ErrorClass == ""
+}
+
+// Matches reports whether the dead letter is selected by all the criteria of the filter
+func (f DeadLetterFilter) Matches(d DeadLetter) bool {
+	if f.Empty() {
+		return false
+	}
+	if f.ErrorClass != "" && f.ErrorClass != d.ErrorClass {
+		return false
+	}
+	if len(f.IDs) == 0 {
+		return true
+	}
+	for _, id := range f.IDs {
+		if id == d.ID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package types
+
+import "errors"
+
+// ErrUnsupportedChannel is returned for a notification channel without a queue or sender
+var ErrUnsupportedChannel = errors.New("unsupported notification channel")
+
+// ErrPeekLimit is returned for a page of dead letters a broker cannot list without consuming the DLQ
+var ErrPeekLimit = errors.New("page beyond the dead letters that can be listed")
+
+// ErrorClass tells why handling a notification failed
+type ErrorClass string
+
+const (
+	// ErrorClassInvalidPayload is a message which cannot be decoded, retrying it never helps
+	ErrorClassInvalidPayload ErrorClass = "invalid_payload"
+	// ErrorClassUnsupportedChannel is a message for a channel without a sender
+	ErrorClassUnsupportedChannel ErrorClass = "unsupported_channel"
+	// ErrorClassRejected is a message the receiver refused, e.g. a callback answered with 4xx, retrying it never helps
+	ErrorClassRejected ErrorClass = "rejected"
+	// ErrorClassSendFailed is a failure of the channel provider which may succeed on retry
+	ErrorClassSendFailed ErrorClass = "send_failed"
+	// ErrorClassUnknown is any error which was not classified
+	ErrorClassUnknown ErrorClass = "unknown"
+)
+
+// Permanent reports whether a message failing with this class has to be dead-lettered without retrying
+func (c ErrorClass) Permanent() bool {
+	return c == ErrorClassInvalidPayload || c == ErrorClassUnsupportedChannel || c == ErrorClassRejected
+}
+
+// DeliveryError is an error that occurred while handling a notification together with its class
+type DeliveryError struct {
+	Class ErrorClass
+	Err   error
+}
+
+func NewDeliveryError(class ErrorClass, err error) *DeliveryError {
+	return &DeliveryError{Class: class, Err: err}
+}
+
+func (e *DeliveryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Outcome is what a broker did with an event which failed
+type Outcome string
+
+const (
+	// OutcomeRetrying is an event which is delivered again, after the backoff of the retry policy or right
+	// away when the broker could not apply the policy
+	OutcomeRetrying Outcome = "retrying"
+	// OutcomeDeadLettered is an event which exhausted the retry policy and was dead-lettered
+	OutcomeDeadLettered Outcome = "dead_lettered"
+	// OutcomeFailed is an event which failed with a permanent error and was dead-lettered without retrying
+	OutcomeFailed Outcome = "failed"
+)
+
+// DeadLetterOutcome returns the outcome of dead-lettering an event which failed with the cause
+func DeadLetterOutcome(cause error) Outcome {
+	if ClassOf(cause).Permanent() {
+		return OutcomeFailed
+	}
+	return OutcomeDeadLettered
+}
+
+// ClassOf returns the class of the first DeliveryError in the chain of err
+func ClassOf(err error) ErrorClass {
+	var deliveryErr *DeliveryError
+	if errors.As(err, &deliveryErr) {
+		return deliveryErr.Class
+	}
+	return ErrorClassUnknown
+}
@@ -1,7 +1,100 @@
 package types
 
-type EventContext struct{
-	EventId string
-	Payload   []byte
+import (
+	"crypto/rand"
+	"fmt"
+	"time"
+)
+
+// Priority of a message, messages with higher priority are consumed first
+type Priority uint8
+
+const (
+	PriorityLow    Priority = 1
+	PriorityNormal Priority = 5
+	PriorityHigh   Priority = 9
+
+	// MaxPriority is the highest priority a queue has to support
+	MaxPriority = PriorityHigh
+)
+
+// ParsePriority maps the priority names accepted by the api to their numeric value,
+// an empty name results in normal priority
+func ParsePriority(name string) (Priority, error) {
+	switch name {
+	case "low":
+		return PriorityLow, nil
+	case "", "normal":
+		return PriorityNormal, nil
+	case "high":
+		return PriorityHigh, nil
+	default:
+		return 0, fmt.Errorf("unknown priority: %s", name)
+	}
+}
+
+// String returns the name of the priority accepted by ParsePriority, or its value for other priorities
+func (p Priority) String() string {
+	switch p {
+	case PriorityLow:
+		return "low"
+	case PriorityNormal:
+		return "normal"
+	case PriorityHigh:
+		return "high"
+	default:
+		return fmt.Sprintf("%d", uint8(p))
+	}
+}
+
+type EventContext struct {
+	EventId    string
+	MessageId  string
+	Queue      string
+	Payload    []byte
 	RetryCount int
-}
\ No newline at end of file
+	Priority   Priority
+	// FirstSeen is the time the message was first published
+	FirstSeen time.Time
+	// ExpiresAt is the time after which the message must not be sent anymore, zero if it never expires
+	ExpiresAt time.Time
+	// Acknowledger is the broker specific handle the event is acknowledged on, e.g. the AMQP channel
+	// it was delivered on, nil for brokers which do not need one
+	Acknowledger interface{}
+}
+
+// Expired reports whether the message of the event expired at now
+func (e EventContext) Expired(now time.Time) bool {
+	return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+}
+
+// Message is a notification payload addressed to a single sending channel
+type Message struct {
+	// ID identifies the notification across retries and redeliveries, it is set once by the api
+	ID       string
+	Channel  string
+	Priority Priority
+	Payload  []byte
+	// ExpiresAt is the time after which the notification must not be sent anymore, zero if it never expires
+	ExpiresAt time.Time
+}
+
+// RetryDelay shortens the backoff of a retry so a message expiring earlier comes back when it expires,
+// the consumer then drops it instead of waiting out the whole backoff
+func RetryDelay(backoff time.Duration, expiresAt, now time.Time) time.Duration {
+	if expiresAt.IsZero() {
+		return backoff
+	}
+	return max(min(backoff, expiresAt.Sub(now)), 0)
+}
+
+// NewMessageID returns a random version 4 UUID
+func NewMessageID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("failed to read random bytes: %v", err))
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}